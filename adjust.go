@@ -5,11 +5,16 @@ import (
 	"image/color"
 	"math"
 
+	"github.com/kovidgoyal/imaging/colorconv"
 	"github.com/kovidgoyal/imaging/nrgba"
+	"github.com/kovidgoyal/imaging/rgbaf"
 )
 
 // Grayscale produces a grayscale version of the image.
 func Grayscale(img image.Image) *image.NRGBA {
+	if f, ok := img.(*RGBAF); ok {
+		return AsNRGBA(GrayscaleFloat(f))
+	}
 	w, h := img.Bounds().Dx(), img.Bounds().Dy()
 	src := nrgba.NewNRGBAScanner(img)
 	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
@@ -38,6 +43,9 @@ func Grayscale(img image.Image) *image.NRGBA {
 
 // Invert produces an inverted (negated) version of the image.
 func Invert(img image.Image) *image.NRGBA {
+	if f, ok := img.(*RGBAF); ok {
+		return AsNRGBA(InvertFloat(f))
+	}
 	w, h := img.Bounds().Dx(), img.Bounds().Dy()
 	src := nrgba.NewNRGBAScanner(img)
 	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
@@ -73,6 +81,9 @@ func AdjustSaturation(img image.Image, percentage float64) *image.NRGBA {
 	if percentage == 0 {
 		return Clone(img)
 	}
+	if f, ok := img.(*RGBAF); ok {
+		return AsNRGBA(AdjustSaturationFloat(f, percentage))
+	}
 
 	percentage = math.Min(math.Max(percentage, -100), 100)
 	multiplier := 1 + percentage/100
@@ -100,6 +111,9 @@ func AdjustHue(img image.Image, shift float64) *image.NRGBA {
 	if math.Mod(shift, 360) == 0 {
 		return Clone(img)
 	}
+	if f, ok := img.(*RGBAF); ok {
+		return AsNRGBA(AdjustHueFloat(f, shift))
+	}
 
 	summand := shift / 360
 
@@ -116,6 +130,53 @@ func AdjustHue(img image.Image, shift float64) *image.NRGBA {
 	})
 }
 
+// oklch_adjuster returns a function that modifies the OKLCH chroma and hue of
+// a color, reducing chroma to bring the result back into the sRGB gamut
+func oklch_adjuster(multiplier, shift float64) func(r, g, b float64) (float64, float64, float64) {
+	return func(r, g, b float64) (float64, float64, float64) {
+		L, C, h := colorconv.SrgbToOKLCH(r, g, b)
+		return colorconv.OKLCHToSrgbReduceChroma(L, C*multiplier, h+shift)
+	}
+}
+
+func adjust_oklch(img image.Image, multiplier, shift float64) *image.NRGBA {
+	f := oklch_adjuster(multiplier, shift)
+	return AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+		r, g, b := f(float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+		return color.NRGBA{clamp(r * 255), clamp(g * 255), clamp(b * 255), c.A}
+	})
+}
+
+// AdjustSaturationOKLCH is like AdjustSaturation except that it scales the
+// chroma of the colors in the perceptually uniform OKLCH color space rather
+// than the saturation in HSL, so that the lightness and hue of the colors do
+// not change. Colors that end up outside the sRGB gamut have their chroma
+// reduced to bring them back into it.
+func AdjustSaturationOKLCH(img image.Image, percentage float64) *image.NRGBA {
+	if percentage == 0 {
+		return Clone(img)
+	}
+	if f, ok := img.(*RGBAF); ok {
+		return AsNRGBA(AdjustSaturationOKLCHFloat(f, percentage))
+	}
+	percentage = math.Min(math.Max(percentage, -100), 100)
+	return adjust_oklch(img, 1+percentage/100, 0)
+}
+
+// AdjustHueOKLCH is like AdjustHue except that it rotates the hue of the
+// colors in the perceptually uniform OKLCH color space rather than in HSL, so
+// that the lightness of the colors does not change. Colors that end up
+// outside the sRGB gamut have their chroma reduced to bring them back into it.
+func AdjustHueOKLCH(img image.Image, shift float64) *image.NRGBA {
+	if math.Mod(shift, 360) == 0 {
+		return Clone(img)
+	}
+	if f, ok := img.(*RGBAF); ok {
+		return AsNRGBA(AdjustHueOKLCHFloat(f, shift))
+	}
+	return adjust_oklch(img, 1, shift)
+}
+
 // AdjustContrast changes the contrast of the image using the percentage parameter and returns the adjusted image.
 // The percentage must be in range (-100, 100). The percentage = 0 gives the original image.
 // The percentage = -100 gives solid gray image.
@@ -128,6 +189,9 @@ func AdjustContrast(img image.Image, percentage float64) *image.NRGBA {
 	if percentage == 0 {
 		return Clone(img)
 	}
+	if f, ok := img.(*RGBAF); ok {
+		return AsNRGBA(AdjustContrastFloat(f, percentage))
+	}
 
 	percentage = math.Min(math.Max(percentage, -100.0), 100.0)
 	lut := make([]uint8, 256)
@@ -159,6 +223,9 @@ func AdjustBrightness(img image.Image, percentage float64) *image.NRGBA {
 	if percentage == 0 {
 		return Clone(img)
 	}
+	if f, ok := img.(*RGBAF); ok {
+		return AsNRGBA(AdjustBrightnessFloat(f, percentage))
+	}
 
 	percentage = math.Min(math.Max(percentage, -100.0), 100.0)
 	lut := make([]uint8, 256)
@@ -182,6 +249,9 @@ func AdjustGamma(img image.Image, gamma float64) *image.NRGBA {
 	if gamma == 1 {
 		return Clone(img)
 	}
+	if f, ok := img.(*RGBAF); ok {
+		return AsNRGBA(AdjustGammaFloat(f, gamma))
+	}
 
 	e := 1.0 / math.Max(gamma, 0.0001)
 	lut := make([]uint8, 256)
@@ -207,6 +277,9 @@ func AdjustSigmoid(img image.Image, midpoint, factor float64) *image.NRGBA {
 	if factor == 0 {
 		return Clone(img)
 	}
+	if f, ok := img.(*RGBAF); ok {
+		return AsNRGBA(AdjustSigmoidFloat(f, midpoint, factor))
+	}
 
 	lut := make([]uint8, 256)
 	a := math.Min(math.Max(midpoint, 0.0), 1.0)
@@ -304,3 +377,149 @@ func AdjustFunc(img image.Image, fn func(c color.NRGBA) color.NRGBA) *image.NRGB
 	}
 	return dst
 }
+
+// AdjustFuncFloat is like AdjustFunc except that it operates on
+// non-premultiplied float32 colors without loss of precision, returning an
+// RGBAF image.
+func AdjustFuncFloat(img image.Image, fn func(c RGBAFColor) RGBAFColor) *RGBAF {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	src := rgbaf.NewRGBAFScanner(img)
+	dst := rgbaf.NewRGBAF(image.Rect(0, 0, w, h))
+	if err := run_in_parallel_over_range(0, func(start, limit int) {
+		for y := start; y < limit; y++ {
+			i := y * dst.Stride
+			src.ScanFloat(0, y, w, y+1, dst.Pix[i:i+w*4])
+			for range w {
+				d := dst.Pix[i : i+4 : i+4]
+				c := fn(RGBAFColor{R: d[0], G: d[1], B: d[2], A: d[3]})
+				d[0], d[1], d[2], d[3] = c.R, c.G, c.B, c.A
+				i += 4
+			}
+		}
+	}, 0, h); err != nil {
+		panic(err)
+	}
+	return dst
+}
+
+// adjustCurveFloat applies the function f to the color channels of the image
+func adjustCurveFloat(img image.Image, f func(float64) float64) *RGBAF {
+	return AdjustFuncFloat(img, func(c RGBAFColor) RGBAFColor {
+		return RGBAFColor{R: float32(f(float64(c.R))), G: float32(f(float64(c.G))), B: float32(f(float64(c.B))), A: c.A}
+	})
+}
+
+// GrayscaleFloat is like Grayscale except that it returns an RGBAF image.
+func GrayscaleFloat(img image.Image) *RGBAF {
+	return AdjustFuncFloat(img, func(c RGBAFColor) RGBAFColor {
+		y := 0.299*c.R + 0.587*c.G + 0.114*c.B
+		return RGBAFColor{R: y, G: y, B: y, A: c.A}
+	})
+}
+
+// InvertFloat is like Invert except that it returns an RGBAF image.
+func InvertFloat(img image.Image) *RGBAF {
+	return adjustCurveFloat(img, func(x float64) float64 { return 1 - x })
+}
+
+// AdjustSaturationFloat is like AdjustSaturation except that it returns an
+// RGBAF image.
+func AdjustSaturationFloat(img image.Image, percentage float64) *RGBAF {
+	percentage = math.Min(math.Max(percentage, -100), 100)
+	multiplier := 1 + percentage/100
+
+	return AdjustFuncFloat(img, func(c RGBAFColor) RGBAFColor {
+		h, s, l := rgbToHSLf(float64(c.R), float64(c.G), float64(c.B))
+		r, g, b := hslToRGBf(h, math.Min(s*multiplier, 1), l)
+		return RGBAFColor{R: float32(r), G: float32(g), B: float32(b), A: c.A}
+	})
+}
+
+// AdjustHueFloat is like AdjustHue except that it returns an RGBAF image.
+func AdjustHueFloat(img image.Image, shift float64) *RGBAF {
+	summand := shift / 360
+
+	return AdjustFuncFloat(img, func(c RGBAFColor) RGBAFColor {
+		h, s, l := rgbToHSLf(float64(c.R), float64(c.G), float64(c.B))
+		h = math.Mod(h+summand, 1)
+		if h < 0 {
+			h++
+		}
+		r, g, b := hslToRGBf(h, s, l)
+		return RGBAFColor{R: float32(r), G: float32(g), B: float32(b), A: c.A}
+	})
+}
+
+// AdjustSaturationOKLCHFloat is like AdjustSaturationOKLCH except that it
+// returns an RGBAF image.
+func AdjustSaturationOKLCHFloat(img image.Image, percentage float64) *RGBAF {
+	percentage = math.Min(math.Max(percentage, -100), 100)
+	return adjust_oklch_float(img, 1+percentage/100, 0)
+}
+
+// AdjustHueOKLCHFloat is like AdjustHueOKLCH except that it returns an RGBAF
+// image.
+func AdjustHueOKLCHFloat(img image.Image, shift float64) *RGBAF {
+	return adjust_oklch_float(img, 1, shift)
+}
+
+func adjust_oklch_float(img image.Image, multiplier, shift float64) *RGBAF {
+	f := oklch_adjuster(multiplier, shift)
+	return AdjustFuncFloat(img, func(c RGBAFColor) RGBAFColor {
+		r, g, b := f(float64(c.R), float64(c.G), float64(c.B))
+		return RGBAFColor{R: float32(r), G: float32(g), B: float32(b), A: c.A}
+	})
+}
+
+// AdjustContrastFloat is like AdjustContrast except that it returns an RGBAF
+// image and does not clip values.
+func AdjustContrastFloat(img image.Image, percentage float64) *RGBAF {
+	percentage = math.Min(math.Max(percentage, -100.0), 100.0)
+	v := (100.0 + percentage) / 100.0
+	return adjustCurveFloat(img, func(x float64) float64 {
+		switch {
+		case 0 <= v && v <= 1:
+			return 0.5 + (x-0.5)*v
+		case 1 < v && v < 2:
+			return 0.5 + (x-0.5)*(1/(2.0-v))
+		default:
+			return math.Floor(x + 0.5)
+		}
+	})
+}
+
+// AdjustBrightnessFloat is like AdjustBrightness except that it returns an
+// RGBAF image and does not clip values.
+func AdjustBrightnessFloat(img image.Image, percentage float64) *RGBAF {
+	shift := math.Min(math.Max(percentage, -100.0), 100.0) / 100.0
+	return adjustCurveFloat(img, func(x float64) float64 { return x + shift })
+}
+
+// AdjustGammaFloat is like AdjustGamma except that it returns an RGBAF image.
+// Negative values are mirrored.
+func AdjustGammaFloat(img image.Image, gamma float64) *RGBAF {
+	e := 1.0 / math.Max(gamma, 0.0001)
+	return adjustCurveFloat(img, func(x float64) float64 { return math.Copysign(math.Pow(math.Abs(x), e), x) })
+}
+
+// AdjustSigmoidFloat is like AdjustSigmoid except that it returns an RGBAF
+// image.
+func AdjustSigmoidFloat(img image.Image, midpoint, factor float64) *RGBAF {
+	if factor == 0 {
+		return AdjustFuncFloat(img, func(c RGBAFColor) RGBAFColor { return c })
+	}
+	a := math.Min(math.Max(midpoint, 0.0), 1.0)
+	b := math.Abs(factor)
+	sig0 := sigmoid(a, b, 0)
+	sig1 := sigmoid(a, b, 1)
+	e := 1.0e-6
+	if factor > 0 {
+		return adjustCurveFloat(img, func(x float64) float64 {
+			return (sigmoid(a, b, x) - sig0) / (sig1 - sig0)
+		})
+	}
+	return adjustCurveFloat(img, func(x float64) float64 {
+		arg := math.Min(math.Max((sig1-sig0)*x+sig0, e), 1.0-e)
+		return a - math.Log(1.0/arg-1.0)/b
+	})
+}
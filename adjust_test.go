@@ -3,7 +3,12 @@ package imaging
 import (
 	"image"
 	"image/color"
+	"math"
 	"testing"
+
+	"github.com/kovidgoyal/imaging/colorconv"
+
+	"github.com/kovidgoyal/imaging/rgbaf"
 )
 
 func TestGrayscale(t *testing.T) {
@@ -1116,3 +1121,96 @@ func BenchmarkAdjustFunc(b *testing.B) {
 		})
 	}
 }
+
+func TestAdjustOKLCH(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	colors := []color.NRGBA{{200, 40, 40, 255}, {40, 160, 60, 128}, {128, 128, 128, 255}, {30, 60, 200, 0}}
+	for x, c := range colors {
+		src.SetNRGBA(x, 0, c)
+	}
+	if !compareNRGBA(AdjustHueOKLCH(src, 360), src, 0) || !compareNRGBA(AdjustSaturationOKLCH(src, 0), src, 0) {
+		t.Fatalf("a null adjustment changed the image")
+	}
+	oklch := func(c color.NRGBA) (float64, float64, float64) {
+		return colorconv.SrgbToOKLCH(float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+	}
+	for _, shift := range []float64{-90, 30, 180} {
+		dst := AdjustHueOKLCH(src, shift)
+		for x, c := range colors {
+			got := dst.NRGBAAt(x, 0)
+			if got.A != c.A {
+				t.Fatalf("alpha changed from %v to %v", c, got)
+			}
+			L, C, h := oklch(c)
+			gL, gC, gh := oklch(got)
+			if math.Abs(gL-L) > 0.01 {
+				t.Fatalf("hue shift by %v changed lightness of %v from %v to %v", shift, c, L, gL)
+			}
+			if C < 0.01 {
+				if gC > 0.01 {
+					t.Fatalf("hue shift by %v gave a neutral color chroma: %v", shift, got)
+				}
+			} else if d := math.Abs(math.Remainder(gh-h-shift, 360)); d > 2 {
+				t.Fatalf("hue shift by %v of %v gave hue %v instead of %v", shift, c, gh, h+shift)
+			}
+		}
+	}
+	dst := AdjustSaturationOKLCH(src, -100)
+	for x, c := range colors {
+		got := dst.NRGBAAt(x, 0)
+		L, _, _ := oklch(c)
+		gL, gC, _ := oklch(got)
+		if gC > 0.01 || math.Abs(gL-L) > 0.01 {
+			t.Fatalf("desaturating %v gave %v", c, got)
+		}
+	}
+	// RGBAF images are adjusted in floating point, without first being
+	// quantized to 8 bits and clipped
+	f := rgbaf.NewRGBAF(image.Rect(0, 0, 2, 1))
+	f.SetRGBAF(0, 0, RGBAFColor{R: 1.4, G: 0.2, B: 0.1, A: 1})
+	f.SetRGBAF(1, 0, RGBAFColor{R: 0.1, G: 0.40123, B: -0.2, A: 1})
+	if !compareNRGBA(AdjustHueOKLCH(f, 30), AsNRGBA(AdjustHueOKLCHFloat(f, 30)), 0) {
+		t.Fatalf("hue shift of an RGBAF image differs from the float hue shift")
+	}
+	if !compareNRGBA(AdjustSaturationOKLCH(f, -40), AsNRGBA(AdjustSaturationOKLCHFloat(f, -40)), 0) {
+		t.Fatalf("desaturation of an RGBAF image differs from the float desaturation")
+	}
+}
+
+func TestAdjustFloat(t *testing.T) {
+	for name, tc := range map[string]struct {
+		want func(image.Image) *image.NRGBA
+		got  func(image.Image) *RGBAF
+	}{
+		"Grayscale":       {Grayscale, GrayscaleFloat},
+		"Invert":          {Invert, InvertFloat},
+		"Saturation":      {func(img image.Image) *image.NRGBA { return AdjustSaturation(img, 30) }, func(img image.Image) *RGBAF { return AdjustSaturationFloat(img, 30) }},
+		"Hue":             {func(img image.Image) *image.NRGBA { return AdjustHue(img, 60) }, func(img image.Image) *RGBAF { return AdjustHueFloat(img, 60) }},
+		"SaturationOKLCH": {func(img image.Image) *image.NRGBA { return AdjustSaturationOKLCH(img, 30) }, func(img image.Image) *RGBAF { return AdjustSaturationOKLCHFloat(img, 30) }},
+		"HueOKLCH":        {func(img image.Image) *image.NRGBA { return AdjustHueOKLCH(img, 60) }, func(img image.Image) *RGBAF { return AdjustHueOKLCHFloat(img, 60) }},
+		"Contrast":        {func(img image.Image) *image.NRGBA { return AdjustContrast(img, 20) }, func(img image.Image) *RGBAF { return AdjustContrastFloat(img, 20) }},
+		"Brightness":      {func(img image.Image) *image.NRGBA { return AdjustBrightness(img, 10) }, func(img image.Image) *RGBAF { return AdjustBrightnessFloat(img, 10) }},
+		"Gamma":           {func(img image.Image) *image.NRGBA { return AdjustGamma(img, 0.7) }, func(img image.Image) *RGBAF { return AdjustGammaFloat(img, 0.7) }},
+		"Sigmoid":         {func(img image.Image) *image.NRGBA { return AdjustSigmoid(img, 0.5, -3) }, func(img image.Image) *RGBAF { return AdjustSigmoidFloat(img, 0.5, -3) }},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.got(testdataFlowersSmallPNG).ToNRGBA(); !compareNRGBA(got, tc.want(testdataFlowersSmallPNG), 1) {
+				t.Fatalf("float result differs from 8 bit result")
+			}
+			if !compareNRGBA(tc.want(AsRGBAF(testdataFlowersSmallPNG)), tc.want(testdataFlowersSmallPNG), 1) {
+				t.Fatalf("adjusting an RGBAF image differs from adjusting in 8 bits")
+			}
+		})
+	}
+	// Values are neither quantized nor clipped
+	src := rgbaf.NewRGBAF(image.Rect(0, 0, 1, 1))
+	src.SetRGBAF(0, 0, RGBAFColor{R: 0.1234567, G: 2, B: 0.5, A: 1})
+	got := AdjustBrightnessFloat(src, 10).RGBAFAt(0, 0)
+	if want := (RGBAFColor{R: 0.1234567 + 0.1, G: 2.1, B: 0.6, A: 1}); !compareFloat64(float64(got.R), float64(want.R), 1e-6) || !compareFloat64(float64(got.G), float64(want.G), 1e-6) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	// RGBAF images are not clipped before being adjusted
+	if got := AdjustBrightness(src, -50).NRGBAAt(0, 0); got.G != 255 {
+		t.Fatalf("got %v want a green of 255", got)
+	}
+}
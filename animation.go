@@ -6,7 +6,6 @@ import (
 	"image/color"
 	"image/draw"
 	"image/gif"
-	"image/png"
 	"io"
 	"io/fs"
 	"math"
@@ -35,6 +34,10 @@ type Image struct {
 	Metadata     *meta.Data  // image metadata
 	LoopCount    uint        // 0 means loop forever, 1 means loop once, ...
 	DefaultImage image.Image `json:"-"` // a "default image" for an animation that is not part of the actual animation
+	// the color space of the pixels, nil means sRGB. Set when decoding
+	// without converting colors to sRGB, see ColorSpace() and TargetProfile().
+	// It is shared by clones and must not be modified.
+	ColorSpace *ImageColorSpace `json:"-"`
 }
 
 func (self *Image) populate_from_apng(p *apng.APNG) {
@@ -325,30 +328,51 @@ func (self *Image) as_apng() (ans apng.APNG) {
 	return
 }
 
-// Encode this image into a PNG
-func (self *Image) EncodeAsPNG(w io.Writer) error {
+// Encode this image into a PNG, embedding its color space, see EmbedColorSpace()
+func (self *Image) EncodeAsPNG(w io.Writer, opts ...EncodeOption) error {
+	opts = append([]EncodeOption{EmbedColorSpace(self.ColorSpace)}, opts...)
 	if len(self.Frames) < 2 {
-		img := self.DefaultImage
-		if img == nil {
-			img = self.Frames[0].Image
-		}
-		return png.Encode(w, img)
+		return Encode(w, self.SingleFrame(), PNG, opts...)
+	}
+	cfg := defaultEncodeConfig
+	for _, option := range opts {
+		option(&cfg)
 	}
 	// Unfortunately apng.Encode() is buggy or I am getting my dispose op
 	// mapping wrong, so coalesce first
 	img := self.Clone()
 	img.Coalesce()
-	return apng.Encode(w, img.as_apng())
+	a := img.as_apng()
+	frames := make([]image.Image, len(a.Frames))
+	for i, f := range a.Frames {
+		frames[i] = f.Image
+	}
+	e, err := cfg.apng_encoder(has_gray_pixels(frames...))
+	if err != nil {
+		return err
+	}
+	return e.Encode(w, a)
+}
+
+// Encode this image in the specified format, embedding its color space, see
+// EmbedColorSpace(). Only PNG supports animation, for other formats the
+// first frame or default image is encoded.
+func (self *Image) Encode(w io.Writer, format Format, opts ...EncodeOption) error {
+	if format == PNG {
+		return self.EncodeAsPNG(w, opts...)
+	}
+	opts = append([]EncodeOption{EmbedColorSpace(self.ColorSpace)}, opts...)
+	return Encode(w, self.SingleFrame(), format, opts...)
 }
 
 // Save this image as PNG
-func (self *Image) SaveAsPNG(path string, mode fs.FileMode) error {
+func (self *Image) SaveAsPNG(path string, mode fs.FileMode, opts ...EncodeOption) error {
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	return self.EncodeAsPNG(f)
+	return self.EncodeAsPNG(f, opts...)
 }
 
 // Flip all frames horizontally
@@ -461,6 +485,22 @@ func (self *Image) Rotate270() {
 
 // Resize all frames to the specified size
 func (self *Image) Resize(width, height int, filter ResampleFilter) {
+	self.resize(width, height, filter, ResizeWithOpacity)
+}
+
+// Resize all frames to the specified size in linear light, see
+// ResizeLinearLight(). Images in other RGB color spaces are linearized with
+// the sRGB transfer function, images in gray or CMYK color spaces are resized
+// normally, as with Resize().
+func (self *Image) ResizeLinearLight(width, height int, filter ResampleFilter) {
+	if !self.ColorSpace.is_rgb() {
+		self.Resize(width, height, filter)
+		return
+	}
+	self.resize(width, height, filter, ResizeLinearLight)
+}
+
+func (self *Image) resize(width, height int, filter ResampleFilter, resize func(image.Image, int, int, ResampleFilter, bool) image.Image) {
 	old_width, old_height := self.Bounds().Dx(), self.Bounds().Dy()
 	sx := float64(width) / float64(old_width)
 	sy := float64(height) / float64(old_height)
@@ -468,17 +508,20 @@ func (self *Image) Resize(width, height int, filter ResampleFilter) {
 	scaledy := func(y int) int { return int(float64(y) * sy) }
 	for i, f := range self.Frames {
 		if i == 0 {
-			f.Image = ResizeWithOpacity(f.Image, width, height, filter, IsOpaque(f.Image))
+			f.Image = resize(f.Image, width, height, filter, IsOpaque(f.Image))
 		} else {
-			f.Image = ResizeWithOpacity(f.Image, scaledx(f.Image.Bounds().Dx()), scaledy(f.Image.Bounds().Dy()), filter, IsOpaque(f.Image))
+			f.Image = resize(f.Image, scaledx(f.Image.Bounds().Dx()), scaledy(f.Image.Bounds().Dy()), filter, IsOpaque(f.Image))
 			f.TopLeft = image.Pt(scaledx(f.TopLeft.X), scaledy(f.TopLeft.Y))
 		}
 	}
 	self.Metadata.PixelWidth, self.Metadata.PixelHeight = uint32(width), uint32(height)
 }
 
-// Paste all frames onto the specified background color (OVER alpha blend)
+// Paste all frames onto the specified background color (OVER alpha blend).
+// The sRGB background color is first converted into the color space of the
+// image, see ColorFromSRGB().
 func (img *Image) PasteOntoBackground(bg color.Color) {
+	bg = img.ColorFromSRGB(bg)
 	if img.DefaultImage != nil {
 		img.DefaultImage = PasteOntoBackground(img.DefaultImage, bg)
 	}
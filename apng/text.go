@@ -0,0 +1,88 @@
+package apng
+
+import (
+	"bytes"
+	"compress/zlib"
+)
+
+// TextChunk is a key/value pair of textual metadata written as a tEXt, zTXt
+// or iTXt chunk. Key and Value are UTF-8. An iTXt chunk is used when a
+// Language or TranslatedKey is specified or Value cannot be represented in
+// Latin-1, otherwise tEXt or zTXt is used, depending on Compressed.
+type TextChunk struct {
+	Key, Value              string
+	Language, TranslatedKey string
+	Compressed              bool
+}
+
+func as_latin1(s string) ([]byte, bool) {
+	ans := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return nil, false
+		}
+		ans = append(ans, byte(r))
+	}
+	return ans, true
+}
+
+func zlib_compress(data []byte, level CompressionLevel) ([]byte, error) {
+	var b bytes.Buffer
+	w, err := zlib.NewWriterLevel(&b, levelToZlib(level))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (e *encoder) writeTextChunk(t TextChunk) {
+	if e.err != nil {
+		return
+	}
+	key, ok := as_latin1(t.Key)
+	if !ok || len(key) < 1 || len(key) > 79 || bytes.IndexByte(key, 0) > -1 {
+		e.err = FormatError("invalid text chunk keyword: " + t.Key)
+		return
+	}
+	b := append(key, 0)
+	var value []byte
+	name := "iTXt"
+	if t.Language == "" && t.TranslatedKey == "" {
+		if value, ok = as_latin1(t.Value); ok {
+			name = "tEXt"
+			if t.Compressed {
+				name = "zTXt"
+				b = append(b, 0)
+			}
+		}
+	}
+	if name == "iTXt" {
+		value = []byte(t.Value)
+		b = append(b, 0, 0)
+		if t.Compressed {
+			b[len(b)-2] = 1
+		}
+		b = append(b, t.Language...)
+		b = append(b, 0)
+		b = append(b, t.TranslatedKey...)
+		b = append(b, 0)
+	}
+	if t.Compressed {
+		if value, e.err = zlib_compress(value, e.enc.CompressionLevel); e.err != nil {
+			return
+		}
+	}
+	e.writeChunk(append(b, value...), name)
+}
+
+func (e *encoder) writeTextChunks() {
+	for _, t := range e.enc.TextChunks {
+		e.writeTextChunk(t)
+	}
+}
@@ -29,6 +29,36 @@ type Encoder struct {
 	// CompressionWriter optionally provides a external zlib compression
 	// writer for writing PNG image data.
 	CompressionWriter func(w io.Writer) (CompressionWriter, error)
+
+	// TextChunks optionally specifies textual metadata to write into the
+	// PNG before the image data.
+	TextChunks []TextChunk
+
+	// PhysicalDimensions optionally specifies the physical pixel size to
+	// write as a pHYs chunk.
+	PhysicalDimensions *PhysicalDimensions
+
+	// ICCProfile optionally specifies the data of an ICC color profile to
+	// write as an iCCP chunk.
+	ICCProfile []byte
+
+	// CICP optionally specifies coding independent code points to write
+	// as a cICP chunk, describing the color space of the image.
+	CICP *CICP
+}
+
+// CICP holds the coding independent code points of ITU-T H.273 that
+// identify a color space.
+type CICP struct {
+	ColorPrimaries, TransferCharacteristics, MatrixCoefficients uint8
+	VideoFullRange                                              bool
+}
+
+// PhysicalDimensions is the intended pixel size or aspect ratio of the image.
+// When UnitIsMeter is false only the aspect ratio is specified.
+type PhysicalDimensions struct {
+	PixelsPerUnitX, PixelsPerUnitY uint32
+	UnitIsMeter                    bool
 }
 
 // CompressionWriter zlib compression writer interface.
@@ -188,6 +218,46 @@ func (e *encoder) writeacTL() {
 	e.writeChunk(e.tmp[:8], "acTL")
 }
 
+func (e *encoder) writepHYs() {
+	p := e.enc.PhysicalDimensions
+	if p == nil {
+		return
+	}
+	binary.BigEndian.PutUint32(e.tmp[0:4], p.PixelsPerUnitX)
+	binary.BigEndian.PutUint32(e.tmp[4:8], p.PixelsPerUnitY)
+	e.tmp[8] = 0
+	if p.UnitIsMeter {
+		e.tmp[8] = 1
+	}
+	e.writeChunk(e.tmp[:9], "pHYs")
+}
+
+func (e *encoder) writecICP() {
+	c := e.enc.CICP
+	if c == nil {
+		return
+	}
+	e.tmp[0], e.tmp[1], e.tmp[2], e.tmp[3] = c.ColorPrimaries, c.TransferCharacteristics, c.MatrixCoefficients, 0
+	if c.VideoFullRange {
+		e.tmp[3] = 1
+	}
+	e.writeChunk(e.tmp[:4], "cICP")
+}
+
+func (e *encoder) writeiCCP() {
+	if len(e.enc.ICCProfile) == 0 || e.err != nil {
+		return
+	}
+	data, err := zlib_compress(e.enc.ICCProfile, e.enc.CompressionLevel)
+	if err != nil {
+		e.err = err
+		return
+	}
+	// The profile name, followed by a null separator and the compression method
+	b := append([]byte("ICC Profile"), 0, 0)
+	e.writeChunk(append(b, data...), "iCCP")
+}
+
 func (e *encoder) writefcTL(f Frame) {
 	binary.BigEndian.PutUint32(e.tmp[0:4], uint32(e.seq))
 	e.seq = e.seq + 1
@@ -712,12 +782,16 @@ func (enc *Encoder) Encode(w io.Writer, a APNG) error {
 
 	_, e.err = io.WriteString(w, pngHeader)
 	e.writeIHDR()
+	e.writecICP()
+	e.writeiCCP()
 	if pal != nil {
 		e.writePLTEAndTRNS(pal)
 	}
 	if len(e.a.Frames) > 1 {
 		e.writeacTL()
 	}
+	e.writepHYs()
+	e.writeTextChunks()
 	if !e.a.Frames[0].IsDefault {
 		e.writefcTL(e.a.Frames[0])
 	}
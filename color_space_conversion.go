@@ -8,8 +8,11 @@ import (
 	"math"
 
 	"github.com/kovidgoyal/go-parallel"
+	"github.com/kovidgoyal/imaging/colorconv"
 	"github.com/kovidgoyal/imaging/nrgb"
+	"github.com/kovidgoyal/imaging/nrgba"
 	"github.com/kovidgoyal/imaging/prism/meta/icc"
+	"github.com/kovidgoyal/imaging/types"
 )
 
 var _ = fmt.Print
@@ -30,55 +33,105 @@ func f8i(x float64) uint8   { return uint8(x * math.MaxUint8) }
 func f16(x uint16) float64  { return float64(x) / math.MaxUint16 }
 func f16i(x float64) uint16 { return uint16(x * math.MaxUint16) }
 
+// The luma of RGB values using the same weights as color.GrayModel, for
+// neutral colors it is the common value of the channels
+func luma(r, g, b float64) float64 {
+	if r == g && g == b {
+		return r
+	}
+	return 0.299*r + 0.587*g + 0.114*b
+}
+
+// Whether the image has more than 8 bits per channel
+func has_16bit_channels(img image.Image) bool {
+	switch img.(type) {
+	case *image.NRGBA64, *image.RGBA64, *image.Gray16, *NRGB48:
+		return true
+	}
+	return false
+}
+
 func convert(tr *icc.Pipeline, image_any image.Image) (ans image.Image, err error) {
-	t := tr.Transform
 	b := image_any.Bounds()
 	width, height := b.Dx(), b.Dy()
+	switch image_any.(type) {
+	case *RGBAF, *image.Paletted:
+		// float images can have values outside [0, 1] which a baked
+		// pipeline would clamp
+	default:
+		// baked pipelines are only accurate to 8 bits
+		if !has_16bit_channels(image_any) {
+			tr = tr.OptimizedFor(width * height)
+		}
+	}
+	t := tr.Transform
+	// Transform a row of interleaved RGB values in place
+	transform_row := func(row []float64) { tr.TransformSlice64(row, row, icc.InterleavedPixels) }
 	ans = image_any
 	var f func(start, limit int)
 	switch img := image_any.(type) {
 	case *NRGB:
 		f = func(start, limit int) {
+			buf := make([]float64, 3*width)
 			for y := start; y < limit; y++ {
-				row := img.Pix[img.Stride*y:]
-				_ = row[3*(width-1)]
-				for range width {
-					r := row[0:3:3]
-					fr, fg, fb := t(f8(r[0]), f8(r[1]), f8(r[2]))
-					r[0], r[1], r[2] = f8i(fr), f8i(fg), f8i(fb)
-					row = row[3:]
+				row := img.Pix[img.Stride*y : img.Stride*y+3*width]
+				for i, v := range row {
+					buf[i] = f8(v)
+				}
+				transform_row(buf)
+				for i, v := range buf {
+					row[i] = f8i(v)
 				}
 			}
 		}
 	case *image.NRGBA:
 		f = func(start, limit int) {
+			buf := make([]float64, 3*width)
 			for y := start; y < limit; y++ {
-				row := img.Pix[img.Stride*y:]
-				_ = row[4*(width-1)]
-				for range width {
-					r := row[0:3:3]
-					fr, fg, fb := t(f8(r[0]), f8(r[1]), f8(r[2]))
-					r[0], r[1], r[2] = f8i(fr), f8i(fg), f8i(fb)
-					row = row[4:]
+				row := img.Pix[img.Stride*y : img.Stride*y+4*width]
+				for x := range width {
+					s, d := row[4*x:4*x+3:4*x+3], buf[3*x:3*x+3:3*x+3]
+					d[0], d[1], d[2] = f8(s[0]), f8(s[1]), f8(s[2])
+				}
+				transform_row(buf)
+				for x := range width {
+					s, d := buf[3*x:3*x+3:3*x+3], row[4*x:4*x+3:4*x+3]
+					d[0], d[1], d[2] = f8i(s[0]), f8i(s[1]), f8i(s[2])
+				}
+			}
+		}
+	case *RGBAF:
+		f = func(start, limit int) {
+			buf := make([]float32, 3*width)
+			for y := start; y < limit; y++ {
+				row := img.Pix[img.Stride*y : img.Stride*y+4*width]
+				for x := range width {
+					copy(buf[3*x:3*x+3], row[4*x:4*x+3])
+				}
+				tr.TransformSlice(buf, buf, icc.InterleavedPixels)
+				for x := range width {
+					copy(row[4*x:4*x+3], buf[3*x:3*x+3])
 				}
 			}
 		}
 	case *image.NRGBA64:
 		f = func(start, limit int) {
+			buf := make([]float64, 3*width)
 			for y := start; y < limit; y++ {
-				row := img.Pix[img.Stride*y:]
-				_ = row[8*(width-1)]
-				for range width {
-					s := row[0:8:8]
-					fr := f16(uint16(s[0])<<8 | uint16(s[1]))
-					fg := f16(uint16(s[2])<<8 | uint16(s[3]))
-					fb := f16(uint16(s[4])<<8 | uint16(s[5]))
-					fr, fg, fb = t(fr, fg, fb)
-					r, g, b := f16i(fr), f16i(fg), f16i(fb)
-					s[0], s[1] = uint8(r>>8), uint8(r)
-					s[2], s[3] = uint8(g>>8), uint8(g)
-					s[4], s[5] = uint8(b>>8), uint8(b)
-					row = row[8:]
+				row := img.Pix[img.Stride*y : img.Stride*y+8*width]
+				for x := range width {
+					s, d := row[8*x:8*x+6:8*x+6], buf[3*x:3*x+3:3*x+3]
+					d[0] = f16(uint16(s[0])<<8 | uint16(s[1]))
+					d[1] = f16(uint16(s[2])<<8 | uint16(s[3]))
+					d[2] = f16(uint16(s[4])<<8 | uint16(s[5]))
+				}
+				transform_row(buf)
+				for x := range width {
+					s, d := buf[3*x:3*x+3:3*x+3], row[8*x:8*x+6:8*x+6]
+					r, g, b := f16i(s[0]), f16i(s[1]), f16i(s[2])
+					d[0], d[1] = uint8(r>>8), uint8(r)
+					d[2], d[3] = uint8(g>>8), uint8(g)
+					d[4], d[5] = uint8(b>>8), uint8(b)
 				}
 			}
 		}
@@ -86,21 +139,22 @@ func convert(tr *icc.Pipeline, image_any image.Image) (ans image.Image, err erro
 		d := image.NewNRGBA(b)
 		ans = d
 		f = func(start, limit int) {
+			buf := make([]float64, 3*width)
 			for y := start; y < limit; y++ {
-				row := img.Pix[img.Stride*y:]
-				drow := d.Pix[d.Stride*y:]
-				_ = row[4*(width-1)]
-				_ = drow[4*(width-1)]
-				for range width {
-					r := row[0:4:4]
-					dr := drow[0:4:4]
-					dr[3] = r[3]
-					if a := row[3]; a != 0 {
-						fr, fg, fb := t(unpremultiply8(r[0], a), unpremultiply8(r[1], a), unpremultiply8(r[2], a))
-						dr[0], dr[1], dr[2] = f8i(fr), f8i(fg), f8i(fb)
+				row := img.Pix[img.Stride*y : img.Stride*y+4*width]
+				drow := d.Pix[d.Stride*y : d.Stride*y+4*width]
+				for x := range width {
+					s, f := row[4*x:4*x+4:4*x+4], buf[3*x:3*x+3:3*x+3]
+					if a := s[3]; a != 0 {
+						f[0], f[1], f[2] = unpremultiply8(s[0], a), unpremultiply8(s[1], a), unpremultiply8(s[2], a)
+					}
+				}
+				transform_row(buf)
+				for x := range width {
+					s, f, dr := row[4*x:4*x+4:4*x+4], buf[3*x:3*x+3:3*x+3], drow[4*x:4*x+4:4*x+4]
+					if dr[3] = s[3]; s[3] != 0 {
+						dr[0], dr[1], dr[2] = f8i(f[0]), f8i(f[1]), f8i(f[2])
 					}
-					row = row[4:]
-					drow = drow[4:]
 				}
 			}
 		}
@@ -108,27 +162,28 @@ func convert(tr *icc.Pipeline, image_any image.Image) (ans image.Image, err erro
 		d := image.NewNRGBA64(b)
 		ans = d
 		f = func(start, limit int) {
+			buf := make([]float64, 3*width)
 			for y := start; y < limit; y++ {
-				row := img.Pix[img.Stride*y:]
-				drow := d.Pix[d.Stride*y:]
-				_ = row[8*(width-1)]
-				_ = drow[8*(width-1)]
-				for range width {
-					s, dr := row[0:8:8], drow[0:8:8]
+				row := img.Pix[img.Stride*y : img.Stride*y+8*width]
+				drow := d.Pix[d.Stride*y : d.Stride*y+8*width]
+				for x := range width {
+					s, f := row[8*x:8*x+8:8*x+8], buf[3*x:3*x+3:3*x+3]
+					if a := uint32(s[6])<<8 | uint32(s[7]); a != 0 {
+						f[0] = unpremultiply((uint32(s[0])<<8 | uint32(s[1])), a)
+						f[1] = unpremultiply((uint32(s[2])<<8 | uint32(s[3])), a)
+						f[2] = unpremultiply((uint32(s[4])<<8 | uint32(s[5])), a)
+					}
+				}
+				transform_row(buf)
+				for x := range width {
+					s, f, dr := row[8*x:8*x+8:8*x+8], buf[3*x:3*x+3:3*x+3], drow[8*x:8*x+8:8*x+8]
 					dr[6], dr[7] = s[6], s[7]
-					a := uint32(s[6])<<8 | uint32(s[7])
-					if a != 0 {
-						fr := unpremultiply((uint32(s[0])<<8 | uint32(s[1])), a)
-						fg := unpremultiply((uint32(s[2])<<8 | uint32(s[3])), a)
-						fb := unpremultiply((uint32(s[4])<<8 | uint32(s[5])), a)
-						fr, fg, fb = t(fr, fg, fb)
-						r, g, b := f16i(fr), f16i(fg), f16i(fb)
+					if s[6] != 0 || s[7] != 0 {
+						r, g, b := f16i(f[0]), f16i(f[1]), f16i(f[2])
 						dr[0], dr[1] = uint8(r>>8), uint8(r)
 						dr[2], dr[3] = uint8(g>>8), uint8(g)
 						dr[4], dr[5] = uint8(b>>8), uint8(b)
 					}
-					row = row[8:]
-					drow = drow[8:]
 				}
 			}
 		}
@@ -143,25 +198,18 @@ func convert(tr *icc.Pipeline, image_any image.Image) (ans image.Image, err erro
 		}
 		return
 	case *image.CMYK:
-		g := tr.TransformGeneral
 		d := nrgb.NewNRGB(b)
 		ans = d
 		f = func(start, limit int) {
-			var inp, outp [4]float64
-			i, o := inp[:], outp[:]
+			inbuf, outbuf := make([]float64, 4*width), make([]float64, 3*width)
 			for y := start; y < limit; y++ {
-				row := img.Pix[img.Stride*y:]
-				drow := d.Pix[d.Stride*y:]
-				_ = row[4*(width-1)]
-				_ = drow[3*(width-1)]
-				for range width {
-					r := row[0:4:4]
-					inp[0], inp[1], inp[2], inp[3] = f8(r[0]), f8(r[1]), f8(r[2]), f8(r[3])
-					g(o, i)
-					r = drow[0:3:3]
-					r[0], r[1], r[2] = f8i(outp[0]), f8i(outp[1]), f8i(outp[2])
-					row = row[4:]
-					drow = drow[3:]
+				for i, v := range img.Pix[img.Stride*y : img.Stride*y+4*width] {
+					inbuf[i] = f8(v)
+				}
+				tr.TransformSlice64(outbuf, inbuf, icc.InterleavedPixels)
+				drow := d.Pix[d.Stride*y : d.Stride*y+3*width]
+				for i, v := range outbuf {
+					drow[i] = f8i(v)
 				}
 			}
 		}
@@ -169,19 +217,22 @@ func convert(tr *icc.Pipeline, image_any image.Image) (ans image.Image, err erro
 		d := nrgb.NewNRGB(b)
 		ans = d
 		f = func(start, limit int) {
+			buf := make([]float64, 3*width)
 			for y := start; y < limit; y++ {
 				ybase := y * img.YStride
-				row := d.Pix[d.Stride*y:]
 				yy := y + b.Min.Y
 				for x := b.Min.X; x < b.Max.X; x++ {
 					iy := ybase + (x - b.Min.X)
 					ic := img.COffset(x, yy)
 					// We use this rather than color.YCbCrToRGB for greater accuracy
 					r, g, bb, _ := color.YCbCr{img.Y[iy], img.Cb[ic], img.Cr[ic]}.RGBA()
-					fr, fg, fb := t(f16(uint16(r)), f16(uint16(g)), f16(uint16(bb)))
-					rr := row[0:3:3]
-					rr[0], rr[1], rr[2] = f8i(fr), f8i(fg), f8i(fb)
-					row = row[3:]
+					f := buf[3*(x-b.Min.X):]
+					f[0], f[1], f[2] = f16(uint16(r)), f16(uint16(g)), f16(uint16(bb))
+				}
+				transform_row(buf)
+				row := d.Pix[d.Stride*y : d.Stride*y+3*width]
+				for i, v := range buf {
+					row[i] = f8i(v)
 				}
 			}
 		}
@@ -189,22 +240,57 @@ func convert(tr *icc.Pipeline, image_any image.Image) (ans image.Image, err erro
 		d := image.NewNRGBA(b)
 		ans = d
 		f = func(start, limit int) {
+			buf := make([]float64, 3*width)
 			for y := start; y < limit; y++ {
 				ybase := y * img.YStride
-				row := d.Pix[d.Stride*y:]
 				yy := y + b.Min.Y
 				for x := b.Min.X; x < b.Max.X; x++ {
-					rr := row[0:4:4]
-					rr[3] = img.A[img.AOffset(x, yy)]
-					if rr[3] != 0 {
-						iy := ybase + (x - b.Min.X)
-						ic := img.COffset(x, yy)
-						// We use this rather than color.YCbCrToRGB for greater accuracy
-						r, g, bb, _ := color.YCbCr{img.Y[iy], img.Cb[ic], img.Cr[ic]}.RGBA()
-						fr, fg, fb := t(f16(uint16(r)), f16(uint16(g)), f16(uint16(bb)))
-						rr[0], rr[1], rr[2] = f8i(fr), f8i(fg), f8i(fb)
-						row = row[4:]
+					iy := ybase + (x - b.Min.X)
+					ic := img.COffset(x, yy)
+					// We use this rather than color.YCbCrToRGB for greater accuracy
+					r, g, bb, _ := color.YCbCr{img.Y[iy], img.Cb[ic], img.Cr[ic]}.RGBA()
+					f := buf[3*(x-b.Min.X):]
+					f[0], f[1], f[2] = f16(uint16(r)), f16(uint16(g)), f16(uint16(bb))
+				}
+				transform_row(buf)
+				row := d.Pix[d.Stride*y : d.Stride*y+4*width]
+				for x := b.Min.X; x < b.Max.X; x++ {
+					rr, f := row[0:4:4], buf[3*(x-b.Min.X):]
+					if rr[3] = img.A[img.AOffset(x, yy)]; rr[3] != 0 {
+						rr[0], rr[1], rr[2] = f8i(f[0]), f8i(f[1]), f8i(f[2])
 					}
+					row = row[4:]
+				}
+			}
+		}
+	case *image.Gray:
+		f = func(start, limit int) {
+			buf := make([]float64, 3*width)
+			for y := start; y < limit; y++ {
+				row := img.Pix[img.Stride*y : img.Stride*y+width]
+				for i, v := range row {
+					fv := f8(v)
+					buf[3*i], buf[3*i+1], buf[3*i+2] = fv, fv, fv
+				}
+				transform_row(buf)
+				for i := range row {
+					row[i] = f8i(luma(buf[3*i], buf[3*i+1], buf[3*i+2]))
+				}
+			}
+		}
+	case *image.Gray16:
+		f = func(start, limit int) {
+			buf := make([]float64, 3*width)
+			for y := start; y < limit; y++ {
+				row := img.Pix[img.Stride*y : img.Stride*y+2*width]
+				for i := range width {
+					fv := f16(uint16(row[2*i])<<8 | uint16(row[2*i+1]))
+					buf[3*i], buf[3*i+1], buf[3*i+2] = fv, fv, fv
+				}
+				transform_row(buf)
+				for i := range width {
+					v := f16i(luma(buf[3*i], buf[3*i+1], buf[3*i+2]))
+					row[2*i], row[2*i+1] = uint8(v>>8), uint8(v)
 				}
 			}
 		}
@@ -248,3 +334,137 @@ func convert(tr *icc.Pipeline, image_any image.Image) (ans image.Image, err erro
 	err = parallel.Run_in_parallel_over_range(0, f, 0, height)
 	return
 }
+
+// Return opaque images as *image.Gray or, for 16 bit images, *image.Gray16.
+// Other images are returned unchanged.
+func as_gray(img image.Image) image.Image {
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		return img
+	}
+	if !IsOpaque(img) {
+		return img
+	}
+	b := img.Bounds()
+	var ans draw.Image
+	switch img.(type) {
+	case *image.NRGBA64, *image.RGBA64:
+		ans = image.NewGray16(b)
+	default:
+		ans = image.NewGray(b)
+	}
+	draw.Draw(ans, b, img, b.Min, draw.Src)
+	return ans
+}
+
+// Convert the image to CMYK using a pipeline with four output channels and
+// three input channels, or four for *image.CMYK images. Translucent pixels are
+// composited onto white, i.e. no ink.
+func convert_to_cmyk(tr *icc.Pipeline, img image.Image) (*image.CMYK, error) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	tr = tr.OptimizedFor(width * height)
+	cmyk, _ := img.(*image.CMYK)
+	var src types.Scanner
+	_, is_float := img.(*RGBAF)
+	// bytes per channel of the scanned pixels
+	bpc := 1
+	switch {
+	case cmyk != nil:
+	case is_float || has_16bit_channels(img):
+		src, bpc = nrgba.NewNRGBA64Scanner(img), 2
+	default:
+		src = nrgba.NewNRGBAScanner(img)
+	}
+	ans := image.NewCMYK(image.Rect(0, 0, width, height))
+	nin, _ := tr.IOSig()
+	f := func(start, limit int) {
+		inbuf, outbuf := make([]float64, nin*width), make([]float64, 4*width)
+		row := make([]uint8, 4*bpc*width)
+		clamped := func(x float64) uint8 { return uint8(max(0, min(x, 1))*math.MaxUint8 + 0.5) }
+		for y := start; y < limit; y++ {
+			if cmyk == nil {
+				src.Scan(0, y, width, y+1, row)
+				for x := range width {
+					i := inbuf[3*x : 3*x+3 : 3*x+3]
+					var r, g, b, a float64
+					if bpc == 2 {
+						p := row[8*x : 8*x+8 : 8*x+8]
+						r, g, b, a = get16(p[0:])/math.MaxUint16, get16(p[2:])/math.MaxUint16, get16(p[4:])/math.MaxUint16, get16(p[6:])/math.MaxUint16
+					} else {
+						p := row[4*x : 4*x+4 : 4*x+4]
+						r, g, b, a = f8(p[0]), f8(p[1]), f8(p[2]), f8(p[3])
+					}
+					i[0], i[1], i[2] = r*a+1-a, g*a+1-a, b*a+1-a
+				}
+			} else {
+				for i, v := range cmyk.Pix[cmyk.PixOffset(b.Min.X, b.Min.Y+y):][:4*width] {
+					inbuf[i] = f8(v)
+				}
+			}
+			tr.TransformSlice64(outbuf, inbuf, icc.InterleavedPixels)
+			d := ans.Pix[ans.Stride*y : ans.Stride*y+4*width]
+			for i, v := range outbuf {
+				d[i] = clamped(v)
+			}
+		}
+	}
+	if err := parallel.Run_in_parallel_over_range(0, f, 0, height); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+// Create a mask that is opaque for pixels whose colors differ by more than
+// tolerance (CIEDE2000) when converted to Lab by the to_lab and
+// gamut_check pipelines. Fully transparent pixels are never marked.
+func gamut_mask(to_lab, gamut_check *icc.Pipeline, tolerance float64, img image.Image) (*image.Alpha, error) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	ans := image.NewAlpha(image.Rect(0, 0, width, height))
+	cmyk, _ := img.(*image.CMYK)
+	var src types.Scanner
+	if cmyk == nil {
+		src = nrgba.NewNRGBAScanner(img)
+	}
+	f := func(start, limit int) {
+		var inp, scratch, lab1, lab2 [4]float64
+		row := make([]uint8, 4*width)
+		for y := start; y < limit; y++ {
+			if cmyk == nil {
+				src.Scan(0, y, width, y+1, row)
+			} else {
+				copy(row, cmyk.Pix[cmyk.PixOffset(b.Min.X, b.Min.Y+y):])
+			}
+			s := row
+			d := ans.Pix[ans.Stride*y:]
+			for x := range width {
+				p := s[0:4:4]
+				s = s[4:]
+				if cmyk == nil {
+					if p[3] == 0 {
+						continue
+					}
+					lab1[0], lab1[1], lab1[2] = to_lab.Transform(f8(p[0]), f8(p[1]), f8(p[2]))
+					lab2[0], lab2[1], lab2[2] = gamut_check.Transform(f8(p[0]), f8(p[1]), f8(p[2]))
+				} else {
+					// TransformGeneral uses its input as scratch space
+					for i, c := range p {
+						inp[i] = f8(c)
+					}
+					scratch = inp
+					to_lab.TransformGeneral(lab1[:], scratch[:])
+					scratch = inp
+					gamut_check.TransformGeneral(lab2[:], scratch[:])
+				}
+				if colorconv.DeltaE2000(lab1[0], lab1[1], lab1[2], lab2[0], lab2[1], lab2[2]) > tolerance {
+					d[x] = math.MaxUint8
+				}
+			}
+		}
+	}
+	if err := parallel.Run_in_parallel_over_range(0, f, 0, height); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
@@ -13,6 +13,11 @@ var _ = fmt.Print
 // may be either the original image unmodified if no color
 // conversion was needed, the original image modified, or a new image (when the original image
 // is not in a supported format).
+//
+// For profiles with a gray device color space, each channel of the image is
+// converted independently to the gray equivalent of sRGB, so gray images keep
+// their type, and gray images with alpha that are stored as RGBA stay
+// neutral.
 func ConvertToSRGB(p *icc.Profile, intent icc.RenderingIntent, use_blackpoint_compensation bool, image_any image.Image) (ans image.Image, err error) {
 	if p.IsSRGB() {
 		return image_any, nil
@@ -21,9 +26,183 @@ func ConvertToSRGB(p *icc.Profile, intent icc.RenderingIntent, use_blackpoint_co
 	if _, is_cmyk := image_any.(*image.CMYK); is_cmyk {
 		num_channels = 4
 	}
+	if p.Header.DataColorSpace == icc.ColorSpaceGray {
+		if num_channels == 4 {
+			return nil, fmt.Errorf("cannot convert a CMYK image using a gray ICC profile")
+		}
+		tr, err := gray_to_srgb_pipeline(p, intent, use_blackpoint_compensation)
+		if err != nil {
+			return nil, err
+		}
+		return convert(tr, image_any)
+	}
 	tr, err := p.CreateTransformerToSRGB(intent, use_blackpoint_compensation, num_channels, true, true, true)
 	if err != nil {
 		return nil, err
 	}
 	return convert(tr, image_any)
 }
+
+// Returns a pipeline that converts each of its three channels independently
+// from the gray profile to sGray, the gray equivalent of sRGB. For neutral
+// colors this is the same as converting them to sRGB.
+func gray_to_srgb_pipeline(p *icc.Profile, intent icc.RenderingIntent, use_blackpoint_compensation bool) (*icc.Pipeline, error) {
+	sgray, err := icc.SGrayProfile.Profile()
+	if err != nil {
+		return nil, err
+	}
+	tr, err := p.CreateTransformerToProfile(sgray, intent, use_blackpoint_compensation, 1, true, true)
+	if err != nil {
+		return nil, err
+	}
+	ans := &icc.Pipeline{}
+	ans.Append(icc.NewUniformFunctionTransformer("ToSGray", func(v float64) float64 {
+		// The stages of gray pipelines use only the first of their inputs
+		g, _, _ := tr.Transform(v, v, v)
+		return g
+	}))
+	ans.Finalize(true)
+	return ans, nil
+}
+
+// Convert colors in the image from the src ICC color profile to the dst ICC
+// color profile, which must have an RGB device color space. The result may be
+// either the original image unmodified if no color conversion was needed, the
+// original image modified, or a new image (when the original image is not in
+// a supported format). Any abstract profiles, such as Lab to Lab effects, are
+// applied in order, in the profile connection space. Colors outside the
+// gamut of dst are mapped into it as specified by dst.GamutMapping.
+func ConvertBetweenProfiles(src, dst *icc.Profile, intent icc.RenderingIntent, use_blackpoint_compensation bool, image_any image.Image, abstract_profiles ...*icc.Profile) (ans image.Image, err error) {
+	if dst.Header.DataColorSpace != icc.ColorSpaceRGB {
+		return nil, fmt.Errorf("converting to the %s color space is not supported", dst.Header.DataColorSpace)
+	}
+	if len(abstract_profiles) == 0 && (src == dst || (src.IsSRGB() && dst.IsSRGB())) {
+		return image_any, nil
+	}
+	num_channels := 3
+	if _, is_cmyk := image_any.(*image.CMYK); is_cmyk {
+		num_channels = 4
+	}
+	tr, err := src.CreateTransformerToProfile(dst, intent, use_blackpoint_compensation, num_channels, true, true, abstract_profiles...)
+	if err != nil {
+		return nil, err
+	}
+	return convert(tr, image_any)
+}
+
+// Returns a pipeline to convert sRGB colors to the specified profile
+func srgb_to_profile_pipeline(dst *icc.Profile, intent icc.RenderingIntent, use_blackpoint_compensation bool) (*icc.Pipeline, error) {
+	srgb, err := icc.SRGBProfile.Profile()
+	if err != nil {
+		return nil, err
+	}
+	return srgb.CreateTransformerToProfile(dst, intent, use_blackpoint_compensation, 3, true, true)
+}
+
+// Convert the image to CMYK using the dst ICC color profile, which must have a
+// CMYK device color space, such as a press or printer profile. The colors of
+// the image are interpreted using the src profile, or as sRGB if src is nil.
+// Translucent pixels are composited onto white, i.e. unprinted paper. Any
+// abstract profiles are applied in order, in the profile connection space.
+func ConvertToCMYK(src, dst *icc.Profile, intent icc.RenderingIntent, use_blackpoint_compensation bool, img image.Image, abstract_profiles ...*icc.Profile) (*image.CMYK, error) {
+	if dst.Header.DataColorSpace != icc.ColorSpaceCMYK {
+		return nil, fmt.Errorf("the profile to convert to CMYK with has the %s color space", dst.Header.DataColorSpace)
+	}
+	if src == nil {
+		var err error
+		if src, err = icc.SRGBProfile.Profile(); err != nil {
+			return nil, err
+		}
+	}
+	tr, err := src.CreateTransformerToProfile(dst, intent, use_blackpoint_compensation, 3, true, true, abstract_profiles...)
+	if err != nil {
+		return nil, err
+	}
+	return convert_to_cmyk(tr, img)
+}
+
+// Apply the device link profile to the image, converting its colors directly
+// from the input color space of the link to its output color space, which
+// must be RGB or CMYK. *image.CMYK images are used as CMYK input, all other
+// images as RGB. For CMYK output, translucent pixels are composited onto
+// white, i.e. unprinted paper, and the result is an *image.CMYK. For RGB
+// output, the result may be either the original image modified, or a new
+// image (when the original image is not in a supported format).
+func ApplyDeviceLink(link *icc.Profile, intent icc.RenderingIntent, img image.Image) (ans image.Image, err error) {
+	_, is_cmyk := img.(*image.CMYK)
+	in := icc.IfElse(is_cmyk, icc.ColorSpaceCMYK, icc.ColorSpaceRGB)
+	if link.Header.DataColorSpace != in {
+		return nil, fmt.Errorf("the device link has the input color space %s, not %s", link.Header.DataColorSpace, in)
+	}
+	tr, err := link.CreateDeviceLinkTransformer(intent, len(in.BlackPoint()), true, true)
+	if err != nil {
+		return nil, err
+	}
+	switch link.Header.ProfileConnectionSpace {
+	case icc.ColorSpaceRGB:
+		return convert(tr, img)
+	case icc.ColorSpaceCMYK:
+		return convert_to_cmyk(tr, img)
+	default:
+		return nil, fmt.Errorf("applying a device link with the output color space %s is not supported", link.Header.ProfileConnectionSpace)
+	}
+}
+
+func profile_or_srgb(p *icc.Profile) (*icc.Profile, error) {
+	if p == nil {
+		return icc.SRGBProfile.Profile()
+	}
+	return p, nil
+}
+
+// Soft proof the image, converting it to show how it will look when
+// reproduced on the device of the proof profile, for example, a printing
+// press, and viewed on a display with the display profile. The src and
+// display profiles default to sRGB when nil. proof_intent is used to convert
+// to the proof device. When simulate_paper_white is true the paper white of
+// the proof device is shown rather than being mapped to display white. The
+// result may be either the original image modified, or a new image (when the
+// original image is not in a supported format).
+func SoftProof(src, proof, display *icc.Profile, proof_intent icc.RenderingIntent, use_blackpoint_compensation, simulate_paper_white bool, image_any image.Image) (ans image.Image, err error) {
+	if src, err = profile_or_srgb(src); err != nil {
+		return nil, err
+	}
+	if display, err = profile_or_srgb(display); err != nil {
+		return nil, err
+	}
+	if display.Header.DataColorSpace != icc.ColorSpaceRGB {
+		return nil, fmt.Errorf("displaying with the %s color space is not supported", display.Header.DataColorSpace)
+	}
+	num_channels := 3
+	if _, is_cmyk := image_any.(*image.CMYK); is_cmyk {
+		num_channels = 4
+	}
+	tr, err := src.CreateSoftProofTransformer(proof, display, proof_intent, use_blackpoint_compensation, simulate_paper_white, num_channels, true)
+	if err != nil {
+		return nil, err
+	}
+	return convert(tr, image_any)
+}
+
+// Return a mask that is opaque for pixels whose colors cannot be reproduced
+// using the target profile to within tolerance, as measured by CIEDE2000. A
+// tolerance of about 2 is barely noticeable. The src profile defaults to sRGB
+// when nil. The mask has the same size as the image with its origin at (0, 0).
+func GamutWarningMask(src, target *icc.Profile, tolerance float64, img image.Image) (ans *image.Alpha, err error) {
+	if src, err = profile_or_srgb(src); err != nil {
+		return nil, err
+	}
+	num_channels := 3
+	if _, is_cmyk := img.(*image.CMYK); is_cmyk {
+		num_channels = 4
+	}
+	to_lab, err := src.CreateTransformerToLab(icc.RelativeColorimetricRenderingIntent, num_channels, true)
+	if err != nil {
+		return nil, err
+	}
+	gamut_check, err := src.CreateGamutCheckTransformer(target, num_channels, true)
+	if err != nil {
+		return nil, err
+	}
+	return gamut_mask(to_lab, gamut_check, tolerance, img)
+}
@@ -1,15 +1,24 @@
 package imaging
 
 import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
+	"io"
 	"math"
 	"testing"
 
+	"github.com/kovidgoyal/imaging/colorconv"
 	"github.com/kovidgoyal/imaging/nrgb"
+	"github.com/kovidgoyal/imaging/prism/meta"
+	"github.com/kovidgoyal/imaging/prism/meta/autometa"
 	"github.com/kovidgoyal/imaging/prism/meta/icc"
+	"github.com/kovidgoyal/imaging/rgbaf"
+	exif_tiff "github.com/rwcarlsen/goexif/tiff"
 	"github.com/stretchr/testify/require"
 )
 
@@ -58,7 +67,7 @@ func image_compare(t *testing.T, a, b image.Image, ct icc.ChannelTransformer, al
 	require.Equal(t, ha, hb)
 	maxval := float64(math.MaxUint8)
 	switch a.(type) {
-	case *image.NRGBA64, *image.RGBA64:
+	case *image.NRGBA64, *image.RGBA64, *RGBAF:
 		maxval = math.MaxUint16
 	}
 	cvt := func(x float64) uint { return uint(x * maxval) }
@@ -256,6 +265,7 @@ func TestProfileApplication(t *testing.T) {
 	run(image.NewNRGBA64(r), 0)
 	run(image.NewRGBA(r), 0)
 	run(image.NewRGBA64(r), 0)
+	run(rgbaf.NewRGBAF(r), 1)
 	run(image.NewCMYK(r), 0)
 	run(new_unknown_image(r), 0)
 	run(new_unknown_image_with_set(r), 0)
@@ -263,3 +273,467 @@ func TestProfileApplication(t *testing.T) {
 	run(image.NewPaletted(r, make(color.Palette, 256)), 0)
 	run(image.NewNYCbCrA(r, image.YCbCrSubsampleRatio444), 0)
 }
+
+func TestConvertBetweenProfiles(t *testing.T) {
+	profile := func(name string) *icc.Profile {
+		p, err := icc.ReadProfile("prism/meta/icc/test-profiles/" + name)
+		require.NoError(t, err)
+		return p
+	}
+	srgb, srgb_lab, p3 := profile("sRGB2014.icc"), profile("sRGB_ICC_v4_Appearance.icc"), profile("displayp3.icc")
+	in_delta := func(expected, actual [3]float64, delta float64, msg string) {
+		t.Helper()
+		require.InDeltaSlice(t, expected[:], actual[:], delta, msg)
+	}
+	to_p3, err := srgb.CreateTransformerToProfile(p3, Relative, false, 3, true, true)
+	require.NoError(t, err)
+	from_p3, err := p3.CreateTransformerToProfile(srgb, Relative, false, 3, true, true)
+	require.NoError(t, err)
+	// The LAB PCS sRGB profile is LUT based and only approximates sRGB
+	lab_to_p3, err := srgb_lab.CreateTransformerToProfile(p3, Relative, false, 3, true, true)
+	require.NoError(t, err)
+	r, g, b := to_p3.Transform(1, 0, 0)
+	in_delta([3]float64{0.9175, 0.2003, 0.1386}, [3]float64{r, g, b}, 0.002, "sRGB red in Display P3")
+	for _, c := range [][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {0.2, 0.5, 0.7}, {1, 1, 1}, {0, 0, 0}} {
+		r, g, b := to_p3.Transform(c[0], c[1], c[2])
+		lr, lg, lb := lab_to_p3.Transform(c[0], c[1], c[2])
+		in_delta([3]float64{r, g, b}, [3]float64{lr, lg, lb}, 0.04, fmt.Sprintf("LAB and XYZ PCS sRGB profiles differ for: %v", c))
+		r, g, b = from_p3.Transform(r, g, b)
+		in_delta(c, [3]float64{r, g, b}, 0.5/255, fmt.Sprintf("round trip via Display P3 failed for: %v", c))
+	}
+
+	// A synthetic profile created from the CICP code points
+	data, err := meta.DISPLAY_P3.ICCProfile()
+	require.NoError(t, err)
+	synthetic_p3, err := icc.DecodeProfile(bytes.NewReader(data))
+	require.NoError(t, err)
+	to_synthetic_p3, err := srgb.CreateTransformerToProfile(synthetic_p3, Relative, false, 3, true, true)
+	require.NoError(t, err)
+	for _, c := range [][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {0.2, 0.5, 0.7}, {1, 1, 1}} {
+		r, g, b := to_p3.Transform(c[0], c[1], c[2])
+		sr, sg, sb := to_synthetic_p3.Transform(c[0], c[1], c[2])
+		in_delta([3]float64{r, g, b}, [3]float64{sr, sg, sb}, 0.5/255, fmt.Sprintf("synthetic Display P3 profile differs for: %v", c))
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	for i := range 4 {
+		copy(img.Pix[i*4:], []uint8{255, 0, 0, 255})
+	}
+	buf := bytes.Buffer{}
+	require.NoError(t, Encode(&buf, img, PNG))
+	data = buf.Bytes()
+	dimg, err := Decode(bytes.NewReader(data), TargetProfile(p3), Backends(GO_IMAGE))
+	require.NoError(t, err)
+	actual := color.NRGBAModel.Convert(dimg.At(1, 1)).(color.NRGBA)
+	require.InDeltaSlice(t, []uint8{234, 51, 35, 255}, []uint8{actual.R, actual.G, actual.B, actual.A}, 1)
+	cimg, err := ConvertBetweenProfiles(srgb, p3, Relative, false, ClonePreservingType(img))
+	require.NoError(t, err)
+	require.Equal(t, actual, cimg.At(0, 0))
+	cimg, err = ConvertBetweenProfiles(srgb, profile("sRGB.icc"), Relative, false, img)
+	require.NoError(t, err)
+	require.Same(t, img, cimg)
+
+	// Colors outside sRGB described by cICP or gAMA and cHRM are preserved
+	var chrm []byte
+	for _, x := range []uint32{31270, 32900, 68000, 32000, 26500, 69000, 15000, 6000} {
+		chrm = binary.BigEndian.AppendUint32(chrm, x)
+	}
+	for _, chunks := range [][]png_chunk{
+		{{"cICP", []byte{12, 13, 0, 1}}},
+		{{"gAMA", binary.BigEndian.AppendUint32(nil, 45455)}, {"cHRM", chrm}},
+	} {
+		dimg, err := Decode(bytes.NewReader(png_with_chunks(data, chunks...)), TargetProfile(p3), Backends(GO_IMAGE))
+		require.NoError(t, err)
+		actual := color.NRGBAModel.Convert(dimg.At(1, 1)).(color.NRGBA)
+		require.InDeltaSlice(t, []uint8{255, 0, 0, 255}, []uint8{actual.R, actual.G, actual.B, actual.A}, 1, chunks[0].name)
+	}
+}
+
+func TestGamutMappingOption(t *testing.T) {
+	p3, err := icc.DisplayP3Profile.Profile()
+	require.NoError(t, err)
+	cfg := NewDecodeConfig(TargetProfile(p3), GamutMapping(colorconv.CuspProjection))
+	require.NotSame(t, p3, cfg.target_profile)
+	require.Equal(t, colorconv.CuspProjection, cfg.target_profile.GamutMapping)
+	require.Equal(t, colorconv.Clip, p3.GamutMapping)
+
+	// A ramp of saturated Display P3 colors, most of which are outside sRGB
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 1))
+	for x := range 64 {
+		copy(img.Pix[x*4:], []uint8{uint8(x * 4), 255, uint8(255 - x*4), 255})
+	}
+	md := &meta.Data{}
+	md.SetICCProfileData(icc.DisplayP3Profile.Data())
+	convert := func(opts ...DecodeOption) *image.NRGBA {
+		frames := []*Frame{{Image: ClonePreservingType(img)}}
+		require.NoError(t, fix_colors(frames, md, NewDecodeConfig(opts...)))
+		return frames[0].Image.(*image.NRGBA)
+	}
+	srgb, err := icc.SRGBProfile.Profile()
+	require.NoError(t, err)
+	clipped := convert(GamutMapping(colorconv.Clip))
+	for _, m := range []colorconv.GamutMapping{colorconv.Clip, colorconv.ChromaReduction, colorconv.OKLCHBinarySearch, colorconv.CuspProjection} {
+		expected, err := ConvertBetweenProfiles(p3, srgb.WithGamutMapping(m), Relative, true, ClonePreservingType(img))
+		require.NoError(t, err)
+		actual := convert(GamutMapping(m))
+		require.Equal(t, expected.(*image.NRGBA).Pix, actual.Pix, m.String())
+		if m != colorconv.Clip {
+			require.NotEqual(t, clipped.Pix, actual.Pix, m.String())
+		}
+	}
+}
+
+func TestConvertToCMYK(t *testing.T) {
+	p, err := icc.ReadProfile("prism/meta/icc/test-profiles/cmyk.icc")
+	require.NoError(t, err)
+	colors := []color.NRGBA{{255, 255, 255, 255}, {128, 128, 128, 255}, {200, 150, 100, 255}, {60, 120, 180, 255}, {0, 0, 0, 0}}
+	img := image.NewNRGBA(image.Rect(0, 0, len(colors), 1))
+	for i, c := range colors {
+		img.SetNRGBA(i, 0, c)
+	}
+	cmyk, err := ConvertToCMYK(nil, p, Relative, true, img)
+	require.NoError(t, err)
+	require.Equal(t, color.CMYK{}, cmyk.CMYKAt(0, 0), "white is not unprinted paper")
+	require.Equal(t, color.CMYK{}, cmyk.CMYKAt(len(colors)-1, 0), "transparent is not unprinted paper")
+	p3, err := icc.DisplayP3Profile.Profile()
+	require.NoError(t, err)
+	_, err = ConvertToCMYK(nil, p3, Relative, true, img)
+	require.Error(t, err)
+
+	check_round_trip := func(back image.Image, tolerance float64, msg string) {
+		t.Helper()
+		for i, c := range colors[:len(colors)-1] {
+			a := color.NRGBAModel.Convert(back.At(i, 0)).(color.NRGBA)
+			require.InDeltaSlice(t, []uint8{c.R, c.G, c.B}, []uint8{a.R, a.G, a.B}, tolerance, "%s: round trip via CMYK failed for: %v", msg, c)
+		}
+	}
+	back, err := ConvertToSRGB(p, Relative, true, ClonePreservingType(cmyk))
+	require.NoError(t, err)
+	check_round_trip(back, 4, "convert")
+
+	for _, format := range []Format{JPEG, TIFF} {
+		buf := bytes.Buffer{}
+		require.NoError(t, Encode(&buf, img, format, CMYKOutput(p, Relative, true), JPEGQuality(100)))
+		md, _, err := autometa.Load(bytes.NewReader(buf.Bytes()))
+		if format == JPEG {
+			require.NoError(t, err)
+			embedded, err := md.ICCProfileData()
+			require.NoError(t, err)
+			expected, err := p.Encode()
+			require.NoError(t, err)
+			require.Equal(t, expected, embedded)
+			decoded, err := Decode(bytes.NewReader(buf.Bytes()), Backends(GO_IMAGE))
+			require.NoError(t, err)
+			check_round_trip(decoded, 6, "JPEG")
+			continue
+		}
+		ifd, err := exif_tiff.Decode(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		tags := map[uint16]*exif_tiff.Tag{}
+		for _, tag := range ifd.Dirs[0].Tags {
+			tags[tag.Id] = tag
+		}
+		val := func(id uint16) int {
+			v, err := tags[id].Int(0)
+			require.NoError(t, err)
+			return v
+		}
+		require.Equal(t, 5, val(262), "photometric interpretation is not separated")
+		require.Equal(t, 4, val(277))
+		expected, err := p.Encode()
+		require.NoError(t, err)
+		require.Equal(t, expected, tags[34675].Val)
+		zr, err := zlib.NewReader(bytes.NewReader(buf.Bytes()[val(273) : val(273)+val(279)]))
+		require.NoError(t, err)
+		pixels, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		require.Equal(t, cmyk.Pix, pixels)
+	}
+
+	// *image.CMYK images are only written as CMYK when asked to
+	is_cmyk := func(format Format, data []byte) bool {
+		if format == JPEG {
+			decoded, err := Decode(bytes.NewReader(data), Backends(GO_IMAGE), ColorSpace(NO_CHANGE_OF_COLORSPACE))
+			require.NoError(t, err)
+			return decoded.ColorModel() == color.CMYKModel
+		}
+		ifd, err := exif_tiff.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+		for _, tag := range ifd.Dirs[0].Tags {
+			if tag.Id == 262 {
+				v, err := tag.Int(0)
+				require.NoError(t, err)
+				return v == 5
+			}
+		}
+		return false
+	}
+	for _, format := range []Format{JPEG, TIFF} {
+		buf := bytes.Buffer{}
+		require.NoError(t, Encode(&buf, cmyk, format))
+		require.False(t, is_cmyk(format, buf.Bytes()), format)
+		buf.Reset()
+		require.NoError(t, Encode(&buf, cmyk, format, EmbedColorSpace(&ImageColorSpace{Profile: p})))
+		require.True(t, is_cmyk(format, buf.Bytes()), format)
+	}
+	// CMYK profiles are not embedded in images with RGB pixels
+	for _, format := range []Format{PNG, JPEG} {
+		buf := bytes.Buffer{}
+		require.NoError(t, Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 2, 2)), format, EmbedColorSpace(&ImageColorSpace{Profile: p})))
+		md, _, err := autometa.Load(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		if md != nil {
+			embedded, err := md.ICCProfile()
+			require.NoError(t, err)
+			require.Nil(t, embedded, format)
+		}
+	}
+
+	// 16 bit images are converted without first reducing them to 8 bits
+	img16 := image.NewNRGBA64(image.Rect(0, 0, 256, 1))
+	for x := range 256 {
+		v := uint16(0x8000 + x)
+		img16.SetNRGBA64(x, 0, color.NRGBA64{v, v, v, 0xffff})
+	}
+	cmyk, err = ConvertToCMYK(nil, p, Relative, true, img16)
+	require.NoError(t, err)
+	distinct := map[color.CMYK]bool{}
+	for x := range 256 {
+		distinct[cmyk.CMYKAt(x, 0)] = true
+	}
+	require.Greater(t, len(distinct), 1)
+}
+
+func TestDeviceLinks(t *testing.T) {
+	curves := func(n int, gamma float64) (ans []icc.Curve1D) {
+		for range n {
+			c, err := icc.NewParametricCurve(icc.SimpleGammaFunction, gamma)
+			require.NoError(t, err)
+			ans = append(ans, c)
+		}
+		return
+	}
+	link := func(in, out icc.ColorSpace, m *icc.Matrix3, b_curves []icc.Curve1D) *icc.Profile {
+		var m_curves []icc.Curve1D
+		if m != nil {
+			m_curves = curves(3, 1)
+		}
+		mt, err := icc.NewModularTag(true, nil, nil, m_curves, m, nil, b_curves)
+		require.NoError(t, err)
+		p, err := icc.NewProfileBuilder(icc.DeviceClassLink, in, out).AddTag(icc.AToB0TagSignature, icc.EncodeModularTag(mt)).Build()
+		require.NoError(t, err)
+		return p
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	copy(img.Pix, []uint8{255, 128, 0, 255, 10, 20, 30, 128})
+	swap := link(icc.ColorSpaceRGB, icc.ColorSpaceRGB, &icc.Matrix3{{0, 0, 1}, {0, 1, 0}, {1, 0, 0}}, curves(3, 1))
+	ans, err := ApplyDeviceLink(swap, Relative, ClonePreservingType(img))
+	require.NoError(t, err)
+	require.Equal(t, []uint8{0, 128, 255, 255, 30, 20, 10, 128}, ans.(*image.NRGBA).Pix)
+
+	cmyk := image.NewCMYK(image.Rect(0, 0, 2, 1))
+	copy(cmyk.Pix, []uint8{255, 0, 128, 64, 0, 0, 0, 0})
+	square := link(icc.ColorSpaceCMYK, icc.ColorSpaceCMYK, nil, curves(4, 2))
+	ans, err = ApplyDeviceLink(square, Relative, cmyk)
+	require.NoError(t, err)
+	require.InDeltaSlice(t, []uint8{255, 0, 64, 16, 0, 0, 0, 0}, ans.(*image.CMYK).Pix, 1)
+	_, err = ApplyDeviceLink(square, Relative, img)
+	require.Error(t, err)
+	_, err = ApplyDeviceLink(swap, Relative, cmyk)
+	require.Error(t, err)
+
+	// An abstract profile that inverts lightness
+	mt, err := icc.NewModularTag(true, nil, nil, curves(3, 1), &icc.Matrix3{{-1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, &icc.Translation{1, 0, 0}, curves(3, 1))
+	require.NoError(t, err)
+	abstract, err := icc.NewProfileBuilder(icc.DeviceClassAbstract, icc.ColorSpaceLab, icc.ColorSpaceLab).AddTag(icc.AToB0TagSignature, icc.EncodeModularTag(mt)).Build()
+	require.NoError(t, err)
+	srgb, err := icc.SRGBProfile.Profile()
+	require.NoError(t, err)
+	ans, err = ConvertBetweenProfiles(srgb, srgb, Relative, false, ClonePreservingType(img), abstract)
+	require.NoError(t, err)
+	c := ans.(*image.NRGBA).NRGBAAt(1, 0)
+	require.Greater(t, int(c.R)+int(c.G)+int(c.B), 600, "lightness not inverted: %v", c)
+	require.Equal(t, uint8(128), c.A)
+}
+
+func TestGrayProfileConversion(t *testing.T) {
+	gray22, err := icc.Gray22Profile.Profile()
+	require.NoError(t, err)
+	expected := func(v float64) float64 {
+		v = math.Pow(v, 2.2)
+		if v <= 0.0031308 {
+			return 12.92 * v
+		}
+		return 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	vals := []uint8{0, 10, 64, 128, 200, 255}
+	g8 := image.NewGray(image.Rect(0, 0, len(vals), 1))
+	g16 := image.NewGray16(image.Rect(0, 0, len(vals), 1))
+	ga := image.NewNRGBA(image.Rect(0, 0, len(vals), 1))
+	for i, v := range vals {
+		g8.Pix[i] = v
+		g16.SetGray16(i, 0, color.Gray16{uint16(v) * 257})
+		ga.SetNRGBA(i, 0, color.NRGBA{v, v, v, 100})
+	}
+	ans, err := ConvertToSRGB(gray22, Relative, false, g8)
+	require.NoError(t, err)
+	require.Same(t, g8, ans)
+	ans16, err := ConvertToSRGB(gray22, Relative, false, g16)
+	require.NoError(t, err)
+	require.Same(t, g16, ans16)
+	ansa, err := ConvertToSRGB(gray22, Relative, false, ga)
+	require.NoError(t, err)
+	require.Same(t, ga, ansa)
+	for i, v := range vals {
+		e := expected(float64(v) / 255)
+		require.InDelta(t, e*255, float64(g8.Pix[i]), 1, "gray: %d", v)
+		require.InDelta(t, e*65535, float64(g16.Gray16At(i, 0).Y), 2, "gray: %d", v)
+		c := ga.NRGBAAt(i, 0)
+		require.Equal(t, color.NRGBA{g8.Pix[i], g8.Pix[i], g8.Pix[i], 100}, c, "gray: %d", v)
+	}
+	_, err = ConvertToSRGB(gray22, Relative, false, image.NewCMYK(image.Rect(0, 0, 1, 1)))
+	require.Error(t, err)
+
+	opaque := image.NewNRGBA64(image.Rect(0, 0, 1, 1))
+	opaque.SetNRGBA64(0, 0, color.NRGBA64{0x8000, 0x8000, 0x8000, 0xffff})
+	md := &meta.Data{}
+	md.SetICCProfileData(icc.Gray22Profile.Data())
+	for _, gray_output := range []bool{false, true} {
+		frames := []*Frame{{Image: ClonePreservingType(opaque)}, {Image: ClonePreservingType(ga)}}
+		require.NoError(t, fix_colors(frames, md, NewDecodeConfig(GrayOutput(gray_output))))
+		if gray_output {
+			require.IsType(t, &image.Gray16{}, frames[0].Image)
+			require.InDelta(t, expected(0x8000/65535.), float64(frames[0].Image.(*image.Gray16).Gray16At(0, 0).Y)/65535, 1e-4)
+		} else {
+			require.IsType(t, &image.NRGBA64{}, frames[0].Image)
+		}
+		require.IsType(t, &image.NRGBA{}, frames[1].Image)
+	}
+	// Conversion to a target profile goes via sRGB
+	frames := []*Frame{{Image: ClonePreservingType(g8)}}
+	copy(frames[0].Image.(*image.Gray).Pix, vals)
+	p3, err := icc.DisplayP3Profile.Profile()
+	require.NoError(t, err)
+	require.NoError(t, fix_colors(frames, md, NewDecodeConfig(TargetProfile(p3))))
+	require.InDeltaSlice(t, g8.Pix, frames[0].Image.(*image.Gray).Pix, 1)
+}
+
+func TestSoftProof(t *testing.T) {
+	p, err := icc.ReadProfile("prism/meta/icc/test-profiles/cmyk.icc")
+	require.NoError(t, err)
+	colors := []color.NRGBA{{255, 255, 255, 255}, {128, 128, 128, 255}, {0, 0, 255, 255}, {0, 255, 0, 255}, {0, 0, 0, 0}}
+	img := image.NewNRGBA(image.Rect(0, 0, len(colors), 1))
+	for i, c := range colors {
+		img.SetNRGBA(i, 0, c)
+	}
+	proof := func(simulate_paper_white bool) *image.NRGBA {
+		ans, err := SoftProof(nil, p, nil, Relative, true, simulate_paper_white, ClonePreservingType(img))
+		require.NoError(t, err)
+		return ans.(*image.NRGBA)
+	}
+	relative, paper := proof(false), proof(true)
+	require.Equal(t, color.NRGBA{255, 255, 255, 255}, relative.NRGBAAt(0, 0))
+	w := paper.NRGBAAt(0, 0)
+	require.Less(t, int(w.B), 255, "paper white is not simulated: %v", w)
+	g := relative.NRGBAAt(1, 0)
+	require.InDeltaSlice(t, []uint8{128, 128, 128}, []uint8{g.R, g.G, g.B}, 8)
+	b := relative.NRGBAAt(2, 0)
+	require.Greater(t, int(b.R)+int(b.G), 20, "blue is not desaturated by the proof: %v", b)
+
+	mask, err := GamutWarningMask(nil, p, 2, img)
+	require.NoError(t, err)
+	require.Equal(t, []uint8{0, 0, 255, 255, 0}, mask.Pix)
+
+	_, err = SoftProof(nil, p, p, Relative, true, false, img)
+	require.Error(t, err)
+}
+
+func TestCICPMatrixCoefficients(t *testing.T) {
+	// BT.709 narrow range Y'CbCr for sRGB white, black and red
+	cicp := func(primaries, transfer, matrix, full_range uint8) meta.CodingIndependentCodePoints {
+		return meta.CodingIndependentCodePoints{ColorPrimaries: primaries, TransferCharacteristics: transfer, MatrixCoefficients: matrix, VideoFullRange: full_range, IsSet: true}
+	}
+	p := cicp(1, 13, 1, 0).PipelineToSRGB()
+	require.NotNil(t, p)
+	for _, c := range [][2][3]uint8{{{235, 128, 128}, {255, 255, 255}}, {{16, 128, 128}, {0, 0, 0}}, {{63, 102, 240}, {255, 0, 0}}} {
+		r, g, b := p.Transform(f8(c[0][0]), f8(c[0][1]), f8(c[0][2]))
+		require.InDeltaSlice(t, c[1][:], []uint8{uint8(math.Round(r * 255)), uint8(math.Round(g * 255)), uint8(math.Round(b * 255))}, 1, "%v", c[0])
+	}
+
+	colors := [][3]float64{{1, 1, 1}, {0, 0, 0}, {0.5, 0.5, 0.5}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {0.2, 0.5, 0.7}, {0.9, 0.8, 0.1}}
+	for _, c := range []meta.CodingIndependentCodePoints{
+		cicp(1, 13, 1, 1), cicp(1, 13, 5, 0), cicp(1, 1, 6, 1), cicp(1, 1, 7, 0), cicp(1, 13, 8, 1),
+		cicp(9, 14, 9, 0), cicp(9, 14, 10, 1), cicp(1, 13, 12, 1), cicp(9, 1, 13, 0), cicp(9, 16, 14, 1), cicp(9, 18, 14, 0),
+		cicp(1, 13, 0, 0),
+	} {
+		// Clipping makes the mapping between SDR and HDR invertible
+		tm := meta.ToneMapping{Operator: meta.ToneMapClip}
+		to, from := meta.SRGB.PipelineToWithToneMapping(c, tm), c.PipelineToSRGBWithToneMapping(tm)
+		require.NotNil(t, to, c.String())
+		require.NotNil(t, from, c.String())
+		for _, x := range colors {
+			r, g, b := to.Transform(x[0], x[1], x[2])
+			for _, v := range []float64{r, g, b} {
+				require.True(t, 0 <= v && v <= 1, "%s: %v encoded out of range: %v", c, x, v)
+			}
+			r, g, b = from.Transform(r, g, b)
+			// Full range chroma of 0.5 is clipped to 255
+			require.InDeltaSlice(t, x[:], []float64{r, g, b}, 2./255, "%s: round trip failed", c)
+		}
+	}
+	require.Nil(t, cicp(1, 13, 11, 1).PipelineToSRGB())
+}
+
+func TestToneMapping(t *testing.T) {
+	pq := meta.CodingIndependentCodePoints{ColorPrimaries: 9, TransferCharacteristics: 16, MatrixCoefficients: 0, VideoFullRange: 1, IsSet: true}
+	hlg := pq
+	hlg.TransferCharacteristics = 18
+	pq_code := func(nits float64) float64 {
+		r, _, _ := meta.CodingIndependentCodePoints{ColorPrimaries: 9, TransferCharacteristics: 8, VideoFullRange: 1, IsSet: true}.PipelineToWithToneMapping(pq, meta.ToneMapping{TargetPeak: 10000}).Transform(nits/10000, 0, 0)
+		return r
+	}
+	linear_gray := func(p *icc.Pipeline, v float64) float64 {
+		r, g, b := p.Transform(v, v, v)
+		require.InDelta(t, r, g, 1e-6)
+		require.InDelta(t, r, b, 1e-6)
+		return icc.SRGBCurve().Transform(r)
+	}
+	for _, op := range []meta.ToneMappingOperator{meta.ToneMapBT2390, meta.ToneMapReinhard, meta.ToneMapHable, meta.ToneMapClip} {
+		p := pq.PipelineToSRGBWithToneMapping(meta.ToneMapping{Operator: op, SourcePeak: 1000})
+		require.NotNil(t, p, op.String())
+		prev := -1.
+		for _, nits := range []float64{0, 1, 10, 50, 100, 203, 400, 700, 1000} {
+			l := linear_gray(p, pq_code(nits))
+			if op == meta.ToneMapClip && nits > 203 {
+				require.Equal(t, prev, l, "%s: not clipped at: %v", op, nits)
+			} else {
+				require.Greater(t, l, prev, "%s: not monotonic at: %v", op, nits)
+			}
+			prev = l
+		}
+		require.InDelta(t, 1, prev, 2e-3, "%s: source peak not mapped to target peak", op)
+		if op == meta.ToneMapClip {
+			require.InDelta(t, 100./203., linear_gray(p, pq_code(100)), 2e-3)
+		} else {
+			require.Less(t, linear_gray(p, pq_code(203)), 1., op.String())
+		}
+	}
+	// The BT.2390 EETF does not change luminance below the knee
+	p := pq.PipelineToSRGBWithToneMapping(meta.ToneMapping{TargetPeak: 100, SourcePeak: 1000})
+	require.InDelta(t, 0.1, linear_gray(p, pq_code(10)), 2e-3)
+	// Hue is preserved by scaling all components equally
+	pq_srgb := pq
+	pq_srgb.ColorPrimaries = 1
+	p = pq_srgb.PipelineToSRGBWithToneMapping(meta.ToneMapping{TargetPeak: 100, SourcePeak: 1000})
+	r, g, b := p.Transform(pq_code(1000), pq_code(500), 0)
+	require.InDelta(t, 1, r, 1e-3)
+	require.InDelta(t, 0.5, icc.SRGBCurve().Transform(g), 1e-3)
+	require.InDelta(t, 0, b, 1e-6)
+
+	// HLG reference white is at 75% signal, which is 203 cd/m² on a 1000 cd/m² display
+	p = hlg.PipelineToSRGBWithToneMapping(meta.ToneMapping{Operator: meta.ToneMapClip})
+	require.InDelta(t, 1, linear_gray(p, 0.75), 2e-3)
+	l := linear_gray(p, 0.5)
+	p = hlg.PipelineToSRGBWithToneMapping(meta.ToneMapping{Operator: meta.ToneMapClip, HLGSystemGamma: 1})
+	require.Greater(t, linear_gray(p, 0.5), l, "lower system gamma does not brighten mid tones")
+}
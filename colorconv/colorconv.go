@@ -7,7 +7,7 @@ import (
 
 // This package converts CIE L*a*b* colors defined relative to the D50 white point
 // into sRGB values relative to D65. It performs chromatic
-// adaptation (Bradford), fuses linear matrix transforms where possible for speed,
+// adaptation (Bradford by default), fuses linear matrix transforms where possible for speed,
 // and does a simple perceptually-minded gamut mapping by scaling chroma (a,b)
 // down towards zero until the resulting sRGB is inside the [0,1] cube.
 //
@@ -40,6 +40,8 @@ type ConvertColor struct {
 	combined_XYZ_to_linear_SRGB Mat3
 	previous_matrices           Mat3
 	out_of_gamut_handler        *ConvertColor
+	// nil for the default ChromaReduction gamut mapping
+	gamut_mapper *GamutMapper
 }
 
 func (c ConvertColor) String() string {
@@ -53,8 +55,15 @@ func (cc *ConvertColor) AddPreviousMatrix(a, b, c [3]float64) {
 }
 
 func NewConvertColor(whitepoint_x, whitepoint_y, whitepoint_z, scale float64) (ans *ConvertColor) {
+	return NewConvertColorWithAdaptation(whitepoint_x, whitepoint_y, whitepoint_z, scale, Bradford)
+}
+
+// Same as NewConvertColor() except that the specified chromatic adaptation
+// transform is used to adapt colors from the whitepoint to D65, rather than
+// Bradford
+func NewConvertColorWithAdaptation(whitepoint_x, whitepoint_y, whitepoint_z, scale float64, method ChromaticAdaptationMethod) (ans *ConvertColor) {
 	ans = &ConvertColor{whitepoint: Vec3{whitepoint_x, whitepoint_y, whitepoint_z}}
-	adapt := chromaticAdaptationMatrix(ans.whitepoint, whiteD65)
+	adapt := ChromaticAdaptationMatrix(method, ans.whitepoint, whiteD65)
 	// sRGB (linear) transform matrix from CIE XYZ (D65)
 	var srgbFromXYZ = Mat3{
 		{3.2406 * scale, -1.5372 * scale, -0.4986 * scale},
@@ -69,6 +78,28 @@ func NewConvertColor(whitepoint_x, whitepoint_y, whitepoint_z, scale float64) (a
 	return
 }
 
+// SetGamutMapping sets how colors outside the sRGB gamut are mapped into it by
+// LabToSRGB() and XYZToSRGB(). The default is ChromaReduction.
+func (c *ConvertColor) SetGamutMapping(m GamutMapping) {
+	if m == ChromaReduction {
+		c.gamut_mapper = nil
+		return
+	}
+	h := c.out_of_gamut_handler
+	from_linear := invertMat3(h.combined_XYZ_to_linear_SRGB)
+	c.gamut_mapper = NewGamutMapper(m, c.whitepoint, h.XYZToSRGBNoClamp, func(r, g, b float64) (X, Y, Z float64) {
+		return mulMat3Vec(from_linear, Vec3{srgbToLinear(r), srgbToLinear(g), srgbToLinear(b)})
+	})
+}
+
+// GamutMapping returns the gamut mapping method used by this converter
+func (c *ConvertColor) GamutMapping() GamutMapping {
+	if c.gamut_mapper == nil {
+		return ChromaReduction
+	}
+	return c.gamut_mapper.Method
+}
+
 func NewStandardConvertColor() (ans *ConvertColor) {
 	return NewConvertColor(WhiteD50[0], WhiteD50[1], WhiteD50[2], 1)
 }
@@ -81,6 +112,9 @@ func (c *ConvertColor) LabToSRGB(L, a, b float64) (r, g, bl float64) {
 	if inGamut(r0, g0, b0) {
 		return r0, g0, b0
 	}
+	if c.gamut_mapper != nil {
+		return c.gamut_mapper.Map(c.LabToXYZ(L, a, b))
+	}
 	// gamut map by scaling chroma (a,b) toward 0 while keeping L constant.
 	rm, gm, bm := c.gamutMapChromaScale(L, a, b)
 	return rm, gm, bm
@@ -162,6 +196,9 @@ func (c *ConvertColor) XYZToSRGB(X, Y, Z float64) (r, g, b float64) {
 		return clamp01(r), clamp01(g), clamp01(b)
 	}
 	X, Y, Z = mulMat3Vec(c.previous_matrices, Vec3{X, Y, Z})
+	if c.gamut_mapper != nil {
+		return c.gamut_mapper.Map(X, Y, Z)
+	}
 	c = c.out_of_gamut_handler
 	L, a, bb := c.XYZToLab(X, Y, Z)
 	return c.LabToSRGB(L, a, bb)
@@ -180,6 +217,10 @@ func finv(t float64) float64 {
 
 // LabToXYZ converts Lab (whitepoint) to CIE XYZ values relative to the whitepoint (Y=1).
 func (c *ConvertColor) LabToXYZ(L, a, b float64) (X, Y, Z float64) {
+	return lab_to_xyz(c.whitepoint, L, a, b)
+}
+
+func lab_to_xyz(wt Vec3, L, a, b float64) (X, Y, Z float64) {
 	// Inverse of the CIELAB f function
 	var fy = (L + 16.0) / 116.0
 	var fx = fy + (a / 500.0)
@@ -189,9 +230,9 @@ func (c *ConvertColor) LabToXYZ(L, a, b float64) (X, Y, Z float64) {
 	yr := finv(fy)
 	zr := finv(fz)
 
-	X = xr * c.whitepoint[0]
-	Y = yr * c.whitepoint[1]
-	Z = zr * c.whitepoint[2]
+	X = xr * wt[0]
+	Y = yr * wt[1]
+	Z = zr * wt[2]
 	return
 }
 
@@ -452,34 +493,119 @@ func mulMat3Vec(m Mat3, v Vec3) (x, y, z float64) {
 	return
 }
 
-// chromaticAdaptationMatrix constructs a 3x3 matrix that adapts XYZ values
-// from sourceWhite to targetWhite using the Bradford method.
-func chromaticAdaptationMatrix(sourceWhite, targetWhite Vec3) Mat3 {
-	// Bradford transform matrices (forward and inverse)
-	var (
-		bradford = Mat3{
-			{0.8951, 0.2664, -0.1614},
-			{-0.7502, 1.7135, 0.0367},
-			{0.0389, -0.0685, 1.0296},
+// A chromatic adaptation transform (CAT), used to adapt XYZ colors from one
+// white point to another by scaling them in a cone response domain
+type ChromaticAdaptationMethod int
+
+const (
+	// Scale X, Y and Z independently, as used by the ICC absolute colorimetric intent
+	XYZScaling ChromaticAdaptationMethod = iota
+	Bradford
+	// The CAT from the CIECAM02 color appearance model
+	CAT02
+	// The CAT from the CAM16 color appearance model
+	CAT16
+	// Scaling of the Hunt-Pointer-Estevez cone responses
+	VonKries
+)
+
+func (m ChromaticAdaptationMethod) String() string {
+	switch m {
+	case XYZScaling:
+		return "XYZScaling"
+	case Bradford:
+		return "Bradford"
+	case CAT02:
+		return "CAT02"
+	case CAT16:
+		return "CAT16"
+	case VonKries:
+		return "VonKries"
+	}
+	return fmt.Sprintf("ChromaticAdaptationMethod(%d)", int(m))
+}
+
+// Bradford transform matrices (forward and inverse)
+var (
+	bradford = Mat3{
+		{0.8951, 0.2664, -0.1614},
+		{-0.7502, 1.7135, 0.0367},
+		{0.0389, -0.0685, 1.0296},
+	}
+	bradford_inverted = Mat3{
+		{0.9869929054667121, -0.1470542564209901, 0.1599626516637312},
+		{0.4323052697233945, 0.5183602715367774, 0.049291228212855594},
+		{-0.008528664575177326, 0.04004282165408486, 0.96848669578755},
+	}
+)
+
+// ConeResponse returns the matrix converting XYZ to the cone response domain
+// in which the method scales colors
+func (m ChromaticAdaptationMethod) ConeResponse() Mat3 {
+	switch m {
+	case Bradford:
+		return bradford
+	case CAT02:
+		return Mat3{
+			{0.7328, 0.4296, -0.1624},
+			{-0.7036, 1.6975, 0.0061},
+			{0.0030, 0.0136, 0.9834},
+		}
+	case CAT16:
+		return Mat3{
+			{0.401288, 0.650173, -0.051461},
+			{-0.250268, 1.204414, 0.045854},
+			{-0.002079, 0.048952, 0.953127},
 		}
-		bradford_inverted = Mat3{
-			{0.9869929054667121, -0.1470542564209901, 0.1599626516637312},
-			{0.4323052697233945, 0.5183602715367774, 0.049291228212855594},
-			{-0.008528664575177326, 0.04004282165408486, 0.96848669578755},
+	case VonKries:
+		return Mat3{
+			{0.40024, 0.70760, -0.08081},
+			{-0.22630, 1.16532, 0.04570},
+			{0, 0, 0.91822},
+		}
+	}
+	return Mat3{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+}
+
+func invertMat3(m Mat3) Mat3 {
+	var o Mat3
+	o[0][0] = m[1][1]*m[2][2] - m[1][2]*m[2][1]
+	o[0][1] = m[0][2]*m[2][1] - m[0][1]*m[2][2]
+	o[0][2] = m[0][1]*m[1][2] - m[0][2]*m[1][1]
+	o[1][0] = m[1][2]*m[2][0] - m[1][0]*m[2][2]
+	o[1][1] = m[0][0]*m[2][2] - m[0][2]*m[2][0]
+	o[1][2] = m[0][2]*m[1][0] - m[0][0]*m[1][2]
+	o[2][0] = m[1][0]*m[2][1] - m[1][1]*m[2][0]
+	o[2][1] = m[0][1]*m[2][0] - m[0][0]*m[2][1]
+	o[2][2] = m[0][0]*m[1][1] - m[0][1]*m[1][0]
+	det := 1 / (m[0][0]*o[0][0] + m[0][1]*o[1][0] + m[0][2]*o[2][0])
+	for i := range o {
+		for j := range o[i] {
+			o[i][j] *= det
 		}
-	)
+	}
+	return o
+}
 
-	// Convert whites to LMS using Bradford
-	srcL, srcM, srcS := mulMat3Vec(bradford, sourceWhite)
-	tgtL, tgtM, tgtS := mulMat3Vec(bradford, targetWhite)
+// ChromaticAdaptationMatrix constructs a 3x3 matrix that adapts XYZ values
+// from sourceWhite to targetWhite using the specified method.
+func ChromaticAdaptationMatrix(method ChromaticAdaptationMethod, sourceWhite, targetWhite Vec3) Mat3 {
+	cone := method.ConeResponse()
+	cone_inverted := bradford_inverted
+	if method != Bradford {
+		cone_inverted = invertMat3(cone)
+	}
+	// Convert whites to the cone response domain
+	srcL, srcM, srcS := mulMat3Vec(cone, sourceWhite)
+	tgtL, tgtM, tgtS := mulMat3Vec(cone, targetWhite)
 	// Build diag matrix in-between
 	diag := Mat3{
 		{tgtL / srcL, 0, 0},
 		{0, tgtM / srcM, 0},
 		{0, 0, tgtS / srcS},
 	}
-	// adapt = invBradford * diag * bradford
-	tmp := mulMat3(diag, bradford)           // diag*B
-	adapt := mulMat3(bradford_inverted, tmp) // invB * (diag*B)
+	// adapt = invCone * diag * cone
+	tmp := mulMat3(diag, cone)           // diag*C
+	adapt := mulMat3(cone_inverted, tmp) // invC * (diag*C)
 	return adapt
 }
@@ -124,3 +124,162 @@ func TestGoldenRegression(t *testing.T) {
 		}
 	}
 }
+
+func TestChromaticAdaptation(t *testing.T) {
+	d65, d50 := Vec3{0.95047, 1, 1.08883}, Vec3{0.96422, 1, 0.82521}
+	for _, method := range []ChromaticAdaptationMethod{XYZScaling, Bradford, CAT02, CAT16, VonKries} {
+		m := ChromaticAdaptationMatrix(method, d65, d50)
+		x, y, z := mulMat3Vec(m, d65)
+		if !nearlyEqual(x, d50[0], 1e-12) || !nearlyEqual(y, d50[1], 1e-12) || !nearlyEqual(z, d50[2], 1e-12) {
+			t.Fatalf("%s does not map the source white to the target white: %v", method, Vec3{x, y, z})
+		}
+		r := mulMat3(ChromaticAdaptationMatrix(method, d50, d65), m)
+		for i := range 3 {
+			for j := range 3 {
+				expected := 0.
+				if i == j {
+					expected = 1
+				}
+				if !nearlyEqual(r[i][j], expected, 1e-12) {
+					t.Fatalf("%s adaptation is not inverted by the reverse adaptation: %v", method, r)
+				}
+			}
+		}
+	}
+	// From http://www.brucelindbloom.com/Eqn_ChromAdapt.html
+	expected := Mat3{
+		{1.0478112, 0.0228866, -0.0501270},
+		{0.0295424, 0.9904844, -0.0170491},
+		{-0.0092345, 0.0150436, 0.7521316},
+	}
+	m := ChromaticAdaptationMatrix(Bradford, d65, d50)
+	for i := range 3 {
+		for j := range 3 {
+			if !nearlyEqual(m[i][j], expected[i][j], 1e-6) {
+				t.Fatalf("Bradford adaptation matrix %v != %v", m, expected)
+			}
+		}
+	}
+	m = ChromaticAdaptationMatrix(XYZScaling, d65, d50)
+	if m[0][1] != 0 || m[1][0] != 0 || !nearlyEqual(m[2][2], d50[2]/d65[2], 1e-12) {
+		t.Fatalf("XYZ scaling matrix is not diagonal: %v", m)
+	}
+}
+
+func TestPerceptualSpaces(t *testing.T) {
+	check := func(name string, expected, actual [3]float64, eps float64) {
+		t.Helper()
+		for i := range 3 {
+			if !nearlyEqual(expected[i], actual[i], eps) {
+				t.Fatalf("%s: expected %v got %v", name, expected, actual)
+			}
+		}
+	}
+	v := func(a, b, c float64) [3]float64 { return [3]float64{a, b, c} }
+	// Reference values from https://bottosson.github.io/posts/oklab/ and https://www.hsluv.org
+	check("OKLab white", v(1, 0, 0), v(SrgbToOKLab(1, 1, 1)), 1e-4)
+	check("OKLab red", v(0.62796, 0.22486, 0.12585), v(SrgbToOKLab(1, 0, 0)), 1e-4)
+	check("OKLCH blue", v(0.45201, 0.31321, 264.052), v(SrgbToOKLCH(0, 0, 1)), 1e-3)
+	check("HSLuv red", v(12.17705, 100, 53.23712), v(SrgbToHSLuv(1, 0, 0)), 1e-4)
+	check("HSLuv white", v(0, 0, 100), v(SrgbToHSLuv(1, 1, 1)), 1e-6)
+	check("LCh red", v(53.2408, 104.5518, 39.9990), v(SrgbToLCh(1, 0, 0)), 1e-3)
+	check("linear sRGB", v(0.214041, 0, -0.214041), v(SrgbToLinearSrgb(0.5, 0, -0.5)), 1e-6)
+	// White is defined to have a lightness of 100 in CAM16
+	J, _, _ := SrgbToCAM16UCS(1, 1, 1)
+	if !nearlyEqual(J, 100, 1e-4) {
+		t.Fatalf("CAM16-UCS lightness of white is %v", J)
+	}
+	spaces := []struct {
+		name     string
+		to, from Conversion
+	}{
+		{"OKLab", SrgbToOKLab, OKLabToSrgb},
+		{"OKLCH", SrgbToOKLCH, OKLCHToSrgb},
+		{"LCh", SrgbToLCh, LChToSrgb},
+		{"HSLuv", SrgbToHSLuv, HSLuvToSrgb},
+		{"CAM16-UCS", SrgbToCAM16UCS, CAM16UCSToSrgb},
+		{"linear sRGB", SrgbToLinearSrgb, LinearSrgbToSrgb},
+	}
+	colors := [][3]float64{{0, 0, 0}, {1, 1, 1}, {0.5, 0.5, 0.5}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {0.2, 0.7, 0.4}, {0.9, 0.8, 0.1}, {0.05, 0.02, 0.3}}
+	for _, s := range spaces {
+		for _, c := range colors {
+			check(s.name+" round trip", c, v(s.from(s.to(c[0], c[1], c[2]))), 1e-6)
+		}
+	}
+	// Perceptual lightness is monotonic in the gray level
+	prev := [3]float64{-1, -1, -1}
+	for i := range 11 {
+		g := float64(i) / 10
+		for k, s := range spaces[:3] {
+			if L, _, _ := s.to(g, g, g); L <= prev[k] {
+				t.Fatalf("%s lightness is not increasing at: %v", s.name, g)
+			} else {
+				prev[k] = L
+			}
+		}
+	}
+	buf := []float32{1, 0, 0, 0.5, 1, 1, 1, 1}
+	ConvertSlice(SrgbToOKLab, buf, 4)
+	check("ConvertSlice", v(0.62796, 0.22486, 0.12585), v(float64(buf[0]), float64(buf[1]), float64(buf[2])), 1e-4)
+	if buf[3] != 0.5 || buf[7] != 1 || !nearlyEqual(float64(buf[4]), 1, 1e-4) {
+		t.Fatalf("ConvertSlice changed alpha or did not convert all colors: %v", buf)
+	}
+	for _, h := range []float64{0, 90, 145, 264, 330} {
+		r, g, b := OKLCHToSrgbReduceChroma(0.7, 0.4, h)
+		if !inGamut(r, g, b) {
+			t.Fatalf("OKLCHToSrgbReduceChroma out of gamut for hue %v: %v %v %v", h, r, g, b)
+		}
+		if L, C, hh := SrgbToOKLCH(r, g, b); !nearlyEqual(L, 0.7, 1e-3) || C < 0.05 || math.Abs(math.Remainder(hh-h, 360)) > 1 {
+			t.Fatalf("OKLCHToSrgbReduceChroma did not preserve lightness and hue for %v: %v %v %v", h, L, C, hh)
+		}
+	}
+}
+
+func TestGamutMapping(t *testing.T) {
+	out_of_gamut := [][3]float64{{50, 120, 120}, {80, -150, 50}, {30, 20, -110}, {95, -60, 100}, {20, 80, -60}}
+	for _, m := range []GamutMapping{Clip, ChromaReduction, OKLCHBinarySearch, CuspProjection} {
+		c := NewStandardConvertColor()
+		c.SetGamutMapping(m)
+		if c.GamutMapping() != m {
+			t.Fatalf("gamut mapping not set to: %s", m)
+		}
+		// In gamut colors are unchanged
+		for _, tc := range tableCases[:1] {
+			r, g, b := c.LabToSRGB(tc.L, tc.a, tc.b)
+			if !nearlyEqual(r, tc.R, 1e-9) || !nearlyEqual(g, tc.G, 1e-9) || !nearlyEqual(b, tc.B, 1e-9) {
+				t.Fatalf("%s changed an in gamut color", m)
+			}
+		}
+		for _, lab := range out_of_gamut {
+			r, g, b := c.LabToSRGB(lab[0], lab[1], lab[2])
+			if !inGamut(r, g, b) {
+				t.Fatalf("%s: %v mapped out of gamut to: %v %v %v", m, lab, r, g, b)
+			}
+			X, Y, Z := c.LabToXYZ(lab[0], lab[1], lab[2])
+			if xr, xg, xb := c.XYZToSRGB(X, Y, Z); !nearlyEqual(xr, r, 1e-6) || !nearlyEqual(xg, g, 1e-6) || !nearlyEqual(xb, b, 1e-6) {
+				t.Fatalf("%s: XYZToSRGB() and LabToSRGB() differ for %v", m, lab)
+			}
+			switch m {
+			case Clip:
+				if cr, cg, cb := c.LabToSRGBClamp(lab[0], lab[1], lab[2]); cr != r || cg != g || cb != b {
+					t.Fatalf("Clip did not clamp %v", lab)
+				}
+			case OKLCHBinarySearch, CuspProjection:
+				// The OKLCH hue is preserved, up to the just noticeable
+				// difference allowed by clipping for OKLCHBinarySearch
+				_, C, h := LabToLCh(c.gamut_mapper.xyz_to_oklab(X, Y, Z))
+				_, mC, mh := SrgbToOKLCH(r, g, b)
+				if dH := 2 * math.Sqrt(C*mC) * math.Sin(math.Abs(math.Remainder(h-mh, 360))*math.Pi/360); dH > 0.02 {
+					t.Fatalf("%s: hue of %v changed from %v to %v", m, lab, h, mh)
+				}
+			}
+		}
+	}
+	// The cusp of sRGB for the hue of red is at the lightness of red
+	c := NewStandardConvertColor()
+	c.SetGamutMapping(CuspProjection)
+	L, _, h := SrgbToOKLCH(1, 0, 0)
+	if cusp := c.gamut_mapper.cusps()[int(math.Round(h))]; !nearlyEqual(cusp, L, 0.01) {
+		t.Fatalf("cusp lightness %v for the hue of red, expected: %v", cusp, L)
+	}
+}
@@ -0,0 +1,231 @@
+package colorconv
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+var _ = fmt.Print
+
+// How colors outside the gamut of a device are brought into it
+type GamutMapping int
+
+const (
+	// Clip each channel to [0, 1] independently. Fast, but shifts the hue
+	// and posterises smooth gradients of saturated colors.
+	Clip GamutMapping = iota
+	// Reduce the CIELAB chroma, keeping the lightness and hue constant, until
+	// the color is in gamut
+	ChromaReduction
+	// The OKLCH binary search of CSS Color 4, which reduces the OKLCH chroma
+	// at constant lightness and hue, stopping as soon as clipping the color
+	// changes it by less than a just noticeable difference, see
+	// https://www.w3.org/TR/css-color-4/#binsearch
+	OKLCHBinarySearch
+	// Project colors in OKLCH, at constant hue, towards the neutral color with
+	// the lightness of the cusp of the gamut, the most colorful color of that
+	// hue, see https://bottosson.github.io/posts/gamutclipping/
+	CuspProjection
+)
+
+func (m GamutMapping) String() string {
+	switch m {
+	case Clip:
+		return "Clip"
+	case ChromaReduction:
+		return "ChromaReduction"
+	case OKLCHBinarySearch:
+		return "OKLCHBinarySearch"
+	case CuspProjection:
+		return "CuspProjection"
+	}
+	return fmt.Sprintf("GamutMapping(%d)", int(m))
+}
+
+// The number of hues at which the cusp of the gamut is computed
+const num_cusp_hues = 360
+
+// GamutMapper maps CIE XYZ colors into the gamut of an RGB like device whose
+// gamut is the unit cube.
+type GamutMapper struct {
+	Method GamutMapping
+
+	white       Vec3
+	to_device   func(X, Y, Z float64) (r, g, b float64)
+	from_device func(r, g, b float64) (X, Y, Z float64)
+	// Between XYZ (white) and linear sRGB (D65), for OKLab
+	to_linear_srgb, from_linear_srgb Mat3
+	cusps                            func() *[num_cusp_hues]float64
+}
+
+// NewGamutMapper creates a mapper for colors in CIE XYZ relative to white
+// (Y=1). to_device must convert such colors to the device without clamping,
+// so that out of gamut colors are outside [0, 1], and from_device must be its
+// inverse for colors in gamut.
+func NewGamutMapper(method GamutMapping, white Vec3, to_device func(X, Y, Z float64) (r, g, b float64), from_device func(r, g, b float64) (X, Y, Z float64)) *GamutMapper {
+	ans := &GamutMapper{Method: method, white: white, to_device: to_device, from_device: from_device}
+	ans.to_linear_srgb = mulMat3(xyzToSRGBMatrix, ChromaticAdaptationMatrix(Bradford, white, whiteD65))
+	ans.from_linear_srgb = invertMat3(ans.to_linear_srgb)
+	ans.cusps = sync.OnceValue(ans.find_cusps)
+	return ans
+}
+
+func (m *GamutMapper) String() string {
+	return fmt.Sprintf("GamutMapper{%s white: %.6v}", m.Method, m.white)
+}
+
+func (m *GamutMapper) xyz_to_oklab(X, Y, Z float64) (L, a, b float64) {
+	return LinearSrgbToOKLab(mulMat3Vec(m.to_linear_srgb, Vec3{X, Y, Z}))
+}
+
+func (m *GamutMapper) oklch_to_xyz(L, C, h float64) (X, Y, Z float64) {
+	r, g, b := OKLabToLinearSrgb(LChToLab(L, C, h))
+	return mulMat3Vec(m.from_linear_srgb, Vec3{r, g, b})
+}
+
+func (m *GamutMapper) oklch_in_gamut(L, C, h float64) bool {
+	return inGamut(m.to_device(m.oklch_to_xyz(L, C, h)))
+}
+
+// Map returns the device values of the color, mapped into gamut with the
+// method of this mapper if needed.
+func (m *GamutMapper) Map(X, Y, Z float64) (r, g, b float64) {
+	if r, g, b = m.to_device(X, Y, Z); inGamut(r, g, b) {
+		return
+	}
+	// Colors that are out of gamut only because of rounding errors, such as
+	// white, are clipped
+	const lower, upper = -0.001, 1.001
+	if r >= lower && r <= upper && g >= lower && g <= upper && b >= lower && b <= upper {
+		return clamp01(r), clamp01(g), clamp01(b)
+	}
+	switch m.Method {
+	case ChromaReduction:
+		r, g, b = m.reduce_lab_chroma(X, Y, Z)
+	case OKLCHBinarySearch:
+		r, g, b = m.oklch_binary_search(X, Y, Z)
+	case CuspProjection:
+		r, g, b = m.project_to_cusp(X, Y, Z)
+	}
+	return clamp01(r), clamp01(g), clamp01(b)
+}
+
+func (m *GamutMapper) reduce_lab_chroma(X, Y, Z float64) (r, g, b float64) {
+	L, a, bb := xyz_to_lab(m.white, X, Y, Z)
+	lo, hi := 0.0, 1.0
+	for range 24 {
+		mid := (lo + hi) / 2
+		if inGamut(m.to_device(lab_to_xyz(m.white, L, a*mid, bb*mid))) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return m.to_device(lab_to_xyz(m.white, L, a*lo, bb*lo))
+}
+
+func (m *GamutMapper) oklch_binary_search(X, Y, Z float64) (r, g, b float64) {
+	const jnd, epsilon = 0.02, 0.0001
+	L, C, h := LabToLCh(m.xyz_to_oklab(X, Y, Z))
+	switch {
+	case L >= 1:
+		return 1, 1, 1
+	case L <= 0:
+		return 0, 0, 0
+	}
+	// Clip the color, returning the difference in OKLab from the unclipped color
+	clip := func(C float64) (r, g, b, E float64) {
+		r, g, b = m.to_device(m.oklch_to_xyz(L, C, h))
+		r, g, b = clamp01(r), clamp01(g), clamp01(b)
+		cL, ca, cb := m.xyz_to_oklab(m.from_device(r, g, b))
+		_, a, bb := LChToLab(L, C, h)
+		return r, g, b, math.Sqrt((cL-L)*(cL-L) + (ca-a)*(ca-a) + (cb-bb)*(cb-bb))
+	}
+	r, g, b, E := clip(C)
+	if E < jnd {
+		return
+	}
+	lo, hi, lo_in_gamut := 0.0, C, true
+	for hi-lo > epsilon {
+		chroma := (lo + hi) / 2
+		if lo_in_gamut && m.oklch_in_gamut(L, chroma, h) {
+			lo = chroma
+			continue
+		}
+		if r, g, b, E = clip(chroma); E < jnd {
+			if jnd-E < epsilon {
+				break
+			}
+			lo_in_gamut = false
+			lo = chroma
+		} else {
+			hi = chroma
+		}
+	}
+	return
+}
+
+// The maximum in gamut OKLCH chroma for the lightness and hue
+func (m *GamutMapper) max_chroma(L, h float64) float64 {
+	lo, hi := 0.0, 0.5
+	for hi < 2 && m.oklch_in_gamut(L, hi, h) {
+		lo, hi = hi, hi*2
+	}
+	for range 16 {
+		mid := (lo + hi) / 2
+		if m.oklch_in_gamut(L, mid, h) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// Find the lightness of the cusp for each hue, by maximizing max_chroma()
+// over lightness with a golden section search
+func (m *GamutMapper) find_cusps() *[num_cusp_hues]float64 {
+	ans := [num_cusp_hues]float64{}
+	inv_phi := (math.Sqrt(5) - 1) / 2
+	for i := range ans {
+		h := float64(i) * 360 / num_cusp_hues
+		lo, hi := 0.0, 1.0
+		a, b := hi-inv_phi*(hi-lo), lo+inv_phi*(hi-lo)
+		ca, cb := m.max_chroma(a, h), m.max_chroma(b, h)
+		for range 20 {
+			if ca > cb {
+				hi, b, cb = b, a, ca
+				a = hi - inv_phi*(hi-lo)
+				ca = m.max_chroma(a, h)
+			} else {
+				lo, a, ca = a, b, cb
+				b = lo + inv_phi*(hi-lo)
+				cb = m.max_chroma(b, h)
+			}
+		}
+		ans[i] = (lo + hi) / 2
+	}
+	return &ans
+}
+
+func (m *GamutMapper) project_to_cusp(X, Y, Z float64) (r, g, b float64) {
+	L, C, h := LabToLCh(m.xyz_to_oklab(X, Y, Z))
+	cusps := m.cusps()
+	pos := h * num_cusp_hues / 360
+	i := int(pos) % num_cusp_hues
+	frac := pos - math.Floor(pos)
+	L0 := cusps[i]*(1-frac) + cusps[(i+1)%num_cusp_hues]*frac
+	// Find the point closest to the color on the line from it to the
+	// neutral color with the lightness of the cusp that is in gamut
+	lo, hi := 0.0, 1.0
+	for range 20 {
+		mid := (lo + hi) / 2
+		if m.oklch_in_gamut(L0+mid*(L-L0), mid*C, h) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return m.to_device(m.oklch_to_xyz(L0+lo*(L-L0), lo*C, h))
+}
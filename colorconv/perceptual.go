@@ -0,0 +1,472 @@
+package colorconv
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+var _ = fmt.Print
+
+// Conversions between sRGB and perceptually uniform color spaces. Unless
+// otherwise noted, sRGB values are gamma-encoded in [0, 1], hues are in degrees
+// in [0, 360) and CIE XYZ values are relative to D65 with Y=1 for white.
+
+var srgbToXYZMatrix = Mat3{
+	{0.4124564, 0.3575761, 0.1804375},
+	{0.2126729, 0.7151522, 0.0721750},
+	{0.0193339, 0.1191920, 0.9503041},
+}
+
+var xyzToSRGBMatrix = invertMat3(srgbToXYZMatrix)
+
+func srgbToXYZ(r, g, b float64) (X, Y, Z float64) {
+	return mulMat3Vec(srgbToXYZMatrix, Vec3{srgbToLinear(r), srgbToLinear(g), srgbToLinear(b)})
+}
+
+// XYZToSrgb converts CIE XYZ (D65) to gamma-encoded sRGB, without clamping.
+func XYZToSrgb(X, Y, Z float64) (r, g, b float64) {
+	r, g, b = mulMat3Vec(xyzToSRGBMatrix, Vec3{X, Y, Z})
+	return linearToSRGBComp(r), linearToSRGBComp(g), linearToSRGBComp(b)
+}
+
+// LabToSrgb is the inverse of SrgbToLab(), the result is not clamped.
+func LabToSrgb(L, a, b float64) (r, g, B float64) {
+	return XYZToSrgb(lab_to_xyz(whiteD65, L, a, b))
+}
+
+// A conversion between two three component color spaces, such as SrgbToOKLab
+type Conversion func(a, b, c float64) (x, y, z float64)
+
+// ConvertSlice converts all the colors in buf in place. Each color occupies
+// stride consecutive values, only the first three of which are converted, so
+// that, for example, interleaved RGBA pixels can be converted with a stride
+// of four, leaving alpha unchanged.
+func ConvertSlice[T float32 | float64](f Conversion, buf []T, stride int) {
+	if stride < 3 {
+		panic(fmt.Sprintf("the stride: %d must be at least three", stride))
+	}
+	for i := 0; i+2 < len(buf); i += stride {
+		x, y, z := f(float64(buf[i]), float64(buf[i+1]), float64(buf[i+2]))
+		buf[i], buf[i+1], buf[i+2] = T(x), T(y), T(z)
+	}
+}
+
+// SrgbToLinearSrgb removes the sRGB gamma encoding. Values outside [0, 1] are
+// not clamped, the transfer function is extended symmetrically about zero,
+// as in CSS Color 4.
+func SrgbToLinearSrgb(r, g, b float64) (lr, lg, lb float64) {
+	return srgbToLinearExtended(r), srgbToLinearExtended(g), srgbToLinearExtended(b)
+}
+
+// LinearSrgbToSrgb is the inverse of SrgbToLinearSrgb().
+func LinearSrgbToSrgb(r, g, b float64) (sr, sg, sb float64) {
+	return linearToSRGBExtended(r), linearToSRGBExtended(g), linearToSRGBExtended(b)
+}
+
+func srgbToLinearExtended(c float64) float64 {
+	a := math.Abs(c)
+	if a <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Copysign(math.Pow((a+0.055)/1.055, 2.4), c)
+}
+
+func linearToSRGBExtended(c float64) float64 {
+	a := math.Abs(c)
+	if a <= 0.0031308 {
+		return 12.92 * c
+	}
+	return math.Copysign(1.055*math.Pow(a, 1/2.4)-0.055, c)
+}
+
+// LabToLCh converts rectangular Lab coordinates to polar ones. It works for
+// any Lab like space, for example, CIELAB and OKLab.
+func LabToLCh(L, a, b float64) (l, C, h float64) {
+	return L, math.Hypot(a, b), hp(a, b)
+}
+
+// LChToLab is the inverse of LabToLCh().
+func LChToLab(L, C, h float64) (l, a, b float64) {
+	s, c := math.Sincos(h * math.Pi / 180)
+	return L, C * c, C * s
+}
+
+// SrgbToLCh converts sRGB to CIE LCh(ab) (D65).
+func SrgbToLCh(r, g, b float64) (L, C, h float64) {
+	return LabToLCh(SrgbToLab(r, g, b))
+}
+
+// LChToSrgb is the inverse of SrgbToLCh(), the result is not clamped.
+func LChToSrgb(L, C, h float64) (r, g, b float64) {
+	return LabToSrgb(LChToLab(L, C, h))
+}
+
+// OKLab {{{
+
+// LinearSrgbToOKLab converts linear-light sRGB to OKLab, see
+// https://bottosson.github.io/posts/oklab/
+func LinearSrgbToOKLab(r, g, b float64) (L, A, B float64) {
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+	L = 0.2104542553*l + 0.7936177850*m - 0.0040720468*s
+	A = 1.9779984951*l - 2.4285922050*m + 0.4505937099*s
+	B = 0.0259040371*l + 0.7827717662*m - 0.8086757660*s
+	return
+}
+
+// OKLabToLinearSrgb is the inverse of LinearSrgbToOKLab(), the result is not clamped.
+func OKLabToLinearSrgb(L, A, B float64) (r, g, b float64) {
+	l := L + 0.3963377774*A + 0.2158037573*B
+	m := L - 0.1055613458*A - 0.0638541728*B
+	s := L - 0.0894841775*A - 1.2914855480*B
+	l, m, s = l*l*l, m*m*m, s*s*s
+	r = 4.0767416621*l - 3.3077115913*m + 0.2309699292*s
+	g = -1.2684380046*l + 2.6097574011*m - 0.3413193965*s
+	b = -0.0041960863*l - 0.7034186147*m + 1.7076147010*s
+	return
+}
+
+// SrgbToOKLab converts sRGB to OKLab. L is in [0, 1] and a, b are roughly in [-0.4, 0.4].
+func SrgbToOKLab(r, g, b float64) (L, A, B float64) {
+	return LinearSrgbToOKLab(srgbToLinear(r), srgbToLinear(g), srgbToLinear(b))
+}
+
+// OKLabToSrgb is the inverse of SrgbToOKLab(), the result is not clamped.
+func OKLabToSrgb(L, A, B float64) (r, g, b float64) {
+	r, g, b = OKLabToLinearSrgb(L, A, B)
+	return linearToSRGBComp(r), linearToSRGBComp(g), linearToSRGBComp(b)
+}
+
+// SrgbToOKLCH converts sRGB to OKLCH, the polar form of OKLab.
+func SrgbToOKLCH(r, g, b float64) (L, C, h float64) {
+	return LabToLCh(SrgbToOKLab(r, g, b))
+}
+
+// OKLCHToSrgb is the inverse of SrgbToOKLCH(), the result is not clamped.
+func OKLCHToSrgb(L, C, h float64) (r, g, b float64) {
+	return OKLabToSrgb(LChToLab(L, C, h))
+}
+
+// OKLCHToSrgbReduceChroma converts OKLCH to sRGB, reducing the chroma, while
+// keeping the lightness and hue, until the color is inside the sRGB gamut.
+func OKLCHToSrgbReduceChroma(L, C, h float64) (r, g, b float64) {
+	if L >= 1 {
+		return 1, 1, 1
+	}
+	if L <= 0 {
+		return 0, 0, 0
+	}
+	if r, g, b = OKLCHToSrgb(L, C, h); inGamut(r, g, b) {
+		return
+	}
+	lo, hi := 0.0, C
+	for range 24 {
+		mid := (lo + hi) / 2
+		if r, g, b = OKLCHToSrgb(L, mid, h); inGamut(r, g, b) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	r, g, b = OKLCHToSrgb(L, lo, h)
+	return clamp01(r), clamp01(g), clamp01(b)
+}
+
+// }}}
+
+// HSLuv {{{
+
+// The constants of the reference implementation at https://www.hsluv.org
+var hsluvM = Mat3{
+	{3.240969941904521, -1.537383177570093, -0.498610760293},
+	{-0.96924363628087, 1.87596750150772, 0.041555057407175},
+	{0.055630079696993, -0.20397695888897, 1.056971514242878},
+}
+
+var hsluvMInv = Mat3{
+	{0.41239079926595, 0.35758433938387, 0.18048078840183},
+	{0.21263900587151, 0.71516867876775, 0.072192315360733},
+	{0.019330818715591, 0.11919477979462, 0.95053215224966},
+}
+
+const (
+	hsluvRefU    = 0.19783000664283
+	hsluvRefV    = 0.46831999493879
+	hsluvKappa   = 903.2962962
+	hsluvEpsilon = 0.0088564516
+)
+
+func hsluv_y_to_l(Y float64) float64 {
+	if Y <= hsluvEpsilon {
+		return Y * hsluvKappa
+	}
+	return 116*math.Cbrt(Y) - 16
+}
+
+func hsluv_l_to_y(L float64) float64 {
+	if L <= 8 {
+		return L / hsluvKappa
+	}
+	x := (L + 16) / 116
+	return x * x * x
+}
+
+// The maximum chroma in LCh(uv) of an sRGB color with the specified lightness and hue
+func hsluv_max_chroma(L, h float64) float64 {
+	sub1 := math.Pow(L+16, 3) / 1560896
+	sub2 := sub1
+	if sub1 <= hsluvEpsilon {
+		sub2 = L / hsluvKappa
+	}
+	s, c := math.Sincos(h * math.Pi / 180)
+	ans := math.Inf(1)
+	for _, row := range hsluvM {
+		m1, m2, m3 := row[0], row[1], row[2]
+		for _, t := range []float64{0, 1} {
+			top1 := (284517*m1 - 94839*m3) * sub2
+			top2 := (838422*m3+769860*m2+731718*m1)*L*sub2 - 769860*t*L
+			bottom := (632260*m3-126452*m2)*sub2 + 126452*t
+			slope, intercept := top1/bottom, top2/bottom
+			if length := intercept / (s - slope*c); length >= 0 {
+				ans = min(ans, length)
+			}
+		}
+	}
+	return ans
+}
+
+// SrgbToHSLuv converts sRGB to HSLuv, a human friendly alternative to HSL
+// based on CIELUV, see https://www.hsluv.org. h is in degrees and s, l are in [0, 100].
+func SrgbToHSLuv(r, g, b float64) (h, s, l float64) {
+	X, Y, Z := mulMat3Vec(hsluvMInv, Vec3{srgbToLinear(r), srgbToLinear(g), srgbToLinear(b)})
+	l = hsluv_y_to_l(Y)
+	var u, v float64
+	if divider := X + 15*Y + 3*Z; divider != 0 && l != 0 {
+		u = 13 * l * (4*X/divider - hsluvRefU)
+		v = 13 * l * (9*Y/divider - hsluvRefV)
+	}
+	C := math.Hypot(u, v)
+	if C < 1e-8 {
+		h = 0
+	} else {
+		h = hp(u, v)
+	}
+	switch {
+	case l > 99.9999999:
+		return h, 0, 100
+	case l < 1e-8:
+		return h, 0, 0
+	}
+	return h, C / hsluv_max_chroma(l, h) * 100, l
+}
+
+// HSLuvToSrgb is the inverse of SrgbToHSLuv(), the result is not clamped.
+func HSLuvToSrgb(h, s, l float64) (r, g, b float64) {
+	switch {
+	case l > 99.9999999:
+		return 1, 1, 1
+	case l < 1e-8:
+		return 0, 0, 0
+	}
+	C := hsluv_max_chroma(l, h) / 100 * s
+	_, u, v := LChToLab(l, C, h)
+	Y := hsluv_l_to_y(l)
+	vu := u/(13*l) + hsluvRefU
+	vv := v/(13*l) + hsluvRefV
+	X := -(9 * Y * vu) / ((vu-4)*vv - vu*vv)
+	Z := (9*Y - 15*vv*Y - vv*X) / (3 * vv)
+	r, g, b = mulMat3Vec(hsluvM, Vec3{X, Y, Z})
+	return linearToSRGBComp(r), linearToSRGBComp(g), linearToSRGBComp(b)
+}
+
+// }}}
+
+// CAM16 {{{
+
+// The surround of the viewing conditions of the CAM16 color appearance model
+type CAM16Surround int
+
+const (
+	AverageSurround CAM16Surround = iota
+	DimSurround
+	DarkSurround
+)
+
+func (s CAM16Surround) String() string {
+	switch s {
+	case AverageSurround:
+		return "AverageSurround"
+	case DimSurround:
+		return "DimSurround"
+	case DarkSurround:
+		return "DarkSurround"
+	}
+	return fmt.Sprintf("CAM16Surround(%d)", int(s))
+}
+
+// The factors F, c and Nc of the surround
+func (s CAM16Surround) factors() (F, c, Nc float64) {
+	switch s {
+	case DimSurround:
+		return 0.9, 0.59, 0.9
+	case DarkSurround:
+		return 0.8, 0.525, 0.8
+	}
+	return 1, 0.69, 1
+}
+
+var cam16M = Mat3{
+	{0.401288, 0.650173, -0.051461},
+	{-0.250268, 1.204414, 0.045854},
+	{-0.002079, 0.048952, 0.953127},
+}
+
+var cam16MInv = invertMat3(cam16M)
+
+// The viewing conditions of the CAM16 color appearance model, see Li et al.,
+// "Comprehensive color solutions: CAM16, CAT16, and CAM16-UCS", 2017.
+type CAM16ViewingConditions struct {
+	White               Vec3
+	AdaptingLuminance   float64
+	BackgroundLuminance float64
+	Surround            CAM16Surround
+
+	c, nc, n, z, fl, fl4, nbb, aw, chroma_factor float64
+	d_rgb                                        Vec3
+}
+
+// NewCAM16ViewingConditions creates viewing conditions for the specified
+// white (Y=1), adapting luminance L_A in cd/m² and relative luminance of the
+// background Y_b in [0, 100].
+func NewCAM16ViewingConditions(white Vec3, adapting_luminance, background_luminance float64, surround CAM16Surround) *CAM16ViewingConditions {
+	ans := &CAM16ViewingConditions{White: white, AdaptingLuminance: adapting_luminance, BackgroundLuminance: background_luminance, Surround: surround}
+	F, c, nc := surround.factors()
+	la := adapting_luminance
+	yw := white[1] * 100
+	rw, gw, bw := mulMat3Vec(cam16M, Vec3{white[0] * 100, yw, white[2] * 100})
+	d := max(0, min(1, F*(1-(1/3.6)*math.Exp((-la-42)/92))))
+	ans.d_rgb = Vec3{d*yw/rw + 1 - d, d*yw/gw + 1 - d, d*yw/bw + 1 - d}
+	k := 1 / (5*la + 1)
+	k4 := k * k * k * k
+	ans.fl = 0.2*k4*(5*la) + 0.1*(1-k4)*(1-k4)*math.Cbrt(5*la)
+	ans.fl4 = math.Pow(ans.fl, 0.25)
+	ans.n = background_luminance / yw
+	ans.z = 1.48 + math.Sqrt(ans.n)
+	ans.nbb = 0.725 * math.Pow(ans.n, -0.2)
+	ans.c, ans.nc = c, nc
+	ans.chroma_factor = math.Pow(1.64-math.Pow(0.29, ans.n), 0.73)
+	ra, ga, ba := ans.adapt(rw, gw, bw)
+	ans.aw = (2*ra + ga + ba/20 - 0.305) * ans.nbb
+	return ans
+}
+
+func (vc *CAM16ViewingConditions) String() string {
+	return fmt.Sprintf("CAM16ViewingConditions{White: %v, AdaptingLuminance: %v, BackgroundLuminance: %v, Surround: %s}", vc.White, vc.AdaptingLuminance, vc.BackgroundLuminance, vc.Surround)
+}
+
+// The viewing conditions of sRGB: a D65 white, an adapting luminance of
+// 64 lux / π × 0.2, a background of 20% and an average surround.
+var DefaultCAM16ViewingConditions = sync.OnceValue(func() *CAM16ViewingConditions {
+	return NewCAM16ViewingConditions(whiteD65, 64/math.Pi*0.2, 20, AverageSurround)
+})
+
+// Apply the chromatic adaptation and the non-linear response compression
+func (vc *CAM16ViewingConditions) adapt(r, g, b float64) (float64, float64, float64) {
+	f := func(x float64) float64 {
+		p := math.Pow(vc.fl*math.Abs(x)/100, 0.42)
+		return math.Copysign(400*p/(27.13+p), x) + 0.1
+	}
+	return f(r * vc.d_rgb[0]), f(g * vc.d_rgb[1]), f(b * vc.d_rgb[2])
+}
+
+func (vc *CAM16ViewingConditions) unadapt(r, g, b float64) (float64, float64, float64) {
+	f := func(x float64) float64 {
+		x -= 0.1
+		a := math.Abs(x)
+		return math.Copysign(100/vc.fl*math.Pow(27.13*a/(400-a), 1/0.42), x)
+	}
+	return f(r) / vc.d_rgb[0], f(g) / vc.d_rgb[1], f(b) / vc.d_rgb[2]
+}
+
+// XYZToCAM16 converts CIE XYZ (relative to the white of the viewing
+// conditions, Y=1) to the CAM16 lightness J, colorfulness M and hue h.
+func (vc *CAM16ViewingConditions) XYZToCAM16(X, Y, Z float64) (J, M, h float64) {
+	r, g, b := mulMat3Vec(cam16M, Vec3{X * 100, Y * 100, Z * 100})
+	r, g, b = vc.adapt(r, g, b)
+	a := r - 12*g/11 + b/11
+	bb := (r + g - 2*b) / 9
+	h = hp(a, bb)
+	et := (math.Cos(h*math.Pi/180+2) + 3.8) / 4
+	A := (2*r + g + b/20 - 0.305) * vc.nbb
+	if A <= 0 {
+		return 0, 0, h
+	}
+	J = 100 * math.Pow(A/vc.aw, vc.c*vc.z)
+	t := (50000 / 13 * vc.nc * vc.nbb * et * math.Hypot(a, bb)) / (r + g + 21*b/20)
+	C := math.Pow(t, 0.9) * math.Sqrt(J/100) * vc.chroma_factor
+	return J, C * vc.fl4, h
+}
+
+// CAM16ToXYZ is the inverse of XYZToCAM16().
+func (vc *CAM16ViewingConditions) CAM16ToXYZ(J, M, h float64) (X, Y, Z float64) {
+	if J <= 0 {
+		return 0, 0, 0
+	}
+	C := M / vc.fl4
+	t := math.Pow(C/(math.Sqrt(J/100)*vc.chroma_factor), 1/0.9)
+	hr := h * math.Pi / 180
+	et := (math.Cos(hr+2) + 3.8) / 4
+	A := vc.aw * math.Pow(J/100, 1/(vc.c*vc.z))
+	p2 := A/vc.nbb + 0.305
+	const p3 = 21. / 20
+	var a, b float64
+	if t > 0 {
+		p1 := (50000 / 13 * vc.nc * vc.nbb) * et / t
+		sin, cos := math.Sincos(hr)
+		if math.Abs(sin) >= math.Abs(cos) {
+			p4 := p1 / sin
+			b = p2 * (2 + p3) * (460. / 1403) / (p4 + (2+p3)*(220./1403)*(cos/sin) - 27./1403 + p3*(6300./1403))
+			a = b * cos / sin
+		} else {
+			p5 := p1 / cos
+			a = p2 * (2 + p3) * (460. / 1403) / (p5 + (2+p3)*(220./1403) - (27./1403-p3*(6300./1403))*(sin/cos))
+			b = a * sin / cos
+		}
+	}
+	r, g, bl := vc.unadapt(
+		(460*p2+451*a+288*b)/1403,
+		(460*p2-891*a-261*b)/1403,
+		(460*p2-220*a-6300*b)/1403,
+	)
+	X, Y, Z = mulMat3Vec(cam16MInv, Vec3{r, g, bl})
+	return X / 100, Y / 100, Z / 100
+}
+
+// XYZToCAM16UCS converts CIE XYZ (relative to the white of the viewing
+// conditions, Y=1) to the CAM16-UCS uniform color space J', a', b'.
+func (vc *CAM16ViewingConditions) XYZToCAM16UCS(X, Y, Z float64) (J, a, b float64) {
+	J, M, h := vc.XYZToCAM16(X, Y, Z)
+	M = math.Log1p(0.0228*M) / 0.0228
+	_, a, b = LChToLab(0, M, h)
+	return 1.7 * J / (1 + 0.007*J), a, b
+}
+
+// CAM16UCSToXYZ is the inverse of XYZToCAM16UCS().
+func (vc *CAM16ViewingConditions) CAM16UCSToXYZ(J, a, b float64) (X, Y, Z float64) {
+	_, M, h := LabToLCh(J, a, b)
+	return vc.CAM16ToXYZ(J/(1.7-0.007*J), math.Expm1(0.0228*M)/0.0228, h)
+}
+
+// SrgbToCAM16UCS converts sRGB to CAM16-UCS using DefaultCAM16ViewingConditions().
+func SrgbToCAM16UCS(r, g, b float64) (J, A, B float64) {
+	return DefaultCAM16ViewingConditions().XYZToCAM16UCS(srgbToXYZ(r, g, b))
+}
+
+// CAM16UCSToSrgb is the inverse of SrgbToCAM16UCS(), the result is not clamped.
+func CAM16UCSToSrgb(J, A, B float64) (r, g, b float64) {
+	return XYZToSrgb(DefaultCAM16ViewingConditions().CAM16UCSToXYZ(J, A, B))
+}
+
+// }}}
@@ -0,0 +1,346 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/kovidgoyal/imaging/colorconv"
+	"github.com/kovidgoyal/imaging/rgbaf"
+)
+
+var _ = fmt.Print
+
+// The formula used to compute the color difference between two pixels
+type DeltaEFormula int
+
+const (
+	// CIEDE2000, the most perceptually uniform formula
+	CIEDE2000 DeltaEFormula = iota
+	// CIE76, the Euclidean distance in CIELAB
+	CIE76
+)
+
+func (f DeltaEFormula) String() string {
+	switch f {
+	case CIEDE2000:
+		return "CIEDE2000"
+	case CIE76:
+		return "CIE76"
+	}
+	return fmt.Sprintf("DeltaEFormula(%d)", int(f))
+}
+
+type compare_config struct {
+	background color.Color
+}
+
+// CompareOption sets an optional parameter for the image comparison functions
+type CompareOption func(*compare_config)
+
+// Set the color that images with transparency are composited onto before
+// comparing them. Defaults to white.
+func CompareOverBackground(bg color.Color) CompareOption {
+	return func(c *compare_config) {
+		c.background = bg
+	}
+}
+
+func new_compare_config(opts []CompareOption) *compare_config {
+	ans := &compare_config{background: color.White}
+	for _, o := range opts {
+		o(ans)
+	}
+	return ans
+}
+
+// The non-premultiplied RGB values of the image, composited onto the background
+func (cfg *compare_config) rgb(img image.Image) []float32 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	br, bg, bb, _ := cfg.background.RGBA()
+	bgc := [3]float32{float32(br) / 0xffff, float32(bg) / 0xffff, float32(bb) / 0xffff}
+	src := rgbaf.NewRGBAFScanner(img)
+	ans := make([]float32, w*h*3)
+	if err := run_in_parallel_over_range(0, func(start, limit int) {
+		row := make([]float32, w*4)
+		for y := start; y < limit; y++ {
+			src.ScanFloat(0, y, w, y+1, row)
+			d := ans[y*w*3 : (y+1)*w*3]
+			for x := range w {
+				s := row[x*4 : x*4+4 : x*4+4]
+				a := s[3]
+				for c := range 3 {
+					d[x*3+c] = s[c]*a + bgc[c]*(1-a)
+				}
+			}
+		}
+	}, 0, h); err != nil {
+		panic(err)
+	}
+	return ans
+}
+
+func (cfg *compare_config) load(a, b image.Image) (pa, pb []float32, w, h int, err error) {
+	w, h = a.Bounds().Dx(), a.Bounds().Dy()
+	if bw, bh := b.Bounds().Dx(), b.Bounds().Dy(); bw != w || bh != h {
+		return nil, nil, 0, 0, fmt.Errorf("cannot compare images of different sizes: %dx%d and %dx%d", w, h, bw, bh)
+	}
+	if w == 0 || h == 0 {
+		return nil, nil, 0, 0, fmt.Errorf("cannot compare empty images")
+	}
+	return cfg.rgb(a), cfg.rgb(b), w, h, nil
+}
+
+// The per-pixel color difference between two images, see DeltaE()
+type DeltaEMap struct {
+	Width, Height int
+	// The differences of the pixels, row by row
+	Pix []float32
+}
+
+// The aggregate statistics of a DeltaEMap
+type DeltaEStats struct {
+	Mean, P95, Max float64
+}
+
+// At returns the difference at the specified pixel
+func (m *DeltaEMap) At(x, y int) float64 {
+	return float64(m.Pix[y*m.Width+x])
+}
+
+// Stats returns the mean, 95th percentile and maximum of the differences
+func (m *DeltaEMap) Stats() (ans DeltaEStats) {
+	if len(m.Pix) == 0 {
+		return
+	}
+	sorted := slices.Clone(m.Pix)
+	slices.Sort(sorted)
+	sum := 0.0
+	for _, x := range sorted {
+		sum += float64(x)
+	}
+	ans.Mean = sum / float64(len(sorted))
+	ans.P95 = float64(sorted[int(math.Ceil(0.95*float64(len(sorted))))-1])
+	ans.Max = float64(sorted[len(sorted)-1])
+	return
+}
+
+// HeatMap renders the differences as an image, going from black for no
+// difference, through blue, green and yellow to red for differences of
+// max_delta_e or more.
+func (m *DeltaEMap) HeatMap(max_delta_e float64) *image.NRGBA {
+	ans := image.NewNRGBA(image.Rect(0, 0, m.Width, m.Height))
+	for i, d := range m.Pix {
+		t := min(float64(d)/max_delta_e, 1)
+		c := ans.Pix[i*4 : i*4+4 : i*4+4]
+		c[0] = clamp(255 * min(4*t-2, 1))
+		c[1] = clamp(255 * min(4*t-0.5, 3.5-4*t, 1))
+		c[2] = clamp(255 * min(4*t, 2-4*t, 1))
+		c[3] = 255
+	}
+	return ans
+}
+
+// DeltaE returns the per-pixel color difference between the two images,
+// which must have the same size, using the specified formula. The images are
+// assumed to be in the sRGB color space.
+func DeltaE(a, b image.Image, formula DeltaEFormula, opts ...CompareOption) (*DeltaEMap, error) {
+	pa, pb, w, h, err := new_compare_config(opts).load(a, b)
+	if err != nil {
+		return nil, err
+	}
+	ans := &DeltaEMap{Width: w, Height: h, Pix: make([]float32, w*h)}
+	if err = run_in_parallel_over_range(0, func(start, limit int) {
+		for i := start; i < limit; i++ {
+			p, q := pa[i*3:i*3+3:i*3+3], pb[i*3:i*3+3:i*3+3]
+			L1, a1, b1 := colorconv.SrgbToLab(float64(p[0]), float64(p[1]), float64(p[2]))
+			L2, a2, b2 := colorconv.SrgbToLab(float64(q[0]), float64(q[1]), float64(q[2]))
+			if formula == CIE76 {
+				ans.Pix[i] = float32(math.Sqrt((L1-L2)*(L1-L2) + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2)))
+			} else {
+				ans.Pix[i] = float32(colorconv.DeltaE2000(L1, a1, b1, L2, a2, b2))
+			}
+		}
+	}, 0, w*h); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+// PSNR returns the peak signal to noise ratio, in decibels, between the RGB
+// values of the two images, which must have the same size. Identical images
+// have a PSNR of +Inf.
+func PSNR(a, b image.Image, opts ...CompareOption) (float64, error) {
+	pa, pb, _, _, err := new_compare_config(opts).load(a, b)
+	if err != nil {
+		return 0, err
+	}
+	var mu sync.Mutex
+	sum := 0.0
+	if err = run_in_parallel_over_range(0, func(start, limit int) {
+		s := 0.0
+		for i := start; i < limit; i++ {
+			d := float64(pa[i]) - float64(pb[i])
+			s += d * d
+		}
+		mu.Lock()
+		sum += s
+		mu.Unlock()
+	}, 0, len(pa)); err != nil {
+		return 0, err
+	}
+	if sum == 0 {
+		return math.Inf(1), nil
+	}
+	return 10 * math.Log10(float64(len(pa))/sum), nil
+}
+
+// A plane of luma values for computing SSIM
+type luma_plane struct {
+	w, h int
+	pix  []float64
+}
+
+func as_luma(rgb []float32, w, h int) *luma_plane {
+	ans := &luma_plane{w, h, make([]float64, w*h)}
+	for i := range ans.pix {
+		p := rgb[i*3 : i*3+3 : i*3+3]
+		ans.pix[i] = 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+	}
+	return ans
+}
+
+// Downsample by averaging 2x2 blocks
+func (p *luma_plane) downsample() *luma_plane {
+	ans := &luma_plane{p.w / 2, p.h / 2, make([]float64, (p.w/2)*(p.h/2))}
+	for y := range ans.h {
+		r1, r2 := p.pix[2*y*p.w:], p.pix[(2*y+1)*p.w:]
+		for x := range ans.w {
+			ans.pix[y*ans.w+x] = (r1[2*x] + r1[2*x+1] + r2[2*x] + r2[2*x+1]) / 4
+		}
+	}
+	return ans
+}
+
+// The 11-tap Gaussian window with σ = 1.5 of the SSIM paper
+var ssim_window = sync.OnceValue(func() []float64 {
+	ans := make([]float64, 11)
+	sum := 0.0
+	for i := range ans {
+		x := float64(i - 5)
+		ans[i] = math.Exp(-x * x / (2 * 1.5 * 1.5))
+		sum += ans[i]
+	}
+	for i := range ans {
+		ans[i] /= sum
+	}
+	return ans
+})
+
+// Filter the plane with the separable Gaussian window, replicating edge pixels
+func (p *luma_plane) gaussian(src []float64) []float64 {
+	k := ssim_window()
+	r := len(k) / 2
+	tmp, ans := make([]float64, len(src)), make([]float64, len(src))
+	for y := range p.h {
+		row := src[y*p.w : (y+1)*p.w]
+		for x := range p.w {
+			s := 0.0
+			for i, kv := range k {
+				s += kv * row[max(0, min(x+i-r, p.w-1))]
+			}
+			tmp[y*p.w+x] = s
+		}
+	}
+	for y := range p.h {
+		for x := range p.w {
+			s := 0.0
+			for i, kv := range k {
+				s += kv * tmp[max(0, min(y+i-r, p.h-1))*p.w+x]
+			}
+			ans[y*p.w+x] = s
+		}
+	}
+	return ans
+}
+
+// The mean SSIM and mean contrast-structure term of the two planes, see Wang
+// et al., "Image quality assessment: from error visibility to structural
+// similarity", 2004
+func ssim_of_planes(a, b *luma_plane) (ssim, cs float64) {
+	const c1, c2 = 0.01 * 0.01, 0.03 * 0.03
+	n := len(a.pix)
+	aa, bb, ab := make([]float64, n), make([]float64, n), make([]float64, n)
+	for i, x := range a.pix {
+		y := b.pix[i]
+		aa[i], bb[i], ab[i] = x*x, y*y, x*y
+	}
+	mu_a, mu_b := a.gaussian(a.pix), a.gaussian(b.pix)
+	s_aa, s_bb, s_ab := a.gaussian(aa), a.gaussian(bb), a.gaussian(ab)
+	for i := range n {
+		va, vb := s_aa[i]-mu_a[i]*mu_a[i], s_bb[i]-mu_b[i]*mu_b[i]
+		cov := s_ab[i] - mu_a[i]*mu_b[i]
+		c := (2*cov + c2) / (va + vb + c2)
+		l := (2*mu_a[i]*mu_b[i] + c1) / (mu_a[i]*mu_a[i] + mu_b[i]*mu_b[i] + c1)
+		ssim += l * c
+		cs += c
+	}
+	return ssim / float64(n), cs / float64(n)
+}
+
+func (cfg *compare_config) luma_planes(a, b image.Image) (*luma_plane, *luma_plane, error) {
+	pa, pb, w, h, err := cfg.load(a, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return as_luma(pa, w, h), as_luma(pb, w, h), nil
+}
+
+// SSIM returns the mean structural similarity index of the luma of the two
+// images, which must have the same size. Identical images have an SSIM of 1.
+func SSIM(a, b image.Image, opts ...CompareOption) (float64, error) {
+	la, lb, err := new_compare_config(opts).luma_planes(a, b)
+	if err != nil {
+		return 0, err
+	}
+	ans, _ := ssim_of_planes(la, lb)
+	return ans, nil
+}
+
+// The weights of the scales of MS-SSIM from Wang et al., "Multiscale
+// structural similarity for image quality assessment", 2003
+var msssim_weights = []float64{0.0448, 0.2856, 0.3001, 0.2363, 0.1333}
+
+// MSSSIM returns the multi-scale structural similarity index of the luma of
+// the two images, which must have the same size. Images that are too small
+// for all five scales use as many scales as they can, with the weights of
+// the scales renormalized. Identical images have an MS-SSIM of 1.
+func MSSSIM(a, b image.Image, opts ...CompareOption) (float64, error) {
+	la, lb, err := new_compare_config(opts).luma_planes(a, b)
+	if err != nil {
+		return 0, err
+	}
+	var values []float64
+	for scale := range msssim_weights {
+		ssim, cs := ssim_of_planes(la, lb)
+		if scale == len(msssim_weights)-1 || min(la.w, la.h) < 2*len(ssim_window()) {
+			values = append(values, ssim)
+			break
+		}
+		values = append(values, cs)
+		la, lb = la.downsample(), lb.downsample()
+	}
+	weights := msssim_weights[:len(values)]
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	ans := 1.0
+	for i, v := range values {
+		ans *= math.Pow(max(v, 0), weights[i]/total)
+	}
+	return ans, nil
+}
@@ -0,0 +1,96 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/kovidgoyal/imaging/colorconv"
+)
+
+func TestDeltaE(t *testing.T) {
+	a := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	b := image.NewNRGBA(image.Rect(10, 10, 13, 11))
+	copy(a.Pix, []uint8{10, 20, 30, 255, 200, 100, 50, 255, 255, 0, 0, 0})
+	copy(b.Pix, []uint8{10, 20, 30, 255, 190, 110, 40, 255, 0, 255, 0, 0})
+	for _, formula := range []DeltaEFormula{CIEDE2000, CIE76} {
+		m, err := DeltaE(a, b, formula)
+		if err != nil {
+			t.Fatal(err)
+		}
+		L1, a1, b1 := colorconv.SrgbToLab(200./255, 100./255, 50./255)
+		L2, a2, b2 := colorconv.SrgbToLab(190./255, 110./255, 40./255)
+		expected := colorconv.DeltaE2000(L1, a1, b1, L2, a2, b2)
+		if formula == CIE76 {
+			expected = math.Sqrt((L1-L2)*(L1-L2) + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2))
+		}
+		// Fully transparent pixels are the same when composited onto the background
+		if m.At(0, 0) != 0 || m.At(2, 0) != 0 || !compareFloat64(m.At(1, 0), expected, 1e-4) {
+			t.Fatalf("%s: unexpected differences: %v expected: %v", formula, m.Pix, expected)
+		}
+		if s := m.Stats(); !compareFloat64(s.Max, expected, 1e-4) || !compareFloat64(s.P95, expected, 1e-4) || !compareFloat64(s.Mean, expected/3, 1e-4) {
+			t.Fatalf("%s: unexpected stats: %v", formula, s)
+		}
+	}
+	// Half transparent pixels are composited onto the background
+	a.Pix[11], b.Pix[11] = 128, 128
+	for _, bg := range []color.Color{color.White, color.Black} {
+		m, err := DeltaE(a, b, CIE76, CompareOverBackground(bg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.At(2, 0) < 10 {
+			t.Fatalf("difference of half transparent red and green over %v too small: %v", bg, m.At(2, 0))
+		}
+	}
+	if _, err := DeltaE(a, image.NewNRGBA(image.Rect(0, 0, 2, 1)), CIEDE2000); err == nil {
+		t.Fatalf("no error for images of different sizes")
+	}
+	heat := (&DeltaEMap{Width: 3, Height: 1, Pix: []float32{0, 5, 10}}).HeatMap(10)
+	for x, expected := range []color.NRGBA{{0, 0, 0, 255}, {0, 255, 0, 255}, {255, 0, 0, 255}} {
+		if c := heat.NRGBAAt(x, 0); c != expected {
+			t.Fatalf("heat map color at %d is %v not %v", x, c, expected)
+		}
+	}
+}
+
+func TestPSNRAndSSIM(t *testing.T) {
+	img := testdataFlowersSmallPNG
+	psnr, err := PSNR(img, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(psnr, 1) {
+		t.Fatalf("PSNR of identical images is: %v", psnr)
+	}
+	a, b := New(8, 8, color.NRGBA{100, 100, 100, 255}), New(8, 8, color.NRGBA{100, 100, 100 + 51, 255})
+	if psnr, _ = PSNR(a, b); !compareFloat64(psnr, 10*math.Log10(3/0.04), 1e-3) {
+		t.Fatalf("unexpected PSNR: %v", psnr)
+	}
+	slightly_blurred, blurred := Blur(img, 0.7), Blur(img, 2)
+	for _, f := range []func(a, b image.Image, opts ...CompareOption) (float64, error){SSIM, MSSSIM} {
+		same, err := f(img, img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, _ := f(img, slightly_blurred)
+		y, _ := f(img, blurred)
+		if !compareFloat64(same, 1, 1e-9) || !(x < 1 && y < x && y > 0) {
+			t.Fatalf("unexpected similarity indices: identical: %v slightly blurred: %v blurred: %v", same, x, y)
+		}
+	}
+	// SSIM is insensitive to a small uniform shift in brightness compared to blurring
+	shifted := AdjustBrightness(img, 2)
+	s1, _ := SSIM(img, shifted)
+	s2, _ := SSIM(img, blurred)
+	if s1 < s2 {
+		t.Fatalf("SSIM of brightness shift %v is less than SSIM of blur %v", s1, s2)
+	}
+	if _, err := MSSSIM(img, New(1, 1, color.Black)); err == nil {
+		t.Fatalf("no error for images of different sizes")
+	}
+	if v, err := MSSSIM(a, b); err != nil || v <= 0 || v >= 1 {
+		t.Fatalf("MS-SSIM of small images: %v %v", v, err)
+	}
+}
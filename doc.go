@@ -3,5 +3,10 @@ Package imaging provides basic image processing functions (resize, rotate, crop,
 
 All the image processing functions provided by the package accept any image type that implements image.Image interface
 as an input, and return a new image of *image.NRGBA type (32bit RGBA colors, non-premultiplied alpha).
+
+To keep the precision of the result, use the variants with a Float suffix, such as BlurFloat and AdjustGammaFloat,
+which return a new image of *RGBAF type (float32 RGBA colors, non-premultiplied alpha) whose values are neither
+clipped nor quantized. The *image.NRGBA returning functions process *RGBAF images in floating point as well,
+but reduce the result to 8 bits.
 */
 package imaging
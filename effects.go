@@ -5,6 +5,7 @@ import (
 	"math"
 
 	"github.com/kovidgoyal/imaging/nrgba"
+	"github.com/kovidgoyal/imaging/rgbaf"
 )
 
 func gaussianBlurKernel(x, sigma float64) float64 {
@@ -13,6 +14,8 @@ func gaussianBlurKernel(x, sigma float64) float64 {
 
 // Blur produces a blurred version of the image using a Gaussian function.
 // Sigma parameter must be positive and indicates how much the image will be blurred.
+// RGBAF images are blurred in floating point and only the result is reduced
+// to 8 bits, use BlurFloat to keep the precision of the result.
 //
 // Example:
 //
@@ -21,15 +24,89 @@ func Blur(img image.Image, sigma float64) *image.NRGBA {
 	if sigma <= 0 {
 		return Clone(img)
 	}
+	if f, ok := img.(*RGBAF); ok {
+		return AsNRGBA(BlurFloat(f, sigma))
+	}
 
+	kernel := gaussian_kernel(sigma)
+	return blurVertical(blurHorizontal(img, kernel), kernel)
+}
+
+func gaussian_kernel(sigma float64) []float64 {
 	radius := int(math.Ceil(sigma * 3.0))
 	kernel := make([]float64, radius+1)
 
 	for i := 0; i <= radius; i++ {
 		kernel[i] = gaussianBlurKernel(float64(i), sigma)
 	}
+	return kernel
+}
+
+// BlurFloat is like Blur except that it blurs in floating point, without loss
+// of precision, returning an RGBAF image.
+func BlurFloat(img image.Image, sigma float64) *RGBAF {
+	if sigma <= 0 {
+		return AdjustFuncFloat(img, func(c RGBAFColor) RGBAFColor { return c })
+	}
 
-	return blurVertical(blurHorizontal(img, kernel), kernel)
+	kernel := gaussian_kernel(sigma)
+	return blurFloat(blurFloat(AsRGBAF(img), kernel, true), kernel, false)
+}
+
+// BlurLinearLight is like Blur except that it blurs in linear light rather
+// than in gamma-encoded sRGB, in floating point, with pixels weighted by their
+// alpha. This avoids the dark halos that blurring sRGB values produces
+// around bright details. The image must be in the sRGB color space.
+func BlurLinearLight(img image.Image, sigma float64) *image.NRGBA {
+	if sigma <= 0 {
+		return Clone(img)
+	}
+	kernel := gaussian_kernel(sigma)
+	ans := blurFloat(blurFloat(to_linear_light(img), kernel, true), kernel, false)
+	return AsNRGBA(from_linear_light(ans))
+}
+
+func blurFloat(img *RGBAF, kernel []float64, horizontal bool) *RGBAF {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dst := rgbaf.NewRGBAF(image.Rect(0, 0, w, h))
+	radius := len(kernel) - 1
+	// Blur lines of n pixels spaced stride apart, lines are line_stride apart
+	n, num_lines, stride, line_stride, dstride, dline_stride := w, h, 4, img.Stride, 4, dst.Stride
+	if !horizontal {
+		n, num_lines, stride, line_stride, dstride, dline_stride = h, w, img.Stride, 4, dst.Stride, 4
+	}
+
+	if err := run_in_parallel_over_range(0, func(start, limit int) {
+		for l := start; l < limit; l++ {
+			src, d := img.Pix[l*line_stride:], dst.Pix[l*dline_stride:]
+			for x := range n {
+				minv := max(0, x-radius)
+				maxv := min(x+radius, n-1)
+				var r, g, b, a, wsum float64
+				for ix := minv; ix <= maxv; ix++ {
+					i := ix * stride
+					weight := kernel[absint(x-ix)]
+					wsum += weight
+					s := src[i : i+4 : i+4]
+					wa := float64(s[3]) * weight
+					r += float64(s[0]) * wa
+					g += float64(s[1]) * wa
+					b += float64(s[2]) * wa
+					a += wa
+				}
+				if a != 0 {
+					aInv := 1 / a
+					j := x * dstride
+					p := d[j : j+4 : j+4]
+					p[0], p[1], p[2], p[3] = float32(r*aInv), float32(g*aInv), float32(b*aInv), float32(a/wsum)
+				}
+			}
+		}
+	}, 0, num_lines); err != nil {
+		panic(err)
+	}
+
+	return dst
 }
 
 func blurHorizontal(img image.Image, kernel []float64) *image.NRGBA {
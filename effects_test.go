@@ -236,3 +236,23 @@ func BenchmarkSharpen(b *testing.B) {
 		Sharpen(testdataBranchesJPG, 3)
 	}
 }
+
+func TestBlurFloat(t *testing.T) {
+	got := BlurFloat(testdataFlowersSmallPNG, 1.5)
+	if !compareNRGBA(got.ToNRGBA(), Blur(testdataFlowersSmallPNG, 1.5), 1) {
+		t.Fatalf("float blur differs from 8 bit blur")
+	}
+	if !compareNRGBA(Blur(AsRGBAF(testdataFlowersSmallPNG), 1.5), Blur(testdataFlowersSmallPNG, 1.5), 1) {
+		t.Fatalf("blurring an RGBAF image differs from blurring in 8 bits")
+	}
+	// 16 bit precision is preserved
+	src := image.NewNRGBA64(image.Rect(0, 0, 7, 5))
+	for i := range src.Pix {
+		src.Pix[i] = []uint8{0x12, 0x34}[i&1]
+	}
+	for _, c := range BlurFloat(src, 2).Pix {
+		if !compareFloat64(float64(c), 0x1234/65535., 1e-6) {
+			t.Fatalf("precision not preserved: %v", c)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+
+	"github.com/kovidgoyal/imaging/prism/meta"
+	"github.com/kovidgoyal/imaging/prism/meta/icc"
+)
+
+var _ = fmt.Print
+
+// ImageColorSpace identifies the color space that the pixels of an Image
+// are in, when it is not sRGB, either with an ICC profile or with coding
+// independent code points (CICP).
+type ImageColorSpace struct {
+	// The ICC profile of the color space, ignored when CICP is set
+	Profile *icc.Profile
+	// The code points of the color space, used when CICP.IsSet is true
+	CICP meta.CodingIndependentCodePoints
+	// The rendering intent and blackpoint compensation used to convert
+	// sRGB colors, such as backgrounds, into this color space
+	RenderingIntent        icc.RenderingIntent
+	BlackpointCompensation bool
+}
+
+// IsSRGB returns true if the color space is sRGB, a nil color space is sRGB
+func (s *ImageColorSpace) IsSRGB() bool {
+	switch {
+	case s == nil:
+		return true
+	case s.CICP.IsSet:
+		return s.CICP.IsSRGB()
+	case s.Profile != nil:
+		return s.Profile.IsSRGB()
+	}
+	return true
+}
+
+// Whether the pixels in this color space are RGB, as opposed to gray or CMYK
+func (s *ImageColorSpace) is_rgb() bool {
+	return s.IsSRGB() || s.CICP.IsSet || s.Profile.Header.DataColorSpace == icc.ColorSpaceRGB
+}
+
+func (s *ImageColorSpace) is_cmyk() bool {
+	return !s.IsSRGB() && !s.CICP.IsSet && s.Profile.Header.DataColorSpace == icc.ColorSpaceCMYK
+}
+
+func (s *ImageColorSpace) is_gray() bool {
+	return !s.IsSRGB() && !s.CICP.IsSet && s.Profile.Header.DataColorSpace == icc.ColorSpaceGray
+}
+
+func (s *ImageColorSpace) String() string {
+	switch {
+	case s.IsSRGB():
+		return "sRGB"
+	case s.CICP.IsSet:
+		return s.CICP.String()
+	}
+	if d, err := s.Profile.Description(); err == nil && d != "" {
+		return fmt.Sprintf("ICC profile: %s", d)
+	}
+	return "ICC profile"
+}
+
+// ICCProfileData returns the serialized ICC profile of this color space, for
+// embedding in images. Code points are converted to an equivalent
+// matrix/TRC profile.
+func (s *ImageColorSpace) ICCProfileData() ([]byte, error) {
+	if s.CICP.IsSet {
+		return s.CICP.ICCProfile()
+	}
+	return s.Profile.Encode()
+}
+
+// The ICC profile of this color space, converting code points, if needed
+func (s *ImageColorSpace) icc_profile() (*icc.Profile, error) {
+	if !s.CICP.IsSet {
+		return s.Profile, nil
+	}
+	data, err := s.ICCProfileData()
+	if err != nil {
+		return nil, err
+	}
+	return icc.NewProfileReader(bytes.NewReader(data)).ReadProfile()
+}
+
+func (s *ImageColorSpace) pipeline_from_srgb() (*icc.Pipeline, error) {
+	if s.CICP.IsSet {
+		if p := meta.SRGB.PipelineTo(s.CICP); p != nil {
+			return p, nil
+		}
+		return nil, fmt.Errorf("cannot convert colors to unknown %s", s.CICP)
+	}
+	return srgb_to_profile_pipeline(s.Profile, s.RenderingIntent, s.BlackpointCompensation)
+}
+
+// FromSRGB converts the sRGB color c into this color space. Alpha is
+// unchanged. The result is a color.NRGBA64 for RGB and gray color spaces,
+// with equal channels for gray, and a color.CMYK for CMYK color spaces.
+func (s *ImageColorSpace) FromSRGB(c color.Color) (color.Color, error) {
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	if s.IsSRGB() {
+		return n, nil
+	}
+	p, err := s.pipeline_from_srgb()
+	if err != nil {
+		return nil, err
+	}
+	var in, out [4]float64
+	in[0], in[1], in[2] = float64(n.R)/0xffff, float64(n.G)/0xffff, float64(n.B)/0xffff
+	p.TransformGeneral(out[:], in[:])
+	switch _, num := p.IOSig(); num {
+	case 1:
+		v := clamp16(out[0] * 0xffff)
+		return color.NRGBA64{R: v, G: v, B: v, A: n.A}, nil
+	case 3:
+		return color.NRGBA64{R: clamp16(out[0] * 0xffff), G: clamp16(out[1] * 0xffff), B: clamp16(out[2] * 0xffff), A: n.A}, nil
+	case 4:
+		return color.CMYK{C: clamp(out[0] * 0xff), M: clamp(out[1] * 0xff), Y: clamp(out[2] * 0xff), K: clamp(out[3] * 0xff)}, nil
+	default:
+		return nil, fmt.Errorf("cannot convert colors to %s with %d channels", s, num)
+	}
+}
+
+// ColorFromSRGB converts the sRGB color c into the color space of this image,
+// for use as a background or overlay color. If the conversion fails, c is
+// returned unchanged.
+func (self *Image) ColorFromSRGB(c color.Color) color.Color {
+	if self.ColorSpace.IsSRGB() {
+		return c
+	}
+	if ans, err := self.ColorSpace.FromSRGB(c); err == nil {
+		return ans
+	}
+	return c
+}
+
+// The color space of the pixels of an image decoded with cfg, nil for sRGB.
+// Images whose colors are not converted are in the color space of their
+// metadata, if any. Embedded ICC profiles that cannot be parsed or that are
+// not for RGB, gray or CMYK colors are ignored, leaving such images untagged.
+func (cfg *decodeConfig) color_space(md *meta.Data) *ImageColorSpace {
+	ans := &ImageColorSpace{RenderingIntent: cfg.rendering_intent, BlackpointCompensation: cfg.use_blackpoint_compensation}
+	switch {
+	case cfg.outputColorspace != NO_CHANGE_OF_COLORSPACE && cfg.target_profile != nil:
+		ans.Profile = cfg.target_profile
+	case cfg.outputColorspace != NO_CHANGE_OF_COLORSPACE || md == nil:
+		return nil
+	case md.CICP.IsSet:
+		ans.CICP = md.CICP
+	default:
+		p, err := md.ICCProfile()
+		if err != nil || p == nil {
+			return nil
+		}
+		switch p.Header.DataColorSpace {
+		case icc.ColorSpaceRGB, icc.ColorSpaceGray, icc.ColorSpaceCMYK:
+		default:
+			return nil
+		}
+		ans.Profile = p
+	}
+	if ans.IsSRGB() {
+		return nil
+	}
+	return ans
+}
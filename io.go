@@ -1,6 +1,7 @@
 package imaging
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"image"
@@ -17,6 +18,7 @@ import (
 	"time"
 
 	"github.com/kovidgoyal/imaging/apng"
+	"github.com/kovidgoyal/imaging/colorconv"
 	myjpeg "github.com/kovidgoyal/imaging/jpeg"
 	"github.com/kovidgoyal/imaging/magick"
 	_ "github.com/kovidgoyal/imaging/netpbm"
@@ -70,6 +72,8 @@ type ColorSpaceType int
 const (
 	NO_CHANGE_OF_COLORSPACE ColorSpaceType = iota
 	SRGB_COLORSPACE
+	// The colorspace of the profile specified with TargetProfile()
+	TARGET_PROFILE_COLORSPACE
 )
 const (
 	Relative   icc.RenderingIntent = icc.RelativeColorimetricRenderingIntent
@@ -89,6 +93,11 @@ type decodeConfig struct {
 	backends                    []Backend
 	rendering_intent            icc.RenderingIntent
 	use_blackpoint_compensation bool
+	target_profile              *icc.Profile
+	tone_mapping                meta.ToneMapping
+	gray_output                 bool
+	gamut_mapping               *colorconv.GamutMapping
+	linear_light_resize         bool
 }
 
 // DecodeOption sets an optional parameter for the Decode and Open functions.
@@ -106,6 +115,9 @@ func AutoOrientation(enabled bool) DecodeOption {
 // ColorSpace returns a DecodeOption that sets the colorspace that the
 // opened image will be in. Defaults to sRGB. If the image has an embedded ICC
 // color profile it is automatically used to convert colors to sRGB if needed.
+// With NO_CHANGE_OF_COLORSPACE, Image.ColorSpace is set to the embedded color
+// space of the image, if any, so that background colors are converted into it
+// and it is embedded when encoding.
 func ColorSpace(cs ColorSpaceType) DecodeOption {
 	return func(c *decodeConfig) {
 		c.outputColorspace = cs
@@ -134,6 +146,16 @@ func ResizeCallback(f ResizeCallbackFunction) DecodeOption {
 	}
 }
 
+// Set whether the image is resized in linear light, with a floating point
+// intermediate, when resizing it with ResizeCallback(), see
+// ResizeLinearLight(). This is slower but avoids darkening fine detail and
+// dark fringes around high contrast edges.
+func LinearLightResize(enable bool) DecodeOption {
+	return func(c *decodeConfig) {
+		c.linear_light_resize = enable
+	}
+}
+
 // Specify which backends to use to try to load the image, successively. If no backends are specified, the default
 // set are used.
 func Backends(backends ...Backend) DecodeOption {
@@ -156,6 +178,50 @@ func BlackpointCompensation(enable bool) DecodeOption {
 	}
 }
 
+// Set an ICC color profile that the colors of the opened image will be
+// converted to, for example, Display P3 for wide gamut output. The profile
+// must have an RGB device color space. Profiles for common color spaces are
+// available via icc.WellKnownProfile, for example, icc.DisplayP3Profile.Profile().
+// Image.ColorSpace is set to the profile.
+func TargetProfile(p *icc.Profile) DecodeOption {
+	return func(c *decodeConfig) {
+		c.target_profile = p
+		c.outputColorspace = TARGET_PROFILE_COLORSPACE
+	}
+}
+
+// Set how HDR images using the PQ or HLG transfer functions are tone mapped
+// when converting them to SDR. Parameters that are not set default to values
+// from the HDR metadata in the image, if any, see meta.ToneMapping for
+// details. By default the BT.2390 operator is used.
+func ToneMapping(t meta.ToneMapping) DecodeOption {
+	return func(c *decodeConfig) {
+		c.tone_mapping = t
+	}
+}
+
+// Set whether opaque images with a gray ICC profile are returned as
+// *image.Gray or *image.Gray16 when converting them to sRGB, even if they were
+// decoded with RGB channels. Images with transparency remain RGBA as there is
+// no gray and alpha image type.
+func GrayOutput(enable bool) DecodeOption {
+	return func(c *decodeConfig) {
+		c.gray_output = enable
+	}
+}
+
+// Set how colors outside the gamut of the output color space are mapped into
+// it when converting the colors of the opened image with its ICC profile. By
+// default colors are clipped when converting to a TargetProfile() and their
+// CIELAB chroma is reduced when converting to sRGB. Mapping the gamut avoids
+// the posterisation of smooth gradients of saturated colors that clipping
+// causes for wide gamut images.
+func GamutMapping(m colorconv.GamutMapping) DecodeOption {
+	return func(c *decodeConfig) {
+		c.gamut_mapping = &m
+	}
+}
+
 func NewDecodeConfig(opts ...DecodeOption) (cfg *decodeConfig) {
 	cfg = &decodeConfig{
 		autoOrientation:  true,
@@ -173,19 +239,36 @@ func NewDecodeConfig(opts ...DecodeOption) (cfg *decodeConfig) {
 	if len(cfg.backends) == 0 {
 		cfg.backends = default_backends
 	}
+	if cfg.gamut_mapping != nil && cfg.target_profile != nil {
+		cfg.target_profile = cfg.target_profile.WithGamutMapping(*cfg.gamut_mapping)
+	}
 	return
 }
 
+// Convert colors to sRGB with the ICC profile, using the configured gamut mapping, if any
+func (cfg *decodeConfig) convert_to_srgb(p *icc.Profile, img image.Image) (image.Image, error) {
+	if cfg.gamut_mapping == nil || p.IsSRGB() || p.Header.DataColorSpace == icc.ColorSpaceGray {
+		return ConvertToSRGB(p, cfg.rendering_intent, cfg.use_blackpoint_compensation, img)
+	}
+	srgb, err := icc.SRGBProfile.Profile()
+	if err != nil {
+		return nil, err
+	}
+	srgb.GamutMapping = *cfg.gamut_mapping
+	return ConvertBetweenProfiles(p, srgb, cfg.rendering_intent, cfg.use_blackpoint_compensation, img)
+}
+
 func (cfg *decodeConfig) magick_callback(w, h int) (ro magick.RenderOptions) {
 	ro.AutoOrient = cfg.autoOrientation
 	if cfg.resize != nil {
 		nw, nh := cfg.resize(w, h)
 		if nw != w || nh != h {
 			ro.ResizeTo.X, ro.ResizeTo.Y = nw, nh
+			ro.LinearLightResize = cfg.linear_light_resize
 		}
 	}
 	ro.Background = cfg.background
-	ro.ToSRGB = cfg.outputColorspace == SRGB_COLORSPACE
+	ro.ToSRGB = cfg.outputColorspace != NO_CHANGE_OF_COLORSPACE
 	ro.Transform = cfg.transform
 	ro.RenderingIntent = cfg.rendering_intent
 	ro.BlackpointCompensation = cfg.use_blackpoint_compensation
@@ -208,37 +291,110 @@ const (
 	orientationRotate90    = 8
 )
 
+func convert_frames(images []*Frame, p *icc.Pipeline) (err error) {
+	for _, f := range images {
+		if f.Image, err = convert(p, f.Image); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func fix_colors(images []*Frame, md *meta.Data, cfg *decodeConfig) error {
-	var err error
-	if md == nil || cfg.outputColorspace != SRGB_COLORSPACE {
+	if md == nil || cfg.outputColorspace == NO_CHANGE_OF_COLORSPACE {
 		return nil
 	}
-	if md.CICP.IsSet && !md.CICP.IsSRGB() {
-		p := md.CICP.PipelineToSRGB()
+	if cfg.target_profile != nil && !cfg.target_profile.IsSRGB() {
+		return convert_colors_to_target_profile(images, md, cfg)
+	}
+	// cICP takes precedence over iCCP, sRGB, gAMA and cHRM
+	if md.CICP.IsSet {
+		if md.CICP.IsSRGB() {
+			return nil
+		}
+		p := md.CICP.PipelineToSRGBWithToneMapping(cfg.tone_mapping.WithDefaults(md.HDR))
 		if p == nil {
 			return fmt.Errorf("cannot convert colorspace, unknown %s", md.CICP)
 		}
-		for _, f := range images {
-			if f.Image, err = convert(p, f.Image); err != nil {
-				return err
-			}
-		}
-		return nil
+		return convert_frames(images, p)
 	}
 	profile, err := md.ICCProfile()
 	if err != nil {
 		return err
 	}
 	if profile != nil {
+		is_gray := profile.Header.DataColorSpace == icc.ColorSpaceGray
 		for _, f := range images {
-			if f.Image, err = ConvertToSRGB(profile, cfg.rendering_intent, cfg.use_blackpoint_compensation, f.Image); err != nil {
+			if f.Image, err = cfg.convert_to_srgb(profile, f.Image); err != nil {
 				return err
 			}
+			if is_gray && cfg.gray_output {
+				f.Image = as_gray(f.Image)
+			}
 		}
+		return nil
+	}
+	if p := md.PNGColorChunksPipelineToSRGB(); p != nil {
+		return convert_frames(images, p)
 	}
 	return nil
 }
 
+// Images described by code points or gAMA and cHRM are converted via
+// unclamped linear light in their own primaries so that colors outside sRGB
+// are preserved, untagged images are assumed to be sRGB.
+func convert_colors_to_target_profile(images []*Frame, md *meta.Data, cfg *decodeConfig) error {
+	var to_linear *icc.Pipeline
+	var linear_primaries meta.Primaries
+	// cICP takes precedence over iCCP, sRGB, gAMA and cHRM
+	switch {
+	case md.CICP.IsSRGB():
+	case md.CICP.IsSet:
+		if to_linear, linear_primaries = md.CICP.PipelineToLinearWithToneMapping(cfg.tone_mapping.WithDefaults(md.HDR)); to_linear == nil {
+			return fmt.Errorf("cannot convert colorspace, unknown %s", md.CICP)
+		}
+	default:
+		profile, err := md.ICCProfile()
+		if err != nil {
+			return err
+		}
+		switch {
+		case profile != nil && profile.Header.DataColorSpace == icc.ColorSpaceGray:
+			// Gray images are converted via sGray and then as sRGB
+			for _, f := range images {
+				if f.Image, err = ConvertToSRGB(profile, cfg.rendering_intent, cfg.use_blackpoint_compensation, f.Image); err != nil {
+					return err
+				}
+			}
+		case profile != nil:
+			for _, f := range images {
+				if f.Image, err = ConvertBetweenProfiles(profile, cfg.target_profile, cfg.rendering_intent, cfg.use_blackpoint_compensation, f.Image); err != nil {
+					return err
+				}
+			}
+			return nil
+		case !md.HasSRGBChunk && !md.GammaAndChromaticitiesAreSRGB():
+			to_linear, linear_primaries = md.GammaAndChromaticitiesPipelineToLinear()
+		}
+	}
+	if to_linear == nil {
+		p, err := srgb_to_profile_pipeline(cfg.target_profile, cfg.rendering_intent, cfg.use_blackpoint_compensation)
+		if err != nil {
+			return err
+		}
+		return convert_frames(images, p)
+	}
+	linear, err := meta.LinearProfile(linear_primaries)
+	if err != nil {
+		return err
+	}
+	p, err := linear.CreateTransformerToProfile(cfg.target_profile, cfg.rendering_intent, cfg.use_blackpoint_compensation, 3, true, true)
+	if err != nil {
+		return err
+	}
+	return convert_frames(images, to_linear.Weld(p, true))
+}
+
 func fix_orientation(ans *Image, md *meta.Data, cfg *decodeConfig) error {
 	if md == nil || !cfg.autoOrientation {
 		return nil
@@ -321,6 +477,7 @@ func decode_all_go(r io.Reader, md *meta.Data, cfg *decodeConfig) (ans *Image, e
 		if ans == nil || err != nil || ans.Metadata == nil {
 			return
 		}
+		ans.ColorSpace = cfg.color_space(ans.Metadata)
 		if cfg.outputColorspace != NO_CHANGE_OF_COLORSPACE {
 			if err = fix_colors(ans.Frames, ans.Metadata, cfg); err != nil {
 				return
@@ -341,7 +498,11 @@ func decode_all_go(r io.Reader, md *meta.Data, cfg *decodeConfig) (ans *Image, e
 			w, h := ans.Bounds().Dx(), ans.Bounds().Dy()
 			nw, nh := cfg.resize(w, h)
 			if nw != w || nh != h {
-				ans.Resize(nw, nh, Lanczos)
+				if cfg.linear_light_resize {
+					ans.ResizeLinearLight(nw, nh, Lanczos)
+				} else {
+					ans.Resize(nw, nh, Lanczos)
+				}
 			}
 		}
 		ans.Metadata.PixelWidth = uint32(ans.Bounds().Dx())
@@ -406,11 +567,33 @@ func decode_all_go(r io.Reader, md *meta.Data, cfg *decodeConfig) (ans *Image, e
 }
 
 func decode_all_magick(inp *types.Input, md *meta.Data, cfg *decodeConfig) (ans *Image, err error) {
-	mi, err := magick.OpenAll(inp, md, cfg.magick_callback)
+	cs := cfg.color_space(md)
+	if cfg.outputColorspace == NO_CHANGE_OF_COLORSPACE && cfg.background != nil && cs != nil {
+		// ImageMagick composes onto the background in the color space of the image
+		c := *cfg
+		bg := color.RGBA64Model.Convert((&Image{ColorSpace: cs}).ColorFromSRGB(*cfg.background)).(color.RGBA64)
+		c.background = &bg
+		cfg = &c
+	}
+	callback := cfg.magick_callback
+	if cfg.outputColorspace != NO_CHANGE_OF_COLORSPACE && cfg.target_profile != nil && !cfg.target_profile.IsSRGB() {
+		// Have ImageMagick convert directly to the target profile rather than
+		// via sRGB, which would clip colors outside sRGB
+		target, err := cfg.target_profile.Encode()
+		if err != nil {
+			return nil, err
+		}
+		callback = func(w, h int) magick.RenderOptions {
+			ro := cfg.magick_callback(w, h)
+			ro.TargetProfile = target
+			return ro
+		}
+	}
+	mi, err := magick.OpenAll(inp, md, callback)
 	if err != nil {
 		return nil, err
 	}
-	ans = &Image{Metadata: md}
+	ans = &Image{Metadata: md, ColorSpace: cs}
 	for _, f := range mi.Frames {
 		fr := &Frame{
 			Number: uint(f.Number), TopLeft: image.Pt(f.Left, f.Top), Image: f.Img,
@@ -572,6 +755,12 @@ type encodeConfig struct {
 	gifQuantizer        draw.Quantizer
 	gifDrawer           draw.Drawer
 	pngCompressionLevel png.CompressionLevel
+	pngText             []meta.TextEntry
+	resolution          meta.Resolution
+	cmyk_profile        *icc.Profile
+	cmyk_intent         icc.RenderingIntent
+	cmyk_bpc            bool
+	color_space         *ImageColorSpace
 }
 
 var defaultEncodeConfig = encodeConfig{
@@ -625,6 +814,127 @@ func PNGCompressionLevel(level png.CompressionLevel) EncodeOption {
 	}
 }
 
+// PNGText returns an EncodeOption that sets textual metadata to be written
+// into PNG images as tEXt, zTXt or iTXt chunks.
+func PNGText(entries ...meta.TextEntry) EncodeOption {
+	return func(c *encodeConfig) {
+		c.pngText = entries
+	}
+}
+
+// PhysicalResolution returns an EncodeOption that sets the physical resolution
+// (DPI) to be written into images for the JPEG, PNG, TIFF and BMP formats.
+func PhysicalResolution(r meta.Resolution) EncodeOption {
+	return func(c *encodeConfig) {
+		c.resolution = r
+	}
+}
+
+// CMYKOutput returns an EncodeOption that causes JPEG and TIFF images to be
+// written as CMYK with the specified profile, which must have a CMYK device
+// color space, embedded. Images are converted to CMYK from sRGB using the
+// profile, except for *image.CMYK images which are assumed to already be in
+// the color space of the profile. Without this option, *image.CMYK images are
+// only written as CMYK when their color space, see EmbedColorSpace(), is CMYK.
+func CMYKOutput(p *icc.Profile, intent icc.RenderingIntent, use_blackpoint_compensation bool) EncodeOption {
+	return func(c *encodeConfig) {
+		c.cmyk_profile, c.cmyk_intent, c.cmyk_bpc = p, intent, use_blackpoint_compensation
+	}
+}
+
+// EmbedColorSpace returns an EncodeOption that embeds the specified color
+// space, which is the color space of the pixels of the image, into JPEG, PNG
+// and TIFF images. PNG images get a cICP chunk for code points, in addition to
+// the ICC profile. Code points that have no equivalent ICC profile, such as
+// those for YCbCr or narrow range values, are only written to PNG images. Gray
+// profiles are only embedded in *image.Gray and *image.Gray16 images. Images
+// being converted to CMYK, see CMYKOutput(), are converted from this color
+// space. It has no effect for sRGB, which is the default, or for GIF and BMP
+// images. Image.EncodeAsPNG() and Image.Encode() use Image.ColorSpace
+// automatically.
+func EmbedColorSpace(s *ImageColorSpace) EncodeOption {
+	return func(c *encodeConfig) {
+		c.color_space = s
+	}
+}
+
+// Whether the pixels of all the images are gray
+func has_gray_pixels(imgs ...image.Image) bool {
+	for _, img := range imgs {
+		switch img.(type) {
+		case *image.Gray, *image.Gray16:
+		default:
+			return false
+		}
+	}
+	return len(imgs) > 0
+}
+
+// The ICC profile of the color space to embed in images with RGB or gray
+// pixels. A gray profile is only embedded in images with gray pixels and a
+// CMYK profile only in CMYK images, see as_cmyk()
+func (cfg *encodeConfig) color_space_profile_data(gray_pixels bool) ([]byte, error) {
+	s := cfg.color_space
+	if s.IsSRGB() || s.is_cmyk() || (s.is_gray() && !gray_pixels) {
+		return nil, nil
+	}
+	data, err := s.ICCProfileData()
+	if err != nil && s.CICP.IsSet {
+		// no equivalent ICC profile, the code points are only written to
+		// the cICP chunk of PNG images
+		return nil, nil
+	}
+	return data, err
+}
+
+// Returns the image as CMYK, converting it if needed, and the data of the
+// ICC profile to embed, if any
+func (cfg *encodeConfig) as_cmyk(img image.Image) (ans *image.CMYK, profile_data []byte, err error) {
+	ans, _ = img.(*image.CMYK)
+	if cfg.cmyk_profile == nil {
+		if ans == nil || !cfg.color_space.is_cmyk() {
+			return nil, nil, nil
+		}
+		if profile_data, err = cfg.color_space.ICCProfileData(); err != nil {
+			return nil, nil, err
+		}
+		return
+	}
+	if profile_data, err = cfg.cmyk_profile.Encode(); err != nil {
+		return nil, nil, err
+	}
+	if ans == nil {
+		var src *icc.Profile
+		if !cfg.color_space.IsSRGB() {
+			if src, err = cfg.color_space.icc_profile(); err != nil {
+				return nil, nil, err
+			}
+		}
+		if ans, err = ConvertToCMYK(src, cfg.cmyk_profile, cfg.cmyk_intent, cfg.cmyk_bpc, img); err != nil {
+			return nil, nil, err
+		}
+	}
+	return
+}
+
+func (cfg *encodeConfig) apng_encoder(gray_pixels bool) (*apng.Encoder, error) {
+	ans := &apng.Encoder{CompressionLevel: apng.CompressionLevel(cfg.pngCompressionLevel), PhysicalDimensions: png_physical_dimensions(cfg.resolution)}
+	var err error
+	if ans.ICCProfile, err = cfg.color_space_profile_data(gray_pixels); err != nil {
+		return nil, err
+	}
+	if s := cfg.color_space; s != nil && s.CICP.IsSet && !s.CICP.IsSRGB() {
+		ans.CICP = &apng.CICP{
+			ColorPrimaries: s.CICP.ColorPrimaries, TransferCharacteristics: s.CICP.TransferCharacteristics,
+			MatrixCoefficients: s.CICP.MatrixCoefficients, VideoFullRange: s.CICP.VideoFullRange != 0}
+	}
+	for _, t := range cfg.pngText {
+		ans.TextChunks = append(ans.TextChunks, apng.TextChunk{
+			Key: t.Key, Value: t.Value, Language: t.Language, TranslatedKey: t.TranslatedKey, Compressed: t.Compressed})
+	}
+	return ans, nil
+}
+
 // Encode writes the image img to w in the specified format (JPEG, PNG, GIF, TIFF or BMP).
 func Encode(w io.Writer, img image.Image, format Format, opts ...EncodeOption) error {
 	cfg := defaultEncodeConfig
@@ -634,17 +944,54 @@ func Encode(w io.Writer, img image.Image, format Format, opts ...EncodeOption) e
 
 	switch format {
 	case JPEG:
+		cmyk, profile_data, err := cfg.as_cmyk(img)
+		if err != nil {
+			return err
+		}
+		if cmyk != nil {
+			opts := &myjpeg.Options{Quality: cfg.jpegQuality, ICCProfile: profile_data}
+			if cfg.resolution.IsSet() {
+				buf := bytes.Buffer{}
+				if err := myjpeg.Encode(&buf, cmyk, opts); err != nil {
+					return err
+				}
+				return write_jpeg_with_exif_resolution(w, buf.Bytes(), cfg.resolution)
+			}
+			return myjpeg.Encode(w, cmyk, opts)
+		}
 		if nrgba, ok := img.(*image.NRGBA); ok && IsOpaque(nrgba) {
-			rgba := &image.RGBA{
+			img = &image.RGBA{
 				Pix:    nrgba.Pix,
 				Stride: nrgba.Stride,
 				Rect:   nrgba.Rect,
 			}
-			return jpeg.Encode(w, rgba, &jpeg.Options{Quality: cfg.jpegQuality})
 		}
-		return jpeg.Encode(w, img, &jpeg.Options{Quality: cfg.jpegQuality})
+		if profile_data, err = cfg.color_space_profile_data(has_gray_pixels(img)); err != nil {
+			return err
+		}
+		encode := func(w io.Writer) error { return jpeg.Encode(w, img, &jpeg.Options{Quality: cfg.jpegQuality}) }
+		if profile_data != nil {
+			encode = func(w io.Writer) error {
+				return myjpeg.Encode(w, img, &myjpeg.Options{Quality: cfg.jpegQuality, ICCProfile: profile_data})
+			}
+		}
+		if cfg.resolution.IsSet() {
+			buf := bytes.Buffer{}
+			if err := encode(&buf); err != nil {
+				return err
+			}
+			return write_jpeg_with_resolution(w, buf.Bytes(), cfg.resolution)
+		}
+		return encode(w)
 
 	case PNG:
+		if len(cfg.pngText) > 0 || cfg.resolution.IsSet() || !cfg.color_space.IsSRGB() {
+			e, err := cfg.apng_encoder(has_gray_pixels(img))
+			if err != nil {
+				return err
+			}
+			return e.Encode(w, apng.APNG{Frames: []apng.Frame{{Image: img, IsDefault: true}}})
+		}
 		encoder := png.Encoder{CompressionLevel: cfg.pngCompressionLevel}
 		return encoder.Encode(w, img)
 
@@ -656,9 +1003,47 @@ func Encode(w io.Writer, img image.Image, format Format, opts ...EncodeOption) e
 		})
 
 	case TIFF:
-		return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+		cmyk, profile_data, err := cfg.as_cmyk(img)
+		if err != nil {
+			return err
+		}
+		if cmyk != nil {
+			return encode_cmyk_tiff(w, cmyk, profile_data, cfg.resolution)
+		}
+		opts := &tiff.Options{Compression: tiff.Deflate, Predictor: true}
+		if profile_data, err = cfg.color_space_profile_data(has_gray_pixels(img)); err != nil {
+			return err
+		}
+		if profile_data != nil {
+			buf := bytes.Buffer{}
+			if err := tiff.Encode(&buf, img, opts); err != nil {
+				return err
+			}
+			data := buf.Bytes()
+			if cfg.resolution.IsSet() {
+				if err := set_tiff_resolution(data, cfg.resolution); err != nil {
+					return err
+				}
+			}
+			if data, err = add_tiff_icc_profile(data, profile_data); err != nil {
+				return err
+			}
+			_, err = w.Write(data)
+			return err
+		}
+		if cfg.resolution.IsSet() {
+			return encode_and_modify(w, func(w io.Writer) error { return tiff.Encode(w, img, opts) }, func(b []byte) error {
+				return set_tiff_resolution(b, cfg.resolution)
+			})
+		}
+		return tiff.Encode(w, img, opts)
 
 	case BMP:
+		if cfg.resolution.IsSet() {
+			return encode_and_modify(w, func(w io.Writer) error { return bmp.Encode(w, img) }, func(b []byte) error {
+				return set_bmp_resolution(b, cfg.resolution)
+			})
+		}
 		return bmp.Encode(w, img)
 	}
 
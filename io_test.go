@@ -2,8 +2,11 @@ package imaging
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"image"
 	"image/color"
 	"image/color/palette"
@@ -12,11 +15,17 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/kovidgoyal/imaging/magick"
+	"github.com/kovidgoyal/imaging/prism/meta"
+	"github.com/kovidgoyal/imaging/prism/meta/autometa"
+	"github.com/kovidgoyal/imaging/prism/meta/icc"
+	"github.com/kovidgoyal/imaging/prism/meta/pngmeta"
 	"github.com/kovidgoyal/imaging/types"
+	exif_tiff "github.com/rwcarlsen/goexif/tiff"
 	"github.com/stretchr/testify/require"
 )
 
@@ -311,3 +320,299 @@ func TestAutoOrientation(t *testing.T) {
 		t.Fatal("expected error got nil")
 	}
 }
+
+func TestPNGText(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	entries := []meta.TextEntry{
+		{Key: "Title", Value: "Café"},
+		{Key: "Comment", Value: strings.Repeat("compressed ", 16), Compressed: true},
+		{Key: "Copyright", Value: "© 世界"},
+		{Key: "Title", Value: "Titre", Language: "fr", TranslatedKey: "Titre", Compressed: true},
+	}
+	buf := bytes.Buffer{}
+	require.NoError(t, Encode(&buf, img, PNG, PNGText(entries...)))
+	md, err := pngmeta.ExtractMetadata(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, entries, md.Text)
+	v, found := md.TextValue("Copyright")
+	require.True(t, found)
+	require.Equal(t, entries[2].Value, v)
+	decoded, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, img.Bounds(), decoded.Bounds())
+
+	buf.Reset()
+	require.Error(t, Encode(&buf, img, PNG, PNGText(meta.TextEntry{Key: "", Value: "x"})))
+}
+
+func TestPhysicalResolution(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	for _, format := range []Format{JPEG, PNG, TIFF, BMP} {
+		for _, r := range []meta.Resolution{{X: 300, Y: 150, Unit: meta.PixelsPerInch}, {X: 120, Y: 120, Unit: meta.PixelsPerCentimeter}} {
+			buf := bytes.Buffer{}
+			require.NoError(t, Encode(&buf, img, format, PhysicalResolution(r)))
+			md, _, err := autometa.Load(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			require.NotNil(t, md, format)
+			require.Equal(t, format, md.Format)
+			ex, ey := r.DPI()
+			ax, ay := md.Resolution.DPI()
+			require.InDelta(t, ex, ax, 0.05, "%s: %s != %s", format, r, md.Resolution)
+			require.InDelta(t, ey, ay, 0.05, "%s: %s != %s", format, r, md.Resolution)
+			decoded, err := Decode(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			require.Equal(t, img.Bounds(), decoded.Bounds())
+		}
+	}
+}
+
+func TestPhysicalResolutionCMYKJPEG(t *testing.T) {
+	p, err := icc.ReadProfile("prism/meta/icc/test-profiles/cmyk.icc")
+	require.NoError(t, err)
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	r := meta.Resolution{X: 300, Y: 150, Unit: meta.PixelsPerInch}
+	buf := bytes.Buffer{}
+	require.NoError(t, Encode(&buf, img, JPEG, CMYKOutput(p, Relative, true), PhysicalResolution(r)))
+	// JFIF implies YCbCr or grayscale, so must not be used for CMYK data
+	require.False(t, bytes.Contains(buf.Bytes(), []byte("JFIF\x00")))
+	md, _, err := autometa.Load(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	ax, ay := md.Resolution.DPI()
+	require.InDelta(t, 300, ax, 0.05, md.Resolution)
+	require.InDelta(t, 150, ay, 0.05, md.Resolution)
+	decoded, err := Decode(bytes.NewReader(buf.Bytes()), Backends(GO_IMAGE), ColorSpace(NO_CHANGE_OF_COLORSPACE))
+	require.NoError(t, err)
+	require.Equal(t, color.CMYKModel, decoded.ColorModel())
+	require.Equal(t, img.Bounds(), decoded.Bounds())
+}
+
+func TestResizeCallback16Bit(t *testing.T) {
+	img := image.NewNRGBA64(image.Rect(0, 0, 4, 4))
+	for y := range 4 {
+		for x := range 4 {
+			img.SetNRGBA64(x, y, color.NRGBA64{0x1001, 0x2002, 0x3003, 0xffff})
+		}
+	}
+	buf := bytes.Buffer{}
+	require.NoError(t, png.Encode(&buf, img))
+	halve := ResizeCallback(func(w, h int) (int, int) { return w / 2, h / 2 })
+	for _, linear := range []bool{false, true} {
+		decoded, _, err := DecodeAll(bytes.NewReader(buf.Bytes()), halve, LinearLightResize(linear), Backends(GO_IMAGE))
+		require.NoError(t, err)
+		r, ok := decoded.Frames[0].Image.(*NRGB48)
+		require.True(t, ok, "%T is not NRGB48", decoded.Frames[0].Image)
+		require.Equal(t, image.Rect(0, 0, 2, 2), r.Bounds())
+		c := r.NRGB48At(1, 1)
+		require.InDeltaSlice(t, []uint16{0x1001, 0x2002, 0x3003}, []uint16{c.R, c.G, c.B}, 1)
+	}
+}
+
+func TestImageColorSpace(t *testing.T) {
+	p3, err := icc.DisplayP3Profile.Profile()
+	require.NoError(t, err)
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	img.SetNRGBA(0, 0, color.NRGBA{0, 0, 255, 255})
+	buf := bytes.Buffer{}
+	require.NoError(t, Encode(&buf, img, PNG, EmbedColorSpace(&ImageColorSpace{Profile: p3})))
+	md, err := pngmeta.ExtractMetadata(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	embedded, err := md.ICCProfile()
+	require.NoError(t, err)
+	require.NotNil(t, embedded)
+	p3_desc, err := p3.Description()
+	require.NoError(t, err)
+	desc, err := embedded.Description()
+	require.NoError(t, err)
+	require.Equal(t, p3_desc, desc)
+
+	red := color.NRGBA{255, 0, 0, 255}
+	decoded, _, err := DecodeAll(bytes.NewReader(buf.Bytes()), ColorSpace(NO_CHANGE_OF_COLORSPACE), Background(red), Backends(GO_IMAGE))
+	require.NoError(t, err)
+	require.NotNil(t, decoded.ColorSpace)
+	require.False(t, decoded.ColorSpace.IsSRGB())
+	require.Equal(t, color.NRGBA{0, 0, 255, 255}, color.NRGBAModel.Convert(decoded.Frames[0].Image.At(0, 0)))
+	// the sRGB background is converted into Display P3
+	bg := color.NRGBAModel.Convert(decoded.Frames[0].Image.At(1, 1)).(color.NRGBA)
+	require.InDeltaSlice(t, []uint8{234, 51, 35}, []uint8{bg.R, bg.G, bg.B}, 2)
+	require.Equal(t, bg, color.NRGBAModel.Convert(decoded.ColorFromSRGB(red)))
+	require.Same(t, decoded.ColorSpace, decoded.Clone().ColorSpace)
+
+	// images whose embedded profile cannot be parsed
+	// or is not for RGB, gray or CMYK colors are decoded untagged
+	lab, err := icc.NewProfileBuilder(icc.DeviceClassColorSpace, icc.ColorSpaceLab, icc.ColorSpaceLab).Encode()
+	require.NoError(t, err)
+	plain := bytes.Buffer{}
+	require.NoError(t, Encode(&plain, img, PNG))
+	for _, profile := range [][]byte{[]byte("not an ICC profile"), lab} {
+		var iccp bytes.Buffer
+		iccp.WriteString("bad\x00\x00")
+		zw := zlib.NewWriter(&iccp)
+		zw.Write(profile)
+		zw.Close()
+		bad, _, err := DecodeAll(bytes.NewReader(png_with_chunks(plain.Bytes(), png_chunk{"iCCP", iccp.Bytes()})), ColorSpace(NO_CHANGE_OF_COLORSPACE), Background(red), Backends(GO_IMAGE))
+		require.NoError(t, err)
+		require.Nil(t, bad.ColorSpace)
+		require.Equal(t, color.NRGBA{0, 0, 255, 255}, color.NRGBAModel.Convert(bad.Frames[0].Image.At(0, 0)))
+	}
+
+	// converting to sRGB leaves the image untagged
+	converted, _, err := DecodeAll(bytes.NewReader(buf.Bytes()), Background(red), Backends(GO_IMAGE))
+	require.NoError(t, err)
+	require.Nil(t, converted.ColorSpace)
+	c := color.NRGBAModel.Convert(converted.Frames[0].Image.At(1, 1)).(color.NRGBA)
+	require.Equal(t, red, c)
+
+	// the color space is embedded automatically when encoding
+	for _, format := range []Format{PNG, JPEG, TIFF} {
+		buf := bytes.Buffer{}
+		require.NoError(t, decoded.Encode(&buf, format, PhysicalResolution(meta.Resolution{X: 300, Y: 300, Unit: meta.PixelsPerInch})))
+		md, _, err := autometa.Load(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		require.NotNil(t, md, format)
+		if format == TIFF {
+			// tiffmeta does not read ICC profiles
+			ifd, err := exif_tiff.Decode(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			for _, tag := range ifd.Dirs[0].Tags {
+				if tag.Id == 34675 {
+					md.SetICCProfileData(tag.Val)
+				}
+			}
+		}
+		embedded, err := md.ICCProfile()
+		require.NoError(t, err)
+		require.NotNil(t, embedded, format)
+		desc, err := embedded.Description()
+		require.NoError(t, err)
+		require.Equal(t, p3_desc, desc, format)
+		x, _ := md.Resolution.DPI()
+		require.InDelta(t, 300, x, 0.05, format)
+		redecoded, err := Decode(bytes.NewReader(buf.Bytes()), ColorSpace(NO_CHANGE_OF_COLORSPACE))
+		require.NoError(t, err)
+		require.Equal(t, img.Bounds(), redecoded.Bounds())
+	}
+
+	// code points are written as both cICP and iCCP chunks
+	buf.Reset()
+	require.NoError(t, Encode(&buf, img, PNG, EmbedColorSpace(&ImageColorSpace{CICP: meta.DISPLAY_P3})))
+	md, err = pngmeta.ExtractMetadata(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, meta.DISPLAY_P3, md.CICP)
+	data, err := md.ICCProfileData()
+	require.NoError(t, err)
+	require.NotEmpty(t, data)
+	decoded, _, err = DecodeAll(bytes.NewReader(buf.Bytes()), ColorSpace(NO_CHANGE_OF_COLORSPACE), Backends(GO_IMAGE))
+	require.NoError(t, err)
+	require.NotNil(t, decoded.ColorSpace)
+	require.Equal(t, meta.DISPLAY_P3, decoded.ColorSpace.CICP)
+	c = color.NRGBAModel.Convert(decoded.ColorFromSRGB(red)).(color.NRGBA)
+	require.InDeltaSlice(t, []uint8{234, 51, 35}, []uint8{c.R, c.G, c.B}, 2)
+
+	// code points without an equivalent ICC profile, narrow range and YCbCr,
+	// are only written as a cICP chunk
+	for _, cicp := range []meta.CodingIndependentCodePoints{
+		{ColorPrimaries: 9, TransferCharacteristics: 16, MatrixCoefficients: 0, VideoFullRange: 0, IsSet: true},
+		{ColorPrimaries: 9, TransferCharacteristics: 16, MatrixCoefficients: 9, VideoFullRange: 1, IsSet: true},
+	} {
+		for _, format := range []Format{PNG, JPEG, TIFF} {
+			buf.Reset()
+			require.NoError(t, Encode(&buf, img, format, EmbedColorSpace(&ImageColorSpace{CICP: cicp})), "%s: %s", format, cicp)
+			if format == TIFF {
+				ifd, err := exif_tiff.Decode(bytes.NewReader(buf.Bytes()))
+				require.NoError(t, err)
+				for _, tag := range ifd.Dirs[0].Tags {
+					require.NotEqual(t, uint16(34675), tag.Id, "%s: %s", format, cicp)
+				}
+				continue
+			}
+			md, _, err := autometa.Load(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			data, err := md.ICCProfileData()
+			require.NoError(t, err)
+			require.Nil(t, data, "%s: %s", format, cicp)
+			if format == PNG {
+				require.Equal(t, cicp, md.CICP)
+			}
+		}
+	}
+}
+
+func TestEmbedGrayColorSpace(t *testing.T) {
+	gray, err := icc.Gray22Profile.Profile()
+	require.NoError(t, err)
+	embedded := func(format Format, data []byte) []byte {
+		if format == TIFF {
+			// tiffmeta does not read ICC profiles
+			ifd, err := exif_tiff.Decode(bytes.NewReader(data))
+			require.NoError(t, err)
+			for _, tag := range ifd.Dirs[0].Tags {
+				if tag.Id == 34675 {
+					return tag.Val
+				}
+			}
+			return nil
+		}
+		md, _, err := autometa.Load(bytes.NewReader(data))
+		require.NoError(t, err)
+		ans, err := md.ICCProfileData()
+		require.NoError(t, err)
+		return ans
+	}
+	r := image.Rect(0, 0, 2, 2)
+	for _, format := range []Format{PNG, JPEG, TIFF} {
+		// gray profiles are not embedded in images with RGB pixels
+		buf := bytes.Buffer{}
+		require.NoError(t, Encode(&buf, image.NewNRGBA(r), format, EmbedColorSpace(&ImageColorSpace{Profile: gray})))
+		require.Nil(t, embedded(format, buf.Bytes()), format)
+		for _, img := range []image.Image{image.NewGray(r), image.NewGray16(r)} {
+			buf.Reset()
+			require.NoError(t, Encode(&buf, img, format, EmbedColorSpace(&ImageColorSpace{Profile: gray})))
+			p, err := icc.NewProfileReader(bytes.NewReader(embedded(format, buf.Bytes()))).ReadProfile()
+			require.NoError(t, err, "%s: %T", format, img)
+			require.Equal(t, icc.ColorSpaceGray, p.Header.DataColorSpace)
+		}
+	}
+}
+
+type png_chunk struct {
+	name string
+	data []byte
+}
+
+// Insert the chunks into the PNG data after its IHDR chunk
+func png_with_chunks(data []byte, chunks ...png_chunk) []byte {
+	const ihdr_end = 8 + 8 + 13 + 4
+	ans := slices.Clone(data[:ihdr_end])
+	for _, c := range chunks {
+		ans = binary.BigEndian.AppendUint32(ans, uint32(len(c.data)))
+		start := len(ans)
+		ans = append(ans, c.name...)
+		ans = append(ans, c.data...)
+		ans = binary.BigEndian.AppendUint32(ans, crc32.ChecksumIEEE(ans[start:]))
+	}
+	return append(ans, data[ihdr_end:]...)
+}
+
+func TestPNGColorChunkPrecedence(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{128, 128, 128, 255})
+	buf := bytes.Buffer{}
+	require.NoError(t, png.Encode(&buf, img))
+	p3, err := icc.DisplayP3Profile.Profile()
+	require.NoError(t, err)
+	gama := png_chunk{"gAMA", binary.BigEndian.AppendUint32(nil, 100000)}
+	// a cICP chunk declaring sRGB overrides gAMA
+	data := png_with_chunks(buf.Bytes(), png_chunk{"cICP", []byte{1, 13, 0, 1}}, gama)
+	for _, opts := range [][]DecodeOption{{}, {TargetProfile(p3)}} {
+		decoded, err := Decode(bytes.NewReader(data), append(opts, Backends(GO_IMAGE))...)
+		require.NoError(t, err)
+		c := color.NRGBAModel.Convert(decoded.At(0, 0)).(color.NRGBA)
+		require.InDelta(t, 128, int(c.R), 1)
+		require.InDelta(t, int(c.R), int(c.B), 1)
+	}
+	// without cICP the gAMA chunk is used
+	decoded, err := Decode(bytes.NewReader(png_with_chunks(buf.Bytes(), gama)), Backends(GO_IMAGE))
+	require.NoError(t, err)
+	c := color.NRGBAModel.Convert(decoded.At(0, 0)).(color.NRGBA)
+	require.Greater(t, int(c.R), 180)
+}
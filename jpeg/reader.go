@@ -65,6 +65,7 @@ const (
 	// but in practice, their use is described at
 	// https://www.sno.phy.queensu.ca/~phil/exiftool/TagNames/JPEG.html
 	app0Marker  = 0xe0
+	app2Marker  = 0xe2
 	app14Marker = 0xee
 	app15Marker = 0xef
 )
@@ -0,0 +1,52 @@
+package jpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	stdlibjpeg "image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	rgb := image.NewRGBA(image.Rect(0, 0, 37, 21))
+	cmyk := image.NewCMYK(rgb.Rect)
+	for y := range 21 {
+		for x := range 37 {
+			rgb.Set(x, y, color.RGBA{uint8(x * 7), uint8(y * 12), 128, 255})
+			cmyk.Set(x, y, color.CMYK{uint8(x * 7), uint8(y * 12), 64, uint8(x * y)})
+		}
+	}
+	// Non CMYK images are encoded identically to the stdlib encoder
+	var a, b bytes.Buffer
+	require.NoError(t, Encode(&a, rgb, &Options{Quality: 90}))
+	require.NoError(t, stdlibjpeg.Encode(&b, rgb, &stdlibjpeg.Options{Quality: 90}))
+	require.Equal(t, b.Bytes(), a.Bytes())
+
+	profile := bytes.Repeat([]byte("0123456789"), 7000)
+	a.Reset()
+	require.NoError(t, Encode(&a, cmyk, &Options{Quality: 100, ICCProfile: profile}))
+	img, err := Decode(bytes.NewReader(a.Bytes()))
+	require.NoError(t, err)
+	require.IsType(t, cmyk, img)
+	actual := img.(*image.CMYK)
+	for i, x := range cmyk.Pix {
+		require.InDelta(t, x, actual.Pix[i], 3, "pixel value differs at: %d", i)
+	}
+
+	// The profile is split into APP2 chunks
+	data, embedded := a.Bytes(), []byte{}
+	for i := 0; i < len(data)-4; i++ {
+		if data[i] == 0xff && data[i+1] == app2Marker {
+			n := int(data[i+2])<<8 | int(data[i+3])
+			chunk := data[i+4 : i+2+n]
+			require.Equal(t, "ICC_PROFILE\x00", string(chunk[:12]))
+			require.Equal(t, byte(2), chunk[13])
+			embedded = append(embedded, chunk[14:]...)
+			i += n
+		}
+	}
+	require.Equal(t, profile, embedded)
+}
@@ -241,11 +241,15 @@ func identify(path *input) (ans []IdentifyRecord, err error) {
 }
 
 type RenderOptions struct {
-	Background             *color.RGBA64
-	ResizeTo               image.Point
-	OnlyFirstFrame         bool
-	AutoOrient             bool
-	ToSRGB                 bool
+	Background        *color.RGBA64
+	ResizeTo          image.Point
+	LinearLightResize bool
+	OnlyFirstFrame    bool
+	AutoOrient        bool
+	ToSRGB            bool
+	// The data of an ICC profile to convert colors to instead of sRGB, when
+	// ToSRGB is true
+	TargetProfile          []byte
 	Transform              types.TransformType
 	RenderingIntent        icc.RenderingIntent
 	BlackpointCompensation bool
@@ -315,11 +319,23 @@ func render(path *input, ro *RenderOptions, is_srgb bool, frames []IdentifyRecor
 		return
 	}
 	defer os.RemoveAll(tdir)
-	if ro.ToSRGB && !is_srgb {
+	if ro.ToSRGB && (!is_srgb || ro.TargetProfile != nil) {
 		profile_path := filepath.Join(tdir, "sRGB.icc")
 		if err = os.WriteFile(profile_path, icc.Srgb_xyz_profile_data, 0o666); err != nil {
 			return nil, fmt.Errorf("failed to create temporary file with profile for ImageMagick with error: %w", err)
 		}
+		if is_srgb {
+			// ImageMagick assigns rather than converts to the first profile
+			// of untagged images
+			cmd = append(cmd, "-profile", profile_path)
+		}
+		if ro.TargetProfile != nil {
+			// Convert directly to the target so that colors outside sRGB are preserved
+			profile_path = filepath.Join(tdir, "target.icc")
+			if err = os.WriteFile(profile_path, ro.TargetProfile, 0o666); err != nil {
+				return nil, fmt.Errorf("failed to create temporary file with profile for ImageMagick with error: %w", err)
+			}
+		}
 
 		cmd = append(cmd, icc.IfElse(ro.BlackpointCompensation, "-", "+")+"black-point-compensation")
 		cmd = append(cmd, "-intent", ro.RenderingIntent.String())
@@ -327,6 +343,9 @@ func render(path *input, ro *RenderOptions, is_srgb bool, frames []IdentifyRecor
 	}
 	if ro.ResizeTo.X > 0 {
 		rcmd := []string{"-resize", fmt.Sprintf("%dx%d!", ro.ResizeTo.X, ro.ResizeTo.Y)}
+		if ro.LinearLightResize {
+			rcmd = append(append([]string{"-colorspace", "RGB"}, rcmd...), "-colorspace", "sRGB")
+		}
 		if get_multiple_frames {
 			cmd = append(cmd, "-coalesce")
 			cmd = append(cmd, rcmd...)
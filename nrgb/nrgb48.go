@@ -0,0 +1,271 @@
+package nrgb
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/kovidgoyal/imaging/types"
+)
+
+var _ = fmt.Print
+
+// Color48 is an opaque color with 16 bits per channel
+type Color48 struct {
+	R, G, B uint16
+}
+
+func (c Color48) RGBA() (r, g, b, a uint32) {
+	return uint32(c.R), uint32(c.G), uint32(c.B), 0xffff
+}
+
+// Image48 is an in-memory opaque image with 16 bits per channel whose At
+// method returns Color48 values.
+type Image48 struct {
+	// Pix holds the image's pixels, in R, G, B order and big-endian format. The pixel at
+	// (x, y) starts at Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*6].
+	Pix []uint8
+	// Stride is the Pix stride (in bytes) between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+}
+
+func nrgb48Model(c color.Color) color.Color {
+	switch q := c.(type) {
+	case Color48:
+		return c
+	case color.NRGBA64:
+		return Color48{q.R, q.G, q.B}
+	}
+	r, g, b, a := c.RGBA()
+	switch a {
+	case 0xffff:
+		return Color48{uint16(r), uint16(g), uint16(b)}
+	case 0:
+		return Color48{0, 0, 0}
+	default:
+		// Since Color.RGBA returns an alpha-premultiplied color, we should have r <= a && g <= a && b <= a.
+		r = (r * 0xffff) / a
+		g = (g * 0xffff) / a
+		b = (b * 0xffff) / a
+		return Color48{uint16(r), uint16(g), uint16(b)}
+	}
+}
+
+var Model48 color.Model = color.ModelFunc(nrgb48Model)
+
+func (p *Image48) ColorModel() color.Model { return Model48 }
+
+func (p *Image48) Bounds() image.Rectangle { return p.Rect }
+
+func (p *Image48) At(x, y int) color.Color {
+	return p.NRGB48At(x, y)
+}
+
+func (p *Image48) NRGB48At(x, y int) Color48 {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return Color48{}
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+6 : i+6] // Small cap improves performance, see https://golang.org/issue/27857
+	return Color48{u16(s[0:]), u16(s[2:]), u16(s[4:])}
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *Image48) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*6
+}
+
+func (p *Image48) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	q := nrgb48Model(c).(Color48)
+	put48(p.Pix[i:i+6:i+6], q.R, q.G, q.B)
+}
+
+func (p *Image48) SetRGBA64(x, y int, c color.RGBA64) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	r, g, b, a := uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)
+	if (a != 0) && (a != 0xffff) {
+		r = (r * 0xffff) / a
+		g = (g * 0xffff) / a
+		b = (b * 0xffff) / a
+	}
+	i := p.PixOffset(x, y)
+	put48(p.Pix[i:i+6:i+6], uint16(r), uint16(g), uint16(b))
+}
+
+func (p *Image48) SetNRGB48(x, y int, c Color48) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	put48(p.Pix[i:i+6:i+6], c.R, c.G, c.B)
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *Image48) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &Image48{}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &Image48{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+// Opaque scans the entire image and reports whether it is fully opaque.
+func (p *Image48) Opaque() bool { return true }
+
+func u16(s []uint8) uint16 { return uint16(s[0])<<8 | uint16(s[1]) }
+
+func put48(d []uint8, r, g, b uint16) {
+	d[0], d[1] = uint8(r>>8), uint8(r)
+	d[2], d[3] = uint8(g>>8), uint8(g)
+	d[4], d[5] = uint8(b>>8), uint8(b)
+}
+
+func NewNRGB48(r image.Rectangle) *Image48 {
+	return &Image48{
+		Pix:    make([]uint8, 6*r.Dx()*r.Dy()),
+		Stride: 6 * r.Dx(),
+		Rect:   r,
+	}
+}
+
+type scanner_rgb48 struct {
+	image       image.Image
+	opaque_base [3]float64
+}
+
+func (s scanner_rgb48) Bytes_per_channel() int                 { return 2 }
+func (s scanner_rgb48) Num_of_channels() int                   { return 3 }
+func (s scanner_rgb48) Bounds() image.Rectangle                { return s.image.Bounds() }
+func (s scanner_rgb48) NewImage(r image.Rectangle) image.Image { return NewNRGB48(r) }
+
+func reverse6(pix []uint8) {
+	if len(pix) <= 6 {
+		return
+	}
+	i := 0
+	j := len(pix) - 6
+	for i < j {
+		pi := pix[i : i+6 : i+6]
+		pj := pix[j : j+6 : j+6]
+		for k := range 6 {
+			pi[k], pj[k] = pj[k], pi[k]
+		}
+		i += 6
+		j -= 6
+	}
+}
+
+func (s *scanner_rgb48) ReverseRow(img image.Image, row int) {
+	d := img.(*Image48)
+	pos := row * d.Stride
+	reverse6(d.Pix[pos : pos+d.Stride : pos+d.Stride])
+}
+
+func (s *scanner_rgb48) ScanRow(x1, y1, x2, y2 int, img image.Image, row int) {
+	d := img.(*Image48)
+	pos := row * d.Stride
+	s.Scan(x1, y1, x2, y2, d.Pix[pos:pos+d.Stride:pos+d.Stride])
+}
+
+// blend the non-premultiplied color onto the opaque base
+func (s *scanner_rgb48) blend(d []uint8, r, g, b, a uint32) {
+	switch a {
+	case 0xffff:
+		put48(d, uint16(r), uint16(g), uint16(b))
+	default:
+		alpha := float64(a) / 0xffff
+		put48(d, uint16(alpha*float64(r)+(1-alpha)*s.opaque_base[0]+0.5),
+			uint16(alpha*float64(g)+(1-alpha)*s.opaque_base[1]+0.5),
+			uint16(alpha*float64(b)+(1-alpha)*s.opaque_base[2]+0.5))
+	}
+}
+
+// Scan scans the given rectangular region of the image into dst as big-endian
+// 16 bit values
+func (s *scanner_rgb48) Scan(x1, y1, x2, y2 int, dst []uint8) {
+	_ = dst[6*(x2-x1)*(y2-y1)-1]
+	switch img := s.image.(type) {
+	case *Image48:
+		size := (x2 - x1) * 6
+		j := 0
+		for y := y1; y < y2; y++ {
+			i := y*img.Stride + x1*6
+			copy(dst[j:j+size], img.Pix[i:i+size])
+			j += size
+		}
+
+	case *image.NRGBA64:
+		j := 0
+		for y := y1; y < y2; y++ {
+			src := img.Pix[y*img.Stride+x1*8:]
+			for range x2 - x1 {
+				s.blend(dst[j:j+6:j+6], uint32(u16(src[0:])), uint32(u16(src[2:])), uint32(u16(src[4:])), uint32(u16(src[6:])))
+				j += 6
+				src = src[8:]
+			}
+		}
+
+	case *image.RGBA64:
+		j := 0
+		for y := y1; y < y2; y++ {
+			src := img.Pix[y*img.Stride+x1*8:]
+			for range x2 - x1 {
+				r, g, b, a := uint32(u16(src[0:])), uint32(u16(src[2:])), uint32(u16(src[4:])), uint32(u16(src[6:]))
+				if a != 0 && a != 0xffff {
+					r, g, b = r*0xffff/a, g*0xffff/a, b*0xffff/a
+				}
+				s.blend(dst[j:j+6:j+6], r, g, b, a)
+				j += 6
+				src = src[8:]
+			}
+		}
+
+	case *image.Gray16:
+		j := 0
+		for y := y1; y < y2; y++ {
+			src := img.Pix[y*img.Stride+x1*2:]
+			for range x2 - x1 {
+				d := dst[j : j+6 : j+6]
+				d[0], d[1], d[2], d[3], d[4], d[5] = src[0], src[1], src[0], src[1], src[0], src[1]
+				j += 6
+				src = src[2:]
+			}
+		}
+
+	default:
+		j := 0
+		b := s.image.Bounds()
+		for y := y1 + b.Min.Y; y < y2+b.Min.Y; y++ {
+			for x := x1 + b.Min.X; x < x2+b.Min.X; x++ {
+				r, g, bl, a := s.image.At(x, y).RGBA()
+				if a != 0 && a != 0xffff {
+					r, g, bl = r*0xffff/a, g*0xffff/a, bl*0xffff/a
+				}
+				s.blend(dst[j:j+6:j+6], r, g, bl, a)
+				j += 6
+			}
+		}
+	}
+}
+
+// NewNRGB48Scanner returns a scanner that converts pixels of any image to
+// opaque 16 bit per channel RGB, blending colors that are not opaque onto
+// opaque_base. The scanned values are big-endian as in Image48.
+func NewNRGB48Scanner(source_image image.Image, opaque_base Color48) types.Scanner {
+	return &scanner_rgb48{image: source_image, opaque_base: [3]float64{float64(opaque_base.R), float64(opaque_base.G), float64(opaque_base.B)}}
+}
@@ -2,6 +2,8 @@ package nrgb
 
 import (
 	"fmt"
+	"image"
+	"image/color"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -38,3 +40,21 @@ func TestNRGB(t *testing.T) {
 		})
 	}
 }
+
+func TestNRGB48(t *testing.T) {
+	src := image.NewNRGBA64(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA64(0, 0, color.NRGBA64{0x1234, 0x5678, 0x9abc, 0xffff})
+	src.SetNRGBA64(1, 0, color.NRGBA64{0xffff, 0xffff, 0xffff, 0x8000})
+	s := NewNRGB48Scanner(src, Color48{0, 0, 0xffff})
+	img := s.NewImage(src.Bounds()).(*Image48)
+	s.ScanRow(0, 0, 2, 1, img, 0)
+	require.Equal(t, Color48{0x1234, 0x5678, 0x9abc}, img.NRGB48At(0, 0))
+	require.Equal(t, Color48{0x8000, 0x8000, 0xffff}, img.NRGB48At(1, 0))
+	s.ReverseRow(img, 0)
+	require.Equal(t, Color48{0x1234, 0x5678, 0x9abc}, img.NRGB48At(1, 0))
+	r, g, b, a := img.At(1, 0).RGBA()
+	require.Equal(t, []uint32{0x1234, 0x5678, 0x9abc, 0xffff}, []uint32{r, g, b, a})
+	img.Set(0, 0, color.NRGBA64{1, 2, 3, 0xffff})
+	require.Equal(t, Color48{1, 2, 3}, img.NRGB48At(0, 0))
+	require.Equal(t, Color48{1, 2, 3}, img.SubImage(image.Rect(0, 0, 1, 1)).(*Image48).NRGB48At(0, 0))
+}
@@ -0,0 +1,155 @@
+package nrgba
+
+import (
+	"image"
+
+	"github.com/kovidgoyal/imaging/nrgb"
+	"github.com/kovidgoyal/imaging/types"
+)
+
+type scanner16 struct {
+	image image.Image
+}
+
+func (s scanner16) Bytes_per_channel() int  { return 2 }
+func (s scanner16) Num_of_channels() int    { return 4 }
+func (s scanner16) Bounds() image.Rectangle { return s.image.Bounds() }
+func (s scanner16) NewImage(r image.Rectangle) image.Image {
+	return image.NewNRGBA64(r)
+}
+
+func reverse8(pix []uint8) {
+	if len(pix) <= 8 {
+		return
+	}
+	i := 0
+	j := len(pix) - 8
+	for i < j {
+		pi := pix[i : i+8 : i+8]
+		pj := pix[j : j+8 : j+8]
+		for k := range 8 {
+			pi[k], pj[k] = pj[k], pi[k]
+		}
+		i += 8
+		j -= 8
+	}
+}
+
+func (s *scanner16) ReverseRow(img image.Image, row int) {
+	d := img.(*image.NRGBA64)
+	pos := row * d.Stride
+	reverse8(d.Pix[pos : pos+d.Stride : pos+d.Stride])
+}
+
+func (s *scanner16) ScanRow(x1, y1, x2, y2 int, img image.Image, row int) {
+	d := img.(*image.NRGBA64)
+	pos := row * d.Stride
+	s.Scan(x1, y1, x2, y2, d.Pix[pos:pos+d.Stride:pos+d.Stride])
+}
+
+func put16(d []uint8, r, g, b, a uint32) {
+	d[0], d[1] = uint8(r>>8), uint8(r)
+	d[2], d[3] = uint8(g>>8), uint8(g)
+	d[4], d[5] = uint8(b>>8), uint8(b)
+	d[6], d[7] = uint8(a>>8), uint8(a)
+}
+
+// Scan scans the given rectangular region of the image into dst as big-endian
+// 16 bit values, in the format of image.NRGBA64.
+func (s *scanner16) Scan(x1, y1, x2, y2 int, dst []uint8) {
+	_ = dst[8*(x2-x1)*(y2-y1)-1]
+	switch img := s.image.(type) {
+	case *image.NRGBA64:
+		size := (x2 - x1) * 8
+		j := 0
+		for y := y1; y < y2; y++ {
+			i := y*img.Stride + x1*8
+			copy(dst[j:j+size], img.Pix[i:i+size])
+			j += size
+		}
+
+	case *nrgb.Image48:
+		j := 0
+		for y := y1; y < y2; y++ {
+			src := img.Pix[y*img.Stride+x1*6:]
+			for range x2 - x1 {
+				d := dst[j : j+8 : j+8]
+				copy(d, src[:6])
+				d[6], d[7] = 0xff, 0xff
+				j += 8
+				src = src[6:]
+			}
+		}
+
+	case *image.NRGBA:
+		j := 0
+		for y := y1; y < y2; y++ {
+			src := img.Pix[y*img.Stride+x1*4:]
+			for range x2 - x1 {
+				d := dst[j : j+8 : j+8]
+				d[0], d[1], d[2], d[3], d[4], d[5], d[6], d[7] = src[0], src[0], src[1], src[1], src[2], src[2], src[3], src[3]
+				j += 8
+				src = src[4:]
+			}
+		}
+
+	case *image.RGBA64:
+		j := 0
+		for y := y1; y < y2; y++ {
+			src := img.Pix[y*img.Stride+x1*8:]
+			for range x2 - x1 {
+				r := uint32(src[0])<<8 | uint32(src[1])
+				g := uint32(src[2])<<8 | uint32(src[3])
+				b := uint32(src[4])<<8 | uint32(src[5])
+				a := uint32(src[6])<<8 | uint32(src[7])
+				switch a {
+				case 0:
+					r, g, b = 0, 0, 0
+				case 0xffff:
+				default:
+					r, g, b = r*0xffff/a, g*0xffff/a, b*0xffff/a
+				}
+				put16(dst[j:j+8:j+8], r, g, b, a)
+				j += 8
+				src = src[8:]
+			}
+		}
+
+	case *image.Gray16:
+		j := 0
+		for y := y1; y < y2; y++ {
+			src := img.Pix[y*img.Stride+x1*2:]
+			for range x2 - x1 {
+				d := dst[j : j+8 : j+8]
+				d[0], d[1], d[2], d[3], d[4], d[5], d[6], d[7] = src[0], src[1], src[0], src[1], src[0], src[1], 0xff, 0xff
+				j += 8
+				src = src[2:]
+			}
+		}
+
+	default:
+		j := 0
+		b := s.image.Bounds()
+		for y := y1 + b.Min.Y; y < y2+b.Min.Y; y++ {
+			for x := x1 + b.Min.X; x < x2+b.Min.X; x++ {
+				r, g, bl, a := s.image.At(x, y).RGBA()
+				switch a {
+				case 0:
+					r, g, bl = 0, 0, 0
+				case 0xffff:
+				default:
+					r, g, bl = r*0xffff/a, g*0xffff/a, bl*0xffff/a
+				}
+				put16(dst[j:j+8:j+8], r, g, bl, a)
+				j += 8
+			}
+		}
+	}
+}
+
+// NewNRGBA64Scanner returns a scanner that converts pixels of any image to
+// non-premultiplied RGBA with 16 bits per channel, in the big-endian format
+// of image.NRGBA64, without loss of precision.
+func NewNRGBA64Scanner(source_image image.Image) types.Scanner {
+	return &scanner16{image: source_image}
+}
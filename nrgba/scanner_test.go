@@ -2,6 +2,8 @@ package nrgba
 
 import (
 	"fmt"
+	"image"
+	"image/color"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -39,3 +41,24 @@ func TestReverse(t *testing.T) {
 		})
 	}
 }
+
+func TestScanner16(t *testing.T) {
+	src := image.NewRGBA64(image.Rect(0, 0, 3, 1))
+	src.SetRGBA64(0, 0, color.RGBA64{0x1234, 0x5678, 0x9abc, 0xffff})
+	src.SetRGBA64(1, 0, color.RGBA64{0x4000, 0x2000, 0, 0x8000})
+	s := NewNRGBA64Scanner(src)
+	img := s.NewImage(src.Bounds()).(*image.NRGBA64)
+	s.ScanRow(0, 0, 3, 1, img, 0)
+	require.Equal(t, color.NRGBA64{0x1234, 0x5678, 0x9abc, 0xffff}, img.NRGBA64At(0, 0))
+	require.Equal(t, color.NRGBA64{0x7fff, 0x3fff, 0, 0x8000}, img.NRGBA64At(1, 0))
+	require.Equal(t, color.NRGBA64{}, img.NRGBA64At(2, 0))
+	s.ReverseRow(img, 0)
+	require.Equal(t, color.NRGBA64{0x1234, 0x5678, 0x9abc, 0xffff}, img.NRGBA64At(2, 0))
+
+	n := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	n.SetNRGBA(0, 0, color.NRGBA{0x12, 0xff, 0, 0x80})
+	s = NewNRGBA64Scanner(n)
+	img = s.NewImage(n.Bounds()).(*image.NRGBA64)
+	s.ScanRow(0, 0, 1, 1, img, 0)
+	require.Equal(t, color.NRGBA64{0x1212, 0xffff, 0, 0x8080}, img.NRGBA64At(0, 0))
+}
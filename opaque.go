@@ -91,7 +91,7 @@ func is_opaque16(pix []uint8, w, h, stride int) bool {
 
 func IsOpaqueType(img image.Image) (ans bool) {
 	switch img.(type) {
-	case *nrgb.Image, *image.CMYK, *image.YCbCr, *image.Gray, *image.Gray16:
+	case *nrgb.Image, *nrgb.Image48, *image.CMYK, *image.YCbCr, *image.Gray, *image.Gray16:
 		return true
 
 	default:
@@ -105,7 +105,7 @@ func IsOpaque(img image.Image) (ans bool) {
 		return true
 	}
 	switch img := img.(type) {
-	case *nrgb.Image, *image.CMYK, *image.YCbCr, *image.Gray, *image.Gray16:
+	case *nrgb.Image, *nrgb.Image48, *image.CMYK, *image.YCbCr, *image.Gray, *image.Gray16:
 		return true
 	case *image.NRGBA:
 		return is_opaque8(img.Pix, img.Bounds().Dx(), img.Bounds().Dy(), img.Stride)
@@ -0,0 +1,101 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/kovidgoyal/imaging/colorconv"
+	"github.com/kovidgoyal/imaging/rgbaf"
+)
+
+var _ = fmt.Print
+
+// A perceptually uniform color space that the colors of images can be
+// converted into, see ToPerceptual()
+type PerceptualColorSpace int
+
+const (
+	// OKLab with L in [0, 1] and a, b roughly in [-0.4, 0.4]
+	OKLab PerceptualColorSpace = iota
+	// The polar form of OKLab: L, C and the hue in degrees
+	OKLCH
+	// The polar form of CIELAB (D65): L in [0, 100], C and the hue in degrees
+	LCh
+	// HSLuv: the hue in degrees and the saturation and lightness in [0, 100]
+	HSLuv
+	// CAM16-UCS J', a', b' with the viewing conditions of sRGB
+	CAM16UCS
+)
+
+func (s PerceptualColorSpace) String() string {
+	switch s {
+	case OKLab:
+		return "OKLab"
+	case OKLCH:
+		return "OKLCH"
+	case LCh:
+		return "LCh"
+	case HSLuv:
+		return "HSLuv"
+	case CAM16UCS:
+		return "CAM16UCS"
+	}
+	return fmt.Sprintf("PerceptualColorSpace(%d)", int(s))
+}
+
+func (s PerceptualColorSpace) conversions() (from_srgb, to_srgb colorconv.Conversion) {
+	switch s {
+	case OKLab:
+		return colorconv.SrgbToOKLab, colorconv.OKLabToSrgb
+	case OKLCH:
+		return colorconv.SrgbToOKLCH, colorconv.OKLCHToSrgb
+	case LCh:
+		return colorconv.SrgbToLCh, colorconv.LChToSrgb
+	case HSLuv:
+		return colorconv.SrgbToHSLuv, colorconv.HSLuvToSrgb
+	case CAM16UCS:
+		return colorconv.SrgbToCAM16UCS, colorconv.CAM16UCSToSrgb
+	}
+	panic(fmt.Sprintf("unknown perceptual color space: %s", s))
+}
+
+// Fill each row of dst using fill and then convert its colors in place
+func convert_rows(dst *RGBAF, f colorconv.Conversion, fill func(y int, row []float32)) {
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	if err := run_in_parallel_over_range(0, func(start, limit int) {
+		for y := start; y < limit; y++ {
+			i := y * dst.Stride
+			row := dst.Pix[i : i+w*4]
+			fill(y, row)
+			colorconv.ConvertSlice(f, row, 4)
+		}
+	}, 0, h); err != nil {
+		panic(err)
+	}
+}
+
+// ToPerceptual converts the colors of the image, which must be in the sRGB
+// color space, to the specified perceptual color space. The three components
+// of the converted colors are stored in the R, G and B channels of the
+// returned image, in that order, and alpha is unchanged. Use FromPerceptual()
+// to convert back to sRGB.
+func ToPerceptual(img image.Image, space PerceptualColorSpace) *RGBAF {
+	from_srgb, _ := space.conversions()
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	src := rgbaf.NewRGBAFScanner(img)
+	dst := rgbaf.NewRGBAF(image.Rect(0, 0, w, h))
+	convert_rows(dst, from_srgb, func(y int, row []float32) { src.ScanFloat(0, y, w, y+1, row) })
+	return dst
+}
+
+// FromPerceptual is the inverse of ToPerceptual(), returning a new image with
+// sRGB colors. Colors outside the sRGB gamut are not clamped.
+func FromPerceptual(img *RGBAF, space PerceptualColorSpace) *RGBAF {
+	_, to_srgb := space.conversions()
+	dst := rgbaf.NewRGBAF(image.Rect(0, 0, img.Rect.Dx(), img.Rect.Dy()))
+	convert_rows(dst, to_srgb, func(y int, row []float32) {
+		i := img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y)
+		copy(row, img.Pix[i:i+len(row)])
+	})
+	return dst
+}
@@ -0,0 +1,36 @@
+package imaging
+
+import (
+	"image"
+	"testing"
+)
+
+func TestPerceptualColorSpaces(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 37)
+	}
+	sub := src.SubImage(image.Rect(1, 0, 3, 2))
+	for _, space := range []PerceptualColorSpace{OKLab, OKLCH, LCh, HSLuv, CAM16UCS} {
+		p := ToPerceptual(sub, space)
+		if p.Bounds() != image.Rect(0, 0, 2, 2) {
+			t.Fatalf("%s: unexpected bounds: %v", space, p.Bounds())
+		}
+		from_srgb, _ := space.conversions()
+		c := src.NRGBAAt(2, 1)
+		x, y, z := from_srgb(float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+		if got := p.RGBAFAt(1, 1); !compareFloat64(float64(got.R), x, 1e-4) || !compareFloat64(float64(got.G), y, 1e-4) || !compareFloat64(float64(got.B), z, 1e-4) || got.A != float32(c.A)/255 {
+			t.Fatalf("%s: got %v want %v %v %v", space, got, x, y, z)
+		}
+		back := FromPerceptual(p.SubImage(image.Rect(1, 0, 2, 2)).(*RGBAF), space).ToNRGBA()
+		if !compareNRGBA(back, Clone(src.SubImage(image.Rect(2, 0, 3, 2))), 0) {
+			t.Fatalf("%s: round trip failed: %v", space, back.Pix)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("no panic for an unknown color space")
+		}
+	}()
+	ToPerceptual(src, PerceptualColorSpace(100))
+}
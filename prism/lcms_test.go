@@ -63,6 +63,9 @@ var profiles = map[string]opt{
 	"prophoto.icc": {inv_tolerance: 0.1 * THRESHOLD8, srgb_tolerance: 0.7 * THRESHOLD8},
 	// Display P3 gamut with sRGB transfer function
 	"displayp3-with-srgb-transfer.icc": {srgb_tolerance: 0.45 * THRESHOLD8},
+	// Display P3 with D2B0/B2D0 multiProcessElement tags, made of segmented
+	// curves, a CLUT and a matrix, lcms evaluates them in float32
+	"displayp3-mpet.icc": {pcs_tolerance: 2 * THRESHOLD16, inv_tolerance: 2 * THRESHOLD16, srgb_tolerance: 0.45 * THRESHOLD8},
 }
 
 // testDir returns the absolute path to the directory containing the test file.
@@ -4,6 +4,7 @@ import (
 	"io"
 
 	"github.com/kovidgoyal/imaging/prism/meta"
+	"github.com/kovidgoyal/imaging/prism/meta/bmpmeta"
 	"github.com/kovidgoyal/imaging/prism/meta/gifmeta"
 	"github.com/kovidgoyal/imaging/prism/meta/jpegmeta"
 	"github.com/kovidgoyal/imaging/prism/meta/netpbmmeta"
@@ -19,6 +20,7 @@ var loaders = []func(io.Reader) (*meta.Data, error){
 	gifmeta.ExtractMetadata,
 	webpmeta.ExtractMetadata,
 	tiffmeta.ExtractMetadata,
+	bmpmeta.ExtractMetadata,
 	netpbmmeta.ExtractMetadata,
 }
 
@@ -0,0 +1,59 @@
+package bmpmeta
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/kovidgoyal/imaging/prism/meta"
+	"github.com/kovidgoyal/imaging/types"
+)
+
+var _ = fmt.Print
+
+const (
+	fileHeaderLen = 14
+	coreHeaderLen = 12
+	infoHeaderLen = 40
+)
+
+func ExtractMetadata(r io.Reader) (md *meta.Data, err error) {
+	var b [fileHeaderLen + infoHeaderLen]byte
+	if _, err = io.ReadFull(r, b[:fileHeaderLen+4]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			err = nil
+		}
+		return nil, err
+	}
+	if string(b[:2]) != "BM" {
+		return nil, nil
+	}
+	md = &meta.Data{Format: types.BMP, BitsPerComponent: 8}
+	switch dib_size := binary.LittleEndian.Uint32(b[fileHeaderLen:]); {
+	case dib_size == coreHeaderLen:
+		h := b[fileHeaderLen+4 : fileHeaderLen+coreHeaderLen]
+		if _, err = io.ReadFull(r, h); err != nil {
+			return nil, err
+		}
+		md.PixelWidth, md.PixelHeight = uint32(binary.LittleEndian.Uint16(h)), uint32(binary.LittleEndian.Uint16(h[2:]))
+	case dib_size >= infoHeaderLen:
+		h := b[fileHeaderLen+4:]
+		if _, err = io.ReadFull(r, h); err != nil {
+			return nil, err
+		}
+		width, height := int32(binary.LittleEndian.Uint32(h)), int32(binary.LittleEndian.Uint32(h[4:]))
+		// negative heights are used for top down images
+		md.PixelWidth, md.PixelHeight = uint32(max(0, width)), uint32(max(height, -height))
+		if bpp := binary.LittleEndian.Uint16(h[10:]); bpp == 64 {
+			md.BitsPerComponent = 16
+		}
+		xppm, yppm := int32(binary.LittleEndian.Uint32(h[20:])), int32(binary.LittleEndian.Uint32(h[24:]))
+		if xppm > 0 && yppm > 0 {
+			md.Resolution = meta.Resolution{X: float64(xppm) / 100, Y: float64(yppm) / 100, Unit: meta.PixelsPerCentimeter}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported BMP header size: %d", dib_size)
+	}
+	return md, nil
+}
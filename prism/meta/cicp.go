@@ -36,13 +36,22 @@ func extend_over_full_range(f func(float64) float64) func(float64) float64 {
 	}
 }
 
+// PipelineTo returns a pipeline to convert code values encoded as per src to
+// code values encoded as per dest or nil if either is unsupported. When the
+// matrix coefficients are not identity, the three channels hold Y', Cb and Cr
+// (or their equivalents such as ICtCp) in that order. HDR content is tone
+// mapped using the default parameters when dest is not HDR and SDR content
+// has its white mapped to the default target peak when dest is HDR.
 func (src CodingIndependentCodePoints) PipelineTo(dest CodingIndependentCodePoints) *icc.Pipeline {
+	return src.PipelineToWithToneMapping(dest, ToneMapping{})
+}
+
+// Same as PipelineTo() except that HDR content is tone mapped using the
+// specified parameters, with unset parameters replaced by their defaults.
+func (src CodingIndependentCodePoints) PipelineToWithToneMapping(dest CodingIndependentCodePoints, tm ToneMapping) *icc.Pipeline {
 	if src == dest {
 		return nil
 	}
-	if src.MatrixCoefficients != 0 || dest.MatrixCoefficients != 0 {
-		return nil // TODO: Add support for these
-	}
 	if !src.VideoFullRangeIsValid() || !dest.VideoFullRangeIsValid() {
 		return nil
 	}
@@ -50,21 +59,17 @@ func (src CodingIndependentCodePoints) PipelineTo(dest CodingIndependentCodePoin
 	if p.Name == "" {
 		return nil
 	}
-	tc := transfer_functions[int(src.TransferCharacteristics)]
-	if tc.Name == "" {
+	to_linear := src.decoder()
+	if to_linear == nil {
 		return nil
 	}
-	to_linear := icc.NewUniformFunctionTransformer(tc.Name, icc.IfElse(src.VideoFullRange == SRGB.VideoFullRange, tc.EOTF, extend_over_full_range(tc.EOTF)))
-	if tc.Name == "Identity" {
-		to_linear = nil
-	}
 	linear_to_xyz := p.CalculateRGBtoXYZMatrix()
 	p = primaries[int(dest.ColorPrimaries)]
 	if p.Name == "" {
 		return nil
 	}
-	tc = transfer_functions[int(dest.TransferCharacteristics)]
-	if tc.Name == "" {
+	from_linear := dest.encoder()
+	if from_linear == nil {
 		return nil
 	}
 	xyz_to_linear := p.CalculateRGBtoXYZMatrix()
@@ -72,24 +77,52 @@ func (src CodingIndependentCodePoints) PipelineTo(dest CodingIndependentCodePoin
 	if err != nil {
 		panic(err)
 	}
-	f := icc.IfElse(dest.VideoFullRange == SRGB.VideoFullRange, tc.OETF, extend_over_full_range(tc.OETF))
-	from_linear := icc.NewUniformFunctionTransformer(tc.Name, func(x float64) float64 {
-		// TODO: Gamut mapping for white point of dest, re-use code from colorconv
-		return max(0, min(f(x), 1))
-	})
-	if tc.Name == "Identity" {
-		from_linear = nil
-	}
 	ans := &icc.Pipeline{}
-	ans.Append(to_linear, &linear_to_xyz, &xyz_to_linear, from_linear)
+	ans.Append(to_linear...)
+	tm = tm.WithDefaults(HDRMetadata{})
+	if src.IsHDR() && !dest.IsHDR() {
+		ans.Append(src.tone_mapper(tm, linear_to_xyz))
+	}
+	ans.Append(&linear_to_xyz, &xyz_to_linear)
+	if dest.IsHDR() && !src.IsHDR() {
+		// SDR white is mapped to the target peak, which defaults to the HDR reference white
+		ans.Append(dest.sdr_to_hdr(tm, p.CalculateRGBtoXYZMatrix()))
+	}
+	ans.Append(from_linear...)
 	ans.Finalize(true)
 	return ans
 }
 
+// PipelineToLinearWithToneMapping returns a pipeline to convert code values to
+// linear RGB, without clamping, and the primaries of the linear RGB, or nil
+// if unsupported. HDR content is tone mapped to SDR using the specified
+// parameters, with unset parameters replaced by their defaults.
+func (c CodingIndependentCodePoints) PipelineToLinearWithToneMapping(tm ToneMapping) (*icc.Pipeline, Primaries) {
+	p := primaries[int(c.ColorPrimaries)]
+	if p.Name == "" || !c.VideoFullRangeIsValid() {
+		return nil, p
+	}
+	to_linear := c.decoder()
+	if to_linear == nil {
+		return nil, p
+	}
+	ans := &icc.Pipeline{}
+	ans.Append(to_linear...)
+	if c.IsHDR() {
+		ans.Append(c.tone_mapper(tm.WithDefaults(HDRMetadata{}), p.CalculateRGBtoXYZMatrix()))
+	}
+	ans.Finalize(true)
+	return ans, p
+}
+
 func (c CodingIndependentCodePoints) PipelineToSRGB() *icc.Pipeline {
 	return c.PipelineTo(SRGB)
 }
 
+func (c CodingIndependentCodePoints) PipelineToSRGBWithToneMapping(tm ToneMapping) *icc.Pipeline {
+	return c.PipelineToWithToneMapping(SRGB, tm)
+}
+
 // XY holds CIE xy chromaticity coordinates.
 type XY struct {
 	X, Y float64
@@ -104,50 +137,15 @@ type Primaries struct {
 	White XY
 }
 
-// xyToXYZ converts xy chromaticity to XYZ coordinates, assuming Y=1.
-func xyToXYZ(p XY) [3]float64 {
-	if p.Y == 0 {
-		return [3]float64{0, 0, 0}
-	}
-	return [3]float64{
-		p.X / p.Y,
-		1.0,
-		(1.0 - p.X - p.Y) / p.Y,
-	}
-}
+func (p XY) as_array() [2]float64 { return [2]float64{p.X, p.Y} }
 
 // CalculateRGBtoXYZMatrix computes the matrix to convert from a linear RGB color space to CIE XYZ.
 func (cs *Primaries) CalculateRGBtoXYZMatrix() icc.Matrix3 {
-	// Convert primaries to XYZ space (normalized to Y=1)
-	r := xyToXYZ(cs.Red)
-	g := xyToXYZ(cs.Green)
-	b := xyToXYZ(cs.Blue)
-
-	// Form the matrix of primaries
-	M := icc.Matrix3{
-		{r[0], g[0], b[0]},
-		{r[1], g[1], b[1]},
-		{r[2], g[2], b[2]},
-	}
-
-	// Calculate the scaling factors (S_r, S_g, S_b)
-	invM, err := M.Inverted()
+	m, err := icc.RGBToXYZMatrix(cs.Red.as_array(), cs.Green.as_array(), cs.Blue.as_array(), cs.White.as_array())
 	if err != nil {
 		panic(err)
 	}
-	whiteXYZ := xyToXYZ(cs.White)
-
-	s_r := invM[0][0]*whiteXYZ[0] + invM[0][1]*whiteXYZ[1] + invM[0][2]*whiteXYZ[2]
-	s_g := invM[1][0]*whiteXYZ[0] + invM[1][1]*whiteXYZ[1] + invM[1][2]*whiteXYZ[2]
-	s_b := invM[2][0]*whiteXYZ[0] + invM[2][1]*whiteXYZ[1] + invM[2][2]*whiteXYZ[2]
-
-	// Scale the primaries matrix to get the final conversion matrix
-	finalMatrix := icc.Matrix3{
-		{M[0][0] * s_r, M[0][1] * s_g, M[0][2] * s_b},
-		{M[1][0] * s_r, M[1][1] * s_g, M[1][2] * s_b},
-		{M[2][0] * s_r, M[2][1] * s_g, M[2][2] * s_b},
-	}
-	return finalMatrix
+	return m
 }
 
 type WellKnownPrimaries int
@@ -450,3 +448,59 @@ func init() {
 		},
 	}
 }
+
+// Curve returns the EOTF as an ICC curve. Well known transfer functions are
+// represented exactly as parametric curves, others are sampled.
+func (tf TransferFunction) Curve() (icc.Curve1D, error) {
+	switch tf.ID {
+	case 1, 12:
+		return icc.NewParametricCurve(icc.SplitFunction, 1/gamma709, 1/alpha709, (alpha709-1)/alpha709, 1/delta709, delta709*beta709)
+	case 13:
+		return icc.NewParametricCurve(icc.SplitFunction, 2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045)
+	case 2:
+		return icc.NewParametricCurve(icc.SimpleGammaFunction, 1)
+	case 4:
+		return icc.NewParametricCurve(icc.SimpleGammaFunction, 2.2)
+	case 5:
+		return icc.NewParametricCurve(icc.SimpleGammaFunction, 2.8)
+	}
+	return icc.NewSampledCurve(tf.EOTF, 4096)
+}
+
+// MatrixTRCProfile returns a builder for a matrix/TRC ICC profile with the
+// specified primaries and transfer function
+func MatrixTRCProfile(description string, p Primaries, tf TransferFunction) (*icc.ProfileBuilder, error) {
+	trc, err := tf.Curve()
+	if err != nil {
+		return nil, err
+	}
+	return icc.NewMatrixTRCProfile(description, p.CalculateRGBtoXYZMatrix(), icc.XYToXYZ(p.White.as_array()), trc), nil
+}
+
+// LinearProfile returns a matrix/TRC ICC profile for linear RGB with the
+// specified primaries
+func LinearProfile(p Primaries) (*icc.Profile, error) {
+	trc, err := icc.NewParametricCurve(icc.SimpleGammaFunction, 1)
+	if err != nil {
+		return nil, err
+	}
+	return icc.NewMatrixTRCProfile(fmt.Sprintf("%s (Linear)", p.Name), p.CalculateRGBtoXYZMatrix(), icc.XYToXYZ(p.White.as_array()), trc).Build()
+}
+
+// ICCProfile returns a serialized matrix/TRC ICC profile equivalent to these
+// code points, for embedding in formats that do not support CICP
+func (c CodingIndependentCodePoints) ICCProfile() ([]byte, error) {
+	if c.MatrixCoefficients != 0 || c.VideoFullRange != 1 {
+		return nil, fmt.Errorf("cannot create an ICC profile for %s", c)
+	}
+	p := primaries[int(c.ColorPrimaries)]
+	tf := transfer_functions[int(c.TransferCharacteristics)]
+	if p.Name == "" || tf.Name == "" {
+		return nil, fmt.Errorf("cannot create an ICC profile for unknown %s", c)
+	}
+	b, err := MatrixTRCProfile(fmt.Sprintf("%s (%s)", p.Name, tf.Name), p, tf)
+	if err != nil {
+		return nil, err
+	}
+	return b.Encode()
+}
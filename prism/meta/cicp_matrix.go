@@ -0,0 +1,255 @@
+package meta
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kovidgoyal/imaging/prism/meta/icc"
+)
+
+var _ = fmt.Print
+
+// Code values use the constants for 8 bit samples from H.273, which are very
+// close to those for higher bit depths once normalized
+const (
+	narrow_range_black  = 16. / 255.
+	narrow_range_luma   = 219. / 255.
+	narrow_range_chroma = 224. / 255.
+	chroma_zero         = 128. / 255.
+)
+
+// Luma coefficients of red and blue from Table 4 of H.273
+var luma_coefficients = map[uint8][2]float64{
+	1:  {0.2126, 0.0722},
+	4:  {0.30, 0.11},
+	5:  {0.299, 0.114},
+	6:  {0.299, 0.114},
+	7:  {0.212, 0.087},
+	9:  {0.2627, 0.0593},
+	10: {0.2627, 0.0593},
+}
+
+// Matrices between L'M'S' and ICtCp from BT.2100
+var (
+	lms_to_ictcp_pq  = icc.Matrix3{{2048, 2048, 0}, {6610, -13613, 7003}, {17933, -17390, -543}}
+	lms_to_ictcp_hlg = icc.Matrix3{{2048, 2048, 0}, {3625, -7465, 3840}, {9500, -9212, -288}}
+	rgb_to_lms       = icc.Matrix3{{1688, 2146, 262}, {683, 2951, 462}, {99, 309, 3688}}
+)
+
+func init() {
+	for _, m := range []*icc.Matrix3{&lms_to_ictcp_pq, &lms_to_ictcp_hlg, &rgb_to_lms} {
+		m.Scale(1. / 4096.)
+	}
+}
+
+// The luma coefficients of red and blue, for matrix coefficients that use them
+func (c CodingIndependentCodePoints) luma_coefficients() (kr, kb float64, ok bool) {
+	switch c.MatrixCoefficients {
+	case 12, 13:
+		// Chromaticity derived, equations 39 and 40 of H.273 amount to the
+		// luminance of the red and blue primaries
+		p := primaries[int(c.ColorPrimaries)]
+		if p.Name == "" {
+			return
+		}
+		m := p.CalculateRGBtoXYZMatrix()
+		return m[1][0], m[1][2], true
+	}
+	k, ok := luma_coefficients[c.MatrixCoefficients]
+	return k[0], k[1], ok
+}
+
+// The matrix to convert R'G'B' to Y'CbCr with Cb and Cr in [-0.5, 0.5]
+func rgb_to_ycbcr_matrix(kr, kb float64) icc.Matrix3 {
+	kg := 1 - kr - kb
+	return icc.Matrix3{
+		{kr, kg, kb},
+		{-kr / (2 * (1 - kb)), -kg / (2 * (1 - kb)), 0.5},
+		{0.5, -kg / (2 * (1 - kr)), -kb / (2 * (1 - kr))},
+	}
+}
+
+// Matrix to convert R'G'B' to YCgCo
+var rgb_to_ycgco = icc.Matrix3{{0.25, 0.5, 0.25}, {-0.25, 0.5, -0.25}, {0.5, 0, -0.5}}
+
+// Translation and scaling to convert code values to Y' in [0, 1] and Cb, Cr in
+// [-0.5, 0.5] or R'G'B' in [0, 1]
+func (c CodingIndependentCodePoints) code_value_transform() (offset icc.Translation, scale icc.Matrix3) {
+	scale = *icc.NewScalingMatrix3(1)
+	has_chroma := c.MatrixCoefficients != 0
+	if c.VideoFullRange == 0 {
+		offset = icc.Translation{-narrow_range_black, -narrow_range_black, -narrow_range_black}
+		scale = *icc.NewScalingMatrix3(1 / narrow_range_luma)
+		if has_chroma {
+			scale[1][1], scale[2][2] = 1/narrow_range_chroma, 1/narrow_range_chroma
+		}
+	}
+	if has_chroma {
+		offset[1], offset[2] = -chroma_zero, -chroma_zero
+	}
+	return
+}
+
+func (c CodingIndependentCodePoints) code_value_decoder() []icc.ChannelTransformer {
+	offset, scale := c.code_value_transform()
+	if c.VideoFullRange == 0 {
+		return []icc.ChannelTransformer{&offset, &scale}
+	}
+	if !offset.Empty() {
+		return []icc.ChannelTransformer{&offset}
+	}
+	return nil
+}
+
+func (c CodingIndependentCodePoints) code_value_encoder() []icc.ChannelTransformer {
+	offset, scale := c.code_value_transform()
+	offset = icc.Translation{-offset[0], -offset[1], -offset[2]}
+	if c.VideoFullRange == 0 {
+		inv, err := scale.Inverted()
+		if err != nil {
+			panic(err)
+		}
+		return []icc.ChannelTransformer{&inv, &offset}
+	}
+	if !offset.Empty() {
+		return []icc.ChannelTransformer{&offset}
+	}
+	return nil
+}
+
+func ictcp_matrix(transfer_characteristics uint8) icc.Matrix3 {
+	return icc.IfElse(transfer_characteristics == 18, lms_to_ictcp_hlg, lms_to_ictcp_pq)
+}
+
+func must_invert(m icc.Matrix3) *icc.Matrix3 {
+	ans, err := m.Inverted()
+	if err != nil {
+		panic(err)
+	}
+	return &ans
+}
+
+// Transformers to convert code values to linear RGB or nil if the encoding is
+// not supported. The first, second and third channels hold Y', Cb and Cr
+// respectively when the matrix coefficients are not identity.
+func (c CodingIndependentCodePoints) decoder() []icc.ChannelTransformer {
+	tc := transfer_functions[int(c.TransferCharacteristics)]
+	if tc.Name == "" {
+		return nil
+	}
+	to_linear := icc.NewUniformFunctionTransformer(tc.Name, icc.IfElse(c.VideoFullRange == SRGB.VideoFullRange, tc.EOTF, extend_over_full_range(tc.EOTF)))
+	if tc.Name == "Identity" {
+		to_linear = nil
+	}
+	ans := c.code_value_decoder()
+	switch c.MatrixCoefficients {
+	case 0:
+		return append(ans, to_linear)
+	case 8:
+		return append(ans, must_invert(rgb_to_ycgco), to_linear)
+	case 10, 13:
+		kr, kb, ok := c.luma_coefficients()
+		if !ok {
+			return nil
+		}
+		return append(ans, new_constant_luminance(kr, kb, tc, false))
+	case 14:
+		return append(ans, must_invert(ictcp_matrix(c.TransferCharacteristics)), to_linear, must_invert(rgb_to_lms))
+	}
+	kr, kb, ok := c.luma_coefficients()
+	if !ok {
+		return nil
+	}
+	return append(ans, must_invert(rgb_to_ycbcr_matrix(kr, kb)), to_linear)
+}
+
+// Transformers to convert linear RGB to code values clamped to [0, 1] or nil
+// if the encoding is not supported
+func (c CodingIndependentCodePoints) encoder() []icc.ChannelTransformer {
+	tc := transfer_functions[int(c.TransferCharacteristics)]
+	if tc.Name == "" {
+		return nil
+	}
+	f := icc.IfElse(c.VideoFullRange == SRGB.VideoFullRange, tc.OETF, extend_over_full_range(tc.OETF))
+	clamp := icc.NewUniformFunctionTransformer("Clamp", func(x float64) float64 { return max(0, min(x, 1)) })
+	from_linear := icc.NewUniformFunctionTransformer(tc.Name, func(x float64) float64 {
+		return max(0, min(f(x), 1))
+	})
+	if tc.Name == "Identity" {
+		from_linear = clamp
+	}
+	var ans []icc.ChannelTransformer
+	switch c.MatrixCoefficients {
+	case 0:
+		ans = []icc.ChannelTransformer{from_linear}
+	case 8:
+		m := rgb_to_ycgco
+		ans = []icc.ChannelTransformer{from_linear, &m}
+	case 10, 13:
+		kr, kb, ok := c.luma_coefficients()
+		if !ok {
+			return nil
+		}
+		ans = []icc.ChannelTransformer{clamp, new_constant_luminance(kr, kb, tc, true)}
+	case 14:
+		lms, m := rgb_to_lms, ictcp_matrix(c.TransferCharacteristics)
+		ans = []icc.ChannelTransformer{clamp, &lms, from_linear, &m}
+	default:
+		kr, kb, ok := c.luma_coefficients()
+		if !ok {
+			return nil
+		}
+		m := rgb_to_ycbcr_matrix(kr, kb)
+		ans = []icc.ChannelTransformer{from_linear, &m}
+	}
+	if e := c.code_value_encoder(); e != nil {
+		ans = append(ans, e...)
+		ans = append(ans, clamp)
+	}
+	return ans
+}
+
+// The constant luminance Y'CbCr encodings of BT.2020 and chromaticity derived
+// constant luminance from equations 51 to 59 of H.273
+type constant_luminance struct {
+	kr, kb, nb, pb, nr, pr float64
+	tc                     TransferFunction
+	encode                 bool
+}
+
+func new_constant_luminance(kr, kb float64, tc TransferFunction, encode bool) *constant_luminance {
+	return &constant_luminance{
+		kr: kr, kb: kb, tc: tc, encode: encode,
+		nb: tc.OETF(1 - kb), pb: 1 - tc.OETF(kb),
+		nr: tc.OETF(1 - kr), pr: 1 - tc.OETF(kr),
+	}
+}
+
+func (c *constant_luminance) String() string {
+	return fmt.Sprintf("ConstantLuminance{kr: %.6v kb: %.6v encode: %v}", c.kr, c.kb, c.encode)
+}
+func (c *constant_luminance) IOSig() (int, int)                        { return 3, 3 }
+func (c *constant_luminance) Iter(f func(icc.ChannelTransformer) bool) { f(c) }
+func (c *constant_luminance) TransformGeneral(o, i []float64) {
+	o[0], o[1], o[2] = c.Transform(i[0], i[1], i[2])
+}
+
+func (c *constant_luminance) Transform(x, y, z float64) (float64, float64, float64) {
+	kg := 1 - c.kr - c.kb
+	if c.encode {
+		r, g, b := x, y, z
+		yc := c.tc.OETF(c.kr*r + kg*g + c.kb*b)
+		db, dr := c.tc.OETF(b)-yc, c.tc.OETF(r)-yc
+		return yc, db / (2 * icc.IfElse(db <= 0, c.nb, c.pb)), dr / (2 * icc.IfElse(dr <= 0, c.nr, c.pr))
+	}
+	yc, cb, cr := x, y, z
+	eotf := extend_over_full_range(c.tc.EOTF)
+	b := eotf(yc + 2*cb*icc.IfElse(cb <= 0, c.nb, c.pb))
+	r := eotf(yc + 2*cr*icc.IfElse(cr <= 0, c.nr, c.pr))
+	y_linear := eotf(yc)
+	g := (y_linear - c.kr*r - c.kb*b) / kg
+	if math.IsNaN(g) {
+		g = 0
+	}
+	return r, g, b
+}
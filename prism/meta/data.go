@@ -22,23 +22,50 @@ type Data struct {
 	HasFrames           bool
 	NumFrames, NumPlays int
 	CICP                CodingIndependentCodePoints
-
-	mutex          sync.Mutex
-	exifData       []byte
-	exif           *exif.Exif
-	exifErr        error
-	iccProfileData []byte
-	iccProfileErr  error
-	iccProfile     *icc.Profile
+	HDR                 HDRMetadata
+	Resolution          Resolution
+
+	// Color information from the PNG sRGB, gAMA, cHRM and sBIT chunks
+	HasSRGBChunk    bool
+	SRGBIntent      icc.RenderingIntent
+	Gamma           float64    // the encoding gamma, for example 1/2.2, zero when not specified
+	Chromaticities  *Primaries // nil when not specified
+	SignificantBits []uint8
+
+	// Textual metadata such as the PNG tEXt, zTXt and iTXt chunks
+	Text []TextEntry
+
+	// IPTC-IIM datasets and Photoshop image resources, nil if not present
+	IPTC      *IPTC
+	Photoshop *PhotoshopResources
+
+	mutex           sync.Mutex
+	exifData        []byte
+	exif            *exif.Exif
+	exifErr         error
+	iccProfileData  []byte
+	iccProfileErr   error
+	iccProfile      *icc.Profile
+	xmpData         []byte
+	xmpExtendedData []byte
+	xmpErr          error
+	xmp             *XMP
 }
 
 func (s *Data) Clone() *Data {
-	return &Data{
+	ans := &Data{
 		Format: s.Format, PixelWidth: s.PixelWidth, PixelHeight: s.PixelHeight, BitsPerComponent: s.BitsPerComponent,
-		HasFrames: s.HasFrames, NumFrames: s.NumFrames, NumPlays: s.NumPlays, CICP: s.CICP,
-		exifData: slices.Clone(s.exifData), exifErr: s.exifErr, iccProfileData: slices.Clone(s.iccProfileData),
-		iccProfileErr: s.iccProfileErr,
+		HasFrames: s.HasFrames, NumFrames: s.NumFrames, NumPlays: s.NumPlays, CICP: s.CICP, HDR: s.HDR,
+		Resolution: s.Resolution, HasSRGBChunk: s.HasSRGBChunk, SRGBIntent: s.SRGBIntent, Gamma: s.Gamma, SignificantBits: slices.Clone(s.SignificantBits),
+		Text: slices.Clone(s.Text), IPTC: s.IPTC, Photoshop: s.Photoshop, exifData: slices.Clone(s.exifData), exifErr: s.exifErr, iccProfileData: slices.Clone(s.iccProfileData),
+		iccProfileErr: s.iccProfileErr, xmpData: slices.Clone(s.xmpData), xmpExtendedData: slices.Clone(s.xmpExtendedData),
+		xmpErr: s.xmpErr,
+	}
+	if s.Chromaticities != nil {
+		c := *s.Chromaticities
+		ans.Chromaticities = &c
 	}
+	return ans
 }
 
 func (s *Data) IsSRGB() bool {
@@ -48,7 +75,10 @@ func (s *Data) IsSRGB() bool {
 	if p, err := s.ICCProfile(); p != nil && err == nil {
 		return p.IsSRGB()
 	}
-	return true
+	if s.HasSRGBChunk {
+		return true
+	}
+	return s.GammaAndChromaticitiesAreSRGB()
 }
 
 // Returns an extracted EXIF metadata object from this metadata.
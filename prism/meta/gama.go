@@ -0,0 +1,104 @@
+package meta
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kovidgoyal/imaging/prism/meta/icc"
+)
+
+var _ = fmt.Print
+
+// The tolerances used to decide if the gAMA and cHRM values are
+// close enough to sRGB to not need conversion. gAMA and cHRM values are
+// stored as integers scaled by 100000 so they cannot exactly represent
+// sRGB anyway.
+const (
+	gamma_srgb_tolerance        = 0.0005
+	chromaticity_srgb_tolerance = 0.001
+	srgb_encoding_gamma         = 1 / 2.2
+)
+
+func (a XY) is_close_to(b XY, tolerance float64) bool {
+	return math.Abs(a.X-b.X) <= tolerance && math.Abs(a.Y-b.Y) <= tolerance
+}
+
+func (p Primaries) is_close_to(q Primaries, tolerance float64) bool {
+	return p.Red.is_close_to(q.Red, tolerance) && p.Green.is_close_to(q.Green, tolerance) && p.Blue.is_close_to(q.Blue, tolerance) && p.White.is_close_to(q.White, tolerance)
+}
+
+// Returns true if the Gamma and Chromaticities are unset or approximately
+// sRGB. An encoding gamma of 1/2.2 is treated as sRGB as is conventional.
+func (s *Data) GammaAndChromaticitiesAreSRGB() bool {
+	if s.Gamma > 0 && math.Abs(s.Gamma-srgb_encoding_gamma) > gamma_srgb_tolerance {
+		return false
+	}
+	if s.Chromaticities != nil && !s.Chromaticities.is_close_to(primaries[1], chromaticity_srgb_tolerance) {
+		return false
+	}
+	return true
+}
+
+// Create a pipeline to convert from the colorspace defined by the Gamma and
+// Chromaticities to linear RGB, without clamping, returning it and the
+// primaries of the linear RGB. When only one of Gamma and Chromaticities is
+// specified, the other is assumed to be sRGB.
+func (s *Data) GammaAndChromaticitiesPipelineToLinear() (*icc.Pipeline, Primaries) {
+	ans := &icc.Pipeline{}
+	ans.Append(s.gamma_to_linear())
+	ans.Finalize(true)
+	if s.Chromaticities != nil {
+		return ans, *s.Chromaticities
+	}
+	return ans, primaries[int(SRGB.ColorPrimaries)]
+}
+
+func (s *Data) gamma_to_linear() *icc.UniformFunctionTransformer {
+	if s.Gamma > 0 {
+		exponent := 1 / s.Gamma
+		return icc.NewUniformFunctionTransformer(fmt.Sprintf("Gamma %.5g", s.Gamma), extend_over_full_range(func(x float64) float64 {
+			return math.Pow(x, exponent)
+		}))
+	}
+	srgb_tf := transfer_functions[int(SRGB.TransferCharacteristics)]
+	return icc.NewUniformFunctionTransformer(srgb_tf.Name, srgb_tf.EOTF)
+}
+
+// Create a pipeline to convert from the colorspace defined by the Gamma and
+// Chromaticities to sRGB. Returns nil if no conversion is needed. When only
+// one of Gamma and Chromaticities is specified, the other is assumed to be
+// sRGB.
+func (s *Data) GammaAndChromaticitiesPipelineToSRGB() *icc.Pipeline {
+	if s.GammaAndChromaticitiesAreSRGB() {
+		return nil
+	}
+	srgb_tf := transfer_functions[int(SRGB.TransferCharacteristics)]
+	ans := &icc.Pipeline{}
+	ans.Append(s.gamma_to_linear())
+	if s.Chromaticities != nil {
+		srgb := primaries[int(SRGB.ColorPrimaries)]
+		linear_to_xyz := s.Chromaticities.CalculateRGBtoXYZMatrix()
+		xyz_to_linear := srgb.CalculateRGBtoXYZMatrix()
+		xyz_to_linear, err := xyz_to_linear.Inverted()
+		if err != nil {
+			panic(err)
+		}
+		ans.Append(&linear_to_xyz, &xyz_to_linear)
+	}
+	ans.Append(icc.NewUniformFunctionTransformer(srgb_tf.Name, func(x float64) float64 {
+		return max(0, min(srgb_tf.OETF(x), 1))
+	}))
+	ans.Finalize(true)
+	return ans
+}
+
+// Returns a pipeline to convert the colors described by the legacy PNG color
+// chunks to sRGB following the precedence in the PNG spec, i.e. the sRGB
+// chunk overrides gAMA and cHRM. Note that cICP and iCCP take precedence
+// over all these and are not handled here. Returns nil if no conversion is needed.
+func (s *Data) PNGColorChunksPipelineToSRGB() *icc.Pipeline {
+	if s.HasSRGBChunk {
+		return nil
+	}
+	return s.GammaAndChromaticitiesPipelineToSRGB()
+}
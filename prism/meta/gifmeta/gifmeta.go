@@ -1,33 +1,135 @@
 package gifmeta
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"image/gif"
 	"io"
-	"strings"
 	"time"
 
 	"github.com/kovidgoyal/imaging/prism/meta"
+	"github.com/kovidgoyal/imaging/streams"
 	"github.com/kovidgoyal/imaging/types"
 )
 
 var _ = fmt.Print
 
 func ExtractMetadata(r io.Reader) (md *meta.Data, err error) {
-	c, err := gif.DecodeConfig(r)
+	var hdr [13]byte
+	n, err := io.ReadFull(r, hdr[:])
 	if err != nil {
-		if strings.Contains(err.Error(), "gif: can't recognize format") {
-			err = nil
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			if n < 3 || string(hdr[:3]) != "GIF" {
+				// not a GIF file
+				return nil, nil
+			}
+			return nil, fmt.Errorf("gif: truncated header: %w", io.ErrUnexpectedEOF)
 		}
 		return nil, err
 	}
+	if sig := string(hdr[:6]); sig != "GIF87a" && sig != "GIF89a" {
+		return nil, nil
+	}
 	md = &meta.Data{
-		Format: types.GIF, PixelWidth: uint32(c.Width), PixelHeight: uint32(c.Height),
+		Format: types.GIF, PixelWidth: uint32(binary.LittleEndian.Uint16(hdr[6:8])), PixelHeight: uint32(binary.LittleEndian.Uint16(hdr[8:10])),
 		BitsPerComponent: 8, HasFrames: true,
 	}
+	if packed := hdr[10]; packed&0x80 != 0 {
+		// skip the global color table
+		if err = streams.Skip(r, 3<<((packed&7)+1)); err != nil {
+			return nil, err
+		}
+	}
+	if xmp, err := read_xmp(r); err != nil {
+		md.SetXMPError(err)
+	} else if xmp != nil {
+		md.SetXMPData(xmp, nil)
+	}
 	return md, nil
 }
 
+const (
+	extensionIntroducer = 0x21
+	imageSeparator      = 0x2c
+	trailer             = 0x3b
+	applicationLabel    = 0xff
+)
+
+func skip_sub_blocks(r io.Reader) error {
+	for {
+		n, err := streams.ReadByte(r)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if err = streams.Skip(r, int64(n)); err != nil {
+			return err
+		}
+	}
+}
+
+// Reads the XMP application extension, if any, that occurs before the first
+// image. XMP data is stored raw with a "magic trailer" that allows it to be
+// read as sub-blocks, so the length bytes are part of the data.
+func read_xmp(r io.Reader) ([]byte, error) {
+	for {
+		b, err := streams.ReadByte(r)
+		if err != nil {
+			return nil, err
+		}
+		switch b {
+		case imageSeparator, trailer:
+			return nil, nil
+		case extensionIntroducer:
+		default:
+			return nil, fmt.Errorf("gif: unknown block type: 0x%x", b)
+		}
+		label, err := streams.ReadByte(r)
+		if err != nil {
+			return nil, err
+		}
+		if label == applicationLabel {
+			size, err := streams.ReadByte(r)
+			if err != nil {
+				return nil, err
+			}
+			id := make([]byte, size)
+			if _, err = io.ReadFull(r, id); err != nil {
+				return nil, err
+			}
+			if string(id) == "XMP DataXMP" {
+				data := bytes.Buffer{}
+				for {
+					n, err := streams.ReadByte(r)
+					if err != nil {
+						return nil, err
+					}
+					if n == 0 {
+						break
+					}
+					data.WriteByte(n)
+					if _, err = io.CopyN(&data, r, int64(n)); err != nil {
+						return nil, err
+					}
+				}
+				ans := data.Bytes()
+				if idx := bytes.LastIndex(ans, []byte("<?xpacket end=")); idx > -1 {
+					if end := bytes.Index(ans[idx:], []byte("?>")); end > -1 {
+						ans = ans[:idx+end+2]
+					}
+				}
+				return ans, nil
+			}
+		}
+		if err = skip_sub_blocks(r); err != nil {
+			return nil, err
+		}
+	}
+}
+
 func CalcMinimumGap(gaps []int) (min_gap int) {
 	// Some broken GIF images have all zero gaps, browsers with their usual
 	// idiot ideas render these with a default 100ms gap https://bugzilla.mozilla.org/show_bug.cgi?id=125137
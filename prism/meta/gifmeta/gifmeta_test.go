@@ -0,0 +1,80 @@
+package gifmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/kovidgoyal/imaging/types"
+	"github.com/stretchr/testify/require"
+)
+
+const test_xmp_packet = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?><x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="3"/>
+</rdf:RDF></x:xmpmeta><?xpacket end="w"?>`
+
+func gif_header(global_color_table bool) *bytes.Buffer {
+	data := &bytes.Buffer{}
+	data.WriteString("GIF89a")
+	binary.Write(data, binary.LittleEndian, uint16(7))
+	binary.Write(data, binary.LittleEndian, uint16(5))
+	if global_color_table {
+		data.Write([]byte{0x80, 0, 0})
+		data.Write(make([]byte, 6))
+	} else {
+		data.Write([]byte{0, 0, 0})
+	}
+	return data
+}
+
+func TestExtractMetadata(t *testing.T) {
+	t.Run("reads XMP metadata", func(t *testing.T) {
+		data := gif_header(true)
+		// an unrelated application extension that must be skipped
+		data.Write([]byte{extensionIntroducer, applicationLabel, 11})
+		data.WriteString("NETSCAPE2.0")
+		data.Write([]byte{3, 1, 0, 0, 0})
+		data.Write([]byte{extensionIntroducer, applicationLabel, 11})
+		data.WriteString("XMP DataXMP")
+		data.WriteString(test_xmp_packet)
+		// the magic trailer
+		data.WriteByte(1)
+		for i := 255; i >= 0; i-- {
+			data.WriteByte(byte(i))
+		}
+		data.WriteByte(0)
+		data.WriteByte(imageSeparator)
+
+		md, err := ExtractMetadata(data)
+		require.NoError(t, err)
+		require.Equal(t, types.GIF, md.Format)
+		require.Equal(t, uint32(7), md.PixelWidth)
+		require.Equal(t, uint32(5), md.PixelHeight)
+		packet, _ := md.XMPData()
+		require.Equal(t, test_xmp_packet, string(packet))
+		x, err := md.XMP()
+		require.NoError(t, err)
+		require.Equal(t, 3.0, x.Rating)
+	})
+
+	t.Run("no XMP metadata", func(t *testing.T) {
+		data := gif_header(false)
+		data.WriteByte(trailer)
+		md, err := ExtractMetadata(data)
+		require.NoError(t, err)
+		packet, _ := md.XMPData()
+		require.Nil(t, packet)
+	})
+
+	t.Run("not a GIF", func(t *testing.T) {
+		md, err := ExtractMetadata(bytes.NewReader([]byte("\x89PNG")))
+		require.NoError(t, err)
+		require.Nil(t, md)
+	})
+
+	t.Run("truncated header", func(t *testing.T) {
+		md, err := ExtractMetadata(bytes.NewReader(gif_header(false).Bytes()[:9]))
+		require.Error(t, err)
+		require.Nil(t, md)
+	})
+}
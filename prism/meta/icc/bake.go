@@ -0,0 +1,250 @@
+package icc
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kovidgoyal/go-parallel"
+)
+
+var _ = fmt.Print
+
+// The default number of grid points per input channel of baked pipelines
+const DefaultBakedLUTGridPoints = 33
+
+// Pipelines with four inputs use at most this many grid points per input
+// channel when baked, as the size of the table grows with the fourth power
+const MaxBakedLUTGridPoints4 = 17
+
+// The minimum number of pixels in an image for OptimizedFor() to bake a
+// pipeline, below this evaluating the pipeline directly is faster
+const MinPixelsForBakedLUT = 512 * 512
+
+// The maximum difference between the outputs of a baked pipeline and the
+// pipeline it approximates for OptimizedFor() to use it, a fraction of an 8
+// bit level. Pipelines whose tables cannot be resampled this accurately, for
+// example, most conversions to and from CMYK, are only baked by calling
+// Bake() explicitly.
+const MaxBakedLUTError = 1. / 512
+
+const num_shaper_points = 4096
+
+// Whether the pipeline is expensive to evaluate per pixel, i.e. it
+// interpolates a color lookup table, maps the gamut or has many stages
+func (p *Pipeline) is_expensive() bool {
+	for _, t := range p.transformers {
+		switch t.(type) {
+		case CLUT, *GamutMapper:
+			return true
+		}
+	}
+	return len(p.transformers) > 6
+}
+
+// Return a pipeline to use for converting the colors of an image with the
+// specified number of pixels. This is a baked version of this pipeline for
+// large images when this pipeline is expensive to evaluate and the baked
+// version is accurate to within MaxBakedLUTError, see Bake(), otherwise it is
+// this pipeline. The baked version is computed only once and cached.
+func (p *Pipeline) OptimizedFor(num_pixels int) *Pipeline {
+	if num_pixels < MinPixelsForBakedLUT || !p.is_expensive() {
+		return p
+	}
+	p.optimized_mutex.Lock()
+	defer p.optimized_mutex.Unlock()
+	if p.optimized == nil {
+		p.optimized = p
+		if ans, difference, err := p.bake(DefaultBakedLUTGridPoints); err == nil && difference <= MaxBakedLUTError {
+			p.optimized = ans
+		}
+	}
+	return p.optimized
+}
+
+// Sample the stages of the pipeline in [start, end) into a CLUT whose
+// inputs are the outputs of the shaper curves
+func (p *Pipeline) sample(start, end, grid_points int) (CLUT, error) {
+	rest := &Pipeline{transformers: p.transformers[start:end]}
+	num_inputs, num_outputs := rest.IOSig()
+	stride := num_outputs
+	for range num_inputs - 1 {
+		stride *= grid_points
+	}
+	samples := make([]unit_float, stride*grid_points)
+	last := unit_float(grid_points - 1)
+	// Parallelize over the first, slowest varying, input channel
+	if err := parallel.Run_in_parallel_over_range(0, func(start, limit int) {
+		var in, out [4]unit_float
+		idx := make([]int, num_inputs)
+		for first := start; first < limit; first++ {
+			s := samples[first*stride : (first+1)*stride]
+			idx[0] = first
+			for i := range idx[1:] {
+				idx[i+1] = 0
+			}
+			for len(s) > 0 {
+				for i, x := range idx {
+					in[i] = unit_float(x) / last
+				}
+				rest.TransformGeneral(out[:], in[:])
+				copy(s, out[:num_outputs])
+				s = s[num_outputs:]
+				// Increment the index, with the last input varying fastest
+				for i := num_inputs - 1; i > 0; i-- {
+					if idx[i]++; idx[i] < grid_points {
+						break
+					}
+					idx[i] = 0
+				}
+			}
+		}
+	}, 0, grid_points); err != nil {
+		return nil, err
+	}
+	grid := make([]int, num_inputs)
+	for i := range grid {
+		grid[i] = grid_points
+	}
+	return make_clut(grid, num_inputs, num_outputs, samples, false, false), nil
+}
+
+func sampled_shaper(c Curves) (ChannelTransformer, error) {
+	shapers := make([]Curve1D, 0, 4)
+	is_inverse := false
+	switch c.(type) {
+	case *InverseCurveTransformer, *InverseCurveTransformer3:
+		is_inverse = true
+	}
+	for _, x := range c.Curves() {
+		s, err := NewSampledCurve(IfElse(is_inverse, x.InverseTransform, x.Transform), num_shaper_points)
+		if err != nil {
+			return nil, err
+		}
+		shapers = append(shapers, s)
+	}
+	return NewCurveTransformer("Shaper", shapers...), nil
+}
+
+// The index of the first stage of the trailing per-channel curves of the
+// pipeline, optionally followed by a function such as Clamp, or -1
+func (p *Pipeline) output_shaper_start() int {
+	end := len(p.transformers)
+	if _, ok := p.transformers[end-1].(*UniformFunctionTransformer); ok {
+		end--
+	}
+	if end < 1 {
+		return -1
+	}
+	if c, ok := p.transformers[end-1].(Curves); ok {
+		if i, o := c.IOSig(); i == o && len(c.Curves()) == o {
+			return end - 1
+		}
+	}
+	return -1
+}
+
+func (p *Pipeline) bake_with_shapers(input_shaper, output_shaper bool, grid_points int) (*Pipeline, error) {
+	ans := &Pipeline{}
+	start, end := 0, len(p.transformers)
+	if input_shaper {
+		s, err := sampled_shaper(p.transformers[0].(Curves))
+		if err != nil {
+			return nil, err
+		}
+		ans.Append(s)
+		start = 1
+	}
+	if output_shaper {
+		end = p.output_shaper_start()
+	}
+	clut, err := p.sample(start, end, grid_points)
+	if err != nil {
+		return nil, err
+	}
+	ans.Append(clut)
+	// The output shaper is applied after the CLUT rather than sampled into
+	// it, as interpolating across its steep or clamped regions is inaccurate
+	for _, t := range p.transformers[end:] {
+		if c, ok := t.(Curves); ok {
+			if t, err = sampled_shaper(c); err != nil {
+				return nil, err
+			}
+		}
+		ans.Append(t)
+	}
+	ans.finalize(false)
+	return ans, nil
+}
+
+// The maximum difference between the outputs of the two pipelines
+func max_pipeline_difference(a, b *Pipeline, points []unit_float) (ans unit_float) {
+	num_inputs, num_outputs := a.IOSig()
+	var in, oa, ob [4]unit_float
+	for i := 0; i < len(points); i += num_inputs {
+		copy(in[:], points[i:i+num_inputs])
+		a.TransformGeneral(oa[:], in[:])
+		copy(in[:], points[i:i+num_inputs])
+		b.TransformGeneral(ob[:], in[:])
+		for c := range num_outputs {
+			ans = max(ans, math.Abs(oa[c]-ob[c]))
+		}
+	}
+	return
+}
+
+// Bake returns a pipeline that approximates this one with a tetrahedrally
+// interpolated color lookup table with grid_points per input channel, which
+// is much faster to evaluate for pipelines with many stages or with lookup
+// tables of their own. When this pipeline starts or ends with per-channel
+// curves, they are sampled into 1D shapers around the table if that gives a
+// more accurate result. Only pipelines with three or four inputs can be
+// baked and inputs are clamped to [0, 1].
+func (p *Pipeline) Bake(grid_points int) (*Pipeline, error) {
+	ans, _, err := p.bake(grid_points)
+	return ans, err
+}
+
+// Bake the pipeline, also returning the maximum difference between the
+// outputs of the baked and this pipeline at points that are not on the grid
+func (p *Pipeline) bake(grid_points int) (ans *Pipeline, ans_difference unit_float, err error) {
+	num_inputs, num_outputs := p.IOSig()
+	if num_inputs != 3 && num_inputs != 4 {
+		return nil, 0, fmt.Errorf("only pipelines with three or four inputs can be baked, not: %d", num_inputs)
+	}
+	if num_outputs < 1 || num_outputs > 4 || !p.IsSuitableFor(num_inputs, num_outputs) {
+		return nil, 0, fmt.Errorf("cannot bake the pipeline: %s", p.String())
+	}
+	if num_inputs == 4 {
+		grid_points = min(grid_points, MaxBakedLUTGridPoints4)
+	}
+	if grid_points < 2 || grid_points > math.MaxUint8 {
+		return nil, 0, fmt.Errorf("invalid number of grid points for a baked pipeline: %d", grid_points)
+	}
+	type shapers struct{ input, output bool }
+	candidates := []shapers{{false, false}}
+	c, has_input := p.transformers[0].(Curves)
+	has_input = has_input && len(c.Curves()) == num_inputs && len(p.transformers) > 1
+	output_start := p.output_shaper_start()
+	if has_input {
+		candidates = append(candidates, shapers{true, false})
+	}
+	if output_start > 0 {
+		candidates = append(candidates, shapers{false, true})
+		if has_input && output_start > 1 {
+			candidates = append(candidates, shapers{true, true})
+		}
+	}
+	// Compare at points that do not lie on the grid
+	pts := points_for_transformer_comparison(num_inputs, IfElse(num_inputs == 4, 8, 12))
+	for _, s := range candidates {
+		q, err := p.bake_with_shapers(s.input, s.output, grid_points)
+		if err != nil {
+			return nil, 0, err
+		}
+		if d := max_pipeline_difference(p, q, pts); ans == nil || d < ans_difference {
+			ans, ans_difference = q, d
+		}
+	}
+	ans.has_lut16type_tag = p.has_lut16type_tag
+	return ans, ans_difference, nil
+}
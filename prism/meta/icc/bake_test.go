@@ -0,0 +1,86 @@
+package icc
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ = fmt.Print
+
+// The mean and maximum absolute differences between the outputs of the two
+// pipelines over all points
+func pipeline_differences(a, b *Pipeline, points []unit_float) (mean, maximum unit_float) {
+	num_inputs, num_outputs := a.IOSig()
+	var in, oa, ob [4]unit_float
+	count := 0
+	for i := 0; i < len(points); i += num_inputs {
+		copy(in[:], points[i:i+num_inputs])
+		a.TransformGeneral(oa[:], in[:])
+		copy(in[:], points[i:i+num_inputs])
+		b.TransformGeneral(ob[:], in[:])
+		for c := range num_outputs {
+			d := math.Abs(oa[c] - ob[c])
+			mean += d
+			maximum = max(maximum, d)
+			count++
+		}
+	}
+	return mean / unit_float(count), maximum
+}
+
+func TestBakedPipelines(t *testing.T) {
+	srgb, err := SRGBProfile.Profile()
+	require.NoError(t, err)
+	load := func(name string) *Profile {
+		p, err := ReadProfile("test-profiles/" + name)
+		require.NoError(t, err)
+		return p
+	}
+	cmyk, lut, prophoto := load("cmyk.icc"), load("lcms-check-lut.icc"), load("prophoto.icc")
+	for _, x := range []struct {
+		name      string
+		from, to  *Profile
+		mean, max unit_float
+		// Whether OptimizedFor() bakes the pipeline for large images
+		auto_baked bool
+	}{
+		// The CLUTs of the CMYK profile cannot be resampled accurately enough
+		// to be baked automatically
+		{"sRGB to CMYK", srgb, cmyk, 1e-3, 0.04, false},
+		{"CMYK to sRGB", cmyk, srgb, 5e-4, 6e-3, false},
+		{"LUT to sRGB", lut, srgb, 1e-4, 1e-3, true},
+		{"ProPhoto to sRGB", prophoto, srgb, 1e-4, 1e-3, false},
+	} {
+		num_inputs := IfElse(x.from.Header.DataColorSpace == ColorSpaceCMYK, 4, 3)
+		tr, err := x.from.CreateTransformerToProfile(x.to, RelativeColorimetricRenderingIntent, false, num_inputs, true, true)
+		require.NoError(t, err, x.name)
+		baked, err := tr.Bake(DefaultBakedLUTGridPoints)
+		require.NoError(t, err, x.name)
+		require.LessOrEqual(t, baked.Len(), 4, "%s: %s", x.name, baked.String())
+		// Use points that mostly do not lie on the grid
+		pts := points_for_transformer_comparison(num_inputs, IfElse(num_inputs == 4, 11, 23))
+		mean, maximum := pipeline_differences(tr, baked, pts)
+		require.LessOrEqual(t, mean, x.mean, x.name)
+		require.LessOrEqual(t, maximum, x.max, x.name)
+		require.Same(t, tr, tr.OptimizedFor(MinPixelsForBakedLUT-1), x.name)
+		optimized := tr.OptimizedFor(MinPixelsForBakedLUT)
+		if x.auto_baked {
+			require.NotSame(t, tr, optimized, x.name)
+			_, maximum = pipeline_differences(tr, optimized, pts)
+			require.LessOrEqual(t, maximum, MaxBakedLUTError, x.name)
+		} else {
+			require.Same(t, tr, optimized, x.name)
+		}
+		// The result is cached
+		require.Same(t, optimized, tr.OptimizedFor(2*MinPixelsForBakedLUT), x.name)
+	}
+	_, err = (&Pipeline{}).Bake(DefaultBakedLUTGridPoints)
+	require.Error(t, err)
+	tr, err := srgb.CreateTransformerToProfile(srgb, RelativeColorimetricRenderingIntent, false, 3, true, true)
+	require.NoError(t, err)
+	_, err = tr.Bake(1)
+	require.Error(t, err)
+}
@@ -0,0 +1,143 @@
+package icc
+
+import (
+	"fmt"
+	"sync"
+)
+
+var _ = fmt.Print
+
+// Optionally implemented by a ChannelTransformer to transform many pixels at
+// once, avoiding a dynamic call per pixel. in and out hold one plane per
+// input and output channel, all of the same length. A plane in out may be
+// the same slice as the plane for that channel in in, so all inputs of a
+// pixel must be read before any of its outputs are written.
+type BatchTransformer interface {
+	TransformPlanes(out, in [][]unit_float)
+}
+
+// The layout of the pixels in the buffers passed to Pipeline.TransformSlice()
+type PixelLayout uint8
+
+const (
+	// The channels of each pixel are contiguous, for example: RGBRGBRGB
+	InterleavedPixels PixelLayout = iota
+	// Each channel is contiguous, for example: RRRGGGBBB
+	PlanarPixels
+)
+
+func (l PixelLayout) String() string {
+	switch l {
+	case InterleavedPixels:
+		return "InterleavedPixels"
+	case PlanarPixels:
+		return "PlanarPixels"
+	}
+	return fmt.Sprintf("PixelLayout(%d)", uint8(l))
+}
+
+// The number of pixels transformed by each stage of a pipeline at a time
+const batch_size = 256
+
+type batch_buffer [4][batch_size]unit_float
+
+var batch_buffers = sync.Pool{New: func() any { return new(batch_buffer) }}
+
+func tp33(t func(r, g, b unit_float) (x, y, z unit_float), o, i [][]unit_float) {
+	i0 := i[0]
+	i1, i2 := i[1][:len(i0)], i[2][:len(i0)]
+	o0, o1, o2 := o[0][:len(i0)], o[1][:len(i0)], o[2][:len(i0)]
+	for k, r := range i0 {
+		o0[k], o1[k], o2[k] = t(r, i1[k], i2[k])
+	}
+}
+
+// Transform the pixels in planes in place, there must be a plane for each
+// channel of the widest stage of the pipeline
+func (p *Pipeline) transform_planes(planes [][]unit_float) {
+	var in, out [4]unit_float
+	for _, t := range p.transformers {
+		nin, nout := t.IOSig()
+		if bt, ok := t.(BatchTransformer); ok {
+			bt.TransformPlanes(planes[:nout], planes[:nin])
+			continue
+		}
+		for k := range planes[0] {
+			for c := range nin {
+				in[c] = planes[c][k]
+			}
+			t.TransformGeneral(out[:], in[:])
+			for c := range nout {
+				planes[c][k] = out[c]
+			}
+		}
+	}
+}
+
+// TransformSlice transforms all the pixels in the in buffer, writing the
+// results to the out buffer, using the specified layout for both. The number
+// of channels per pixel in the buffers is given by IOSig(). in and out can
+// be the same buffer when the pipeline has as many outputs as inputs.
+func (p *Pipeline) TransformSlice(out, in []float32, layout PixelLayout) {
+	transform_slice(p, out, in, layout)
+}
+
+// TransformSlice64 is the same as TransformSlice() except that it uses float64
+// buffers, for when the values must not lose any precision
+func (p *Pipeline) TransformSlice64(out, in []float64, layout PixelLayout) {
+	transform_slice(p, out, in, layout)
+}
+
+func transform_slice[T float32 | float64](p *Pipeline, out, in []T, layout PixelLayout) {
+	nin, nout := p.IOSig()
+	if nin < 1 {
+		panic("cannot transform pixels with an empty pipeline")
+	}
+	n := len(in) / nin
+	if len(in) != n*nin || len(out) != n*nout {
+		panic(fmt.Sprintf("buffer sizes: %d and %d do not match the %d inputs and %d outputs of the pipeline", len(in), len(out), nin, nout))
+	}
+	buf := batch_buffers.Get().(*batch_buffer)
+	defer batch_buffers.Put(buf)
+	var planes [4][]unit_float
+	for start := 0; start < n; start += batch_size {
+		count := min(batch_size, n-start)
+		for c := range planes {
+			planes[c] = buf[c][:count]
+		}
+		switch layout {
+		case InterleavedPixels:
+			src := in[start*nin : (start+count)*nin]
+			for c, plane := range planes[:nin] {
+				for k := range plane {
+					plane[k] = unit_float(src[k*nin+c])
+				}
+			}
+		case PlanarPixels:
+			for c, plane := range planes[:nin] {
+				for k, x := range in[c*n+start : c*n+start+count] {
+					plane[k] = unit_float(x)
+				}
+			}
+		default:
+			panic(fmt.Sprintf("unknown pixel layout: %s", layout))
+		}
+		p.transform_planes(planes[:])
+		switch layout {
+		case InterleavedPixels:
+			dest := out[start*nout : (start+count)*nout]
+			for c, plane := range planes[:nout] {
+				for k, x := range plane {
+					dest[k*nout+c] = T(x)
+				}
+			}
+		case PlanarPixels:
+			for c, plane := range planes[:nout] {
+				dest := out[c*n+start : c*n+start+count]
+				for k, x := range plane {
+					dest[k] = T(x)
+				}
+			}
+		}
+	}
+}
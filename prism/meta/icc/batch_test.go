@@ -0,0 +1,80 @@
+package icc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ = fmt.Print
+
+func TestTransformSlice(t *testing.T) {
+	srgb, err := SRGBProfile.Profile()
+	require.NoError(t, err)
+	load := func(name string) *Profile {
+		p, err := ReadProfile("test-profiles/" + name)
+		require.NoError(t, err)
+		return p
+	}
+	gray, err := Gray22Profile.Profile()
+	require.NoError(t, err)
+	cmyk, lut := load("cmyk.icc"), load("lcms-check-lut.icc")
+	for _, x := range []struct {
+		name       string
+		from, to   *Profile
+		num_inputs int
+	}{
+		{"sRGB to CMYK", srgb, cmyk, 3},
+		{"CMYK to sRGB", cmyk, srgb, 4},
+		{"LUT to sRGB", lut, srgb, 3},
+		{"Gray to sRGB", gray, srgb, 1},
+		{"CMYK to CMYK", cmyk, cmyk, 4},
+	} {
+		tr, err := x.from.CreateTransformerToProfile(x.to, RelativeColorimetricRenderingIntent, false, x.num_inputs, true, true)
+		require.NoError(t, err, x.name)
+		nin, nout := tr.IOSig()
+		// Use a number of pixels that is not a multiple of the batch size
+		pts := points_for_transformer_comparison(nin, IfElse(nin == 4, 9, IfElse(nin == 1, 1000, 17)))
+		n := len(pts) / nin
+		var inbuf, expected [4]unit_float
+		interleaved, planar := make([]float32, len(pts)), make([]float32, len(pts))
+		for k := range n {
+			for c := range nin {
+				interleaved[k*nin+c] = float32(pts[k*nin+c])
+				planar[c*n+k] = float32(pts[k*nin+c])
+			}
+		}
+		iout, pout := make([]float32, n*nout), make([]float32, n*nout)
+		tr.TransformSlice(iout, interleaved, InterleavedPixels)
+		tr.TransformSlice(pout, planar, PlanarPixels)
+		out64 := make([]float64, n*nout)
+		tr.TransformSlice64(out64, pts, InterleavedPixels)
+		for k := range n {
+			// Use the float32 input values so the results are comparable
+			for c := range nin {
+				inbuf[c] = unit_float(interleaved[k*nin+c])
+			}
+			tr.TransformGeneral(expected[:], inbuf[:])
+			for c := range nout {
+				require.InDelta(t, expected[c], iout[k*nout+c], 1e-5, "%s: pixel %d channel %d", x.name, k, c)
+				require.InDelta(t, expected[c], pout[c*n+k], 1e-5, "%s: pixel %d channel %d", x.name, k, c)
+			}
+			copy(inbuf[:], pts[k*nin:(k+1)*nin])
+			tr.TransformGeneral(expected[:], inbuf[:])
+			for c := range nout {
+				require.InDelta(t, expected[c], out64[k*nout+c], 1e-12, "%s: pixel %d channel %d", x.name, k, c)
+			}
+		}
+		if nin == nout {
+			// Transforming in place
+			tr.TransformSlice(interleaved, interleaved, InterleavedPixels)
+			require.Equal(t, iout, interleaved, x.name)
+			tr.TransformSlice(planar, planar, PlanarPixels)
+			require.Equal(t, pout, planar, x.name)
+		}
+	}
+	tr, err := srgb.CreateTransformerToProfile(srgb, RelativeColorimetricRenderingIntent, false, 3, true, true)
+	require.NoError(t, err)
+	require.Panics(t, func() { tr.TransformSlice(make([]float32, 3), make([]float32, 4), InterleavedPixels) })
+}
@@ -0,0 +1,91 @@
+package icc
+
+import (
+	"fmt"
+)
+
+var _ = fmt.Println
+
+// Create a transformer from the AToB or DToB tag of a device link or abstract
+// profile. It works with normalized values for both the data and connection
+// color spaces. See _cmsReadDevicelinkLUT() in cmsio1.c in lcms.
+func (p *Profile) create_lut_transformer(rendering_intent RenderingIntent) (ans *Pipeline, err error) {
+	const forward = true
+	a2b, err := p.find_conversion_tag(forward, rendering_intent)
+	if err != nil {
+		return nil, err
+	}
+	if a2b == nil {
+		return nil, fmt.Errorf("%s profile has no AToB or DToB tag", p.Header.DeviceClass)
+	}
+	ans = &Pipeline{}
+	ans.Append(a2b)
+	if ans.has_lut16type_tag {
+		// The lut16type data uses the legacy LAB encoding
+		if p.Header.DataColorSpace == ColorSpaceLab {
+			ans.Insert(0, NewLABToMFT2())
+		}
+		if p.Header.ProfileConnectionSpace == ColorSpaceLab {
+			ans.Append(NewLABFromMFT2())
+		}
+	}
+	return
+}
+
+// Create a transformer that applies this device link profile, converting
+// colors from its input color space directly to its output color space. Lab
+// and XYZ values are not normalized, as for CreateTransformerToPCS(). If clamp
+// is true and the output has three channels, output values are clamped to
+// [0, 1].
+func (p *Profile) CreateDeviceLinkTransformer(rendering_intent RenderingIntent, input_channels int, clamp, optimize bool) (ans *Pipeline, err error) {
+	if p.Header.DeviceClass != DeviceClassLink {
+		return nil, fmt.Errorf("not a device link profile, has class: %s", p.Header.DeviceClass)
+	}
+	in, out := p.Header.DataColorSpace, p.Header.ProfileConnectionSpace
+	num_output_channels := len(out.BlackPoint())
+	lut, err := p.create_lut_transformer(rendering_intent)
+	if err != nil {
+		return nil, err
+	}
+	ans = &Pipeline{}
+	if in == ColorSpaceLab || in == ColorSpaceXYZ {
+		ans.Append(transform_for_pcs_colorspace(in, false))
+	}
+	ans.Append(lut.transformers...)
+	if out == ColorSpaceLab || out == ColorSpaceXYZ {
+		ans.Append(transform_for_pcs_colorspace(out, true))
+	} else if clamp && num_output_channels == 3 {
+		ans.Append(NewUniformFunctionTransformer("Clamp", clamp01))
+	}
+	if !ans.IsSuitableFor(input_channels, num_output_channels) {
+		return nil, fmt.Errorf("transformer %s not suitable for %d input channels and %d output channels", ans.String(), input_channels, num_output_channels)
+	}
+	ans.finalize(optimize)
+	return
+}
+
+// Append the transforms of abstract profiles to the pipeline which must
+// output non-normalized values in the pcs color space. Returns the color space
+// of the output of the last abstract profile.
+func append_abstract_profiles(ans *Pipeline, pcs ColorSpace, illuminant XYZType, rendering_intent RenderingIntent, abstract_profiles ...*Profile) (ColorSpace, error) {
+	for _, a := range abstract_profiles {
+		if a.Header.DeviceClass != DeviceClassAbstract {
+			return pcs, fmt.Errorf("not an abstract profile, has class: %s", a.Header.DeviceClass)
+		}
+		lut, err := a.create_lut_transformer(rendering_intent)
+		if err != nil {
+			return pcs, err
+		}
+		switch in := a.Header.DataColorSpace; {
+		case pcs == ColorSpaceLab && in == ColorSpaceXYZ:
+			ans.Append(NewLABtoXYZ(illuminant))
+		case pcs == ColorSpaceXYZ && in == ColorSpaceLab:
+			ans.Append(NewXYZtoLAB(illuminant))
+		}
+		ans.Append(transform_for_pcs_colorspace(a.Header.DataColorSpace, false))
+		ans.Append(lut.transformers...)
+		pcs = a.Header.ProfileConnectionSpace
+		ans.Append(transform_for_pcs_colorspace(pcs, true))
+	}
+	return pcs, nil
+}
@@ -0,0 +1,87 @@
+package icc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ = fmt.Print
+
+func identity_curves(n int) (ans []Curve1D) {
+	for range n {
+		c := IdentityCurve(0)
+		ans = append(ans, &c)
+	}
+	return
+}
+
+// Sample a pipeline with three inputs into a CLUT
+func sample_pipeline(t *testing.T, tr *Pipeline, num_grid_points, num_outputs int) CLUT {
+	var samples []unit_float
+	inp, out := make([]unit_float, 4), make([]unit_float, 4)
+	last := unit_float(num_grid_points - 1)
+	for r := range num_grid_points {
+		for g := range num_grid_points {
+			for b := range num_grid_points {
+				inp[0], inp[1], inp[2] = unit_float(r)/last, unit_float(g)/last, unit_float(b)/last
+				tr.TransformGeneral(out, inp)
+				for _, v := range out[:num_outputs] {
+					samples = append(samples, clamp01(v))
+				}
+			}
+		}
+	}
+	ans, err := NewCLUT([]int{num_grid_points, num_grid_points, num_grid_points}, num_outputs, samples)
+	require.NoError(t, err)
+	return ans
+}
+
+func TestDeviceLinkProfiles(t *testing.T) {
+	srgb, err := SRGBProfile.Profile()
+	require.NoError(t, err)
+	cmyk, err := ReadProfile("test-profiles/cmyk.icc")
+	require.NoError(t, err)
+	direct, err := srgb.CreateTransformerToProfile(cmyk, RelativeColorimetricRenderingIntent, true, 3, false, false)
+	require.NoError(t, err)
+	mt, err := NewModularTag(true, identity_curves(3), sample_pipeline(t, direct, 17, 4), nil, nil, nil, identity_curves(4))
+	require.NoError(t, err)
+	p, err := NewProfileBuilder(DeviceClassLink, ColorSpaceRGB, ColorSpaceCMYK).AddTag(AToB0TagSignature, EncodeModularTag(mt)).Build()
+	require.NoError(t, err)
+
+	link, err := p.CreateDeviceLinkTransformer(RelativeColorimetricRenderingIntent, 3, true, false)
+	require.NoError(t, err)
+	inp, a, b := make([]unit_float, 4), make([]unit_float, 4), make([]unit_float, 4)
+	for _, rgb := range [][3]unit_float{{0, 0, 0}, {1, 1, 1}, {0.5, 0.25, 1}, {0.3, 0.6, 0.9}, {0.9, 0.1, 0.4}} {
+		copy(inp, rgb[:])
+		direct.TransformGeneral(a, inp)
+		copy(inp, rgb[:])
+		link.TransformGeneral(b, inp)
+		require.InDeltaSlice(t, a, b, 0.02, "%v", rgb)
+	}
+	_, err = p.CreateTransformerToPCS(RelativeColorimetricRenderingIntent, 3, false)
+	require.Error(t, err)
+	_, err = p.CreateDeviceLinkTransformer(RelativeColorimetricRenderingIntent, 4, true, false)
+	require.Error(t, err)
+	_, err = srgb.CreateDeviceLinkTransformer(RelativeColorimetricRenderingIntent, 3, true, false)
+	require.Error(t, err)
+
+	// An abstract profile that removes all chroma
+	abstract, err := NewProfileBuilder(DeviceClassAbstract, ColorSpaceLab, ColorSpaceLab).AddTag(
+		DToB0TagSignature, encode_mpet(3, 3, encode_matrix_element(Matrix3{{1, 0, 0}, {0, 0, 0}, {0, 0, 0}}, 0, 0, 0))).Build()
+	require.NoError(t, err)
+	tr, err := srgb.CreateTransformerToProfile(srgb, PerceptualRenderingIntent, false, 3, true, false, abstract)
+	require.NoError(t, err)
+	for _, rgb := range [][3]unit_float{{1, 0, 0}, {0.2, 0.8, 0.3}, {0.5, 0.5, 0.5}} {
+		r, g, b := tr.Transform(rgb[0], rgb[1], rgb[2])
+		require.InDelta(t, r, g, 1e-3, "%v", rgb)
+		require.InDelta(t, r, b, 1e-3, "%v", rgb)
+	}
+	r, g, bl := tr.Transform(0.5, 0.5, 0.5)
+	require.InDeltaSlice(t, []unit_float{0.5, 0.5, 0.5}, []unit_float{r, g, bl}, 1e-3)
+	_, err = srgb.CreateTransformerToProfile(srgb, PerceptualRenderingIntent, false, 3, true, false, cmyk)
+	require.Error(t, err)
+	_, err = abstract.CreateTransformerToSRGB(PerceptualRenderingIntent, false, 3, true, true, false)
+	require.Error(t, err)
+}
@@ -0,0 +1,92 @@
+package icc
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/kovidgoyal/imaging/colorconv"
+)
+
+var _ = fmt.Print
+
+// Converts PCS colors to the device color space of a profile, mapping colors
+// that are outside its gamut into it, see Profile.GamutMapping
+type GamutMapper struct {
+	m *colorconv.GamutMapper
+	// Converts Lab to and from XYZ when the PCS is Lab, nil otherwise
+	lab *colorconv.ConvertColor
+	// The trailing per-channel curves of the transform to the device, such as
+	// the inverse TRC of matrix/TRC profiles, that clamp their inputs and so
+	// are applied after mapping the gamut
+	output *Pipeline
+}
+
+func (p *Profile) create_gamut_mapper(rendering_intent RenderingIntent) (*GamutMapper, error) {
+	to_device, err := p.createTransformerToDevice(rendering_intent, false)
+	if err != nil {
+		return nil, err
+	}
+	if !to_device.IsSuitableFor(3, 3) {
+		return nil, fmt.Errorf("cannot map the gamut of a profile with the transform to device: %s", to_device)
+	}
+	to_pcs, err := p.createTransformerToPCS(rendering_intent)
+	if err != nil {
+		return nil, err
+	}
+	pcs := p.Header.ProfileConnectionSpace
+	to_pcs.Append(transform_for_pcs_colorspace(pcs, true))
+	to_pcs.finalize(true)
+	ans := &GamutMapper{output: &Pipeline{}}
+	if idx := to_device.output_shaper_start(); idx > 0 {
+		ans.output.transformers = to_device.transformers[idx:]
+		to_device.transformers = to_device.transformers[:idx]
+	}
+	to_device.finalize(true)
+	ans.output.finalize(false)
+	w := p.PCSIlluminant
+	if pcs == ColorSpaceLab {
+		ans.lab = colorconv.NewConvertColor(w.X, w.Y, w.Z, 1)
+	}
+	ans.m = colorconv.NewGamutMapper(p.GamutMapping, colorconv.Vec3{w.X, w.Y, w.Z},
+		func(X, Y, Z unit_float) (unit_float, unit_float, unit_float) {
+			if ans.lab != nil {
+				X, Y, Z = ans.lab.XYZToLab(X, Y, Z)
+			}
+			return to_device.Transform(X, Y, Z)
+		},
+		func(r, g, b unit_float) (unit_float, unit_float, unit_float) {
+			X, Y, Z := to_pcs.Transform(ans.output.Transform(r, g, b))
+			if ans.lab != nil {
+				return ans.lab.LabToXYZ(X, Y, Z)
+			}
+			return X, Y, Z
+		})
+	return ans, nil
+}
+
+func (g *GamutMapper) Transform(x, y, z unit_float) (unit_float, unit_float, unit_float) {
+	if g.lab != nil {
+		x, y, z = g.lab.LabToXYZ(x, y, z)
+	}
+	return g.output.Transform(g.m.Map(x, y, z))
+}
+func (g *GamutMapper) TransformGeneral(o, i []unit_float)   { tg33(g.Transform, o, i) }
+func (g *GamutMapper) TransformPlanes(o, i [][]unit_float)  { tp33(g.Transform, o, i) }
+func (g *GamutMapper) IOSig() (int, int)                    { return 3, 3 }
+func (g *GamutMapper) Iter(f func(ChannelTransformer) bool) { f(g) }
+func (g *GamutMapper) String() string {
+	if g.output.Len() == 0 {
+		return g.m.String()
+	}
+	return fmt.Sprintf("%s → %s", g.m, g.output)
+}
+
+// WithGamutMapping returns a copy of this profile that uses the specified
+// gamut mapping, see Profile.GamutMapping
+func (p *Profile) WithGamutMapping(m colorconv.GamutMapping) *Profile {
+	return &Profile{
+		Header: p.Header, TagTable: TagTable{entries: p.TagTable.entries}, PCSIlluminant: p.PCSIlluminant,
+		AbsoluteIntentAdaptation: p.AbsoluteIntentAdaptation, UseChadTagForAbsoluteIntent: p.UseChadTagForAbsoluteIntent,
+		GamutMapping: m, blackpoints: maps.Clone(p.blackpoints),
+	}
+}
@@ -0,0 +1,46 @@
+package icc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kovidgoyal/imaging/colorconv"
+	"github.com/stretchr/testify/require"
+)
+
+var _ = fmt.Print
+
+func TestGamutMapping(t *testing.T) {
+	p3, err := DisplayP3Profile.Profile()
+	require.NoError(t, err)
+	srgb, err := SRGBProfile.Profile()
+	require.NoError(t, err)
+	to_pcs, err := p3.CreateTransformerToPCS(RelativeColorimetricRenderingIntent, 3, true)
+	require.NoError(t, err)
+	clip, err := p3.CreateTransformerToProfile(srgb, RelativeColorimetricRenderingIntent, false, 3, true, true)
+	require.NoError(t, err)
+	out_of_gamut := [][3]unit_float{{1, 0, 0}, {0, 1, 0}, {0, 0.2, 1}, {0.9, 0.9, 0}, {0.3, 0.9, 0.8}}
+	in_gamut := [][3]unit_float{{0.5, 0.5, 0.5}, {0.6, 0.4, 0.3}, {1, 1, 1}, {0, 0, 0}}
+	for _, m := range []colorconv.GamutMapping{colorconv.Clip, colorconv.ChromaReduction, colorconv.OKLCHBinarySearch, colorconv.CuspProjection} {
+		dst := srgb.WithGamutMapping(m)
+		require.Equal(t, colorconv.Clip, srgb.GamutMapping)
+		tr, err := p3.CreateTransformerToProfile(dst, RelativeColorimetricRenderingIntent, false, 3, true, true)
+		require.NoError(t, err)
+		for _, c := range in_gamut {
+			r, g, b := tr.Transform(c[0], c[1], c[2])
+			er, eg, eb := clip.Transform(c[0], c[1], c[2])
+			require.InDeltaSlice(t, []unit_float{er, eg, eb}, []unit_float{r, g, b}, 1e-6, "%s changed in gamut color: %v", m, c)
+		}
+		// The mapping matches that of colorconv for sRGB
+		cc := colorconv.NewStandardConvertColor()
+		cc.SetGamutMapping(m)
+		for _, c := range out_of_gamut {
+			r, g, b := tr.Transform(c[0], c[1], c[2])
+			for _, x := range []unit_float{r, g, b} {
+				require.True(t, 0 <= x && x <= 1, "%s mapped %v out of gamut: %v %v %v", m, c, r, g, b)
+			}
+			er, eg, eb := cc.XYZToSRGB(to_pcs.Transform(c[0], c[1], c[2]))
+			require.InDeltaSlice(t, []unit_float{er, eg, eb}, []unit_float{r, g, b}, 0.01, "%s: %v", m, c)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package icc
+
+import (
+	"fmt"
+)
+
+var _ = fmt.Println
+
+// Convert a single gray channel to normalized PCS values using the gray TRC,
+// see BuildGrayInputMatrixPipeline() in cmsio1.c in lcms. Gray maps to the
+// luminance of the PCS illuminant for XYZ and to L* with a neutral a*, b* for
+// Lab.
+type GrayToPCS struct {
+	trc    Curve1D
+	is_lab bool
+	white  XYZType
+}
+
+func NewGrayToPCS(trc Curve1D, pcs ColorSpace, pcs_illuminant XYZType) *GrayToPCS {
+	return &GrayToPCS{trc, pcs == ColorSpaceLab, pcs_illuminant}
+}
+
+func (n *GrayToPCS) String() string {
+	return fmt.Sprintf("GrayToPCS{lab: %v, trc: %s}", n.is_lab, n.trc.String())
+}
+func (n *GrayToPCS) IOSig() (int, int)                    { return 1, 3 }
+func (n *GrayToPCS) Iter(f func(ChannelTransformer) bool) { f(n) }
+func (n *GrayToPCS) Transform(v, _, _ unit_float) (unit_float, unit_float, unit_float) {
+	y := n.trc.Transform(v)
+	if n.is_lab {
+		return y, 128. / 255, 128. / 255
+	}
+	y *= MAX_ENCODEABLE_XYZ_INVERSE
+	return y * n.white.X, y * n.white.Y, y * n.white.Z
+}
+func (n *GrayToPCS) TransformGeneral(o, i []unit_float) { o[0], o[1], o[2] = n.Transform(i[0], 0, 0) }
+
+// Convert normalized PCS values to a single gray channel using the inverse of
+// the gray TRC, see BuildGrayOutputPipeline() in cmsio1.c in lcms. The gray
+// value is repeated in all outputs of Transform().
+type PCSToGray struct {
+	trc    Curve1D
+	is_lab bool
+}
+
+func NewPCSToGray(trc Curve1D, pcs ColorSpace) *PCSToGray {
+	return &PCSToGray{trc, pcs == ColorSpaceLab}
+}
+
+func (n *PCSToGray) String() string {
+	return fmt.Sprintf("PCSToGray{lab: %v, trc: %s}", n.is_lab, n.trc.String())
+}
+func (n *PCSToGray) IOSig() (int, int)                    { return 3, 1 }
+func (n *PCSToGray) Iter(f func(ChannelTransformer) bool) { f(n) }
+func (n *PCSToGray) Transform(x, y, z unit_float) (unit_float, unit_float, unit_float) {
+	if n.is_lab {
+		y = x
+	} else {
+		y *= MAX_ENCODEABLE_XYZ
+	}
+	v := n.trc.InverseTransform(clamp01(y))
+	return v, v, v
+}
+func (n *PCSToGray) TransformGeneral(o, i []unit_float) { o[0], _, _ = n.Transform(i[0], i[1], i[2]) }
+
+func (p *Profile) create_gray_trc_transformer(forward bool, chromatic_adaptation *Matrix3, pipeline *Pipeline) (err error) {
+	pcs := p.Header.ProfileConnectionSpace
+	trc, err := p.TagTable.load_curve_tag(GrayTRCTagSignature)
+	if err != nil {
+		return err
+	}
+	if pcs == ColorSpaceLab {
+		// chromatic adaptation has no effect on neutral Lab values
+		chromatic_adaptation = nil
+	}
+	if forward {
+		pipeline.Append(NewGrayToPCS(trc, pcs, p.PCSIlluminant), chromatic_adaptation)
+	} else {
+		pipeline.Append(chromatic_adaptation, NewPCSToGray(trc, pcs))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package icc
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ = fmt.Print
+
+func TestGrayProfiles(t *testing.T) {
+	gray22, err := Gray22Profile.Profile()
+	require.NoError(t, err)
+	sgray, err := SGrayProfile.Profile()
+	require.NoError(t, err)
+	srgb_curve := SRGBCurve()
+
+	to_srgb, err := gray22.CreateTransformerToSRGB(RelativeColorimetricRenderingIntent, false, 1, true, true, true)
+	require.NoError(t, err)
+	to_sgray, err := gray22.CreateTransformerToProfile(sgray, RelativeColorimetricRenderingIntent, false, 1, true, true)
+	require.NoError(t, err)
+	require.True(t, to_sgray.IsSuitableFor(1, 1), to_sgray.String())
+	in, out := make([]unit_float, 4), make([]unit_float, 4)
+	for _, v := range []unit_float{0, 0.1, 0.25, 0.5, 0.8, 1} {
+		expected := srgb_curve.InverseTransform(unit_float(math.Pow(float64(v), 2.2)))
+		in[0] = v
+		to_srgb.TransformGeneral(out, in)
+		require.InDeltaSlice(t, []unit_float{expected, expected, expected}, out[:3], 2e-3, "gray: %v", v)
+		in[0] = v
+		to_sgray.TransformGeneral(out, in)
+		require.InDelta(t, expected, out[0], 1e-4, "gray: %v", v)
+		r, _, _ := to_sgray.Transform(v, v, v)
+		require.InDelta(t, expected, r, 1e-4, "gray: %v", v)
+	}
+
+	// Gray profiles with a Lab PCS use the TRC to map gray to L*
+	b, err := Gray22Profile.builder()
+	require.NoError(t, err)
+	b.Header.ProfileConnectionSpace = ColorSpaceLab
+	lab_gray, err := b.Build()
+	require.NoError(t, err)
+	to_lab, err := lab_gray.CreateTransformerToLab(RelativeColorimetricRenderingIntent, 1, true)
+	require.NoError(t, err)
+	from_lab, err := sgray.CreateTransformerToProfile(lab_gray, RelativeColorimetricRenderingIntent, false, 1, true, true)
+	require.NoError(t, err)
+	for _, v := range []unit_float{0, 0.3, 1} {
+		in[0] = v
+		to_lab.TransformGeneral(out, in)
+		L := 100 * unit_float(math.Pow(float64(v), 2.2))
+		require.InDeltaSlice(t, []unit_float{L, 0, 0}, out[:3], 1e-3, "gray: %v", v)
+		Y := unit_float(math.Pow(float64(L+16)/116, 3))
+		in[0] = srgb_curve.InverseTransform(IfElse(L > 8, Y, L/903.3))
+		from_lab.TransformGeneral(out, in)
+		require.InDelta(t, v, out[0], 2e-3, "gray: %v", v)
+	}
+}
@@ -31,6 +31,13 @@ func (m *Scaling) Transform(x, y, z unit_float) (unit_float, unit_float, unit_fl
 func (m *Scaling) AsMatrix3() *Matrix3 { return NewScalingMatrix3(m.s) }
 
 func (m *Scaling) TransformGeneral(o, i []unit_float) { tg33(m.Transform, o, i) }
+func (m *Scaling) TransformPlanes(o, i [][]unit_float) {
+	for c := range 3 {
+		for k, v := range i[c] {
+			o[c][k] = v * m.s
+		}
+	}
+}
 
 func NewScaling(name string, s unit_float) *Scaling { return &Scaling{name, s} }
 
@@ -50,6 +57,13 @@ func (m *Scaling4) TransformGeneral(o, i []unit_float) {
 		o[x] = m.s * i[x]
 	}
 }
+func (m *Scaling4) TransformPlanes(o, i [][]unit_float) {
+	for c := range 4 {
+		for k, v := range i[c] {
+			o[c][k] = v * m.s
+		}
+	}
+}
 
 // A transformer to convert normalized [0,1] values to the [0,1.99997]
 // (u1Fixed15Number) values used by ICC XYZ PCS space
@@ -72,7 +86,8 @@ func (m *NormalizedToLAB) Transform(x, y, z unit_float) (unit_float, unit_float,
 	return x * 100, (y*255 - 128), (z*255 - 128)
 }
 
-func (m *NormalizedToLAB) TransformGeneral(o, i []unit_float) { tg33(m.Transform, o, i) }
+func (m *NormalizedToLAB) TransformGeneral(o, i []unit_float)  { tg33(m.Transform, o, i) }
+func (m *NormalizedToLAB) TransformPlanes(o, i [][]unit_float) { tp33(m.Transform, o, i) }
 
 func NewNormalizedToLAB() *NormalizedToLAB {
 	x := NormalizedToLAB(0)
@@ -89,7 +104,8 @@ func (m *LABToNormalized) Transform(x, y, z unit_float) (unit_float, unit_float,
 	return x * (1. / 100), (y*(1./255) + 128./255), (z*(1./255) + 128./255)
 }
 
-func (m *LABToNormalized) TransformGeneral(o, i []unit_float) { tg33(m.Transform, o, i) }
+func (m *LABToNormalized) TransformGeneral(o, i []unit_float)  { tg33(m.Transform, o, i) }
+func (m *LABToNormalized) TransformPlanes(o, i [][]unit_float) { tp33(m.Transform, o, i) }
 
 func NewLABToNormalized() *LABToNormalized {
 	x := LABToNormalized(0)
@@ -183,6 +199,13 @@ func (c *UniformFunctionTransformer) TransformGeneral(o, i []unit_float) {
 		o[k] = c.f(x)
 	}
 }
+func (c *UniformFunctionTransformer) TransformPlanes(o, i [][]unit_float) {
+	for n, plane := range i {
+		for k, x := range plane {
+			o[n][k] = c.f(x)
+		}
+	}
+}
 func NewUniformFunctionTransformer(name string, f func(unit_float) unit_float) *UniformFunctionTransformer {
 	return &UniformFunctionTransformer{name, f}
 }
@@ -211,6 +234,7 @@ func (c *XYZtosRGB) Transform(l, a, b unit_float) (unit_float, unit_float, unit_
 	return c.t(l, a, b)
 }
 func (m *XYZtosRGB) TransformGeneral(o, i []unit_float)   { tg33(m.Transform, o, i) }
+func (m *XYZtosRGB) TransformPlanes(o, i [][]unit_float)  { tp33(m.t, o, i) }
 func (n *XYZtosRGB) IOSig() (int, int)                    { return 3, 3 }
 func (n *XYZtosRGB) String() string                       { return fmt.Sprintf("%T%s", n, n.c.String()) }
 func (n *XYZtosRGB) Iter(f func(ChannelTransformer) bool) { f(n) }
@@ -229,6 +253,7 @@ func (c *LABtoXYZ) Transform(l, a, b unit_float) (unit_float, unit_float, unit_f
 	return c.t(l, a, b)
 }
 func (m *LABtoXYZ) TransformGeneral(o, i []unit_float)   { tg33(m.Transform, o, i) }
+func (m *LABtoXYZ) TransformPlanes(o, i [][]unit_float)  { tp33(m.t, o, i) }
 func (n *LABtoXYZ) IOSig() (int, int)                    { return 3, 3 }
 func (n *LABtoXYZ) String() string                       { return fmt.Sprintf("%T%s", n, n.c.String()) }
 func (n *LABtoXYZ) Iter(f func(ChannelTransformer) bool) { f(n) }
@@ -247,6 +272,7 @@ func (c *XYZtoLAB) Transform(l, a, b unit_float) (unit_float, unit_float, unit_f
 	return c.t(l, a, b)
 }
 func (m *XYZtoLAB) TransformGeneral(o, i []unit_float)   { tg33(m.Transform, o, i) }
+func (m *XYZtoLAB) TransformPlanes(o, i [][]unit_float)  { tp33(m.t, o, i) }
 func (n *XYZtoLAB) IOSig() (int, int)                    { return 3, 3 }
 func (n *XYZtoLAB) String() string                       { return fmt.Sprintf("%T%s", n, n.c.String()) }
 func (n *XYZtoLAB) Iter(f func(ChannelTransformer) bool) { f(n) }
@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"slices"
 	"strings"
+	"sync"
 )
 
 var _ = fmt.Print
@@ -14,6 +15,10 @@ type Pipeline struct {
 	tfuncs            []func(r, g, b unit_float) (unit_float, unit_float, unit_float)
 	has_lut16type_tag bool
 	finalized         bool
+	// The result of OptimizedFor() for large images, cached so that it is
+	// computed only once, for example, for all the frames of an animation
+	optimized_mutex sync.Mutex
+	optimized       *Pipeline
 }
 
 type AsMatrix3 interface {
@@ -77,18 +82,48 @@ func (p *Pipeline) finalize(optimize bool) {
 			}
 		}
 	}
+	if p.has_wide_intermediate() {
+		// For example, soft proofing via a CMYK profile
+		p.tfuncs = []func(r unit_float, g unit_float, b unit_float) (unit_float, unit_float, unit_float){p.transform_via_general}
+		return
+	}
 	p.tfuncs = make([]func(r unit_float, g unit_float, b unit_float) (unit_float, unit_float, unit_float), len(p.transformers))
 	for i, t := range p.transformers {
 		p.tfuncs[i] = t.Transform
 	}
 }
 
+// Whether this is a three channel pipeline that has more than three channels
+// between its stages and so cannot use the Transform() of its stages
+func (p *Pipeline) has_wide_intermediate() bool {
+	if len(p.transformers) < 2 {
+		return false
+	}
+	if nin, _ := p.transformers[0].IOSig(); nin != 3 {
+		return false
+	}
+	for _, t := range p.transformers[:len(p.transformers)-1] {
+		if _, nout := t.IOSig(); nout > 3 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Pipeline) transform_via_general(r, g, b unit_float) (unit_float, unit_float, unit_float) {
+	var in, out [4]unit_float
+	in[0], in[1], in[2] = r, g, b
+	p.TransformGeneral(out[:], in[:])
+	return out[0], out[1], out[2]
+}
+
 func (p *Pipeline) Finalize(optimize bool) { p.finalize(optimize) }
 
 func (p *Pipeline) insert(idx int, c ChannelTransformer) {
 	if is_nil(c) {
 		return
 	}
+	p.optimized = nil
 	switch c.(type) {
 	case *IdentityMatrix:
 		return
@@ -109,6 +144,9 @@ func (p *Pipeline) insert(idx int, c ChannelTransformer) {
 }
 
 func (p *Pipeline) Insert(idx int, c ChannelTransformer) {
+	if is_nil(c) {
+		return
+	}
 	s := slices.Collect(c.Iter)
 	if idx > -1 {
 		slices.Reverse(s)
@@ -7,6 +7,8 @@ import (
 	"io"
 	"os"
 	"sync"
+
+	"github.com/kovidgoyal/imaging/colorconv"
 )
 
 var _ = fmt.Println
@@ -22,13 +24,32 @@ const (
 	AdobeRGBProfile
 	PhotoProProfile
 	DisplayP3Profile
+	Rec2020Profile
+	Gray22Profile
+	// Gray with the sRGB transfer function and a D50 white point
+	SGrayProfile
 )
 
 type Profile struct {
 	Header        Header
 	TagTable      TagTable
 	PCSIlluminant XYZType
-	blackpoints   map[RenderingIntent]*XYZType
+	// The chromatic adaptation transform from the PCS illuminant to the
+	// media white point used to convert PCS relative colors to media relative
+	// ones for the absolute colorimetric intent. The default, XYZ scaling, is
+	// as specified by ICC and used by lcms.
+	AbsoluteIntentAdaptation colorconv.ChromaticAdaptationMethod
+	// When set, the inverse of the chad tag, if present, is used instead of
+	// AbsoluteIntentAdaptation, undoing the adaptation the profile creator
+	// applied to get media relative colors.
+	UseChadTagForAbsoluteIntent bool
+	// How colors outside the gamut of the device color space of this profile
+	// are mapped into it by transforms to this profile that clamp their
+	// output. The default, Clip, is what lcms does. Profiles with lookup
+	// tables usually map the gamut in their tables, so this mostly matters for
+	// matrix/TRC profiles.
+	GamutMapping colorconv.GamutMapping
+	blackpoints  map[RenderingIntent]*XYZType
 }
 
 func (p *Profile) Description() (string, error) {
@@ -43,36 +64,56 @@ func (p *Profile) DeviceModelDescription() (string, error) {
 	return p.TagTable.getDeviceModelDescription()
 }
 
+// The matrix that converts PCS relative XYZ values to media relative ones for
+// the absolute colorimetric intent, or its inverse when not forward. See
+// ComputeAbsoluteIntent() in cmscnvrt.c in lcms.
 func (p *Profile) get_effective_chromatic_adaption(forward bool, intent RenderingIntent) (ans *Matrix3, err error) {
 	if intent != AbsoluteColorimetricRenderingIntent { // ComputeConversion() in lcms
 		return nil, nil
 	}
-	pcs_whitepoint := p.Header.ParsedPCSIlluminant()
-	x, err := p.TagTable.get_parsed(MediaWhitePointTagSignature, p.Header.DataColorSpace, p.Header.ProfileConnectionSpace)
-	if err != nil {
-		return nil, err
-	}
-	wtpt, ok := x.(*XYZType)
-	if !ok {
-		return nil, fmt.Errorf("wtpt tag is not of XYZType")
-	}
-	if pcs_whitepoint == *wtpt {
+	white := p.media_white_point()
+	if white == p.PCSIlluminant {
 		return nil, nil
 	}
-	defer func() {
-		if err == nil && ans != nil && !forward {
-			m, ierr := ans.Inverted()
-			if ierr == nil {
-				ans = &m
-			} else {
-				ans, err = nil, ierr
+	if p.UseChadTagForAbsoluteIntent {
+		// The chad tag adapts media relative colors to the PCS illuminant
+		chad, err := p.TagTable.get_chromatic_adaption()
+		if err != nil {
+			return nil, err
+		}
+		if chad != nil {
+			if !forward {
+				return chad, nil
+			}
+			m, err := chad.Inverted()
+			if err != nil {
+				return nil, err
 			}
+			return &m, nil
 		}
-	}()
-	return p.TagTable.get_chromatic_adaption()
+	}
+	m := IfElse(forward, ChromaticAdaptation(p.AbsoluteIntentAdaptation, p.PCSIlluminant, white), ChromaticAdaptation(p.AbsoluteIntentAdaptation, white, p.PCSIlluminant))
+	return &m, nil
+}
+
+// Append the chromatic adaptation matrix, which operates on XYZ values, to a
+// pipeline that has normalized PCS values at its end
+func (p *Profile) append_chromatic_adaptation(ans *Pipeline, chromatic_adaptation *Matrix3) {
+	if chromatic_adaptation == nil {
+		return
+	}
+	if p.Header.ProfileConnectionSpace == ColorSpaceLab {
+		ans.Append(NewNormalizedToLAB(), NewLABtoXYZ(p.PCSIlluminant), chromatic_adaptation, NewXYZtoLAB(p.PCSIlluminant), NewLABToNormalized())
+	} else {
+		// Matrices commute with the scaling of normalized XYZ values
+		ans.Append(chromatic_adaptation)
+	}
 }
 
 func (p *Profile) create_matrix_trc_transformer(forward bool, chromatic_adaptation *Matrix3, pipeline *Pipeline) (err error) {
+	if p.Header.DataColorSpace == ColorSpaceGray {
+		return p.create_gray_trc_transformer(forward, chromatic_adaptation, pipeline)
+	}
 	if p.Header.ProfileConnectionSpace != ColorSpaceXYZ {
 		return fmt.Errorf("matrix/TRC based profile using non XYZ PCS color space: %v", p.Header.ProfileConnectionSpace)
 	}
@@ -105,54 +146,70 @@ func (p *Profile) create_matrix_trc_transformer(forward bool, chromatic_adaptati
 	return nil
 }
 
-// See section 8.10.2 of ICC.1-2202-05.pdf for tag selection algorithm
-func (p *Profile) find_conversion_tag(forward bool, rendering_intent RenderingIntent) (ans ChannelTransformer, err error) {
-	var ans_sig Signature = UnknownSignature
-	found_tag := false
-	if forward {
-		switch rendering_intent {
-		case PerceptualRenderingIntent:
-			ans_sig = AToB0TagSignature
-		case RelativeColorimetricRenderingIntent:
-			ans_sig = AToB1TagSignature
-		case SaturationRenderingIntent:
-			ans_sig = AToB2TagSignature
-		case AbsoluteColorimetricRenderingIntent:
-			ans_sig = AToB3TagSignature
-		default:
-			return nil, fmt.Errorf("unknown rendering intent: %v", rendering_intent)
-		}
-		found_tag = p.TagTable.Has(ans_sig)
-		const fallback = AToB0TagSignature
-		if !found_tag && p.TagTable.Has(fallback) {
-			ans_sig = fallback
-			found_tag = true
-		}
-	} else {
-		switch rendering_intent {
-		case PerceptualRenderingIntent:
-			ans_sig = BToA0TagSignature
-		case RelativeColorimetricRenderingIntent:
-			ans_sig = BToA1TagSignature
-		case SaturationRenderingIntent:
-			ans_sig = BToA2TagSignature
-		case AbsoluteColorimetricRenderingIntent:
-			ans_sig = BToA3TagSignature
-		default:
-			return nil, fmt.Errorf("unknown rendering intent: %v", rendering_intent)
-		}
-		found_tag = p.TagTable.Has(ans_sig)
-		const fallback = BToA0TagSignature
-		if !found_tag && p.TagTable.Has(fallback) {
-			ans_sig = fallback
-			found_tag = true
-		}
+// The floating point D2Bx and B2Dx tags indexed by rendering intent
+var float_conversion_tags = [2][4]Signature{
+	{BToD0TagSignature, BToD1TagSignature, BToD2TagSignature, BToD3TagSignature},
+	{DToB0TagSignature, DToB1TagSignature, DToB2TagSignature, DToB3TagSignature},
+}
+
+// The floating point D2Bx and B2Dx tags are preferred when present for the
+// rendering intent, without any fallback to other intents, see
+// _cmsReadInputLUT() and _cmsReadOutputLUT() in cmsio1.c in lcms
+func (p *Profile) find_float_conversion_tag(forward bool, rendering_intent RenderingIntent) (ChannelTransformer, error) {
+	if rendering_intent < PerceptualRenderingIntent || rendering_intent > AbsoluteColorimetricRenderingIntent {
+		return nil, nil
 	}
-	if !found_tag {
+	sig := float_conversion_tags[IfElse(forward, 1, 0)][rendering_intent]
+	if !p.TagTable.Has(sig) {
 		return nil, nil
 	}
+	c, err := p.TagTable.get_parsed(sig, p.Header.DataColorSpace, p.Header.ProfileConnectionSpace)
+	if err != nil {
+		return nil, err
+	}
+	mpe, ok := c.(*MultiProcessElementsTag)
+	if !ok {
+		return nil, fmt.Errorf("%s tag is not a multiProcessElementsType tag: %T", sig, c)
+	}
+	return mpe.with_normalization(p.Header.DataColorSpace, p.Header.ProfileConnectionSpace, forward), nil
+}
+
+// The A2Bx and B2Ax tags indexed by rendering intent. There are no A2B3 or
+// B2A3 tags, the absolute colorimetric intent uses the media relative
+// colorimetric A2B1 and B2A1 tags, which are then adapted to the media white
+// point. See section 8.10.2 of ICC.1-2202-05.pdf and Device2PCS16() in
+// cmsio1.c in lcms.
+var lut_conversion_tags = [2][4]Signature{
+	{BToA0TagSignature, BToA1TagSignature, BToA2TagSignature, BToA1TagSignature},
+	{AToB0TagSignature, AToB1TagSignature, AToB2TagSignature, AToB1TagSignature},
+}
+
+// Returns the A2Bx or B2Ax tag to use for the rendering intent, falling back
+// to the perceptual tag when the tag for the intent is missing. Returns
+// UnknownSignature if the profile has neither.
+func (p *Profile) lut_conversion_tag(forward bool, rendering_intent RenderingIntent) (Signature, error) {
+	if rendering_intent < PerceptualRenderingIntent || rendering_intent > AbsoluteColorimetricRenderingIntent {
+		return UnknownSignature, fmt.Errorf("unknown rendering intent: %v", rendering_intent)
+	}
+	tags := lut_conversion_tags[IfElse(forward, 1, 0)]
+	for _, sig := range []Signature{tags[rendering_intent], tags[PerceptualRenderingIntent]} {
+		if p.TagTable.Has(sig) {
+			return sig, nil
+		}
+	}
+	return UnknownSignature, nil
+}
+
+func (p *Profile) find_conversion_tag(forward bool, rendering_intent RenderingIntent) (ans ChannelTransformer, err error) {
+	if ans, err = p.find_float_conversion_tag(forward, rendering_intent); ans != nil || err != nil {
+		return
+	}
+	ans_sig, err := p.lut_conversion_tag(forward, rendering_intent)
+	if err != nil || ans_sig == UnknownSignature {
+		return nil, err
+	}
 	// We rely on profile reader to error out if the PCS color space is not XYZ
-	// or LAB and the device colorspace is not RGB or CMYK
+	// or LAB and the device colorspace is not RGB, CMYK or Gray
 	input_colorspace, output_colorspace := p.Header.DataColorSpace, p.Header.ProfileConnectionSpace
 	if !forward {
 		input_colorspace, output_colorspace = output_colorspace, input_colorspace
@@ -168,6 +225,16 @@ func (p *Profile) find_conversion_tag(forward bool, rendering_intent RenderingIn
 	return ans, nil
 }
 
+// Device link and abstract profiles do not convert between a device color
+// space and the PCS
+func (p *Profile) check_has_pcs() error {
+	switch p.Header.DeviceClass {
+	case DeviceClassLink, DeviceClassAbstract:
+		return fmt.Errorf("cannot convert to or from the PCS with a %s profile", p.Header.DeviceClass)
+	}
+	return nil
+}
+
 func (p *Profile) effective_bpc(intent RenderingIntent, user_requested_bpc bool) bool {
 	// See _cmsLinkProfiles() in cmscnvrt.c
 	if intent == AbsoluteColorimetricRenderingIntent {
@@ -184,16 +251,21 @@ func (p *Profile) CreateTransformerToDevice(rendering_intent RenderingIntent, us
 	if num_output_channels == 0 {
 		return nil, fmt.Errorf("unsupported device color space: %s", p.Header.DataColorSpace)
 	}
-	defer func() {
-		if err == nil && !ans.IsSuitableFor(3, num_output_channels) {
-			err = fmt.Errorf("transformer to PCS %s not suitable for 3 output channels", ans.String())
-		}
-		if err == nil {
-			ans.finalize(optimize)
-		}
-	}()
-	ans = &Pipeline{}
+	if ans, err = p.createTransformerToDevice(rendering_intent, use_blackpoint_compensation); err != nil {
+		return nil, err
+	}
+	if !ans.IsSuitableFor(3, num_output_channels) {
+		return nil, fmt.Errorf("transformer to PCS %s not suitable for 3 output channels", ans.String())
+	}
+	ans.finalize(optimize)
+	return
+}
 
+func (p *Profile) createTransformerToDevice(rendering_intent RenderingIntent, use_blackpoint_compensation bool) (ans *Pipeline, err error) {
+	if err = p.check_has_pcs(); err != nil {
+		return nil, err
+	}
+	ans = &Pipeline{}
 	if p.effective_bpc(rendering_intent, use_blackpoint_compensation) {
 		var PCS_blackpoint XYZType // 0, 0, 0
 		output_blackpoint := p.BlackPoint(rendering_intent, nil)
@@ -222,9 +294,17 @@ func (p *Profile) CreateTransformerToDevice(rendering_intent RenderingIntent, us
 		return nil, err
 	}
 	if b2a != nil {
+		p.append_chromatic_adaptation(ans, chromatic_adaptation)
+		b2a_idx := ans.Len()
 		ans.Append(b2a)
-		ans.Append(chromatic_adaptation)
-		if p.Header.ProfileConnectionSpace == ColorSpaceLab {
+		if _, is_float := b2a.(*MultiProcessElementsTag); p.Header.ProfileConnectionSpace == ColorSpaceLab && !is_float {
+			if ans.has_lut16type_tag {
+				// The lut16type data uses the legacy LAB encoding, see _cmsReadOutputLUT() in cmsio1.c
+				ans.Insert(b2a_idx, NewLABToMFT2())
+				if p.Header.DataColorSpace == ColorSpaceLab {
+					ans.Append(NewLABFromMFT2())
+				}
+			}
 			// For some reason, lcms prefers trilinear over tetrahedral in this
 			// case, see _cmsReadOutputLUT() in cmsio1.c
 			ans.UseTrilinearInsteadOfTetrahedral()
@@ -236,6 +316,9 @@ func (p *Profile) CreateTransformerToDevice(rendering_intent RenderingIntent, us
 }
 
 func (p *Profile) createTransformerToPCS(rendering_intent RenderingIntent) (ans *Pipeline, err error) {
+	if err = p.check_has_pcs(); err != nil {
+		return nil, err
+	}
 	const forward = true
 	ans = &Pipeline{}
 	a2b, err := p.find_conversion_tag(forward, rendering_intent)
@@ -248,7 +331,6 @@ func (p *Profile) createTransformerToPCS(rendering_intent RenderingIntent) (ans
 	}
 	if a2b != nil {
 		ans.Append(a2b)
-		ans.Append(chromatic_adaptation)
 		if ans.has_lut16type_tag && p.Header.ProfileConnectionSpace == ColorSpaceLab {
 			// Need to scale the lut16type data for legacy LAB encoding in ICC profiles
 			if p.Header.DataColorSpace == ColorSpaceLab {
@@ -256,6 +338,7 @@ func (p *Profile) createTransformerToPCS(rendering_intent RenderingIntent) (ans
 			}
 			ans.Append(NewLABFromMFT2())
 		}
+		p.append_chromatic_adaptation(ans, chromatic_adaptation)
 	} else {
 		err = p.create_matrix_trc_transformer(forward, chromatic_adaptation, ans)
 	}
@@ -338,6 +421,84 @@ func (p *Profile) CreateTransformerToSRGB(rendering_intent RenderingIntent, use_
 	return
 }
 
+// Create a transformer that converts colors from the device color space of
+// this profile to the device color space of the dst profile, by chaining the
+// transform to PCS of this profile with the transform from PCS of dst. If
+// clamp is true and dst has three channels, output values are clamped to [0, 1].
+// The transforms of any abstract profiles, such as Lab to Lab effects, are
+// applied in order, in the PCS.
+func (p *Profile) CreateTransformerToProfile(dst *Profile, rendering_intent RenderingIntent, use_blackpoint_compensation bool, input_channels int, clamp, optimize bool, abstract_profiles ...*Profile) (ans *Pipeline, err error) {
+	return p.create_transformer_to_profile(dst, rendering_intent, use_blackpoint_compensation, input_channels, clamp, optimize, nil, abstract_profiles...)
+}
+
+// media_white_scaling, if not nil, is applied to the PCS values in XYZ space
+func (p *Profile) create_transformer_to_profile(dst *Profile, rendering_intent RenderingIntent, use_blackpoint_compensation bool, input_channels int, clamp, optimize bool, media_white_scaling *Matrix3, abstract_profiles ...*Profile) (ans *Pipeline, err error) {
+	num_output_channels := len(dst.Header.DataColorSpace.BlackPoint())
+	if num_output_channels == 0 {
+		return nil, fmt.Errorf("unsupported device color space: %s", dst.Header.DataColorSpace)
+	}
+	if ans, err = p.createTransformerToPCS(rendering_intent); err != nil {
+		return
+	}
+	if !ans.IsSuitableFor(input_channels, 3) {
+		return nil, fmt.Errorf("transformer to PCS %s not suitable for %d input channels", ans.String(), input_channels)
+	}
+	pcs := p.Header.ProfileConnectionSpace
+	// Blackpoint compensation is done in XYZ space, using the version of the
+	// output profile to decide if it is needed, see _cmsLinkProfiles() in cmscnvrt.c
+	if dst.effective_bpc(rendering_intent, use_blackpoint_compensation) {
+		input_blackpoint, output_blackpoint := p.BlackPoint(rendering_intent, nil), dst.BlackPoint(rendering_intent, nil)
+		if input_blackpoint != output_blackpoint {
+			if pcs == ColorSpaceLab {
+				ans.Append(transform_for_pcs_colorspace(pcs, true))
+				ans.Append(NewLABtoXYZ(p.PCSIlluminant))
+				ans.Append(NewXYZToNormalized())
+				pcs = ColorSpaceXYZ
+			}
+			ans.Append(NewBlackPointCorrection(p.PCSIlluminant, input_blackpoint, output_blackpoint))
+		}
+	}
+	ans.Append(transform_for_pcs_colorspace(pcs, true))
+	if pcs, err = append_abstract_profiles(ans, pcs, p.PCSIlluminant, rendering_intent, abstract_profiles...); err != nil {
+		return nil, err
+	}
+	if media_white_scaling != nil {
+		if pcs == ColorSpaceLab {
+			ans.Append(NewLABtoXYZ(p.PCSIlluminant))
+			pcs = ColorSpaceXYZ
+		}
+		ans.Append(media_white_scaling)
+	}
+	switch dst_pcs := dst.Header.ProfileConnectionSpace; {
+	case pcs == ColorSpaceLab && dst_pcs == ColorSpaceXYZ:
+		ans.Append(NewLABtoXYZ(p.PCSIlluminant))
+	case pcs == ColorSpaceXYZ && dst_pcs == ColorSpaceLab:
+		ans.Append(NewXYZtoLAB(dst.PCSIlluminant))
+	}
+	map_gamut := clamp && num_output_channels == 3 && dst.GamutMapping != colorconv.Clip
+	if map_gamut {
+		gm, err := dst.create_gamut_mapper(rendering_intent)
+		if err != nil {
+			return nil, err
+		}
+		ans.Append(gm)
+	} else {
+		dev, err := dst.createTransformerToDevice(rendering_intent, false)
+		if err != nil {
+			return nil, err
+		}
+		ans.Append(dev.transformers...)
+	}
+	if !ans.IsSuitableFor(input_channels, num_output_channels) {
+		return nil, fmt.Errorf("transformer %s not suitable for %d input channels and %d output channels", ans.String(), input_channels, num_output_channels)
+	}
+	if clamp && num_output_channels == 3 && !map_gamut {
+		ans.Append(NewUniformFunctionTransformer("Clamp", clamp01))
+	}
+	ans.finalize(optimize)
+	return
+}
+
 func (p *Profile) CreateDefaultTransformerToDevice() (*Pipeline, error) {
 	return p.CreateTransformerToDevice(p.Header.RenderingIntent, false, true)
 }
@@ -0,0 +1,168 @@
+package icc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kovidgoyal/imaging/colorconv"
+	"github.com/stretchr/testify/require"
+)
+
+var _ = fmt.Print
+
+func TestAbsoluteColorimetricIntent(t *testing.T) {
+	const absolute, relative = AbsoluteColorimetricRenderingIntent, RelativeColorimetricRenderingIntent
+	to_xyz := func(p *Profile, intent RenderingIntent, rgb ...unit_float) []unit_float {
+		tr, err := p.CreateTransformerToPCS(intent, 3, true)
+		require.NoError(t, err)
+		x, y, z := tr.Transform(rgb[0], rgb[1], rgb[2])
+		return []unit_float{x, y, z}
+	}
+	srgb, err := SRGBProfile.Profile()
+	require.NoError(t, err)
+	// The media white of v4 display profiles is the PCS illuminant
+	for _, rgb := range [][]unit_float{{1, 1, 1}, {0.2, 0.5, 0.9}} {
+		require.Equal(t, to_xyz(srgb, relative, rgb...), to_xyz(srgb, absolute, rgb...))
+		srgb.UseChadTagForAbsoluteIntent = true
+		require.Equal(t, to_xyz(srgb, relative, rgb...), to_xyz(srgb, absolute, rgb...))
+		srgb.UseChadTagForAbsoluteIntent = false
+	}
+	d65 := XYZType{0.9505, 1, 1.089}
+
+	paper := XYZType{0.9, 0.93, 0.7}
+	b, err := DisplayP3Profile.builder()
+	require.NoError(t, err)
+	p, err := b.AddTag(MediaWhitePointTagSignature, EncodeXYZTag(paper)).Build()
+	require.NoError(t, err)
+	gray := []unit_float{0.5, 0.5, 0.5}
+	rel := to_xyz(p, relative, gray...)
+	// By default the chad tag is ignored and XYZ scaling to the media white is used
+	require.True(t, p.TagTable.Has(ChromaticAdaptationTagSignature))
+	scaling := ChromaticAdaptation(colorconv.XYZScaling, p.PCSIlluminant, paper)
+	x, y, z := scaling.Transform(rel[0], rel[1], rel[2])
+	require.InDeltaSlice(t, []unit_float{x, y, z}, to_xyz(p, absolute, gray...), 2e-3)
+	for _, method := range []colorconv.ChromaticAdaptationMethod{colorconv.XYZScaling, colorconv.Bradford, colorconv.CAT02, colorconv.CAT16, colorconv.VonKries} {
+		p.AbsoluteIntentAdaptation = method
+		for _, use_chad := range []bool{false, true} {
+			// The chad tag is only used when asked for, undoing the adaptation to D50
+			p.UseChadTagForAbsoluteIntent = use_chad
+			if !use_chad {
+				// White is mapped to the media white by all methods
+				require.InDeltaSlice(t, []unit_float{paper.X, paper.Y, paper.Z}, to_xyz(p, absolute, 1, 1, 1), 2e-3, method.String())
+			}
+			m := IfElse(use_chad, ChromaticAdaptation(colorconv.Bradford, p.PCSIlluminant, d65), ChromaticAdaptation(method, p.PCSIlluminant, paper))
+			x, y, z := m.Transform(rel[0], rel[1], rel[2])
+			require.InDeltaSlice(t, []unit_float{x, y, z}, to_xyz(p, absolute, gray...), 2e-3, "%s chad: %v", method, use_chad)
+			// Round tripping through the profile is the identity
+			tr, err := p.CreateTransformerToProfile(p, absolute, false, 3, true, true)
+			require.NoError(t, err)
+			r, g, b := tr.Transform(0.2, 0.5, 0.9)
+			require.InDeltaSlice(t, []unit_float{0.2, 0.5, 0.9}, []unit_float{r, g, b}, 1e-3, "%s chad: %v", method, use_chad)
+		}
+	}
+	// By default, absolute colorimetric conversion to sRGB simulates the paper white with XYZ scaling
+	p.AbsoluteIntentAdaptation, p.UseChadTagForAbsoluteIntent = colorconv.XYZScaling, false
+	tr, err := p.CreateTransformerToProfile(srgb, absolute, false, 3, true, true)
+	require.NoError(t, err)
+	r, g, bl := tr.Transform(1, 1, 1)
+	expected, err := srgb.CreateTransformerToDevice(relative, false, true)
+	require.NoError(t, err)
+	er, eg, eb := expected.Transform(paper.X, paper.Y, paper.Z)
+	require.InDeltaSlice(t, []unit_float{er, eg, eb}, []unit_float{r, g, bl}, 2e-3)
+	require.Less(t, bl, r)
+}
+
+func TestAbsoluteColorimetricIntentWithLUTProfile(t *testing.T) {
+	const absolute, relative = AbsoluteColorimetricRenderingIntent, RelativeColorimetricRenderingIntent
+	p, err := ReadProfile("test-profiles/cmyk.icc")
+	require.NoError(t, err)
+	// This profile has no A2B3/B2A3 tags, distinct A2B0 and A2B1 tags and a
+	// media white that is not the PCS illuminant
+	require.False(t, p.TagTable.Has(AToB3TagSignature))
+	require.True(t, p.TagTable.Has(AToB0TagSignature) && p.TagTable.Has(AToB1TagSignature))
+	white := p.media_white_point()
+	require.NotEqual(t, p.PCSIlluminant, white)
+	to_pcs := func(intent RenderingIntent, cmyk ...unit_float) []unit_float {
+		tr, err := p.CreateTransformerToPCS(intent, 4, true)
+		require.NoError(t, err)
+		// TransformGeneral uses its input as scratch space
+		var out, in [4]unit_float
+		copy(in[:], cmyk)
+		tr.TransformGeneral(out[:], in[:])
+		return out[:3]
+	}
+	cmyk := []unit_float{0.2, 0.6, 0.1, 0.05}
+	// The absolute intent is the media relative A2B1 tag adapted to the media white
+	rel := to_pcs(relative, cmyk...)
+	x, y, z := NewLABtoXYZ(p.PCSIlluminant).Transform(rel[0], rel[1], rel[2])
+	m := ChromaticAdaptation(colorconv.XYZScaling, p.PCSIlluminant, white)
+	x, y, z = m.Transform(x, y, z)
+	l, a, b := NewXYZtoLAB(p.PCSIlluminant).Transform(x, y, z)
+	require.InDeltaSlice(t, []unit_float{l, a, b}, to_pcs(absolute, cmyk...), 1e-3)
+	require.NotEqual(t, to_pcs(PerceptualRenderingIntent, cmyk...), to_pcs(absolute, cmyk...))
+	// The B2A1 tag is used in the reverse direction, undoing the adaptation
+	from_pcs := func(intent RenderingIntent) []unit_float {
+		tr, err := p.CreateTransformerToProfile(p, intent, false, 4, false, false)
+		require.NoError(t, err)
+		var out, in [4]unit_float
+		copy(in[:], cmyk)
+		tr.TransformGeneral(out[:], in[:])
+		return out[:]
+	}
+	require.InDeltaSlice(t, from_pcs(relative), from_pcs(absolute), 1e-3)
+}
+
+func TestLUTConversionTagSelection(t *testing.T) {
+	const (
+		perceptual = PerceptualRenderingIntent
+		relative   = RelativeColorimetricRenderingIntent
+		saturation = SaturationRenderingIntent
+		absolute   = AbsoluteColorimetricRenderingIntent
+	)
+	type expected struct {
+		intent            RenderingIntent
+		forward, backward Signature
+	}
+	for _, tc := range []struct {
+		profile string
+		tags    []expected
+	}{
+		{"cmyk.icc", []expected{
+			{perceptual, AToB0TagSignature, BToA0TagSignature},
+			{relative, AToB1TagSignature, BToA1TagSignature},
+			{saturation, AToB2TagSignature, BToA2TagSignature},
+			// there are no A2B3/B2A3 tags, absolute uses the media relative tags
+			{absolute, AToB1TagSignature, BToA1TagSignature},
+		}},
+		{"sRGB_ICC_v4_Appearance.icc", []expected{
+			{perceptual, AToB0TagSignature, BToA0TagSignature},
+			{relative, AToB1TagSignature, BToA1TagSignature},
+			// missing tags fall back to the perceptual tags
+			{saturation, AToB0TagSignature, BToA0TagSignature},
+			{absolute, AToB1TagSignature, BToA1TagSignature},
+		}},
+		{"jpegli.icc", []expected{
+			{perceptual, AToB0TagSignature, BToA0TagSignature},
+			{relative, AToB0TagSignature, BToA0TagSignature},
+			{saturation, AToB0TagSignature, BToA0TagSignature},
+			{absolute, AToB0TagSignature, BToA0TagSignature},
+		}},
+		{"sRGB.icc", []expected{
+			{perceptual, UnknownSignature, UnknownSignature},
+			{absolute, UnknownSignature, UnknownSignature},
+		}},
+	} {
+		p, err := ReadProfile("test-profiles/" + tc.profile)
+		require.NoError(t, err)
+		for _, e := range tc.tags {
+			sig, err := p.lut_conversion_tag(true, e.intent)
+			require.NoError(t, err)
+			require.Equal(t, e.forward, sig, "%s: %s", tc.profile, e.intent)
+			sig, err = p.lut_conversion_tag(false, e.intent)
+			require.NoError(t, err)
+			require.Equal(t, e.backward, sig, "%s: %s", tc.profile, e.intent)
+		}
+		_, err = p.lut_conversion_tag(true, RenderingIntent(17))
+		require.Error(t, err)
+	}
+}
@@ -52,11 +52,29 @@ func (pr *ProfileReader) readHeader(header *Header) (err error) {
 			if n != len(data) {
 				return fmt.Errorf("decoding header consumed %d instead of %d bytes", n, len(data))
 			}
-			if header.ProfileConnectionSpace != ColorSpaceXYZ && header.ProfileConnectionSpace != ColorSpaceLab {
-				return fmt.Errorf("unsupported profile connection space colorspace: %s", header.ProfileConnectionSpace)
+			is_pcs := func(cs ColorSpace) bool { return cs == ColorSpaceXYZ || cs == ColorSpaceLab }
+			is_device := func(cs ColorSpace) bool {
+				return cs == ColorSpaceRGB || cs == ColorSpaceCMYK || cs == ColorSpaceGray
 			}
-			if header.DataColorSpace != ColorSpaceRGB && header.DataColorSpace != ColorSpaceCMYK {
-				return fmt.Errorf("unsupported device colorspace: %s", header.DataColorSpace)
+			switch header.DeviceClass {
+			case DeviceClassLink:
+				// The PCS field of a device link holds the output color space
+				for _, cs := range []ColorSpace{header.DataColorSpace, header.ProfileConnectionSpace} {
+					if !is_pcs(cs) && !is_device(cs) {
+						return fmt.Errorf("unsupported device link colorspace: %s", cs)
+					}
+				}
+			case DeviceClassAbstract:
+				if !is_pcs(header.DataColorSpace) || !is_pcs(header.ProfileConnectionSpace) {
+					return fmt.Errorf("unsupported abstract profile colorspaces: %s -> %s", header.DataColorSpace, header.ProfileConnectionSpace)
+				}
+			default:
+				if !is_pcs(header.ProfileConnectionSpace) {
+					return fmt.Errorf("unsupported profile connection space colorspace: %s", header.ProfileConnectionSpace)
+				}
+				if !is_device(header.DataColorSpace) {
+					return fmt.Errorf("unsupported device colorspace: %s", header.DataColorSpace)
+				}
 			}
 		}
 	}
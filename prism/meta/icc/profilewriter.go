@@ -0,0 +1,195 @@
+package icc
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kovidgoyal/imaging/colorconv"
+)
+
+var _ = fmt.Println
+
+// The D50 illuminant as used by the ICC PCS
+var D50 = XYZType{0.9642, 1, 0.8249}
+
+type builder_tag struct {
+	sig  Signature
+	data []byte
+}
+
+// ProfileBuilder is used to serialize ICC profiles. Tags are added as encoded
+// data, using the various Encode*Tag() functions.
+type ProfileBuilder struct {
+	Header Header
+	tags   []builder_tag
+}
+
+// Create a builder for a v4.4 profile with a D50 PCS illuminant and the current time as the creation time
+func NewProfileBuilder(device_class DeviceClass, data_colorspace, pcs ColorSpace) *ProfileBuilder {
+	ans := &ProfileBuilder{}
+	h := &ans.Header
+	h.Version = Version{Major: 4, MinorAndRev: 0x40}
+	h.DeviceClass, h.DataColorSpace, h.ProfileConnectionSpace = device_class, data_colorspace, pcs
+	h.FileSignature = ProfileFileSignature
+	h.RenderingIntent = PerceptualRenderingIntent
+	h.SetCreatedAt(time.Now())
+	h.SetPCSIlluminant(D50)
+	return ans
+}
+
+func (h *Header) SetCreatedAt(t time.Time) {
+	t = t.UTC()
+	h.CreatedAtRaw = [6]uint16{uint16(t.Year()), uint16(t.Month()), uint16(t.Day()), uint16(t.Hour()), uint16(t.Minute()), uint16(t.Second())}
+}
+
+func (h *Header) SetPCSIlluminant(xyz XYZType) {
+	copy(h.PCSIlluminant[:], append_s15fixed16(nil, xyz.X, xyz.Y, xyz.Z))
+}
+
+// Add a tag with the specified encoded data, replacing any existing tag with
+// the same signature. Tags with identical data share storage in the
+// serialized profile.
+func (b *ProfileBuilder) AddTag(sig Signature, data []byte) *ProfileBuilder {
+	if idx := slices.IndexFunc(b.tags, func(t builder_tag) bool { return t.sig == sig }); idx > -1 {
+		b.tags[idx].data = data
+	} else {
+		b.tags = append(b.tags, builder_tag{sig, data})
+	}
+	return b
+}
+
+func (b *ProfileBuilder) RemoveTag(sig Signature) *ProfileBuilder {
+	b.tags = slices.DeleteFunc(b.tags, func(t builder_tag) bool { return t.sig == sig })
+	return b
+}
+
+// Serialize the profile, calculating its size and, for v4 profiles or if the
+// header has a non-zero profile ID, its ID
+func (b *ProfileBuilder) Encode() (ans []byte, err error) {
+	const header_size = 128
+	type entry struct{ offset, size uint32 }
+	entries := make([]entry, len(b.tags))
+	tag_data_offset := header_size + 4 + 12*len(b.tags)
+	var tag_data []byte
+	for i, t := range b.tags {
+		if j := slices.IndexFunc(b.tags[:i], func(q builder_tag) bool { return bytes.Equal(q.data, t.data) }); j > -1 {
+			entries[i] = entries[j]
+			continue
+		}
+		entries[i] = entry{uint32(tag_data_offset + len(tag_data)), uint32(len(t.data))}
+		tag_data = pad_to_4(append(tag_data, t.data...))
+	}
+	h := b.Header
+	h.ProfileSize = uint32(tag_data_offset + len(tag_data))
+	h.ProfileID = [16]byte{}
+	if ans, err = binary.Append(make([]byte, 0, h.ProfileSize), binary.BigEndian, &h); err != nil {
+		return nil, err
+	}
+	if len(ans) != header_size {
+		return nil, fmt.Errorf("encoding header produced %d instead of %d bytes", len(ans), header_size)
+	}
+	ans = binary.BigEndian.AppendUint32(ans, uint32(len(b.tags)))
+	for i, t := range b.tags {
+		ans = binary.BigEndian.AppendUint32(ans, uint32(t.sig))
+		ans = binary.BigEndian.AppendUint32(ans, entries[i].offset)
+		ans = binary.BigEndian.AppendUint32(ans, entries[i].size)
+	}
+	ans = append(ans, tag_data...)
+	if h.Version.Major >= 4 || b.Header.ProfileID != [16]byte{} {
+		id := CalculateProfileID(ans)
+		copy(ans[84:100], id[:])
+	}
+	return ans, nil
+}
+
+// Serialize and then parse the profile
+func (b *ProfileBuilder) Build() (*Profile, error) {
+	data, err := b.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeProfile(bytes.NewReader(data))
+}
+
+// Calculate the profile ID of the serialized profile as per section 7.2.18
+// of ICC.1-2202-05.pdf. This is the MD5 of the profile with the flags,
+// rendering intent and profile ID fields set to zero.
+func CalculateProfileID(data []byte) [16]byte {
+	h := md5.New()
+	var zeros [16]byte
+	if len(data) < 100 {
+		h.Write(data)
+	} else {
+		h.Write(data[:44])
+		h.Write(zeros[:4])
+		h.Write(data[48:64])
+		h.Write(zeros[:4])
+		h.Write(data[68:84])
+		h.Write(zeros[:])
+		h.Write(data[100:])
+	}
+	var ans [16]byte
+	copy(ans[:], h.Sum(nil))
+	return ans
+}
+
+// Serialize the profile. The tag data is written unmodified, so it round
+// trips even for tag types that are not understood.
+func (p *Profile) Encode() ([]byte, error) {
+	b := &ProfileBuilder{Header: p.Header}
+	sigs := make([]Signature, 0, len(p.TagTable.entries))
+	for sig := range p.TagTable.entries {
+		sigs = append(sigs, sig)
+	}
+	slices.SortFunc(sigs, func(a, b Signature) int {
+		if ao, bo := p.TagTable.entries[a].offset, p.TagTable.entries[b].offset; ao != bo {
+			return ao - bo
+		}
+		return int(a) - int(b)
+	})
+	for _, sig := range sigs {
+		b.AddTag(sig, p.TagTable.entries[sig].data)
+	}
+	return b.Encode()
+}
+
+// The matrix to adapt XYZ values from the src white point to the dst white
+// point using the specified chromatic adaptation transform
+func ChromaticAdaptation(method colorconv.ChromaticAdaptationMethod, src, dst XYZType) Matrix3 {
+	return Matrix3(colorconv.ChromaticAdaptationMatrix(method, colorconv.Vec3{src.X, src.Y, src.Z}, colorconv.Vec3{dst.X, dst.Y, dst.Z}))
+}
+
+// The matrix to adapt XYZ values from the src white point to the dst white
+// point using the Bradford transform
+func BradfordAdaptation(src, dst XYZType) Matrix3 {
+	return ChromaticAdaptation(colorconv.Bradford, src, dst)
+}
+
+func add_info_tags(b *ProfileBuilder, description string) {
+	b.AddTag(DescSignature, EncodeMLUCTag(LocalizedString{Language: "en", Country: "US", Value: description}))
+	b.AddTag(CopyrightTagSignature, EncodeMLUCTag(LocalizedString{Language: "en", Country: "US", Value: "No copyright, use freely"}))
+}
+
+// Create a builder for a display class matrix/TRC RGB profile. rgb_to_xyz
+// converts linear RGB to XYZ relative to the white point of the color space
+// and is adapted to the D50 PCS. trc is used for all three channels.
+func NewMatrixTRCProfile(description string, rgb_to_xyz Matrix3, white XYZType, trc Curve1D) *ProfileBuilder {
+	b := NewProfileBuilder(DeviceClassDisplay, ColorSpaceRGB, ColorSpaceXYZ)
+	chad := BradfordAdaptation(white, D50)
+	m := chad.Multiply(rgb_to_xyz)
+	curve := EncodeCurveTag(trc)
+	add_info_tags(b, description)
+	b.AddTag(MediaWhitePointTagSignature, EncodeXYZTag(D50))
+	b.AddTag(ChromaticAdaptationTagSignature, EncodeS15Fixed16ArrayTag(chad[0][0], chad[0][1], chad[0][2], chad[1][0], chad[1][1], chad[1][2], chad[2][0], chad[2][1], chad[2][2]))
+	b.AddTag(RedMatrixColumnTagSignature, EncodeXYZTag(XYZType{m[0][0], m[1][0], m[2][0]}))
+	b.AddTag(GreenMatrixColumnTagSignature, EncodeXYZTag(XYZType{m[0][1], m[1][1], m[2][1]}))
+	b.AddTag(BlueMatrixColumnTagSignature, EncodeXYZTag(XYZType{m[0][2], m[1][2], m[2][2]}))
+	b.AddTag(RedTRCTagSignature, curve)
+	b.AddTag(GreenTRCTagSignature, curve)
+	b.AddTag(BlueTRCTagSignature, curve)
+	return b
+}
@@ -0,0 +1,172 @@
+package icc
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type general_transformer interface {
+	IOSig() (int, int)
+	Transform(r, g, b unit_float) (unit_float, unit_float, unit_float)
+	TransformGeneral(out, in []unit_float)
+}
+
+func transform_points(tr general_transformer) []unit_float {
+	num_inputs, num_outputs := tr.IOSig()
+	pts := IfElse(num_inputs == 4, Points_for_transformer_comparison4(), Points_for_transformer_comparison3())
+	ans := make([]unit_float, 0, len(pts))
+	var in, out [4]unit_float
+	for i := 0; i < len(pts); i += num_inputs {
+		if num_inputs == 3 {
+			r, g, b := tr.Transform(pts[i], pts[i+1], pts[i+2])
+			ans = append(ans, r, g, b)
+			continue
+		}
+		copy(in[:], pts[i:i+num_inputs])
+		tr.TransformGeneral(out[:], in[:])
+		ans = append(ans, out[:num_outputs]...)
+	}
+	return ans
+}
+
+func TestProfileWriter(t *testing.T) {
+	t.Run("round trips profiles", func(t *testing.T) {
+		names, err := filepath.Glob("test-profiles/*.ic[cm]")
+		require.NoError(t, err)
+		for _, name := range names {
+			original, err := os.ReadFile(name)
+			require.NoError(t, err)
+			p, err := DecodeProfile(bytes.NewReader(original))
+			if err != nil {
+				continue
+			}
+			// Apple's Display P3 profile has a non-conformant ID
+			if p.Header.ProfileID != [16]byte{} && filepath.Base(name) != "displayp3.icc" {
+				require.Equal(t, p.Header.ProfileID, CalculateProfileID(original), name)
+			}
+			data, err := p.Encode()
+			require.NoError(t, err)
+			q, err := DecodeProfile(bytes.NewReader(data))
+			require.NoError(t, err)
+			require.Equal(t, uint32(len(data)), q.Header.ProfileSize)
+			if q.Header.ProfileID != [16]byte{} {
+				require.Equal(t, q.Header.ProfileID, CalculateProfileID(data), name)
+			}
+			for sig, e := range p.TagTable.entries {
+				require.Equal(t, e.data, q.TagTable.entries[sig].data, "%s: %s", name, sig)
+			}
+			num_channels := len(p.Header.DataColorSpace.BlackPoint())
+			if a, err := p.CreateDefaultTransformerToPCS(num_channels); err == nil {
+				b, err := q.CreateDefaultTransformerToPCS(num_channels)
+				require.NoError(t, err)
+				require.Equal(t, transform_points(a), transform_points(b), name)
+			}
+		}
+	})
+
+	t.Run("encodes tags", func(t *testing.T) {
+		check := func(data []byte, expected any) {
+			t.Helper()
+			q, err := parse_tag(RedTRCTagSignature, data, ColorSpaceRGB, ColorSpaceXYZ)
+			require.NoError(t, err)
+			require.Equal(t, expected, q)
+		}
+		check(EncodeXYZTag(D50), &XYZType{0.964202880859375, 1, 0.8249053955078125})
+		check(EncodeS15Fixed16ArrayTag(1, -0.5, 2.25), []unit_float{1, -0.5, 2.25})
+		check(EncodeMLUCTag(LocalizedString{"en", "US", "hello ⛄"}, LocalizedString{"de", "DE", "hallo"}), &MultiLocalizedTag{Strings: []LocalizedString{{"en", "US", "hello ⛄"}, {"de", "DE", "hallo"}}})
+		check(EncodeDescTag("some profile"), &DescriptionTag{ASCII: "some profile"})
+		check(EncodeTextTag("copyright"), &PlainText{"copyright"})
+
+		curve := func(c Curve1D, err error) Curve1D {
+			require.NoError(t, err)
+			return c
+		}
+		for _, c := range []Curve1D{
+			nil,
+			curve(NewParametricCurve(SimpleGammaFunction, 2.2)),
+			curve(NewParametricCurve(ConditionalZeroFunction, 2.4, 0.9, 0.1)),
+			curve(NewParametricCurve(ConditionalCFunction, 2.4, 0.9, 0.1, 0.05)),
+			SRGBCurve(),
+			curve(NewParametricCurve(ComplexFunction, 2.4, 0.9, 0.1, 0.07, 0.04, 0.01, 0.02)),
+			curve(NewPointsCurve([]unit_float{0, 0.1, 0.3, 0.7, 1})),
+			curve(NewSampledCurve(func(x unit_float) unit_float { return x * x }, 1024)),
+		} {
+			q, err := parse_tag(RedTRCTagSignature, EncodeCurveTag(c), ColorSpaceRGB, ColorSpaceXYZ)
+			require.NoError(t, err)
+			if c == nil {
+				require.Equal(t, "IdentityCurve", q.(Curve1D).String())
+				continue
+			}
+			for i := range 101 {
+				x := unit_float(i) / 100
+				require.InDelta(t, c.Transform(x), q.(Curve1D).Transform(x), 2*FLOAT_EQUALITY_THRESHOLD, "%s at %v", c, x)
+			}
+		}
+	})
+
+	t.Run("encodes LUT tags", func(t *testing.T) {
+		gamma := func(g unit_float) Curve1D {
+			c, err := NewParametricCurve(SimpleGammaFunction, g)
+			require.NoError(t, err)
+			return c
+		}
+		grid := []int{5, 5, 5}
+		samples := make([]unit_float, 0, 5*5*5*3)
+		for r := range 5 {
+			for g := range 5 {
+				for b := range 5 {
+					samples = append(samples, unit_float(b)/4, unit_float(r)/4, unit_float(g)/4)
+				}
+			}
+		}
+		clut, err := NewCLUT(grid, 3, samples)
+		require.NoError(t, err)
+		curves := []Curve1D{gamma(1.8), gamma(2.2), gamma(2.4)}
+		check := func(expected ChannelTransformer, data []byte, tolerance float64) {
+			t.Helper()
+			q, err := parse_tag(AToB0TagSignature, data, ColorSpaceRGB, ColorSpaceRGB)
+			require.NoError(t, err)
+			a, b := transform_points(expected), transform_points(q.(ChannelTransformer))
+			require.InDeltaSlice(t, a, b, tolerance)
+		}
+		m := &Matrix3{{0.5, 0.2, 0.1}, {0.1, 0.6, 0.2}, {0.05, 0.1, 0.7}}
+		for _, is_a_to_b := range []bool{true, false} {
+			mt, err := NewModularTag(is_a_to_b, curves, clut, curves, m, &Translation{0.01, 0.02, 0.03}, curves)
+			require.NoError(t, err)
+			check(mt, EncodeModularTag(mt), 1e-4)
+			mt, err = NewModularTag(is_a_to_b, nil, nil, curves, m, nil, curves)
+			require.NoError(t, err)
+			check(mt, EncodeModularTag(mt), 1e-4)
+		}
+		for _, is8bit := range []bool{true, false} {
+			mft, err := NewMFT(is8bit, nil, curves, clut, curves)
+			require.NoError(t, err)
+			// 8-bit tables are quantized to 1/255
+			check(mft, EncodeMFTTag(mft), IfElse(is8bit, 3.0/255, 1e-4))
+		}
+	})
+
+	t.Run("creates matrix/TRC profiles", func(t *testing.T) {
+		// linear sRGB to XYZ relative to D65
+		m := Matrix3{{0.4124, 0.3576, 0.1805}, {0.2126, 0.7152, 0.0722}, {0.0193, 0.1192, 0.9505}}
+		b := NewMatrixTRCProfile("test sRGB", m, XYZType{0.95047, 1, 1.08883}, SRGBCurve())
+		p, err := b.Build()
+		require.NoError(t, err)
+		desc, err := p.Description()
+		require.NoError(t, err)
+		require.Equal(t, "test sRGB", desc)
+		require.True(t, p.IsSRGB())
+		b.Header.Version = Version{Major: 2, MinorAndRev: 0x40}
+		data, err := b.Encode()
+		require.NoError(t, err)
+		p, err = DecodeProfile(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, [16]byte{}, p.Header.ProfileID)
+		// shared tag data is stored only once
+		require.Equal(t, p.TagTable.entries[RedTRCTagSignature].offset, p.TagTable.entries[BlueTRCTagSignature].offset)
+	})
+}
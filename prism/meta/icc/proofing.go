@@ -0,0 +1,86 @@
+package icc
+
+import (
+	"fmt"
+)
+
+var _ = fmt.Println
+
+// The media white point as used by lcms for the absolute colorimetric intent,
+// see cmsReadMediaWhitePoint() in cmsio1.c
+func (p *Profile) media_white_point() XYZType {
+	// V2 display profiles should give D50
+	if p.Header.Version.Major < 4 && p.Header.DeviceClass == DeviceClassDisplay {
+		return p.PCSIlluminant
+	}
+	x, err := p.TagTable.get_parsed(MediaWhitePointTagSignature, p.Header.DataColorSpace, p.Header.ProfileConnectionSpace)
+	if err != nil {
+		return p.PCSIlluminant
+	}
+	if wtpt, ok := x.(*XYZType); ok && wtpt.Y > 0 && wtpt.X > 0 && wtpt.Z > 0 {
+		return *wtpt
+	}
+	return p.PCSIlluminant
+}
+
+// Create a transformer that converts colors from the device color space of
+// this profile to CIE Lab relative to the PCS illuminant
+func (p *Profile) CreateTransformerToLab(rendering_intent RenderingIntent, input_channels int, optimize bool) (ans *Pipeline, err error) {
+	if ans, err = p.createTransformerToPCS(rendering_intent); err != nil {
+		return
+	}
+	if !ans.IsSuitableFor(input_channels, 3) {
+		return nil, fmt.Errorf("transformer to PCS %s not suitable for %d input channels", ans.String(), input_channels)
+	}
+	ans.Append(transform_for_pcs_colorspace(p.Header.ProfileConnectionSpace, true))
+	if p.Header.ProfileConnectionSpace == ColorSpaceXYZ {
+		ans.Append(NewXYZtoLAB(p.PCSIlluminant))
+	}
+	ans.finalize(optimize)
+	return
+}
+
+// Create a soft proofing transformer that converts colors from this profile
+// to the display profile, simulating how they look when reproduced on the
+// device of the proof profile, for example, a printing press. proof_intent is
+// used to convert to the device color space of the proof profile. When
+// simulate_paper_white is true, the colors of the proof device are converted
+// to the display using the absolute colorimetric intent so that its paper
+// white is shown, otherwise the relative colorimetric intent maps paper white
+// to display white. See the handling of cmsFLAGS_SOFTPROOFING in cmsxform.c
+// and ComputeAbsoluteIntent() in cmscnvrt.c in lcms.
+func (p *Profile) CreateSoftProofTransformer(proof, display *Profile, proof_intent RenderingIntent, use_blackpoint_compensation, simulate_paper_white bool, input_channels int, optimize bool) (*Pipeline, error) {
+	to_proof, err := p.CreateTransformerToProfile(proof, proof_intent, use_blackpoint_compensation, input_channels, true, false)
+	if err != nil {
+		return nil, err
+	}
+	var scaling *Matrix3
+	if simulate_paper_white {
+		// Observer fully adapted to the display white
+		win, wout := proof.media_white_point(), display.media_white_point()
+		scaling = &Matrix3{{win.X / wout.X, 0, 0}, {0, win.Y / wout.Y, 0}, {0, 0, win.Z / wout.Z}}
+	}
+	to_display, err := proof.create_transformer_to_profile(display, RelativeColorimetricRenderingIntent, false, len(proof.Header.DataColorSpace.BlackPoint()), true, false, scaling)
+	if err != nil {
+		return nil, err
+	}
+	return to_proof.Weld(to_display, optimize), nil
+}
+
+// Create a transformer that converts colors from this profile to CIE Lab via
+// the device color space of the target profile, using the relative
+// colorimetric intent. Colors that are out of the gamut of the target are
+// clipped by the round trip, so comparing the output with that of
+// CreateTransformerToLab() gives the error in reproducing colors on the target
+// device.
+func (p *Profile) CreateGamutCheckTransformer(target *Profile, input_channels int, optimize bool) (*Pipeline, error) {
+	to_target, err := p.CreateTransformerToProfile(target, RelativeColorimetricRenderingIntent, false, input_channels, true, false)
+	if err != nil {
+		return nil, err
+	}
+	to_lab, err := target.CreateTransformerToLab(RelativeColorimetricRenderingIntent, len(target.Header.DataColorSpace.BlackPoint()), false)
+	if err != nil {
+		return nil, err
+	}
+	return to_target.Weld(to_lab, optimize), nil
+}
@@ -181,3 +181,54 @@ func sigDecoder(raw []byte) (any, error) {
 	}
 	return signature(raw[8:12]), nil
 }
+
+// Encode the strings as a mluc tag, as used in v4 profiles
+func EncodeMLUCTag(strings ...LocalizedString) []byte {
+	b := tag_type_header(MultiLocalisedUnicodeSignature)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(strings)))
+	b = binary.BigEndian.AppendUint32(b, 12)
+	offset := len(b) + 12*len(strings)
+	var data []byte
+	for _, s := range strings {
+		lang, country := [2]byte{' ', ' '}, [2]byte{' ', ' '}
+		copy(lang[:], s.Language)
+		copy(country[:], s.Country)
+		b = append(b, lang[0], lang[1], country[0], country[1])
+		start := len(data)
+		for _, u := range utf16.Encode([]rune(s.Value)) {
+			data = binary.BigEndian.AppendUint16(data, u)
+		}
+		b = binary.BigEndian.AppendUint32(b, uint32(len(data)-start))
+		b = binary.BigEndian.AppendUint32(b, uint32(offset+start))
+	}
+	return append(b, data...)
+}
+
+// Encode the string as a desc (textDescriptionType) tag, as used in v2
+// profiles. Non ASCII characters are only stored in the Unicode description.
+func EncodeDescTag(s string) []byte {
+	b := tag_type_header(DescSignature)
+	ascii := make([]byte, 0, len(s)+1)
+	for _, r := range s {
+		ascii = append(ascii, IfElse(r < 0x80, byte(r), '?'))
+	}
+	ascii = append(ascii, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(ascii)))
+	b = append(b, ascii...)
+	u := utf16.Encode([]rune(s + "\x00"))
+	b = binary.BigEndian.AppendUint32(b, 0) // language code
+	b = binary.BigEndian.AppendUint32(b, uint32(len(u)))
+	for _, x := range u {
+		b = binary.BigEndian.AppendUint16(b, x)
+	}
+	// empty ScriptCode description
+	b = append(b, 0, 0, 0)
+	return append(b, make([]byte, 67)...)
+}
+
+// Encode the string as a text tag, as used for the copyright in v2 profiles
+func EncodeTextTag(s string) []byte {
+	b := tag_type_header(TextTagSignature)
+	b = append(b, s...)
+	return append(b, 0)
+}
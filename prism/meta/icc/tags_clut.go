@@ -135,6 +135,20 @@ func (m *TrilinearInterpolate) TransformGeneral(o, i []unit_float) {
 	}
 	m.d.trilinear_interpolate(i[0:m.d.num_inputs:m.d.num_inputs], o)
 }
+func (m *TrilinearInterpolate) TransformPlanes(o, i [][]unit_float) {
+	var ibuf, obuf [4]unit_float
+	in, out := ibuf[:m.d.num_inputs], obuf[:m.d.num_outputs]
+	for k := range i[0] {
+		for c := range in {
+			in[c] = i[c][k]
+		}
+		clear(out)
+		m.d.trilinear_interpolate(in, out)
+		for c, x := range out {
+			o[c][k] = x
+		}
+	}
+}
 
 func (c *TetrahedralInterpolate) Tetrahedral_interpolate(r, g, b unit_float) (unit_float, unit_float, unit_float) {
 	var obuf [3]unit_float
@@ -147,9 +161,77 @@ func (c *TetrahedralInterpolate) Transform(r, g, b unit_float) (unit_float, unit
 }
 
 func (m *TetrahedralInterpolate) TransformGeneral(o, i []unit_float) {
-	m.d.tetrahedral_interpolation4(i[0], i[1], i[2], i[3], o[:m.d.num_outputs:m.d.num_outputs])
+	o = o[:m.d.num_outputs:m.d.num_outputs]
+	if m.d.num_inputs == 3 {
+		// For example, the BToA tables of CMYK profiles
+		m.d.tetrahedral_interpolation(i[0], i[1], i[2], o)
+	} else {
+		m.d.tetrahedral_interpolation4(i[0], i[1], i[2], i[3], o)
+	}
+}
+
+func (m *TetrahedralInterpolate) TransformPlanes(o, i [][]unit_float) {
+	var obuf [4]unit_float
+	out := obuf[:m.d.num_outputs]
+	i0 := i[0]
+	i1, i2 := i[1][:len(i0)], i[2][:len(i0)]
+	if m.d.num_inputs == 3 {
+		for k, r := range i0 {
+			m.d.tetrahedral_interpolation(r, i1[k], i2[k], out)
+			for c, x := range out {
+				o[c][k] = x
+			}
+		}
+		return
+	}
+	i3 := i[3][:len(i0)]
+	for k, r := range i0 {
+		m.d.tetrahedral_interpolation4(r, i1[k], i2[k], i3[k], out)
+		for c, x := range out {
+			o[c][k] = x
+		}
+	}
 }
 
 func clamp01(v unit_float) unit_float {
 	return max(0, min(v, 1))
 }
+
+// Create a color lookup table with the specified number of grid points per
+// input channel. The samples are in [0, 1] with the output channels varying
+// fastest and the first input channel varying slowest.
+func NewCLUT(grid_points []int, num_outputs int, samples []unit_float) (CLUT, error) {
+	if len(grid_points) < 1 || len(grid_points) > 4 {
+		return nil, fmt.Errorf("a CLUT must have between one and four input channels not: %d", len(grid_points))
+	}
+	for i, g := range grid_points {
+		if g < 2 || g > math.MaxUint8 {
+			return nil, fmt.Errorf("CLUT input channel %d has invalid grid points: %d", i, g)
+		}
+	}
+	if expected := expectedValues(grid_points, num_outputs); expected != len(samples) {
+		return nil, fmt.Errorf("CLUT has %d samples instead of %d", len(samples), expected)
+	}
+	return make_clut(grid_points, len(grid_points), num_outputs, samples, false, false), nil
+}
+
+func clut_data(c CLUT) *interpolation_data {
+	switch c := c.(type) {
+	case *TrilinearInterpolate:
+		return c.d
+	case *TetrahedralInterpolate:
+		return c.d
+	}
+	return nil
+}
+
+// Append the CLUT in the format used by mAB/mBA tags with 16 bit precision
+func append_clut(b []byte, c CLUT) []byte {
+	var grid [16]byte
+	for i, g := range clut_data(c).grid_points {
+		grid[i] = byte(g)
+	}
+	b = append(b, grid[:]...)
+	b = append(b, 2, 0, 0, 0)
+	return append_uint16_table(b, c.Samples()...)
+}
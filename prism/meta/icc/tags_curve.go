@@ -58,6 +58,13 @@ func (c CurveTransformer) TransformGeneral(o, i []unit_float) {
 		o[n] = c.Transform(i[n])
 	}
 }
+func (c CurveTransformer) TransformPlanes(o, i [][]unit_float) {
+	for n, c := range c.curves {
+		for k, x := range i[n] {
+			o[n][k] = c.Transform(x)
+		}
+	}
+}
 
 func (c InverseCurveTransformer) IOSig() (int, int) {
 	return len(c.curves), len(c.curves)
@@ -71,6 +78,13 @@ func (c InverseCurveTransformer) TransformGeneral(o, i []unit_float) {
 		o[n] = c.InverseTransform(i[n])
 	}
 }
+func (c InverseCurveTransformer) TransformPlanes(o, i [][]unit_float) {
+	for n, c := range c.curves {
+		for k, x := range i[n] {
+			o[n][k] = c.InverseTransform(x)
+		}
+	}
+}
 
 type CurveTransformer3 struct {
 	r, g, b Curve1D
@@ -82,6 +96,13 @@ func (c CurveTransformer3) Transform(r, g, b unit_float) (unit_float, unit_float
 	return c.r.Transform(r), c.g.Transform(g), c.b.Transform(b)
 }
 func (m CurveTransformer3) TransformGeneral(o, i []unit_float) { tg33(m.Transform, o, i) }
+func (m CurveTransformer3) TransformPlanes(o, i [][]unit_float) {
+	for n, c := range [3]Curve1D{m.r, m.g, m.b} {
+		for k, x := range i[n] {
+			o[n][k] = c.Transform(x)
+		}
+	}
+}
 
 type InverseCurveTransformer3 struct {
 	r, g, b Curve1D
@@ -121,6 +142,13 @@ func (c InverseCurveTransformer3) Transform(r, g, b unit_float) (unit_float, uni
 	return c.r.InverseTransform(clamp01(r)), c.g.InverseTransform(clamp01(g)), c.b.InverseTransform(clamp01(b))
 }
 func (m InverseCurveTransformer3) TransformGeneral(o, i []unit_float) { tg33(m.Transform, o, i) }
+func (m InverseCurveTransformer3) TransformPlanes(o, i [][]unit_float) {
+	for n, c := range [3]Curve1D{m.r, m.g, m.b} {
+		for k, x := range i[n] {
+			o[n][k] = c.InverseTransform(clamp01(x))
+		}
+	}
+}
 
 type Curves interface {
 	ChannelTransformer
@@ -666,3 +694,125 @@ var SRGBCurveTransformer = sync.OnceValue(func() Curves {
 var SRGBCurveInverseTransformer = sync.OnceValue(func() Curves {
 	return NewInverseCurveTransformer("TRC", SRGBCurve(), SRGBCurve(), SRGBCurve())
 })
+
+// Create a parametric curve of the specified function type, the parameters
+// are in the order used by the ICC specification: g, a, b, c, d, e, f
+func NewParametricCurve(function ParametricCurveFunction, params ...unit_float) (ans Curve1D, err error) {
+	p := func(i int) unit_float {
+		if i < len(params) {
+			return params[i]
+		}
+		return 0
+	}
+	switch function {
+	case SimpleGammaFunction:
+		ans = &GammaCurve{gamma: p(0)}
+	case ConditionalZeroFunction:
+		ans = &ConditionalZeroCurve{g: p(0), a: p(1), b: p(2)}
+	case ConditionalCFunction:
+		ans = &ConditionalCCurve{g: p(0), a: p(1), b: p(2), c: p(3)}
+	case SplitFunction:
+		ans = &SplitCurve{g: p(0), a: p(1), b: p(2), c: p(3), d: p(4)}
+	case ComplexFunction:
+		ans = &ComplexCurve{g: p(0), a: p(1), b: p(2), c: p(3), d: p(4), e: p(5), f: p(6)}
+	default:
+		return nil, fmt.Errorf("unknown parametric function type: %d", function)
+	}
+	if err = ans.Prepare(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Create a curve from evenly spaced samples in [0, 1]
+func NewPointsCurve(points []unit_float) (Curve1D, error) {
+	if len(points) < 2 {
+		return nil, fmt.Errorf("a sampled curve must have at least two points")
+	}
+	return load_points_curve(points)
+}
+
+// Create a curve by sampling the specified function at num_points evenly spaced points in [0, 1]
+func NewSampledCurve(f func(unit_float) unit_float, num_points int) (Curve1D, error) {
+	return NewPointsCurve(sample_curve(f, num_points))
+}
+
+func sample_curve(f func(unit_float) unit_float, num_points int) []unit_float {
+	ans := make([]unit_float, num_points)
+	n := 1 / unit_float(num_points-1)
+	for i := range ans {
+		ans[i] = clamp01(f(unit_float(i) * n))
+	}
+	return ans
+}
+
+func append_s15fixed16(b []byte, vals ...unit_float) []byte {
+	for _, v := range vals {
+		v = max(math.MinInt32, min(math.Round(v*65536), math.MaxInt32))
+		b = binary.BigEndian.AppendUint32(b, uint32(int32(v)))
+	}
+	return b
+}
+
+func append_uint16_table(b []byte, vals ...unit_float) []byte {
+	for _, v := range vals {
+		b = binary.BigEndian.AppendUint16(b, uint16(math.Round(clamp01(v)*math.MaxUint16)))
+	}
+	return b
+}
+
+func append_uint8_table(b []byte, vals ...unit_float) []byte {
+	for _, v := range vals {
+		b = append(b, uint8(math.Round(clamp01(v)*math.MaxUint8)))
+	}
+	return b
+}
+
+func tag_type_header(sig Signature) []byte {
+	b := make([]byte, 8, 64)
+	binary.BigEndian.PutUint32(b, uint32(sig))
+	return b
+}
+
+func pad_to_4(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+const default_num_of_curve_samples = 4096
+
+// Encode a curve as a curv or para tag, curves that are neither analytic nor
+// sampled are sampled at 4096 points
+func EncodeCurveTag(c Curve1D) []byte {
+	para := func(f ParametricCurveFunction, params ...unit_float) []byte {
+		b := tag_type_header(ParametricCurveTypeSignature)
+		b = binary.BigEndian.AppendUint16(b, uint16(f))
+		b = append(b, 0, 0)
+		return append_s15fixed16(b, params...)
+	}
+	curv := func(points []unit_float) []byte {
+		b := tag_type_header(CurveTypeSignature)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(points)))
+		return pad_to_4(append_uint16_table(b, points...))
+	}
+	switch c := c.(type) {
+	case nil, *IdentityCurve:
+		return curv(nil)
+	case *GammaCurve:
+		return para(SimpleGammaFunction, c.gamma)
+	case *ConditionalZeroCurve:
+		return para(ConditionalZeroFunction, c.g, c.a, c.b)
+	case *ConditionalCCurve:
+		return para(ConditionalCFunction, c.g, c.a, c.b, c.c)
+	case *SplitCurve:
+		return para(SplitFunction, c.g, c.a, c.b, c.c, c.d)
+	case *ComplexCurve:
+		return para(ComplexFunction, c.g, c.a, c.b, c.c, c.d, c.e, c.f)
+	case *PointsCurve:
+		return curv(c.points)
+	default:
+		return curv(sample_curve(c.Transform, default_num_of_curve_samples))
+	}
+}
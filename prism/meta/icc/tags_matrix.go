@@ -87,6 +87,17 @@ func (m *Matrix3) Transform(r, g, b unit_float) (unit_float, unit_float, unit_fl
 	return m[0][0]*r + m[0][1]*g + m[0][2]*b, m[1][0]*r + m[1][1]*g + m[1][2]*b, m[2][0]*r + m[2][1]*g + m[2][2]*b
 }
 func (m *Matrix3) TransformGeneral(o, i []unit_float) { tg33(m.Transform, o, i) }
+func (m *Matrix3) TransformPlanes(o, i [][]unit_float) {
+	i0 := i[0]
+	i1, i2 := i[1][:len(i0)], i[2][:len(i0)]
+	o0, o1, o2 := o[0][:len(i0)], o[1][:len(i0)], o[2][:len(i0)]
+	for k, r := range i0 {
+		g, b := i1[k], i2[k]
+		o0[k] = m[0][0]*r + m[0][1]*g + m[0][2]*b
+		o1[k] = m[1][0]*r + m[1][1]*g + m[1][2]*b
+		o2[k] = m[2][0]*r + m[2][1]*g + m[2][2]*b
+	}
+}
 
 func (m *Matrix3) Transpose() Matrix3 {
 	return Matrix3{
@@ -186,6 +197,13 @@ func (m *Translation) Transform(r, g, b unit_float) (unit_float, unit_float, uni
 }
 
 func (m *Translation) TransformGeneral(o, i []unit_float) { tg33(m.Transform, o, i) }
+func (m *Translation) TransformPlanes(o, i [][]unit_float) {
+	for c, x := range m {
+		for k, v := range i[c] {
+			o[c][k] = v + x
+		}
+	}
+}
 
 func (m IdentityMatrix) Transform(r, g, b unit_float) (unit_float, unit_float, unit_float) {
 	return r, g, b
@@ -207,3 +225,40 @@ func (m *MatrixWithOffset) Transform(r, g, b unit_float) (unit_float, unit_float
 	return r, g, b
 }
 func (m *MatrixWithOffset) TransformGeneral(o, i []unit_float) { tg33(m.Transform, o, i) }
+func (m *MatrixWithOffset) TransformPlanes(o, i [][]unit_float) {
+	if bt, ok := m.m.(BatchTransformer); ok {
+		bt.TransformPlanes(o, i)
+		t := Translation{m.offset1, m.offset2, m.offset3}
+		t.TransformPlanes(o, o)
+	} else {
+		tp33(m.Transform, o, i)
+	}
+}
+
+// Split a matrix transformer, as stored in parsed tags, into its matrix and offset
+func split_matrix(c ChannelTransformer) (m *Matrix3, offset *Translation) {
+	switch c := c.(type) {
+	case *MatrixWithOffset:
+		m, _ = split_matrix(c.m)
+		return m, c.Translation()
+	case AsMatrix3:
+		return c.AsMatrix3(), nil
+	}
+	return nil, nil
+}
+
+// Append the matrix in the format used by mAB/mBA and mft tags, a nil
+// matrix is written as the identity matrix. The offset, if any, is written
+// after the matrix.
+func append_matrix(b []byte, m *Matrix3, offset *Translation) []byte {
+	if m == nil {
+		m = NewScalingMatrix3(1)
+	}
+	for _, row := range m {
+		b = append_s15fixed16(b, row[:]...)
+	}
+	if offset != nil {
+		b = append_s15fixed16(b, offset[:]...)
+	}
+	return b
+}
@@ -169,3 +169,81 @@ func decode_mft16(raw []byte, input_colorspace, output_colorspace ColorSpace) (a
 	err = load_mft_body(a, raw[4:], load_16bit_table, int(input_table_entries), int(output_table_entries), input_colorspace, output_colorspace, 2)
 	return a, err
 }
+
+// Create a lut8type (mft1) or lut16type (mft2) transform. The matrix can be
+// nil and is only used when the input color space is XYZ. All input
+// channels of the CLUT must have the same number of grid points.
+func NewMFT(is8bit bool, matrix *Matrix3, input_curves []Curve1D, clut CLUT, output_curves []Curve1D) (*MFT, error) {
+	d := clut_data(clut)
+	if d == nil {
+		return nil, fmt.Errorf("mft tags must have a CLUT")
+	}
+	if len(input_curves) != d.num_inputs || len(output_curves) != d.num_outputs {
+		return nil, fmt.Errorf("the number of curves does not match the number of CLUT channels")
+	}
+	for _, g := range d.grid_points {
+		if g != d.grid_points[0] {
+			return nil, fmt.Errorf("mft tags must have the same number of CLUT grid points for every input channel")
+		}
+	}
+	ans := &MFT{
+		in_channels: d.num_inputs, out_channels: d.num_outputs, grid_points: d.grid_points, is8bit: is8bit,
+		input_curve: NewCurveTransformer("Input", input_curves...), output_curve: NewCurveTransformer("Output", output_curves...),
+		clut: make_clut(d.grid_points, d.num_inputs, d.num_outputs, d.samples, true, false),
+	}
+	if matrix == nil {
+		m := IdentityMatrix(0)
+		ans.matrix = &m
+	} else {
+		ans.matrix = matrix
+	}
+	return ans, nil
+}
+
+func (c *MFT) curve_tables(curves Curves, num_curves int) (tables [][]unit_float) {
+	var cc []Curve1D
+	if !is_nil(curves) {
+		cc = curves.Curves()
+	}
+	num_entries := 256
+	if !c.is8bit {
+		num_entries = 1024
+		for _, x := range cc {
+			if p, ok := x.(*PointsCurve); ok {
+				num_entries = max(num_entries, len(p.points))
+			}
+		}
+		num_entries = min(num_entries, default_num_of_curve_samples)
+	}
+	for i := range num_curves {
+		f := func(x unit_float) unit_float { return x }
+		if i < len(cc) && cc[i] != nil {
+			f = cc[i].Transform
+		}
+		tables = append(tables, sample_curve(f, num_entries))
+	}
+	return
+}
+
+// Encode as a lut8type (mft1) or lut16type (mft2) tag
+func EncodeMFTTag(c *MFT) []byte {
+	b := tag_type_header(IfElse(c.is8bit, Lut8TypeSignature, Lut16TypeSignature))
+	b = append(b, byte(c.in_channels), byte(c.out_channels), byte(c.grid_points[0]), 0)
+	m, _ := split_matrix(c.matrix)
+	b = append_matrix(b, m, nil)
+	input_tables, output_tables := c.curve_tables(c.input_curve, c.in_channels), c.curve_tables(c.output_curve, c.out_channels)
+	appender := append_uint8_table
+	if !c.is8bit {
+		appender = append_uint16_table
+		b = binary.BigEndian.AppendUint16(b, uint16(len(input_tables[0])))
+		b = binary.BigEndian.AppendUint16(b, uint16(len(output_tables[0])))
+	}
+	for _, t := range input_tables {
+		b = appender(b, t...)
+	}
+	b = appender(b, c.clut.Samples()...)
+	for _, t := range output_tables {
+		b = appender(b, t...)
+	}
+	return b
+}
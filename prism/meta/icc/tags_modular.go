@@ -91,7 +91,7 @@ func modularDecoder(raw []byte, _, output_colorspace ColorSpace) (ans any, err e
 		block := raw[offset:]
 		var c any
 		var consumed int
-		for range inputCh {
+		for range num_curves_reqd {
 			if len(block) < 4 {
 				return nil, errors.New("modular (mAB/mBA) tag too short")
 			}
@@ -121,7 +121,7 @@ func modularDecoder(raw []byte, _, output_colorspace ColorSpace) (ans any, err e
 	if mt.a_curves, err = read_curves(a, IfElse(is_a_to_b, inputCh, outputCh)); err != nil {
 		return nil, err
 	}
-	if mt.m_curves, err = read_curves(m, outputCh); err != nil {
+	if mt.m_curves, err = read_curves(m, IfElse(is_a_to_b, outputCh, inputCh)); err != nil {
 		return nil, err
 	}
 	var temp any
@@ -139,7 +139,12 @@ func modularDecoder(raw []byte, _, output_colorspace ColorSpace) (ans any, err e
 			mt.matrix = temp.(ChannelTransformer)
 		}
 	}
-	ans = mt
+	mt.build_transform_objects()
+	return mt, nil
+}
+
+func (mt *ModularTag) build_transform_objects() {
+	mt.transform_objects = nil
 	add_curves := func(name string, c []Curve1D) {
 		if len(c) > 0 {
 			has_non_identity := false
@@ -173,8 +178,92 @@ func modularDecoder(raw []byte, _, output_colorspace ColorSpace) (ans any, err e
 		}
 	}
 	add_curves("B", mt.b_curves)
-	if !is_a_to_b {
+	if !mt.is_a_to_b {
 		slices.Reverse(mt.transform_objects)
 	}
-	return
+}
+
+// Create a lutAtoBType (mAB) or lutBtoAType (mBA) transform. For mAB the
+// order of processing is A curves, CLUT, M curves, matrix, B curves and
+// for mBA it is the reverse. The B curves are required, everything else can
+// be nil. The M curves must be present if the matrix is.
+func NewModularTag(is_a_to_b bool, a_curves []Curve1D, clut CLUT, m_curves []Curve1D, matrix *Matrix3, offset *Translation, b_curves []Curve1D) (*ModularTag, error) {
+	if len(b_curves) == 0 {
+		return nil, fmt.Errorf("modular tags must have B curves")
+	}
+	if (matrix != nil || offset != nil) && len(m_curves) == 0 {
+		return nil, fmt.Errorf("modular tags with a matrix must have M curves")
+	}
+	if len(a_curves) > 0 && clut == nil {
+		return nil, fmt.Errorf("modular tags with A curves must have a CLUT")
+	}
+	mt := &ModularTag{is_a_to_b: is_a_to_b, a_curves: a_curves, m_curves: m_curves, b_curves: b_curves, clut: clut}
+	pcs_channels, device_channels := len(b_curves), len(b_curves)
+	if clut != nil {
+		d := clut_data(clut)
+		if d == nil {
+			return nil, fmt.Errorf("unsupported CLUT type: %T", clut)
+		}
+		device_channels = d.num_inputs
+		if !is_a_to_b {
+			device_channels = d.num_outputs
+		}
+		if len(a_curves) != device_channels {
+			return nil, fmt.Errorf("modular tags with a CLUT must have A curves for every device channel")
+		}
+		if pcs_channels != IfElse(is_a_to_b, d.num_outputs, d.num_inputs) {
+			return nil, fmt.Errorf("the number of CLUT channels does not match the number of B curves")
+		}
+	}
+	if (len(m_curves) > 0 && len(m_curves) != pcs_channels) || ((matrix != nil || offset != nil) && pcs_channels != 3) {
+		return nil, fmt.Errorf("the number of M curves or matrix channels does not match the number of B curves")
+	}
+	if matrix != nil || offset != nil {
+		if offset == nil || offset.Empty() {
+			mt.matrix = matrix
+		} else {
+			if matrix == nil {
+				matrix = NewScalingMatrix3(1)
+			}
+			mt.matrix = &MatrixWithOffset{m: matrix, offset1: offset[0], offset2: offset[1], offset3: offset[2]}
+		}
+	}
+	mt.num_input_channels, mt.num_output_channels = IfElse(is_a_to_b, device_channels, pcs_channels), IfElse(is_a_to_b, pcs_channels, device_channels)
+	mt.build_transform_objects()
+	return mt, nil
+}
+
+// Encode as a lutAtoBType (mAB) or lutBtoAType (mBA) tag
+func EncodeModularTag(mt *ModularTag) []byte {
+	b := tag_type_header(IfElse(mt.is_a_to_b, LutAtoBTypeSignature, LutBtoATypeSignature))
+	b = append(b, byte(mt.num_input_channels), byte(mt.num_output_channels), 0, 0)
+	offsets_pos := len(b)
+	b = append(b, make([]byte, 20)...)
+	set_offset := func(idx int) {
+		binary.BigEndian.PutUint32(b[offsets_pos+4*idx:], uint32(len(b)))
+	}
+	append_curves := func(idx int, curves []Curve1D) {
+		if len(curves) > 0 {
+			set_offset(idx)
+			for _, c := range curves {
+				b = append(b, pad_to_4(EncodeCurveTag(c))...)
+			}
+		}
+	}
+	append_curves(0, mt.b_curves)
+	if mt.matrix != nil {
+		set_offset(1)
+		m, offset := split_matrix(mt.matrix)
+		if offset == nil {
+			offset = &Translation{}
+		}
+		b = append_matrix(b, m, offset)
+	}
+	append_curves(2, mt.m_curves)
+	if mt.clut != nil {
+		set_offset(3)
+		b = pad_to_4(append_clut(b, mt.clut.(CLUT)))
+	}
+	append_curves(4, mt.a_curves)
+	return b
 }
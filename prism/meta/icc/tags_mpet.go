@@ -0,0 +1,405 @@
+package icc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var _ = fmt.Print
+
+const (
+	SegmentedCurveSignature  Signature = 0x63757266 /* 'curf' */
+	FormulaCurveSegSignature Signature = 0x70617266 /* 'parf' */
+	SampledCurveSegSignature Signature = 0x73616D66 /* 'samf' */
+)
+
+// MultiProcessElementsTag represents the multiProcessElementsType tag,
+// section 10.14 of ICC.1-2202-05.pdf, used by the D2Bx and B2Dx tags. It
+// operates on unbounded floating point values.
+type MultiProcessElementsTag struct {
+	num_input_channels, num_output_channels int
+	elements                                []ChannelTransformer
+}
+
+var _ ChannelTransformer = (*MultiProcessElementsTag)(nil)
+
+func (m MultiProcessElementsTag) String() string {
+	return fmt.Sprintf("mpet{ %s }", transformers_as_string(m.elements...))
+}
+
+func (m *MultiProcessElementsTag) IOSig() (int, int) {
+	return m.num_input_channels, m.num_output_channels
+}
+
+func (m *MultiProcessElementsTag) Iter(f func(ChannelTransformer) bool) {
+	for _, c := range m.elements {
+		if !f(c) {
+			break
+		}
+	}
+}
+
+func (m *MultiProcessElementsTag) Transform(r, g, b unit_float) (unit_float, unit_float, unit_float) {
+	for _, t := range m.elements {
+		r, g, b = t.Transform(r, g, b)
+	}
+	return r, g, b
+}
+
+func (m *MultiProcessElementsTag) TransformGeneral(o, i []unit_float) {
+	for _, t := range m.elements {
+		t.TransformGeneral(o, i)
+		copy(i, o)
+	}
+}
+
+// Return a copy with the stages needed to convert between the normalized
+// [0, 1] encoding used by pipelines in this package and the actual values of
+// the PCS and device color spaces as used by the floating point tags, see
+// _cmsReadFloatInputTag() and _cmsReadFloatOutputTag() in cmsio1.c in lcms
+func (m *MultiProcessElementsTag) with_normalization(device_colorspace, pcs ColorSpace, forward bool) *MultiProcessElementsTag {
+	in, out := device_colorspace, pcs
+	if !forward {
+		in, out = out, in
+	}
+	ans := &MultiProcessElementsTag{num_input_channels: m.num_input_channels, num_output_channels: m.num_output_channels}
+	switch in {
+	case ColorSpaceLab, ColorSpaceXYZ:
+		ans.elements = append(ans.elements, transform_for_pcs_colorspace(in, true))
+	}
+	ans.elements = append(ans.elements, m.elements...)
+	switch out {
+	case ColorSpaceLab, ColorSpaceXYZ:
+		ans.elements = append(ans.elements, transform_for_pcs_colorspace(out, false))
+	}
+	return ans
+}
+
+// A curve segment of a SegmentedCurve, the curve is evaluated by the
+// segment for which x0 < x <= x1
+type curve_segment struct {
+	x0, x1     unit_float
+	formula    uint16
+	params     []unit_float
+	samples    []unit_float // sampled segments, the first sample is implicit
+	is_sampled bool
+}
+
+func (s *curve_segment) eval(x unit_float) unit_float {
+	if s.is_sampled {
+		// Linear interpolation of the samples, evenly spaced over the segment
+		t := clamp01((x - s.x0) / (s.x1 - s.x0))
+		n := len(s.samples) - 1
+		if t >= 1 {
+			return s.samples[n]
+		}
+		p := t * unit_float(n)
+		i := int(p)
+		f := p - unit_float(i)
+		return s.samples[i] + f*(s.samples[i+1]-s.samples[i])
+	}
+	// See DefaultEvalParametricFn() in cmsgmt.c in lcms for handling of the
+	// undefined regions
+	p := s.params
+	switch s.formula {
+	case 0:
+		// Y = (a*X + b)^γ + c
+		e := p[1]*x + p[2]
+		if e < 0 {
+			return p[3]
+		}
+		return math.Pow(e, p[0]) + p[3]
+	case 1:
+		// Y = a*log10(b*X^γ + c) + d
+		e := p[2]*math.Pow(x, p[0]) + p[3]
+		if e <= 0 {
+			return p[4]
+		}
+		return p[1]*math.Log10(e) + p[4]
+	default:
+		// Y = a*b^(c*X + d) + e
+		return p[0]*math.Pow(p[1], p[2]*x+p[3]) + p[4]
+	}
+}
+
+// SegmentedCurve represents a segmented curve of a curve set element,
+// section 10.14.3 of ICC.1-2202-05.pdf
+type SegmentedCurve struct {
+	segments []curve_segment
+}
+
+var _ Curve1D = (*SegmentedCurve)(nil)
+
+func (c *SegmentedCurve) Prepare() error { return nil }
+
+func (c *SegmentedCurve) String() string {
+	var b strings.Builder
+	for i, s := range c.segments {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		if s.is_sampled {
+			fmt.Fprintf(&b, "samf(%d)", len(s.samples))
+		} else {
+			fmt.Fprintf(&b, "parf%d%.6v", s.formula, s.params)
+		}
+	}
+	return "SegmentedCurve{" + b.String() + "}"
+}
+
+func (c *SegmentedCurve) Transform(x unit_float) unit_float {
+	for i := len(c.segments) - 1; i >= 0; i-- {
+		if s := &c.segments[i]; x > s.x0 && x <= s.x1 {
+			return s.eval(x)
+		}
+	}
+	return c.segments[0].eval(x)
+}
+
+// The inverse is found numerically in [0, 1] assuming the curve is monotonic
+func (c *SegmentedCurve) InverseTransform(y unit_float) unit_float {
+	lo, hi := unit_float(0), unit_float(1)
+	increasing := c.Transform(hi) >= c.Transform(lo)
+	for range 64 {
+		mid := (lo + hi) / 2
+		if (c.Transform(mid) < y) == increasing {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+func read_float32(b []byte) unit_float {
+	return unit_float(math.Float32frombits(binary.BigEndian.Uint32(b)))
+}
+
+func read_float32s(b []byte, n int) ([]unit_float, error) {
+	if len(b) < 4*n {
+		return nil, fmt.Errorf("float32 array too short: %d < %d", len(b), 4*n)
+	}
+	ans := make([]unit_float, n)
+	for i := range ans {
+		ans[i] = read_float32(b[4*i:])
+	}
+	return ans, nil
+}
+
+func segmentedCurveDecoder(raw []byte) (*SegmentedCurve, error) {
+	if len(raw) < 12 || signature(raw) != SegmentedCurveSignature {
+		return nil, errors.New("invalid segmented curve")
+	}
+	count := int(binary.BigEndian.Uint16(raw[8:]))
+	if count < 1 {
+		return nil, errors.New("segmented curve has no segments")
+	}
+	breaks, err := read_float32s(raw[12:], count-1)
+	if err != nil {
+		return nil, err
+	}
+	ans := &SegmentedCurve{segments: make([]curve_segment, count)}
+	prev := unit_float(math.Inf(-1))
+	for i, b := range breaks {
+		ans.segments[i].x0, ans.segments[i].x1 = prev, b
+		prev = b
+	}
+	ans.segments[count-1].x0, ans.segments[count-1].x1 = prev, unit_float(math.Inf(1))
+	raw = raw[12+4*len(breaks):]
+	for i := range ans.segments {
+		s := &ans.segments[i]
+		if len(raw) < 12 {
+			return nil, errors.New("segmented curve too short")
+		}
+		switch signature(raw) {
+		case FormulaCurveSegSignature:
+			s.formula = binary.BigEndian.Uint16(raw[8:])
+			if s.formula > 2 {
+				return nil, fmt.Errorf("unsupported formula curve segment type: %d", s.formula)
+			}
+			n := IfElse(s.formula == 0, 4, 5)
+			if s.params, err = read_float32s(raw[12:], n); err != nil {
+				return nil, err
+			}
+			raw = raw[12+4*n:]
+		case SampledCurveSegSignature:
+			if i == 0 || math.IsInf(float64(s.x1), 1) {
+				return nil, errors.New("the first and last segments of a segmented curve cannot be sampled")
+			}
+			n := int(binary.BigEndian.Uint32(raw[8:]))
+			if n < 1 {
+				return nil, errors.New("sampled curve segment has no samples")
+			}
+			samples, err := read_float32s(raw[12:], n)
+			if err != nil {
+				return nil, err
+			}
+			s.is_sampled = true
+			// The first sample is the value of the previous segment at the break point
+			s.samples = append([]unit_float{ans.segments[i-1].eval(s.x0)}, samples...)
+			raw = raw[12+4*n:]
+		default:
+			return nil, fmt.Errorf("unknown curve segment type: %s", signature(raw))
+		}
+	}
+	return ans, nil
+}
+
+// A matrix element with an arbitrary number of inputs and outputs
+type MatrixElement struct {
+	num_inputs, num_outputs int
+	m, offsets              []unit_float // the matrix is num_outputs rows of num_inputs columns
+}
+
+var _ ChannelTransformer = (*MatrixElement)(nil)
+
+func (m *MatrixElement) String() string {
+	return fmt.Sprintf("MatrixElement{%d×%d %.6v %.6v}", m.num_outputs, m.num_inputs, m.m, m.offsets)
+}
+func (m *MatrixElement) IOSig() (int, int)                    { return m.num_inputs, m.num_outputs }
+func (m *MatrixElement) Iter(f func(ChannelTransformer) bool) { f(m) }
+func (m *MatrixElement) Transform(r, g, b unit_float) (unit_float, unit_float, unit_float) {
+	var o [3]unit_float
+	m.TransformGeneral(o[:], []unit_float{r, g, b})
+	return o[0], o[1], o[2]
+}
+func (m *MatrixElement) TransformGeneral(o, i []unit_float) {
+	var buf [16]unit_float
+	out := buf[:m.num_outputs]
+	for r := range out {
+		row := m.m[r*m.num_inputs : (r+1)*m.num_inputs]
+		v := m.offsets[r]
+		for c, x := range row {
+			v += x * i[c]
+		}
+		out[r] = v
+	}
+	copy(o, out)
+}
+
+func mpe_element_decoder(raw []byte) (ans []ChannelTransformer, err error) {
+	if len(raw) < 12 {
+		return nil, errors.New("multi process element too short")
+	}
+	in, out := int(binary.BigEndian.Uint16(raw[8:])), int(binary.BigEndian.Uint16(raw[10:]))
+	if in < 1 || out < 1 || in > 15 || out > 15 {
+		return nil, fmt.Errorf("multi process element has invalid number of channels: %d -> %d", in, out)
+	}
+	switch sig := signature(raw); sig {
+	case CurveSetElemTypeSignature:
+		if in != out {
+			return nil, fmt.Errorf("curve set element has different number of input and output channels: %d != %d", in, out)
+		}
+		positions, err := read_position_table(raw, 12, in)
+		if err != nil {
+			return nil, err
+		}
+		curves := make([]Curve1D, in)
+		for i, p := range positions {
+			if curves[i], err = segmentedCurveDecoder(p); err != nil {
+				return nil, err
+			}
+		}
+		return []ChannelTransformer{NewCurveTransformer("SegmentedCurves", curves...)}, nil
+	case MatrixElemTypeSignature:
+		vals, err := read_float32s(raw[12:], in*out+out)
+		if err != nil {
+			return nil, err
+		}
+		if in == 3 && out == 3 {
+			m := Matrix3{}
+			for r := range 3 {
+				copy(m[r][:], vals[3*r:3*r+3])
+			}
+			ans = append(ans, &m)
+			if t := (Translation{vals[9], vals[10], vals[11]}); !t.Empty() {
+				ans = append(ans, &t)
+			}
+			return ans, nil
+		}
+		return []ChannelTransformer{&MatrixElement{num_inputs: in, num_outputs: out, m: vals[:in*out], offsets: vals[in*out:]}}, nil
+	case CLutElemTypeSignature:
+		if in > 4 {
+			return nil, fmt.Errorf("CLUT elements with more than four inputs are not supported: %d", in)
+		}
+		if len(raw) < 28 {
+			return nil, errors.New("CLUT element too short")
+		}
+		grid_points := make([]int, in)
+		for i := range grid_points {
+			if grid_points[i] = int(raw[12+i]); grid_points[i] < 2 {
+				return nil, fmt.Errorf("CLUT input channel %d has invalid grid points: %d", i, grid_points[i])
+			}
+		}
+		samples, err := read_float32s(raw[28:], expectedValues(grid_points, out))
+		if err != nil {
+			return nil, err
+		}
+		return []ChannelTransformer{make_clut(grid_points, in, out, samples, false, false)}, nil
+	case BAcsElemTypeSignature, EAcsElemTypeSignature:
+		// Ignored, as in lcms
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown multi process element type: %s", sig)
+	}
+}
+
+// Read a table of count (offset, size) entries at raw[start:] returning the
+// data they point to. Offsets are relative to the start of raw.
+func read_position_table(raw []byte, start, count int) (ans [][]byte, err error) {
+	if len(raw) < start+8*count {
+		return nil, errors.New("position table too short")
+	}
+	ans = make([][]byte, count)
+	for i := range ans {
+		offset := int(binary.BigEndian.Uint32(raw[start+8*i:]))
+		size := int(binary.BigEndian.Uint32(raw[start+8*i+4:]))
+		if offset < 0 || size < 0 || offset+size > len(raw) {
+			return nil, fmt.Errorf("position table entry %d out of bounds", i)
+		}
+		ans[i] = raw[offset : offset+size]
+	}
+	return
+}
+
+func multiProcessElementsDecoder(raw []byte) (any, error) {
+	if len(raw) < 16 {
+		return nil, errors.New("mpet tag too short")
+	}
+	in, out := int(binary.BigEndian.Uint16(raw[8:])), int(binary.BigEndian.Uint16(raw[10:]))
+	count := int(binary.BigEndian.Uint32(raw[12:]))
+	if count < 1 {
+		return nil, errors.New("mpet tag has no elements")
+	}
+	positions, err := read_position_table(raw, 16, count)
+	if err != nil {
+		return nil, err
+	}
+	ans := &MultiProcessElementsTag{num_input_channels: in, num_output_channels: out}
+	channels := in
+	for i, p := range positions {
+		if len(p) < 12 {
+			return nil, fmt.Errorf("mpet element %d too short", i)
+		}
+		if ein := int(binary.BigEndian.Uint16(p[8:])); ein != channels {
+			return nil, fmt.Errorf("mpet element %d has %d inputs instead of %d", i, ein, channels)
+		}
+		channels = int(binary.BigEndian.Uint16(p[10:]))
+		elems, err := mpe_element_decoder(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range elems {
+			if !is_nil(e) {
+				ans.elements = append(ans.elements, e)
+			}
+		}
+	}
+	if channels != out {
+		return nil, fmt.Errorf("mpet tag elements have %d outputs instead of %d", channels, out)
+	}
+	return ans, nil
+}
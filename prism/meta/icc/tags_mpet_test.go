@@ -0,0 +1,272 @@
+package icc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ = fmt.Print
+
+func append_float32(b []byte, vals ...unit_float) []byte {
+	for _, v := range vals {
+		b = binary.BigEndian.AppendUint32(b, math.Float32bits(float32(v)))
+	}
+	return b
+}
+
+type test_segment struct {
+	formula uint16
+	params  []unit_float
+	samples []unit_float
+}
+
+func encode_segmented_curve(breaks []unit_float, segments ...test_segment) []byte {
+	b := tag_type_header(SegmentedCurveSignature)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(segments)))
+	b = append(b, 0, 0)
+	b = append_float32(b, breaks...)
+	for _, s := range segments {
+		if s.samples != nil {
+			b = append(b, tag_type_header(SampledCurveSegSignature)...)
+			b = binary.BigEndian.AppendUint32(b, uint32(len(s.samples)))
+			b = append_float32(b, s.samples...)
+		} else {
+			b = append(b, tag_type_header(FormulaCurveSegSignature)...)
+			b = binary.BigEndian.AppendUint16(b, s.formula)
+			b = append(b, 0, 0)
+			b = append_float32(b, s.params...)
+		}
+	}
+	return b
+}
+
+func encode_with_position_table(header []byte, items ...[]byte) []byte {
+	offset := len(header) + 8*len(items)
+	for _, x := range items {
+		header = binary.BigEndian.AppendUint32(header, uint32(offset))
+		header = binary.BigEndian.AppendUint32(header, uint32(len(x)))
+		offset += len(x)
+	}
+	for _, x := range items {
+		header = append(header, x...)
+	}
+	return header
+}
+
+func encode_element(sig Signature, in, out int) []byte {
+	b := tag_type_header(sig)
+	b = binary.BigEndian.AppendUint16(b, uint16(in))
+	return binary.BigEndian.AppendUint16(b, uint16(out))
+}
+
+func encode_curve_set(curves ...[]byte) []byte {
+	return encode_with_position_table(encode_element(CurveSetElemTypeSignature, len(curves), len(curves)), curves...)
+}
+
+func encode_matrix_element(m Matrix3, offsets ...unit_float) []byte {
+	b := encode_element(MatrixElemTypeSignature, 3, 3)
+	for _, row := range m {
+		b = append_float32(b, row[:]...)
+	}
+	return append_float32(b, offsets...)
+}
+
+func encode_clut_element(grid_points []int, out int, samples ...unit_float) []byte {
+	b := encode_element(CLutElemTypeSignature, len(grid_points), out)
+	var grid [16]byte
+	for i, g := range grid_points {
+		grid[i] = byte(g)
+	}
+	return append_float32(append(b, grid[:]...), samples...)
+}
+
+func encode_mpet(in, out int, elements ...[]byte) []byte {
+	b := tag_type_header(MultiProcessElementTypeSignature)
+	b = binary.BigEndian.AppendUint16(b, uint16(in))
+	b = binary.BigEndian.AppendUint16(b, uint16(out))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(elements)))
+	return encode_with_position_table(b, elements...)
+}
+
+func TestMultiProcessElements(t *testing.T) {
+	// A sampled segment uses the value of the previous segment at its start
+	// as its first point
+	c, err := segmentedCurveDecoder(encode_segmented_curve([]unit_float{0, 1},
+		test_segment{params: []unit_float{1, 0, 0, -1}},
+		test_segment{samples: []unit_float{0.5, 2}},
+		test_segment{params: []unit_float{1, 1, 1, 0}},
+	))
+	require.NoError(t, err)
+	for x, y := range map[unit_float]unit_float{-5: -1, 0: -1, 0.25: -0.25, 0.5: 0.5, 0.75: 1.25, 1: 2, 3: 4} {
+		require.InDelta(t, y, c.Transform(x), 1e-6, "x=%v", x)
+	}
+	// Formula segments
+	for _, tc := range []struct {
+		formula uint16
+		params  []unit_float
+		x, y    unit_float
+	}{
+		{0, []unit_float{2, 2, 1, 1}, 0.5, 5},
+		{0, []unit_float{2, 1, -1, 7}, 0.5, 7},
+		{1, []unit_float{1, 2, 10, 0, 1}, 10, 5},
+		{1, []unit_float{1, 2, 10, 0, 3}, -1, 3},
+		{2, []unit_float{2, 10, 1, 1, 1}, 1, 201},
+	} {
+		c, err := segmentedCurveDecoder(encode_segmented_curve(nil, test_segment{formula: tc.formula, params: tc.params}))
+		require.NoError(t, err)
+		require.InDelta(t, tc.y, c.Transform(tc.x), 1e-5, "%v", tc)
+	}
+
+	// D2B0 and B2D0 tags are preferred for the perceptual intent and other
+	// intents fall back to the matrix/TRC of the profile
+	b, err := DisplayP3Profile.builder()
+	require.NoError(t, err)
+	base, err := b.Build()
+	require.NoError(t, err)
+	col := func(sig Signature) *XYZType {
+		x, err := base.TagTable.get_parsed(sig, ColorSpaceRGB, ColorSpaceXYZ)
+		require.NoError(t, err)
+		return x.(*XYZType)
+	}
+	r, g, bl := col(RedMatrixColumnTagSignature), col(GreenMatrixColumnTagSignature), col(BlueMatrixColumnTagSignature)
+	m := Matrix3{{r.X, g.X, bl.X}, {r.Y, g.Y, bl.Y}, {r.Z, g.Z, bl.Z}}
+	srgb := encode_segmented_curve([]unit_float{0.04045},
+		test_segment{params: []unit_float{1, 1 / 12.92, 0, 0}},
+		test_segment{params: []unit_float{2.4, 1 / 1.055, 0.055 / 1.055, 0}},
+	)
+	inv := SRGBCurve()
+	var samples []unit_float
+	for i := range 256 {
+		samples = append(samples, inv.InverseTransform(unit_float(i+1)/256))
+	}
+	inverse_srgb := encode_segmented_curve([]unit_float{0, 1},
+		test_segment{params: []unit_float{1, 0, 0, 0}},
+		test_segment{samples: samples},
+		test_segment{params: []unit_float{1, 1, 0, 0}},
+	)
+	minv, err := m.Inverted()
+	require.NoError(t, err)
+	b.AddTag(DToB0TagSignature, encode_mpet(3, 3, encode_curve_set(srgb, srgb, srgb), encode_matrix_element(m, 0, 0, 0)))
+	b.AddTag(BToD0TagSignature, encode_mpet(3, 3, encode_matrix_element(minv, 0, 0, 0), encode_curve_set(inverse_srgb, inverse_srgb, inverse_srgb)))
+	p, err := b.Build()
+	require.NoError(t, err)
+
+	float_tr, err := p.CreateTransformerToPCS(PerceptualRenderingIntent, 3, false)
+	require.NoError(t, err)
+	require.True(t, strings.Contains(float_tr.String(), "SegmentedCurve"), float_tr.String())
+	matrix_tr, err := p.CreateTransformerToPCS(RelativeColorimetricRenderingIntent, 3, false)
+	require.NoError(t, err)
+	require.False(t, strings.Contains(matrix_tr.String(), "SegmentedCurve"), matrix_tr.String())
+	require.InDeltaSlice(t, transform_points(matrix_tr), transform_points(float_tr), 1e-5)
+
+	to_device, err := p.CreateTransformerToDevice(PerceptualRenderingIntent, false, false)
+	require.NoError(t, err)
+	require.True(t, strings.Contains(to_device.String(), "SegmentedCurve"), to_device.String())
+	pts := Points_for_transformer_comparison3()
+	for i := 0; i < len(pts); i += 3 {
+		x, y, z := float_tr.Transform(pts[i], pts[i+1], pts[i+2])
+		x, y, z = to_device.Transform(x, y, z)
+		require.InDeltaSlice(t, pts[i:i+3], []unit_float{x, y, z}, 2e-3)
+	}
+
+	// Invalid tags are reported as errors
+	b.AddTag(DToB0TagSignature, encode_mpet(3, 4, encode_curve_set(srgb, srgb, srgb)))
+	p, err = b.Build()
+	require.NoError(t, err)
+	_, err = p.CreateTransformerToPCS(PerceptualRenderingIntent, 3, false)
+	require.Error(t, err)
+}
+
+func TestCLUTElement(t *testing.T) {
+	decode := func(raw []byte) ChannelTransformer {
+		tr, err := mpe_element_decoder(raw)
+		require.NoError(t, err)
+		require.Len(t, tr, 1)
+		return tr[0]
+	}
+	// Samples are ordered with the first input varying slowest
+	f := func(x, y, z unit_float) []unit_float { return []unit_float{x * x, y + z/2, 1 - x*y*z} }
+	const n = 3
+	var samples []unit_float
+	for i := range n {
+		for j := range n {
+			for k := range n {
+				samples = append(samples, f(unit_float(i)/(n-1), unit_float(j)/(n-1), unit_float(k)/(n-1))...)
+			}
+		}
+	}
+	tr := decode(encode_clut_element([]int{n, n, n}, 3, samples...))
+	in, out := tr.IOSig()
+	require.Equal(t, []int{3, 3}, []int{in, out})
+	var o [3]unit_float
+	for _, pt := range [][3]unit_float{{0, 0, 0}, {1, 1, 1}, {0.5, 0, 1}, {1, 0.5, 0.5}} {
+		i := pt
+		tr.TransformGeneral(o[:], i[:])
+		require.InDeltaSlice(t, f(pt[0], pt[1], pt[2]), o[:], 1e-6, "%v", pt)
+	}
+	// Between grid points values are interpolated, which is exact for affine
+	// functions
+	g := func(x, y, z unit_float) []unit_float { return []unit_float{0.2 + 0.5*x - 0.1*y, z, 1 - x} }
+	samples = samples[:0]
+	for i := range 2 {
+		for j := range 2 {
+			for k := range 2 {
+				samples = append(samples, g(unit_float(i), unit_float(j), unit_float(k))...)
+			}
+		}
+	}
+	tr = decode(encode_clut_element([]int{2, 2, 2}, 3, samples...))
+	for _, pt := range [][3]unit_float{{0.3, 0.6, 0.9}, {0.25, 0.75, 0.1}} {
+		i := pt
+		tr.TransformGeneral(o[:], i[:])
+		require.InDeltaSlice(t, g(pt[0], pt[1], pt[2]), o[:], 1e-6, "%v", pt)
+	}
+	// CLUTs with a different number of inputs and outputs
+	tr = decode(encode_clut_element([]int{2, 3}, 1, 0, 0.5, 1, 1, 0.5, 0))
+	in, out = tr.IOSig()
+	require.Equal(t, []int{2, 1}, []int{in, out})
+	var o1 [1]unit_float
+	tr.TransformGeneral(o1[:], []unit_float{0.5, 0.25})
+	require.InDelta(t, 0.5, o1[0], 1e-6)
+	// Invalid CLUTs are errors
+	_, err := mpe_element_decoder(encode_clut_element([]int{1, 2, 2}, 3, make([]unit_float, 12)...))
+	require.Error(t, err)
+	_, err = mpe_element_decoder(encode_clut_element([]int{2, 2, 2}, 3, make([]unit_float, 12)...))
+	require.Error(t, err)
+}
+
+func TestMultiProcessElementsProfile(t *testing.T) {
+	// A Display P3 profile whose D2B0 and B2D0 tags desaturate colors with
+	// a CLUT in linear light
+	p, err := ReadProfile("test-profiles/displayp3-mpet.icc")
+	require.NoError(t, err)
+	require.True(t, p.TagTable.Has(DToB0TagSignature) && p.TagTable.Has(BToD0TagSignature))
+	perceptual, err := p.CreateTransformerToPCS(PerceptualRenderingIntent, 3, false)
+	require.NoError(t, err)
+	require.True(t, strings.Contains(perceptual.String(), "TetrahedralInterpolate"), perceptual.String())
+	relative, err := p.CreateTransformerToPCS(RelativeColorimetricRenderingIntent, 3, false)
+	require.NoError(t, err)
+	// Grays are unchanged, other colors are desaturated
+	for _, v := range []unit_float{0, 0.2, 0.5, 1} {
+		x, y, z := perceptual.Transform(v, v, v)
+		ex, ey, ez := relative.Transform(v, v, v)
+		require.InDeltaSlice(t, []unit_float{ex, ey, ez}, []unit_float{x, y, z}, 1e-5)
+	}
+	x, _, _ := perceptual.Transform(1, 0, 0)
+	ex, _, _ := relative.Transform(1, 0, 0)
+	require.Less(t, x, ex)
+	// Round tripping through the D2B0 and B2D0 tags is the identity
+	to_device, err := p.CreateTransformerToDevice(PerceptualRenderingIntent, false, false)
+	require.NoError(t, err)
+	pts := Points_for_transformer_comparison3()
+	for i := 0; i < len(pts); i += 3 {
+		x, y, z := perceptual.Transform(pts[i], pts[i+1], pts[i+2])
+		x, y, z = to_device.Transform(x, y, z)
+		require.InDeltaSlice(t, pts[i:i+3], []unit_float{x, y, z}, 2e-3)
+	}
+}
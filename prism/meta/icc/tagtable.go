@@ -87,6 +87,20 @@ func decode_array(data []byte) (ans any, err error) {
 	return a, nil
 }
 
+// Encode one or more XYZ values as an XYZ tag
+func EncodeXYZTag(vals ...XYZType) []byte {
+	b := tag_type_header(XYZTypeSignature)
+	for _, v := range vals {
+		b = append_s15fixed16(b, v.X, v.Y, v.Z)
+	}
+	return b
+}
+
+// Encode the values as an sf32 tag
+func EncodeS15Fixed16ArrayTag(vals ...unit_float) []byte {
+	return append_s15fixed16(tag_type_header(S15Fixed16ArrayTypeSignature), vals...)
+}
+
 func parse_tag(sig Signature, data []byte, input_colorspace, output_colorspace ColorSpace) (result any, err error) {
 	if len(data) == 0 {
 		return nil, &not_found{sig}
@@ -106,6 +120,8 @@ func parse_tag(sig Signature, data []byte, input_colorspace, output_colorspace C
 		return matrixDecoder(data)
 	case LutAtoBTypeSignature, LutBtoATypeSignature:
 		return modularDecoder(data, input_colorspace, output_colorspace)
+	case MultiProcessElementTypeSignature:
+		return multiProcessElementsDecoder(data)
 	case Lut16TypeSignature:
 		return decode_mft16(data, input_colorspace, output_colorspace)
 	case Lut8TypeSignature:
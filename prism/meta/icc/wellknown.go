@@ -0,0 +1,141 @@
+package icc
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var _ = fmt.Println
+
+// CIE xy chromaticities of the D65 and D50 white points
+var (
+	D65WhitePoint = [2]unit_float{0.3127, 0.3290}
+	D50WhitePoint = [2]unit_float{0.3457, 0.3585}
+)
+
+// Convert xy chromaticity to XYZ with Y=1
+func XYToXYZ(xy [2]unit_float) XYZType {
+	if xy[1] == 0 {
+		return XYZType{}
+	}
+	return XYZType{xy[0] / xy[1], 1, (1 - xy[0] - xy[1]) / xy[1]}
+}
+
+// The matrix to convert linear RGB to XYZ relative to the white point, for an
+// RGB color space with the specified primaries and white point as xy
+// chromaticities
+func RGBToXYZMatrix(red, green, blue, white [2]unit_float) (Matrix3, error) {
+	r, g, b := XYToXYZ(red), XYToXYZ(green), XYToXYZ(blue)
+	m := Matrix3{{r.X, g.X, b.X}, {r.Y, g.Y, b.Y}, {r.Z, g.Z, b.Z}}
+	inv, err := m.Inverted()
+	if err != nil {
+		return m, err
+	}
+	w := XYToXYZ(white)
+	sr, sg, sb := inv.Transform(w.X, w.Y, w.Z)
+	return Matrix3{
+		{m[0][0] * sr, m[0][1] * sg, m[0][2] * sb},
+		{m[1][0] * sr, m[1][1] * sg, m[1][2] * sb},
+		{m[2][0] * sr, m[2][1] * sg, m[2][2] * sb},
+	}, nil
+}
+
+func (w WellKnownProfile) String() string {
+	switch w {
+	case SRGBProfile:
+		return "sRGB"
+	case AdobeRGBProfile:
+		return "Adobe RGB (1998)"
+	case PhotoProProfile:
+		return "ProPhoto RGB"
+	case DisplayP3Profile:
+		return "Display P3"
+	case Rec2020Profile:
+		return "Rec. 2020"
+	case Gray22Profile:
+		return "Gray gamma 2.2"
+	case SGrayProfile:
+		return "sGray"
+	}
+	return "Unknown"
+}
+
+// The creation time of the generated profiles, fixed so that their data is
+// reproducible
+var well_known_profile_creation_time = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func (w WellKnownProfile) builder() (*ProfileBuilder, error) {
+	rgb := func(red, green, blue, white [2]unit_float, trc Curve1D, err error) (*ProfileBuilder, error) {
+		if err != nil {
+			return nil, err
+		}
+		m, err := RGBToXYZMatrix(red, green, blue, white)
+		if err != nil {
+			return nil, err
+		}
+		return NewMatrixTRCProfile(w.String(), m, XYToXYZ(white), trc), nil
+	}
+	gamma := func(g unit_float) (Curve1D, error) { return NewParametricCurve(SimpleGammaFunction, g) }
+	switch w {
+	case AdobeRGBProfile:
+		c, err := gamma(563. / 256.)
+		return rgb([2]unit_float{0.64, 0.33}, [2]unit_float{0.21, 0.71}, [2]unit_float{0.15, 0.06}, D65WhitePoint, c, err)
+	case PhotoProProfile:
+		c, err := gamma(1.8)
+		return rgb([2]unit_float{0.7347, 0.2653}, [2]unit_float{0.1596, 0.8404}, [2]unit_float{0.0366, 0.0001}, D50WhitePoint, c, err)
+	case DisplayP3Profile:
+		return rgb([2]unit_float{0.680, 0.320}, [2]unit_float{0.265, 0.690}, [2]unit_float{0.150, 0.060}, D65WhitePoint, SRGBCurve(), nil)
+	case Rec2020Profile:
+		// The BT.709 transfer function, which is also used by BT.2020
+		const alpha, beta = 1.09929682680944, 0.018053968510807
+		c, err := NewParametricCurve(SplitFunction, 1/0.45, 1/alpha, (alpha-1)/alpha, 1/4.5, 4.5*beta)
+		return rgb([2]unit_float{0.708, 0.292}, [2]unit_float{0.170, 0.797}, [2]unit_float{0.131, 0.046}, D65WhitePoint, c, err)
+	case Gray22Profile, SGrayProfile:
+		c, err := gamma(2.2)
+		if w == SGrayProfile {
+			c, err = SRGBCurve(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		b := NewProfileBuilder(DeviceClassDisplay, ColorSpaceGray, ColorSpaceXYZ)
+		add_info_tags(b, w.String())
+		b.AddTag(MediaWhitePointTagSignature, EncodeXYZTag(D50))
+		b.AddTag(GrayTRCTagSignature, EncodeCurveTag(c))
+		return b, nil
+	}
+	return nil, fmt.Errorf("no profile data available for: %s", w)
+}
+
+var well_known_profile_data = sync.OnceValue(func() map[WellKnownProfile][]byte {
+	ans := map[WellKnownProfile][]byte{SRGBProfile: Srgb_xyz_profile_data}
+	for _, w := range []WellKnownProfile{AdobeRGBProfile, PhotoProProfile, DisplayP3Profile, Rec2020Profile, Gray22Profile, SGrayProfile} {
+		b, err := w.builder()
+		if err != nil {
+			panic(err)
+		}
+		b.Header.SetCreatedAt(well_known_profile_creation_time)
+		if ans[w], err = b.Encode(); err != nil {
+			panic(err)
+		}
+	}
+	return ans
+})
+
+// Data returns the serialized ICC profile or nil for UnknownProfile. The
+// returned data must not be modified.
+func (w WellKnownProfile) Data() []byte {
+	return well_known_profile_data()[w]
+}
+
+// Profile returns a newly parsed copy of the profile. Note that profiles
+// cache black points and so must not be shared between goroutines.
+func (w WellKnownProfile) Profile() (*Profile, error) {
+	data := w.Data()
+	if data == nil {
+		return nil, fmt.Errorf("no profile data available for: %s", w)
+	}
+	return DecodeProfile(bytes.NewReader(data))
+}
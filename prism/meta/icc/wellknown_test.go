@@ -0,0 +1,36 @@
+package icc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWellKnownProfiles(t *testing.T) {
+	for _, w := range []WellKnownProfile{SRGBProfile, AdobeRGBProfile, PhotoProProfile, DisplayP3Profile, Rec2020Profile, Gray22Profile, SGrayProfile} {
+		p, err := w.Profile()
+		require.NoError(t, err, w.String())
+		require.Equal(t, w == SRGBProfile, p.IsSRGB(), w.String())
+		require.Equal(t, IfElse(w == Gray22Profile || w == SGrayProfile, ColorSpaceGray, ColorSpaceRGB), p.Header.DataColorSpace)
+		if w != SRGBProfile {
+			desc, err := p.Description()
+			require.NoError(t, err)
+			require.Equal(t, w.String(), desc)
+		}
+	}
+	_, err := UnknownProfile.Profile()
+	require.Error(t, err)
+
+	for w, name := range map[WellKnownProfile]string{AdobeRGBProfile: "adobergb.icc", PhotoProProfile: "prophoto.icc", DisplayP3Profile: "displayp3.icc"} {
+		expected, err := ReadProfile("test-profiles/" + name)
+		require.NoError(t, err)
+		actual, err := w.Profile()
+		require.NoError(t, err)
+		a, err := expected.CreateDefaultTransformerToPCS(3)
+		require.NoError(t, err)
+		b, err := actual.CreateDefaultTransformerToPCS(3)
+		require.NoError(t, err)
+		// The test profiles use u8Fixed8 gamma values and so differ slightly
+		require.InDeltaSlice(t, transform_points(a), transform_points(b), 2e-3, name)
+	}
+}
@@ -0,0 +1,216 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var _ = fmt.Print
+
+// IPTC-IIM record numbers and well known dataset numbers
+const (
+	IPTCRecordEnvelope    = 1
+	IPTCRecordApplication = 2
+
+	IPTCCodedCharacterSet = 90 // in the envelope record
+
+	IPTCObjectName         = 5
+	IPTCKeywords           = 25
+	IPTCSpecialInstruction = 40
+	IPTCDateCreated        = 55
+	IPTCByline             = 80
+	IPTCBylineTitle        = 85
+	IPTCCity               = 90
+	IPTCProvinceState      = 95
+	IPTCCountryName        = 101
+	IPTCHeadline           = 105
+	IPTCCredit             = 110
+	IPTCSource             = 115
+	IPTCCopyrightNotice    = 116
+	IPTCCaption            = 120
+	IPTCCaptionWriter      = 122
+)
+
+// The escape sequence used in the CodedCharacterSet dataset to indicate UTF-8
+var iptc_utf8_escape = []byte{0x1b, '%', 'G'}
+
+// IPTCDataset is a single IPTC-IIM dataset
+type IPTCDataset struct {
+	Record, Number uint8
+	Data           []byte
+}
+
+// IPTC holds the IPTC-IIM datasets from an image
+type IPTC struct {
+	Datasets []IPTCDataset
+	// True if the CodedCharacterSet dataset specifies UTF-8
+	IsUTF8 bool
+}
+
+// Decode returns the data of the specified dataset as a UTF-8 string. When the
+// character set is not specified as UTF-8, data that is not valid UTF-8 is
+// assumed to be Latin-1.
+func (s *IPTC) Decode(d IPTCDataset) string {
+	if s.IsUTF8 || utf8.Valid(d.Data) {
+		return string(d.Data)
+	}
+	var b strings.Builder
+	for _, c := range d.Data {
+		b.WriteRune(rune(c))
+	}
+	return b.String()
+}
+
+// Get returns the decoded values of all datasets with the specified record and number
+func (s *IPTC) Get(record, number uint8) (ans []string) {
+	for _, d := range s.Datasets {
+		if d.Record == record && d.Number == number {
+			ans = append(ans, s.Decode(d))
+		}
+	}
+	return
+}
+
+// First returns the decoded value of the first dataset in the application
+// record with the specified number
+func (s *IPTC) First(number uint8) string {
+	if ans := s.Get(IPTCRecordApplication, number); len(ans) > 0 {
+		return ans[0]
+	}
+	return ""
+}
+
+func (s *IPTC) Caption() string   { return s.First(IPTCCaption) }
+func (s *IPTC) Headline() string  { return s.First(IPTCHeadline) }
+func (s *IPTC) Byline() string    { return s.First(IPTCByline) }
+func (s *IPTC) Copyright() string { return s.First(IPTCCopyrightNotice) }
+func (s *IPTC) Keywords() []string {
+	return s.Get(IPTCRecordApplication, IPTCKeywords)
+}
+
+// ParseIPTC parses IPTC-IIM data
+func ParseIPTC(data []byte) (*IPTC, error) {
+	ans := &IPTC{}
+	for len(data) > 0 {
+		if data[0] != 0x1c {
+			// Some writers pad the data with zeros
+			if bytes.Count(data, []byte{0}) == len(data) {
+				break
+			}
+			return nil, fmt.Errorf("invalid IPTC tag marker: 0x%x", data[0])
+		}
+		if len(data) < 5 {
+			return nil, fmt.Errorf("truncated IPTC dataset header")
+		}
+		d := IPTCDataset{Record: data[1], Number: data[2]}
+		size := int(binary.BigEndian.Uint16(data[3:5]))
+		data = data[5:]
+		if size&0x8000 != 0 {
+			// extended dataset, the size is stored in the next n bytes
+			n := size & 0x7fff
+			if n > 4 || len(data) < n {
+				return nil, fmt.Errorf("invalid IPTC extended dataset size")
+			}
+			size = 0
+			for _, b := range data[:n] {
+				size = size<<8 | int(b)
+			}
+			data = data[n:]
+		}
+		if len(data) < size {
+			return nil, fmt.Errorf("truncated IPTC dataset %d:%d", d.Record, d.Number)
+		}
+		d.Data, data = data[:size], data[size:]
+		if d.Record == IPTCRecordEnvelope && d.Number == IPTCCodedCharacterSet {
+			ans.IsUTF8 = bytes.Equal(d.Data, iptc_utf8_escape)
+		}
+		ans.Datasets = append(ans.Datasets, d)
+	}
+	return ans, nil
+}
+
+// Photoshop image resource IDs
+const (
+	PhotoshopResolutionInfo = 0x03ed
+	PhotoshopIPTC           = 0x0404
+	PhotoshopThumbnailOld   = 0x0409
+	PhotoshopThumbnail      = 0x040c
+)
+
+// PhotoshopResolution is the ResolutionInfo Photoshop image resource. Units
+// are 1 for pixels per inch and 2 for pixels per centimeter.
+type PhotoshopResolution struct {
+	XDensity, YDensity float64
+	XUnit, YUnit       uint16
+}
+
+func (r PhotoshopResolution) AsResolution() Resolution {
+	if r.XUnit != r.YUnit {
+		return Resolution{}
+	}
+	switch r.XUnit {
+	case 1:
+		return Resolution{r.XDensity, r.YDensity, PixelsPerInch}
+	case 2:
+		return Resolution{r.XDensity, r.YDensity, PixelsPerCentimeter}
+	}
+	return Resolution{}
+}
+
+// PhotoshopResources holds some commonly used Photoshop image resources
+type PhotoshopResources struct {
+	Resolution *PhotoshopResolution
+	// The JPEG data of the embedded thumbnail, if any
+	Thumbnail []byte
+	// The raw IPTC-IIM data, if any
+	IPTCData []byte
+}
+
+// ParsePhotoshopResources parses a sequence of Photoshop 8BIM image resource blocks
+func ParsePhotoshopResources(data []byte) (*PhotoshopResources, error) {
+	ans := &PhotoshopResources{}
+	for len(data) >= 12 {
+		switch string(data[:4]) {
+		case "8BIM", "PHUT", "AgHg", "DCSR":
+		default:
+			return nil, fmt.Errorf("invalid Photoshop image resource signature: %#v", string(data[:4]))
+		}
+		id := binary.BigEndian.Uint16(data[4:6])
+		data = data[6:]
+		// The name is a Pascal string padded to an even length
+		name_len := int(data[0]) + 1
+		name_len += name_len & 1
+		if len(data) < name_len+4 {
+			return nil, fmt.Errorf("truncated Photoshop image resource")
+		}
+		data = data[name_len:]
+		size := int(binary.BigEndian.Uint32(data[:4]))
+		data = data[4:]
+		if len(data) < size {
+			return nil, fmt.Errorf("truncated Photoshop image resource: 0x%x", id)
+		}
+		payload := data[:size]
+		data = data[min(len(data), size+size&1):]
+		switch id {
+		case PhotoshopIPTC:
+			ans.IPTCData = payload
+		case PhotoshopResolutionInfo:
+			if len(payload) >= 16 {
+				fixed := func(b []byte) float64 { return float64(binary.BigEndian.Uint32(b)) / 65536 }
+				ans.Resolution = &PhotoshopResolution{
+					XDensity: fixed(payload[0:4]), XUnit: binary.BigEndian.Uint16(payload[4:6]),
+					YDensity: fixed(payload[8:12]), YUnit: binary.BigEndian.Uint16(payload[12:14]),
+				}
+			}
+		case PhotoshopThumbnail, PhotoshopThumbnailOld:
+			// 28 byte header followed by JFIF data when format is 1
+			if len(payload) > 28 && binary.BigEndian.Uint32(payload[:4]) == 1 {
+				ans.Thumbnail = payload[28:]
+			}
+		}
+	}
+	return ans, nil
+}
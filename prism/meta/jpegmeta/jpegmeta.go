@@ -2,6 +2,7 @@ package jpegmeta
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"strings"
@@ -13,8 +14,12 @@ import (
 )
 
 const exifSignature = "Exif\x00\x00"
+const xmpSignature = "http://ns.adobe.com/xap/1.0/\x00"
+const extendedXMPSignature = "http://ns.adobe.com/xmp/extension/\x00"
 
 var iccProfileIdentifier = []byte("ICC_PROFILE\x00")
+var photoshopIdentifier = []byte("Photoshop 3.0\x00")
+var jfifIdentifier = []byte("JFIF\x00")
 
 // Load loads the metadata for a JPEG image stream.
 //
@@ -48,7 +53,8 @@ func ExtractMetadata(r io.Reader) (md *meta.Data, err error) {
 
 	var iccProfileChunks [][]byte
 	var iccProfileChunksExtracted int
-	var exif []byte
+	var exif, xmp, photoshop []byte
+	extended_xmp_chunks := extended_xmp_assembler{}
 
 	allMetadataExtracted := func() bool {
 		return metadataExtracted &&
@@ -96,8 +102,32 @@ parseSegments:
 			break parseSegments
 
 		case markerTypeApp1:
-			if bytes.HasPrefix(segment.Data, []byte(exifSignature)) {
+			switch {
+			case bytes.HasPrefix(segment.Data, []byte(exifSignature)):
 				exif = segment.Data
+			case bytes.HasPrefix(segment.Data, []byte(xmpSignature)):
+				xmp = segment.Data[len(xmpSignature):]
+			case bytes.HasPrefix(segment.Data, []byte(extendedXMPSignature)):
+				extended_xmp_chunks.add(segment.Data[len(extendedXMPSignature):])
+			}
+		case markerTypeApp0:
+			if d := segment.Data; bytes.HasPrefix(d, jfifIdentifier) && len(d) >= len(jfifIdentifier)+7 {
+				d = d[len(jfifIdentifier)+2:]
+				r := meta.Resolution{X: float64(binary.BigEndian.Uint16(d[1:3])), Y: float64(binary.BigEndian.Uint16(d[3:5]))}
+				switch d[0] {
+				case 1:
+					r.Unit = meta.PixelsPerInch
+				case 2:
+					r.Unit = meta.PixelsPerCentimeter
+				}
+				if r.IsSet() {
+					md.Resolution = r
+				}
+			}
+		case markerTypeApp13:
+			// Photoshop image resources can be split over multiple segments
+			if bytes.HasPrefix(segment.Data, photoshopIdentifier) {
+				photoshop = append(photoshop, segment.Data[len(photoshopIdentifier):]...)
 			}
 		case markerTypeApp2:
 			if len(segment.Data) < len(iccProfileIdentifier)+2 {
@@ -145,6 +175,24 @@ parseSegments:
 		return nil, fmt.Errorf("no metadata found")
 	}
 	md.SetExifData(exif)
+	if xmp != nil {
+		md.SetXMPData(xmp, extended_xmp_chunks.packet(xmp))
+	}
+	if photoshop != nil {
+		// Corrupt Photoshop resources are ignored
+		if ps, err := meta.ParsePhotoshopResources(photoshop); err == nil {
+			md.Photoshop = ps
+			if ps.IPTCData != nil {
+				md.IPTC, _ = meta.ParseIPTC(ps.IPTCData)
+			}
+		}
+	}
+	md.FallbackToExifResolution()
+	if r := md.Photoshop; r != nil && r.Resolution != nil && !md.Resolution.HasPhysicalUnit() {
+		if res := r.Resolution.AsResolution(); res.IsSet() {
+			md.Resolution = res
+		}
+	}
 
 	// Incomplete or missing ICC profile
 	if len(iccProfileChunks) != iccProfileChunksExtracted {
@@ -2,6 +2,7 @@ package jpegmeta
 
 import (
 	"bytes"
+	"encoding/binary"
 	"testing"
 
 	"github.com/kovidgoyal/imaging/prism/meta"
@@ -204,6 +205,113 @@ func TestExtractMetadata(t *testing.T) {
 		}
 	})
 
+	t.Run("reads XMP metadata", func(t *testing.T) {
+		writeApp1 := func(dest *bytes.Buffer, chunkData ...[]byte) {
+			dest.Write([]byte{0xFF, byte(markerTypeApp1)})
+			chunkLength := 2
+			for _, x := range chunkData {
+				chunkLength += len(x)
+			}
+			dest.Write([]byte{byte(chunkLength >> 8 & 0xFF), byte(chunkLength & 0xFF)})
+			for _, x := range chunkData {
+				dest.Write(x)
+			}
+		}
+		guid := "0123456789ABCDEF0123456789ABCDEF"
+		main := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:tiff="http://ns.adobe.com/tiff/1.0/"
+ xmlns:xmpNote="http://ns.adobe.com/xmp/note/" xmp:Rating="4" xmpNote:HasExtendedXMP="` + guid + `">
+<tiff:Orientation>6</tiff:Orientation>
+<dc:title xmlns:dc="http://purl.org/dc/elements/1.1/"><rdf:Alt>
+<rdf:li xml:lang="x-default">A title</rdf:li><rdf:li xml:lang="fr">Un titre</rdf:li>
+</rdf:Alt></dc:title>
+</rdf:Description></rdf:RDF></x:xmpmeta>`
+		extended := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:crs="http://ns.adobe.com/camera-raw-settings/1.0/" crs:Exposure2012="+0.50">
+<crs:Contrast2012>-12</crs:Contrast2012>
+<dc:rights xmlns:dc="http://purl.org/dc/elements/1.1/"><rdf:Alt><rdf:li xml:lang="x-default">Copyright me</rdf:li></rdf:Alt></dc:rights>
+</rdf:Description></rdf:RDF></x:xmpmeta>`
+		extended_chunk := func(offset int) []byte {
+			b := []byte(guid)
+			b = binary.BigEndian.AppendUint32(b, uint32(len(extended)))
+			b = binary.BigEndian.AppendUint32(b, uint32(offset))
+			return b
+		}
+		data := &bytes.Buffer{}
+		data.Write([]byte{0xFF, byte(markerTypeStartOfImage)})
+		writeApp1(data, []byte(extendedXMPSignature), extended_chunk(100), []byte(extended[100:]))
+		writeApp1(data, []byte(xmpSignature), []byte(main))
+		writeApp1(data, []byte(extendedXMPSignature), extended_chunk(0), []byte(extended[:100]))
+		data.Write([]byte{0xFF, byte(markerTypeStartOfFrameBaseline), 0x00, 0x07, 0x00, 0x00, 0x00, 0x00, 0x00})
+		data.Write([]byte{0xFF, byte(markerTypeStartOfScan), 0x00, 0x02})
+		md, err := extractMetadata(data)
+		require.NoError(t, err)
+		packet, extended_packet := md.XMPData()
+		require.Equal(t, main, string(packet))
+		require.Equal(t, extended, string(extended_packet))
+		x, err := md.XMP()
+		require.NoError(t, err)
+		require.Equal(t, 4.0, x.Rating)
+		require.Equal(t, 6, x.Orientation)
+		require.Equal(t, meta.LangAlternative{"x-default": "A title", "fr": "Un titre"}, x.Title)
+		require.Equal(t, "Copyright me", x.Rights.Default())
+		require.Equal(t, map[string]string{"Exposure2012": "+0.50", "Contrast2012": "-12"}, x.CameraRaw)
+	})
+
+	t.Run("reads IPTC metadata from Photoshop resources", func(t *testing.T) {
+		resource := func(id uint16, payload []byte) []byte {
+			b := []byte("8BIM")
+			b = binary.BigEndian.AppendUint16(b, id)
+			b = append(b, 0, 0) // empty name padded to even length
+			b = binary.BigEndian.AppendUint32(b, uint32(len(payload)))
+			b = append(b, payload...)
+			if len(payload)&1 != 0 {
+				b = append(b, 0)
+			}
+			return b
+		}
+		dataset := func(record, number uint8, val string) []byte {
+			b := []byte{0x1c, record, number}
+			b = binary.BigEndian.AppendUint16(b, uint16(len(val)))
+			return append(b, val...)
+		}
+		build := func(iptc []byte) *bytes.Buffer {
+			res := append([]byte{}, photoshopIdentifier...)
+			res = append(res, resource(meta.PhotoshopResolutionInfo, []byte{0, 72, 0, 0, 0, 1, 0, 1, 0, 144, 0, 0, 0, 1, 0, 1})...)
+			res = append(res, resource(meta.PhotoshopIPTC, iptc)...)
+			data := &bytes.Buffer{}
+			data.Write([]byte{0xFF, byte(markerTypeStartOfImage)})
+			// split over two segments
+			for _, chunk := range [][]byte{res[:30], res[30:]} {
+				if len(data.Bytes()) > 2 {
+					chunk = append(append([]byte{}, photoshopIdentifier...), chunk...)
+				}
+				data.Write([]byte{0xFF, byte(markerTypeApp13)})
+				data.Write(binary.BigEndian.AppendUint16(nil, uint16(len(chunk)+2)))
+				data.Write(chunk)
+			}
+			data.Write([]byte{0xFF, byte(markerTypeStartOfFrameBaseline), 0x00, 0x07, 0x00, 0x00, 0x00, 0x00, 0x00})
+			data.Write([]byte{0xFF, byte(markerTypeStartOfScan), 0x00, 0x02})
+			return data
+		}
+		iptc := dataset(1, 90, "\x1b%G")
+		iptc = append(iptc, dataset(2, 120, "Caption ☺")...)
+		iptc = append(iptc, dataset(2, 25, "one")...)
+		iptc = append(iptc, dataset(2, 25, "two")...)
+		md, err := extractMetadata(build(iptc))
+		require.NoError(t, err)
+		require.NotNil(t, md.IPTC)
+		require.True(t, md.IPTC.IsUTF8)
+		require.Equal(t, "Caption ☺", md.IPTC.Caption())
+		require.Equal(t, []string{"one", "two"}, md.IPTC.Keywords())
+		require.Equal(t, &meta.PhotoshopResolution{XDensity: 72, YDensity: 144, XUnit: 1, YUnit: 1}, md.Photoshop.Resolution)
+
+		md, err = extractMetadata(build(dataset(2, 80, "Andr\xe9")))
+		require.NoError(t, err)
+		require.False(t, md.IPTC.IsUTF8)
+		require.Equal(t, "André", md.IPTC.Byline())
+	})
+
 	t.Run("stops reading after all interesting metadata has been found", func(t *testing.T) {
 		data := &bytes.Buffer{}
 		data.Write([]byte{0xFF, byte(markerTypeStartOfImage)})
@@ -0,0 +1,75 @@
+package jpegmeta
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+)
+
+var _ = fmt.Print
+
+type extended_xmp_chunk struct {
+	offset uint32
+	data   []byte
+}
+
+type extended_xmp struct {
+	full_length uint32
+	chunks      []extended_xmp_chunk
+}
+
+// Extended XMP is split into chunks identified by the GUID of the full
+// extended packet. See Part 3 of the XMP specification for details.
+type extended_xmp_assembler map[string]*extended_xmp
+
+func (a extended_xmp_assembler) add(data []byte) {
+	if len(data) < 40 {
+		return
+	}
+	guid := string(data[:32])
+	full_length, offset := binary.BigEndian.Uint32(data[32:36]), binary.BigEndian.Uint32(data[36:40])
+	data = data[40:]
+	x := a[guid]
+	if x == nil {
+		x = &extended_xmp{full_length: full_length}
+		a[guid] = x
+	}
+	if x.full_length != full_length || uint64(offset)+uint64(len(data)) > uint64(full_length) {
+		return
+	}
+	x.chunks = append(x.chunks, extended_xmp_chunk{offset, data})
+}
+
+var has_extended_xmp_pat = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`HasExtendedXMP(?:="|>)([0-9A-Fa-f]{32})`)
+})
+
+// Returns the reassembled extended XMP packet referred to by the main packet
+// or nil if there is no such packet or it is incomplete.
+func (a extended_xmp_assembler) packet(main_packet []byte) []byte {
+	if len(a) == 0 {
+		return nil
+	}
+	m := has_extended_xmp_pat().FindSubmatch(main_packet)
+	if m == nil {
+		return nil
+	}
+	x := a[string(m[1])]
+	if x == nil {
+		return nil
+	}
+	slices.SortFunc(x.chunks, func(a, b extended_xmp_chunk) int { return int(a.offset) - int(b.offset) })
+	var ans []byte
+	for _, c := range x.chunks {
+		if int(c.offset) != len(ans) {
+			return nil
+		}
+		ans = append(ans, c.data...)
+	}
+	if len(ans) != int(x.full_length) {
+		return nil
+	}
+	return ans
+}
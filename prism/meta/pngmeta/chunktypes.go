@@ -7,5 +7,15 @@ const (
 	chunkTypeIHDR = "IHDR"
 	chunkTypeacTL = "acTL"
 	chunkTypeeXIf = "eXIf"
-	chunkTypecICP = "eICP"
+	chunkTypecICP = "cICP"
+	chunkTypesRGB = "sRGB"
+	chunkTypegAMA = "gAMA"
+	chunkTypecHRM = "cHRM"
+	chunkTypesBIT = "sBIT"
+	chunkTypetEXt = "tEXt"
+	chunkTypezTXt = "zTXt"
+	chunkTypeiTXt = "iTXt"
+	chunkTypepHYs = "pHYs"
+	chunkTypemDCv = "mDCv"
+	chunkTypecLLi = "cLLi"
 )
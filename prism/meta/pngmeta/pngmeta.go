@@ -2,7 +2,6 @@ package pngmeta
 
 import (
 	"bytes"
-	"compress/zlib"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -10,6 +9,7 @@ import (
 	"unsafe"
 
 	"github.com/kovidgoyal/imaging/prism/meta"
+	"github.com/kovidgoyal/imaging/prism/meta/icc"
 	"github.com/kovidgoyal/imaging/streams"
 	"github.com/kovidgoyal/imaging/types"
 )
@@ -130,6 +130,84 @@ parseChunks:
 			if allMetadataExtracted() {
 				break parseChunks
 			}
+
+		case chunkTypesRGB:
+			if chunk, err = read_chunk(r, ch.Length); err != nil {
+				return nil, err
+			}
+			if len(chunk) > 0 {
+				md.HasSRGBChunk = true
+				md.SRGBIntent = icc.RenderingIntent(chunk[0])
+			}
+
+		case chunkTypegAMA:
+			if chunk, err = read_chunk(r, ch.Length); err != nil {
+				return nil, err
+			}
+			var gamma uint32
+			if len(chunk) != 4 || decode(&gamma) != nil || gamma == 0 {
+				break // ignore malformed ancillary chunks
+			}
+			md.Gamma = float64(gamma) / 100000
+
+		case chunkTypecHRM:
+			if chunk, err = read_chunk(r, ch.Length); err != nil {
+				return nil, err
+			}
+			var c [8]uint32
+			if len(chunk) != 32 || decode(&c) != nil {
+				break // ignore malformed ancillary chunks
+			}
+			xy := func(i int) meta.XY { return meta.XY{X: float64(c[i]) / 100000, Y: float64(c[i+1]) / 100000} }
+			md.Chromaticities = &meta.Primaries{Name: chunkTypecHRM, White: xy(0), Red: xy(2), Green: xy(4), Blue: xy(6)}
+
+		case chunkTypepHYs:
+			if chunk, err = read_chunk(r, ch.Length); err != nil {
+				return nil, err
+			}
+			var x, y uint32
+			if len(chunk) != 9 || decode(&x) != nil || decode(&y) != nil {
+				break // ignore malformed ancillary chunks
+			}
+			md.Resolution = meta.Resolution{X: float64(x), Y: float64(y)}
+			if len(chunk) > 0 && chunk[0] == 1 {
+				// pixels per meter
+				md.Resolution.X /= 100
+				md.Resolution.Y /= 100
+				md.Resolution.Unit = meta.PixelsPerCentimeter
+			}
+
+		case chunkTypemDCv:
+			if chunk, err = read_chunk(r, ch.Length); err != nil {
+				return nil, err
+			}
+			var c struct {
+				Chromaticities [8]uint16
+				Max, Min       uint32
+			}
+			if len(chunk) != 24 || decode(&c) != nil {
+				break // ignore malformed ancillary chunks
+			}
+			md.HDR.MasteringMaxLuminance = float64(c.Max) / 10000
+			md.HDR.MasteringMinLuminance = float64(c.Min) / 10000
+
+		case chunkTypecLLi:
+			if chunk, err = read_chunk(r, ch.Length); err != nil {
+				return nil, err
+			}
+			var c [2]uint32
+			if len(chunk) != 8 || decode(&c) != nil {
+				break // ignore malformed ancillary chunks
+			}
+			md.HDR.MaxContentLightLevel = float64(c[0]) / 10000
+			md.HDR.MaxFrameAverageLightLevel = float64(c[1]) / 10000
+
+		case chunkTypesBIT:
+			if chunk, err = read_chunk(r, ch.Length); err != nil {
+				return nil, err
+			}
+			md.SignificantBits = chunk
+
 		case chunkTypeacTL:
 			if chunk, err = read_chunk(r, ch.Length); err != nil {
 				return nil, err
@@ -164,16 +242,9 @@ parseChunks:
 			}
 			chunk = chunk[1:]
 			// Decompress ICC profile data
-			zReader, err := zlib.NewReader(bytes.NewReader(chunk))
-			if err != nil {
-				md.SetICCProfileError(err)
-				break
-			}
-			defer zReader.Close()
-			profileData := &bytes.Buffer{}
-			_, err = io.Copy(profileData, zReader)
+			profileData, err := decompress(chunk, -1)
 			if err == nil {
-				md.SetICCProfileData(profileData.Bytes())
+				md.SetICCProfileData(profileData)
 				if allMetadataExtracted() {
 					break parseChunks
 				}
@@ -181,6 +252,29 @@ parseChunks:
 				md.SetICCProfileError(err)
 			}
 
+		// Note that text chunks that occur after the image data are not
+		// extracted as that would require reading the entire stream
+		case chunkTypetEXt, chunkTypezTXt, chunkTypeiTXt:
+			if chunk, err = read_chunk(r, ch.Length); err != nil {
+				return nil, err
+			}
+			var t meta.TextEntry
+			switch string(ch.ChunkType[:]) {
+			case chunkTypetEXt:
+				t, err = parse_tEXt(chunk)
+			case chunkTypezTXt:
+				t, err = parse_zTXt(chunk)
+			default:
+				t, err = parse_iTXt(chunk)
+			}
+			// Malformed text chunks are ignored
+			if err == nil {
+				md.Text = append(md.Text, t)
+				if t.Key == meta.XMPPNGKeyword {
+					md.SetXMPData([]byte(t.Value), nil)
+				}
+			}
+
 		case chunkTypeIDAT, chunkTypeIEND:
 			break parseChunks
 
@@ -194,6 +288,7 @@ parseChunks:
 	if !metadataExtracted {
 		return nil, fmt.Errorf("no metadata found")
 	}
+	md.FallbackToExifResolution()
 
 	return md, nil
 }
@@ -7,6 +7,8 @@ import (
 	"io"
 	"testing"
 
+	"github.com/kovidgoyal/imaging/prism/meta"
+	"github.com/kovidgoyal/imaging/prism/meta/icc"
 	"github.com/stretchr/testify/require"
 )
 
@@ -217,6 +219,161 @@ func TestExtractMetadata(t *testing.T) {
 		}
 	})
 
+	t.Run("returns color chunks", func(t *testing.T) {
+		data := &bytes.Buffer{}
+		data.Write(pngSignature[:])
+
+		write_header(data, 13, chunkTypeIHDR)
+		headerData := [13]byte{0, 0, 0, 15, 0, 0, 0, 16, 8}
+		data.Write(headerData[:])
+		dummyCRC := uint32(0)
+		write(data, dummyCRC)
+
+		write_header(data, 4, chunkTypegAMA)
+		write(data, 100000)
+		write(data, dummyCRC)
+
+		write_header(data, 32, chunkTypecHRM)
+		for _, x := range []uint32{31270, 32900, 64000, 33000, 30000, 60000, 15000, 6000} {
+			write(data, x)
+		}
+		write(data, dummyCRC)
+
+		write_header(data, 3, chunkTypesBIT)
+		data.Write([]byte{5, 6, 5})
+		write(data, dummyCRC)
+
+		write_header(data, 24, chunkTypemDCv)
+		data.Write(make([]byte, 16))
+		write(data, 10000000)
+		write(data, 50)
+		write(data, dummyCRC)
+
+		write_header(data, 8, chunkTypecLLi)
+		write(data, 6000000)
+		write(data, 2000000)
+		write(data, dummyCRC)
+
+		md, err := extractMetadata(data)
+		require.NoError(t, err)
+		require.Equal(t, 1.0, md.Gamma)
+		require.NotNil(t, md.Chromaticities)
+		require.Equal(t, 0.64, md.Chromaticities.Red.X)
+		require.Equal(t, 0.3290, md.Chromaticities.White.Y)
+		require.Equal(t, []uint8{5, 6, 5}, md.SignificantBits)
+		require.Equal(t, meta.HDRMetadata{MasteringMaxLuminance: 1000, MasteringMinLuminance: 0.005, MaxContentLightLevel: 600, MaxFrameAverageLightLevel: 200}, md.HDR)
+		require.Equal(t, 600., md.HDR.Peak())
+		require.False(t, md.HasSRGBChunk)
+		require.False(t, md.IsSRGB())
+		p := md.PNGColorChunksPipelineToSRGB()
+		require.NotNil(t, p)
+		r, g, b := p.Transform(0.5, 0.5, 0.5)
+		require.InDelta(t, 0.7354, r, 0.0001)
+		require.InDelta(t, r, g, 1e-6)
+		require.InDelta(t, r, b, 1e-6)
+
+		data.Reset()
+		data.Write(pngSignature[:])
+		write_header(data, 13, chunkTypeIHDR)
+		data.Write(headerData[:])
+		write(data, dummyCRC)
+		write_header(data, 1, chunkTypesRGB)
+		data.WriteByte(1)
+		write(data, dummyCRC)
+		write_header(data, 4, chunkTypegAMA)
+		write(data, 100000)
+		write(data, dummyCRC)
+		md, err = extractMetadata(data)
+		require.NoError(t, err)
+		require.True(t, md.HasSRGBChunk)
+		require.Equal(t, icc.RelativeColorimetricRenderingIntent, md.SRGBIntent)
+		require.True(t, md.IsSRGB())
+		require.Nil(t, md.PNGColorChunksPipelineToSRGB())
+	})
+
+	t.Run("ignores malformed color and HDR chunks", func(t *testing.T) {
+		data := &bytes.Buffer{}
+		data.Write(pngSignature[:])
+		write_header(data, 13, chunkTypeIHDR)
+		headerData := [13]byte{0, 0, 0, 15, 0, 0, 0, 16, 8}
+		data.Write(headerData[:])
+		dummyCRC := uint32(0)
+		write(data, dummyCRC)
+		write_header(data, 2, chunkTypegAMA)
+		data.Write([]byte{1, 2})
+		write(data, dummyCRC)
+		write_header(data, 8, chunkTypecHRM)
+		write(data, 31270)
+		write(data, 32900)
+		write(data, dummyCRC)
+		write_header(data, 10, chunkTypemDCv)
+		data.Write(make([]byte, 10))
+		write(data, dummyCRC)
+		write_header(data, 4, chunkTypecLLi)
+		write(data, 10000000)
+		write(data, dummyCRC)
+		// truncated pHYs missing the y resolution and unit
+		write_header(data, 4, chunkTypepHYs)
+		write(data, 2835)
+		write(data, dummyCRC)
+		md, err := extractMetadata(data)
+		require.NoError(t, err)
+		require.Equal(t, uint32(15), md.PixelWidth)
+		require.False(t, md.Resolution.IsSet())
+		require.Equal(t, 0.0, md.Gamma)
+		require.Nil(t, md.Chromaticities)
+		require.Equal(t, 0.0, md.HDR.MasteringMaxLuminance)
+		require.Equal(t, 0.0, md.HDR.MaxContentLightLevel)
+	})
+
+	t.Run("ignores text chunks that decompress to too much data", func(t *testing.T) {
+		data := &bytes.Buffer{}
+		data.Write(pngSignature[:])
+		write_header(data, 13, chunkTypeIHDR)
+		headerData := [13]byte{0, 0, 0, 15, 0, 0, 0, 16, 8}
+		data.Write(headerData[:])
+		dummyCRC := uint32(0)
+		write(data, dummyCRC)
+		for _, size := range []int{max_text_size + 1, max_text_size} {
+			text := compressICCProfileData(make([]byte, size))
+			write_header(data, uint32(len("Comment")+2+len(text)), chunkTypezTXt)
+			io.WriteString(data, "Comment")
+			data.Write([]byte{0, 0})
+			data.Write(text)
+			write(data, dummyCRC)
+		}
+		md, err := extractMetadata(data)
+		require.NoError(t, err)
+		require.Len(t, md.Text, 1)
+		require.Len(t, md.Text[0].Value, max_text_size)
+	})
+
+	t.Run("reads XMP metadata from iTXt chunks", func(t *testing.T) {
+		packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="2"/>
+</rdf:RDF></x:xmpmeta>`
+		data := &bytes.Buffer{}
+		data.Write(pngSignature[:])
+		write_header(data, 13, chunkTypeIHDR)
+		headerData := [13]byte{0, 0, 0, 15, 0, 0, 0, 16, 8}
+		data.Write(headerData[:])
+		dummyCRC := uint32(0)
+		write(data, dummyCRC)
+		// keyword, compression flag and method, empty language and translated keyword
+		write_header(data, uint32(len(meta.XMPPNGKeyword)+5+len(packet)), chunkTypeiTXt)
+		io.WriteString(data, meta.XMPPNGKeyword)
+		data.Write([]byte{0, 0, 0, 0, 0})
+		io.WriteString(data, packet)
+		write(data, dummyCRC)
+		md, err := extractMetadata(data)
+		require.NoError(t, err)
+		xmp, _ := md.XMPData()
+		require.Equal(t, packet, string(xmp))
+		x, err := md.XMP()
+		require.NoError(t, err)
+		require.Equal(t, 2.0, x.Rating)
+	})
+
 	t.Run("stops reading after all interesting metadata has been found", func(t *testing.T) {
 		data := &bytes.Buffer{}
 		data.Write(pngSignature[:])
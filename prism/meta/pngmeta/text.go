@@ -0,0 +1,114 @@
+package pngmeta
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kovidgoyal/imaging/prism/meta"
+)
+
+var _ = fmt.Print
+
+// The maximum size of the decompressed text of a zTXt or iTXt chunk, larger
+// chunks are ignored to protect against decompression bombs
+const max_text_size = 16 * 1024 * 1024
+
+// Decompress zlib data, failing if it expands to more than limit bytes, a
+// negative limit means no limit
+func decompress(data []byte, limit int64) ([]byte, error) {
+	zReader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zReader.Close()
+	ans := &bytes.Buffer{}
+	var src io.Reader = zReader
+	if limit >= 0 {
+		// read one byte more than the limit to detect data that is too large
+		src = io.LimitReader(zReader, limit+1)
+	}
+	if _, err = io.Copy(ans, src); err != nil {
+		return nil, err
+	}
+	if limit >= 0 && int64(ans.Len()) > limit {
+		return nil, fmt.Errorf("compressed data expands to more than %d bytes", limit)
+	}
+	return ans.Bytes(), nil
+}
+
+func latin1_to_utf8(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data))
+	for _, c := range data {
+		b.WriteRune(rune(c))
+	}
+	return b.String()
+}
+
+// Splits off the null terminated keyword at the start of a text chunk
+func split_keyword(chunk []byte) (keyword string, rest []byte, err error) {
+	idx := bytes.IndexByte(chunk, 0)
+	if idx < 1 || idx > 79 {
+		return "", nil, fmt.Errorf("invalid keyword in PNG text chunk")
+	}
+	return latin1_to_utf8(chunk[:idx]), chunk[idx+1:], nil
+}
+
+func parse_tEXt(chunk []byte) (ans meta.TextEntry, err error) {
+	if ans.Key, chunk, err = split_keyword(chunk); err != nil {
+		return
+	}
+	ans.Value = latin1_to_utf8(chunk)
+	return
+}
+
+func parse_zTXt(chunk []byte) (ans meta.TextEntry, err error) {
+	if ans.Key, chunk, err = split_keyword(chunk); err != nil {
+		return
+	}
+	if len(chunk) < 1 {
+		return ans, fmt.Errorf("incomplete zTXt chunk in PNG file")
+	}
+	if compressionMethod := chunk[0]; compressionMethod != 0x00 {
+		return ans, fmt.Errorf("unknown compression method (%d)", compressionMethod)
+	}
+	if chunk, err = decompress(chunk[1:], max_text_size); err != nil {
+		return
+	}
+	ans.Value = latin1_to_utf8(chunk)
+	ans.Compressed = true
+	return
+}
+
+func parse_iTXt(chunk []byte) (ans meta.TextEntry, err error) {
+	if ans.Key, chunk, err = split_keyword(chunk); err != nil {
+		return
+	}
+	if len(chunk) < 2 {
+		return ans, fmt.Errorf("incomplete iTXt chunk in PNG file")
+	}
+	ans.Compressed = chunk[0] != 0
+	if compressionMethod := chunk[1]; ans.Compressed && compressionMethod != 0x00 {
+		return ans, fmt.Errorf("unknown compression method (%d)", compressionMethod)
+	}
+	chunk = chunk[2:]
+	idx := bytes.IndexByte(chunk, 0)
+	if idx < 0 {
+		return ans, fmt.Errorf("null terminator not found reading iTXt language tag")
+	}
+	ans.Language, chunk = string(chunk[:idx]), chunk[idx+1:]
+	if idx = bytes.IndexByte(chunk, 0); idx < 0 {
+		return ans, fmt.Errorf("null terminator not found reading iTXt translated keyword")
+	}
+	ans.TranslatedKey, chunk = string(chunk[:idx]), chunk[idx+1:]
+	if ans.Compressed {
+		if chunk, err = decompress(chunk, max_text_size); err != nil {
+			return
+		}
+	}
+	ans.Value = string(chunk)
+	return
+}
@@ -0,0 +1,114 @@
+package meta
+
+import (
+	"fmt"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+var _ = fmt.Print
+
+type ResolutionUnit uint8
+
+const (
+	// Only the aspect ratio of the pixels is known
+	NoResolutionUnit ResolutionUnit = iota
+	PixelsPerInch
+	PixelsPerCentimeter
+)
+
+const centimeters_per_inch = 2.54
+
+func (u ResolutionUnit) String() string {
+	switch u {
+	case NoResolutionUnit:
+		return "None"
+	case PixelsPerInch:
+		return "PixelsPerInch"
+	case PixelsPerCentimeter:
+		return "PixelsPerCentimeter"
+	}
+	return fmt.Sprintf("UnknownResolutionUnit(%d)", u)
+}
+
+// Resolution is the physical resolution (pixel density) of an image. The zero
+// value means the resolution is not known.
+type Resolution struct {
+	X, Y float64
+	Unit ResolutionUnit
+}
+
+func (r Resolution) String() string {
+	return fmt.Sprintf("Resolution{X: %g, Y: %g, Unit: %s}", r.X, r.Y, r.Unit)
+}
+
+func (r Resolution) IsSet() bool { return r.X > 0 && r.Y > 0 }
+
+// HasPhysicalUnit returns true if the resolution is set and has a physical unit,
+// i.e. it is not just an aspect ratio
+func (r Resolution) HasPhysicalUnit() bool { return r.IsSet() && r.Unit != NoResolutionUnit }
+
+// DPI returns the resolution in dots per inch, zero if the resolution has no
+// physical unit
+func (r Resolution) DPI() (x, y float64) {
+	switch r.Unit {
+	case PixelsPerInch:
+		return r.X, r.Y
+	case PixelsPerCentimeter:
+		return r.X * centimeters_per_inch, r.Y * centimeters_per_inch
+	}
+	return 0, 0
+}
+
+// In returns the resolution converted to the specified unit. Resolutions without a physical unit are returned unchanged.
+func (r Resolution) In(unit ResolutionUnit) Resolution {
+	if r.Unit == unit || r.Unit == NoResolutionUnit || unit == NoResolutionUnit {
+		return r
+	}
+	if unit == PixelsPerInch {
+		return Resolution{r.X * centimeters_per_inch, r.Y * centimeters_per_inch, unit}
+	}
+	return Resolution{r.X / centimeters_per_inch, r.Y / centimeters_per_inch, unit}
+}
+
+// ResolutionFromExif returns the resolution specified in the EXIF metadata,
+// if any
+func ResolutionFromExif(e *exif.Exif) (ans Resolution) {
+	rat := func(name exif.FieldName) float64 {
+		if t, err := e.Get(name); err == nil {
+			if num, den, err := t.Rat2(0); err == nil && den != 0 && num > 0 {
+				return float64(num) / float64(den)
+			}
+		}
+		return 0
+	}
+	if ans.X, ans.Y = rat(exif.XResolution), rat(exif.YResolution); !ans.IsSet() {
+		return Resolution{}
+	}
+	// The EXIF default unit is inches
+	ans.Unit = PixelsPerInch
+	if t, err := e.Get(exif.ResolutionUnit); err == nil {
+		if u, err := t.Int(0); err == nil {
+			switch u {
+			case 1:
+				ans.Unit = NoResolutionUnit
+			case 3:
+				ans.Unit = PixelsPerCentimeter
+			}
+		}
+	}
+	return
+}
+
+// Sets Resolution from the EXIF metadata if it does not already have a
+// physical unit and the EXIF metadata specifies a resolution
+func (md *Data) FallbackToExifResolution() {
+	if md.Resolution.HasPhysicalUnit() {
+		return
+	}
+	if e, err := md.Exif(); err == nil && e != nil {
+		if r := ResolutionFromExif(e); r.IsSet() && (r.HasPhysicalUnit() || !md.Resolution.IsSet()) {
+			md.Resolution = r
+		}
+	}
+}
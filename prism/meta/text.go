@@ -0,0 +1,30 @@
+package meta
+
+import (
+	"fmt"
+)
+
+var _ = fmt.Print
+
+// TextEntry is a single key/value pair of textual metadata, for example, from
+// the PNG tEXt, zTXt and iTXt chunks. Value is always UTF-8.
+type TextEntry struct {
+	Key   string
+	Value string
+	// The language of Value as an RFC 3066 language tag, empty if unknown
+	Language string
+	// The Key translated into Language, empty if unknown
+	TranslatedKey string
+	// Whether the value was (or should be) stored compressed
+	Compressed bool
+}
+
+// Returns the value of the first text entry with the specified key
+func (s *Data) TextValue(key string) (string, bool) {
+	for _, t := range s.Text {
+		if t.Key == key {
+			return t.Value, true
+		}
+	}
+	return "", false
+}
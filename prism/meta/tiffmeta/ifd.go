@@ -0,0 +1,109 @@
+package tiffmeta
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/kovidgoyal/imaging/prism/meta"
+	exif_tiff "github.com/rwcarlsen/goexif/tiff"
+)
+
+var _ = fmt.Print
+
+const (
+	xResolutionTag    = 282
+	yResolutionTag    = 283
+	resolutionUnitTag = 296
+	xmpTag            = 700
+)
+
+// Adapts an io.ReadSeeker to the io.ReaderAt needed by the goexif tiff
+// package with offsets relative to the start of the TIFF data
+type read_at_seeker struct {
+	io.ReadSeeker
+	base int64
+}
+
+func (r read_at_seeker) ReadAt(p []byte, off int64) (n int, err error) {
+	cur, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = r.Seek(r.base+off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err = io.ReadFull(r.ReadSeeker, p)
+	if _, serr := r.Seek(cur, io.SeekStart); serr != nil && err == nil {
+		err = serr
+	}
+	return
+}
+
+// Reads the first IFD of the TIFF data starting at pos
+func read_first_ifd(r io.ReadSeeker, pos int64) (*exif_tiff.Dir, error) {
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch string(hdr[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("tiff: could not read tiff byte order")
+	}
+	if _, err := r.Seek(pos+int64(order.Uint32(hdr[4:])), io.SeekStart); err != nil {
+		return nil, err
+	}
+	d, _, err := exif_tiff.DecodeDir(read_at_seeker{r, pos}, order)
+	return d, err
+}
+
+func find_tag(d *exif_tiff.Dir, id uint16) *exif_tiff.Tag {
+	for _, t := range d.Tags {
+		if t.Id == id {
+			return t
+		}
+	}
+	return nil
+}
+
+func xmp_from_ifd(d *exif_tiff.Dir) []byte {
+	if t := find_tag(d, xmpTag); t != nil {
+		return t.Val
+	}
+	return nil
+}
+
+func resolution_from_ifd(d *exif_tiff.Dir) (ans meta.Resolution) {
+	rat := func(id uint16) float64 {
+		if t := find_tag(d, id); t != nil {
+			if num, den, err := t.Rat2(0); err == nil && den != 0 && num > 0 {
+				return float64(num) / float64(den)
+			}
+		}
+		return 0
+	}
+	if ans.X, ans.Y = rat(xResolutionTag), rat(yResolutionTag); !ans.IsSet() {
+		return meta.Resolution{}
+	}
+	// The TIFF default unit is inches
+	ans.Unit = meta.PixelsPerInch
+	if t := find_tag(d, resolutionUnitTag); t != nil {
+		if u, err := t.Int(0); err == nil {
+			switch u {
+			case 1:
+				ans.Unit = meta.NoResolutionUnit
+			case 3:
+				ans.Unit = meta.PixelsPerCentimeter
+			}
+		}
+	}
+	return
+}
@@ -61,6 +61,14 @@ func ExtractMetadata(r_ io.Reader) (md *meta.Data, err error) {
 		Format: types.TIFF, PixelWidth: uint32(c.Width), PixelHeight: uint32(c.Height),
 		BitsPerComponent: BitsPerComponent(c.ColorModel),
 	}
+	if ifd, err := read_first_ifd(r, pos); err != nil {
+		md.SetXMPError(err)
+	} else {
+		if xmp := xmp_from_ifd(ifd); xmp != nil {
+			md.SetXMPData(xmp, nil)
+		}
+		md.Resolution = resolution_from_ifd(ifd)
+	}
 	if _, err = r.Seek(pos, io.SeekStart); err != nil {
 		return nil, err
 	}
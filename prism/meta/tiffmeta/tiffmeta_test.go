@@ -0,0 +1,90 @@
+package tiffmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/kovidgoyal/imaging/types"
+	"github.com/stretchr/testify/require"
+)
+
+type ifd_entry struct {
+	tag, typ uint16
+	count    uint32
+	value    uint32
+}
+
+// Builds a little endian, uncompressed, single strip 8-bit grayscale TIFF
+// whose first IFD contains the specified XMP packet, if any
+func tiff_with_xmp(width, height int, xmp []byte) []byte {
+	const short, long, byte_type = 3, 4, 1
+	entries := []ifd_entry{
+		{256, short, 1, uint32(width)},
+		{257, short, 1, uint32(height)},
+		{258, short, 1, 8},
+		{259, short, 1, 1},
+		{262, short, 1, 1},
+		{273, long, 1, 0}, // strip offset filled in below
+		{277, short, 1, 1},
+		{278, short, 1, uint32(height)},
+		{279, long, 1, uint32(width * height)},
+	}
+	if len(xmp) > 0 {
+		entries = append(entries, ifd_entry{xmpTag, byte_type, uint32(len(xmp)), 0})
+	}
+	ifd_size := 2 + len(entries)*12 + 4
+	xmp_offset := uint32(8 + ifd_size)
+	if len(xmp) > 0 {
+		entries[len(entries)-1].value = xmp_offset
+	}
+	entries[5].value = xmp_offset + uint32(len(xmp))
+
+	b := &bytes.Buffer{}
+	w := func(x any) { _ = binary.Write(b, binary.LittleEndian, x) }
+	b.WriteString("II")
+	w(uint16(42))
+	w(uint32(8))
+	w(uint16(len(entries)))
+	for _, e := range entries {
+		w(e.tag)
+		w(e.typ)
+		w(e.count)
+		if e.typ == short {
+			w(uint16(e.value))
+			w(uint16(0))
+		} else {
+			w(e.value)
+		}
+	}
+	w(uint32(0))
+	b.Write(xmp)
+	b.Write(make([]byte, width*height))
+	return b.Bytes()
+}
+
+func TestExtractMetadata(t *testing.T) {
+	t.Run("reads XMP metadata from the first IFD", func(t *testing.T) {
+		packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:tiff="http://ns.adobe.com/tiff/1.0/" xmp:Rating="1" tiff:Orientation="3"/>
+</rdf:RDF></x:xmpmeta>`
+		md, err := ExtractMetadata(bytes.NewReader(tiff_with_xmp(3, 2, []byte(packet))))
+		require.NoError(t, err)
+		require.Equal(t, types.TIFF, md.Format)
+		require.Equal(t, uint32(3), md.PixelWidth)
+		require.Equal(t, uint32(2), md.PixelHeight)
+		xmp, _ := md.XMPData()
+		require.Equal(t, packet, string(xmp))
+		x, err := md.XMP()
+		require.NoError(t, err)
+		require.Equal(t, 1.0, x.Rating)
+		require.Equal(t, 3, x.Orientation)
+	})
+
+	t.Run("no XMP metadata", func(t *testing.T) {
+		md, err := ExtractMetadata(bytes.NewReader(tiff_with_xmp(3, 2, nil)))
+		require.NoError(t, err)
+		xmp, _ := md.XMPData()
+		require.Nil(t, xmp)
+	})
+}
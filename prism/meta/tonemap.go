@@ -0,0 +1,233 @@
+package meta
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kovidgoyal/imaging/prism/meta/icc"
+)
+
+var _ = fmt.Print
+
+type ToneMappingOperator int
+
+const (
+	// The EETF from ITU-R BT.2390 applied in the PQ domain
+	ToneMapBT2390 ToneMappingOperator = iota
+	// Extended Reinhard, mapping the mastering peak to the target peak
+	ToneMapReinhard
+	// The filmic curve of John Hable from Uncharted 2
+	ToneMapHable
+	// No tone mapping, values above the target peak are clipped
+	ToneMapClip
+)
+
+func (t ToneMappingOperator) String() string {
+	switch t {
+	case ToneMapBT2390:
+		return "BT.2390"
+	case ToneMapReinhard:
+		return "Reinhard"
+	case ToneMapHable:
+		return "Hable"
+	case ToneMapClip:
+		return "Clip"
+	}
+	return fmt.Sprintf("ToneMappingOperator(%d)", int(t))
+}
+
+// Luminance metadata of HDR content, in cd/m². Zero values are unknown.
+type HDRMetadata struct {
+	// Luminance range of the mastering display, from the PNG mDCv chunk
+	MasteringMaxLuminance, MasteringMinLuminance float64
+	// The content light levels from the PNG cLLi chunk
+	MaxContentLightLevel, MaxFrameAverageLightLevel float64
+}
+
+// Peak luminance of the content, preferring the content light level over the
+// mastering display luminance. Zero if unknown.
+func (h HDRMetadata) Peak() float64 {
+	if h.MaxContentLightLevel > 0 {
+		if h.MasteringMaxLuminance > 0 {
+			return min(h.MaxContentLightLevel, h.MasteringMaxLuminance)
+		}
+		return h.MaxContentLightLevel
+	}
+	return h.MasteringMaxLuminance
+}
+
+// Parameters for tone mapping HDR content using the PQ or HLG transfer
+// functions to SDR. The zero value uses the BT.2390 operator with defaults
+// for all luminances.
+type ToneMapping struct {
+	Operator ToneMappingOperator
+	// Peak luminance of the target display in cd/m², defaults to 203, the
+	// HDR reference white of BT.2408
+	TargetPeak float64
+	// Luminance range of the content in cd/m². For PQ content the peak
+	// defaults to 1000. For HLG content the peak is the nominal peak
+	// luminance of the display used for the OOTF and defaults to 1000.
+	SourcePeak, SourceBlack float64
+	// System gamma of the HLG OOTF, defaults to the value computed from the
+	// source peak as per BT.2100
+	HLGSystemGamma float64
+}
+
+const (
+	pq_peak_luminance   = 10000
+	default_target_peak = 203
+	default_source_peak = 1000
+)
+
+// Return a copy of the tone mapping parameters with defaults filled in from
+// metadata, where present, and the standard values otherwise
+func (t ToneMapping) WithDefaults(md HDRMetadata) ToneMapping {
+	if t.TargetPeak <= 0 {
+		t.TargetPeak = default_target_peak
+	}
+	if t.SourcePeak <= 0 {
+		if t.SourcePeak = md.Peak(); t.SourcePeak <= 0 {
+			t.SourcePeak = default_source_peak
+		}
+	}
+	if t.SourceBlack <= 0 {
+		t.SourceBlack = max(0, md.MasteringMinLuminance)
+	}
+	if t.HLGSystemGamma <= 0 {
+		t.HLGSystemGamma = 1.2 + 0.42*math.Log10(t.SourcePeak/1000)
+	}
+	return t
+}
+
+func (c CodingIndependentCodePoints) IsHDR() bool {
+	return c.TransferCharacteristics == 16 || c.TransferCharacteristics == 18
+}
+
+func pq_inverse_eotf(nits float64) float64 {
+	return transfer_functions[16].OETF(max(0, nits) / pq_peak_luminance)
+}
+
+func pq_eotf(v float64) float64 {
+	return transfer_functions[16].EOTF(max(0, v)) * pq_peak_luminance
+}
+
+// Return a function that maps luminance in cd/m² to the range [0, 1] of the
+// target display
+func (t ToneMapping) curve() func(float64) float64 {
+	peak := t.SourcePeak / t.TargetPeak
+	switch t.Operator {
+	case ToneMapReinhard:
+		return func(nits float64) float64 {
+			x := nits / t.TargetPeak
+			return x * (1 + x/(peak*peak)) / (1 + x)
+		}
+	case ToneMapHable:
+		hable := func(x float64) float64 {
+			const A, B, C, D, E, F = 0.15, 0.50, 0.10, 0.20, 0.02, 0.30
+			return (x*(A*x+C*B)+D*E)/(x*(A*x+B)+D*F) - E/F
+		}
+		// The exposure bias of the original
+		const exposure = 2
+		white := hable(exposure * peak)
+		return func(nits float64) float64 { return hable(exposure*nits/t.TargetPeak) / white }
+	case ToneMapBT2390:
+		if t.SourcePeak <= t.TargetPeak {
+			break
+		}
+		src_min, src_max := pq_inverse_eotf(t.SourceBlack), pq_inverse_eotf(t.SourcePeak)
+		normalize := func(nits float64) float64 { return (pq_inverse_eotf(nits) - src_min) / (src_max - src_min) }
+		min_lum, max_lum := normalize(0), normalize(t.TargetPeak)
+		ks := 1.5*max_lum - 0.5
+		return func(nits float64) float64 {
+			e := min(max(normalize(nits), 0), 1)
+			if e > ks {
+				// Hermite spline roll off
+				u := (e - ks) / (1 - ks)
+				u2, u3 := u*u, u*u*u
+				e = (2*u3-3*u2+1)*ks + (u3-2*u2+u)*(1-ks) + (-2*u3+3*u2)*max_lum
+			}
+			e += min_lum * math.Pow(1-e, 4)
+			return pq_eotf(e*(src_max-src_min)+src_min) / t.TargetPeak
+		}
+	}
+	return func(nits float64) float64 { return nits / t.TargetPeak }
+}
+
+// Tone maps linear RGB by scaling it so that its maximum component follows
+// the tone curve, which preserves hue. The input is first converted to
+// display light in cd/m², using the HLG OOTF if needed.
+type tone_mapper struct {
+	name        string
+	luminance   [3]float64 // the Y row of the RGB to XYZ matrix, for the HLG OOTF
+	is_hlg      bool
+	peak, gamma float64
+	target_peak float64
+	curve       func(float64) float64
+}
+
+func (c *tone_mapper) String() string                           { return fmt.Sprintf("ToneMap{%s}", c.name) }
+func (c *tone_mapper) IOSig() (int, int)                        { return 3, 3 }
+func (c *tone_mapper) Iter(f func(icc.ChannelTransformer) bool) { f(c) }
+func (c *tone_mapper) TransformGeneral(o, i []float64) {
+	o[0], o[1], o[2] = c.Transform(i[0], i[1], i[2])
+}
+
+func (c *tone_mapper) Transform(r, g, b float64) (float64, float64, float64) {
+	r, g, b = max(0, r), max(0, g), max(0, b)
+	if c.is_hlg {
+		// OOTF from BT.2100
+		y := c.luminance[0]*r + c.luminance[1]*g + c.luminance[2]*b
+		s := c.peak * math.Pow(y, c.gamma-1)
+		if y == 0 {
+			s = 0
+		}
+		r, g, b = r*s, g*s, b*s
+	} else {
+		r, g, b = r*pq_peak_luminance, g*pq_peak_luminance, b*pq_peak_luminance
+	}
+	m := max(r, g, b)
+	if m <= 0 {
+		return 0, 0, 0
+	}
+	s := c.curve(m) / m
+	return r * s, g * s, b * s
+}
+
+// Converts SDR linear RGB, where 1 is the target peak luminance, to HDR
+// linear RGB, the inverse of tone_mapper with the ToneMapClip operator
+type sdr_to_hdr struct {
+	tone_mapper
+}
+
+func (c *sdr_to_hdr) String() string                           { return "SDRToHDR" }
+func (c *sdr_to_hdr) Iter(f func(icc.ChannelTransformer) bool) { f(c) }
+func (c *sdr_to_hdr) TransformGeneral(o, i []float64) {
+	o[0], o[1], o[2] = c.Transform(i[0], i[1], i[2])
+}
+
+func (c *sdr_to_hdr) Transform(r, g, b float64) (float64, float64, float64) {
+	s := c.target_peak
+	r, g, b = max(0, r)*s, max(0, g)*s, max(0, b)*s
+	if c.is_hlg {
+		// Inverse OOTF from BT.2100
+		y := (c.luminance[0]*r + c.luminance[1]*g + c.luminance[2]*b) / c.peak
+		if y <= 0 {
+			return 0, 0, 0
+		}
+		s = 1 / (c.peak * math.Pow(y, (c.gamma-1)/c.gamma))
+	} else {
+		s = 1. / pq_peak_luminance
+	}
+	return r * s, g * s, b * s
+}
+
+func (c CodingIndependentCodePoints) sdr_to_hdr(t ToneMapping, rgb_to_xyz icc.Matrix3) *sdr_to_hdr {
+	return &sdr_to_hdr{*c.tone_mapper(t, rgb_to_xyz)}
+}
+
+func (c CodingIndependentCodePoints) tone_mapper(t ToneMapping, rgb_to_xyz icc.Matrix3) *tone_mapper {
+	return &tone_mapper{
+		name: t.Operator.String(), luminance: rgb_to_xyz[1], is_hlg: c.TransferCharacteristics == 18,
+		peak: t.SourcePeak, gamma: t.HLGSystemGamma, target_peak: t.TargetPeak, curve: t.curve(),
+	}
+}
@@ -8,4 +8,5 @@ var (
 	chunkTypeVP8X = [4]byte{'V', 'P', '8', 'X'}
 	chunkTypeICCP = [4]byte{'I', 'C', 'C', 'P'}
 	chunkTypeEXIF = [4]byte{'E', 'X', 'I', 'F'}
+	chunkTypeXMP  = [4]byte{'X', 'M', 'P', ' '}
 )
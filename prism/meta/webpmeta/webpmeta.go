@@ -65,6 +65,7 @@ func ExtractMetadata(r io.Reader) (md *meta.Data, err error) {
 	if err != nil {
 		return nil, err
 	}
+	md.FallbackToExifResolution()
 	return md, nil
 }
 
@@ -132,6 +133,7 @@ func parseWebpExtended(r io.Reader, md *meta.Data, chunkLen uint32) error {
 	}
 	hasProfile := h[0]&(1<<5) != 0
 	hasExif := h[0]&(1<<3) != 0
+	hasXMP := h[0]&(1<<2) != 0
 	animated := h[0]&(1<<1) != 0
 	h = h[4:]
 	w := uint32(h[0]) | uint32(h[1])<<8 | uint32(h[2])<<16
@@ -140,7 +142,7 @@ func parseWebpExtended(r io.Reader, md *meta.Data, chunkLen uint32) error {
 	md.PixelHeight = ht + 1
 	md.BitsPerComponent = bitsPerComponent
 	md.HasFrames = animated
-	if !hasProfile && !hasExif {
+	if !hasProfile && !hasExif && !hasXMP {
 		return nil
 	}
 	if err := skip(r, chunkLen-10); err != nil {
@@ -157,28 +159,39 @@ func parseWebpExtended(r io.Reader, md *meta.Data, chunkLen uint32) error {
 		}
 	}
 
-	if hasExif {
-		for {
-			ch, err := readChunkHeader(r)
-			if err != nil {
-				if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
-					err = nil
-					break
-				}
+	// EXIF and XMP chunks come after the image data
+	for hasExif || hasXMP {
+		ch, err := readChunkHeader(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				err = nil
+				break
+			}
+			return err
+		}
+		switch ch.ChunkType {
+		case chunkTypeEXIF, chunkTypeXMP:
+			data := make([]byte, ch.Length)
+			if _, err := io.ReadFull(r, data); err != nil {
 				return err
 			}
 			if ch.ChunkType == chunkTypeEXIF {
-				data := make([]byte, ch.Length)
-				if _, err := io.ReadFull(r, data); err != nil {
-					return err
-				}
 				md.SetExifData(data)
-				break
+				hasExif = false
 			} else {
-				if err = skip(r, ch.Length); err != nil {
+				md.SetXMPData(data, nil)
+				hasXMP = false
+			}
+			if ch.Length&1 != 0 {
+				if err = skip(r, 1); err != nil && (hasExif || hasXMP) {
 					return err
 				}
 			}
+		default:
+			// Chunks are padded to an even length
+			if err = skip(r, ch.Length+ch.Length&1); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -88,6 +88,29 @@ func TestExtractMetadata(t *testing.T) {
 		require.NotNil(t, exif)
 	})
 
+	t.Run("reads XMP metadata after the image data", func(t *testing.T) {
+		packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="5"/>
+</rdf:RDF></x:xmpmeta>`
+		data := &bytes.Buffer{}
+		data.Write([]byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00\x04\x00\x00\x00\x09\x00\x00\x04\x00\x00"))
+		// odd length image data chunk, padded to an even length
+		data.Write([]byte("VP8L\x03\x00\x00\x00\x2f\x00\x00\x00"))
+		data.Write(chunkTypeXMP[:])
+		binary.Write(data, binary.LittleEndian, uint32(len(packet)))
+		data.WriteString(packet)
+
+		md, err := extractMetadata(data)
+		require.NoError(t, err)
+		require.Equal(t, uint32(10), md.PixelWidth)
+		require.Equal(t, uint32(5), md.PixelHeight)
+		xmp, _ := md.XMPData()
+		require.Equal(t, packet, string(xmp))
+		x, err := md.XMP()
+		require.NoError(t, err)
+		require.Equal(t, 5.0, x.Rating)
+	})
+
 	t.Run("returns all metadata", func(t *testing.T) {
 		data := &bytes.Buffer{}
 		iccProfileData := []byte{1, 2, 3, 4}
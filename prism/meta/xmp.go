@@ -0,0 +1,243 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var _ = fmt.Print
+
+const (
+	ns_rdf  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	ns_xml  = "http://www.w3.org/XML/1998/namespace"
+	ns_dc   = "http://purl.org/dc/elements/1.1/"
+	ns_xmp  = "http://ns.adobe.com/xap/1.0/"
+	ns_tiff = "http://ns.adobe.com/tiff/1.0/"
+	ns_crs  = "http://ns.adobe.com/camera-raw-settings/1.0/"
+)
+
+// The key used for XMP packets in PNG iTXt chunks
+const XMPPNGKeyword = "XML:com.adobe.xmp"
+
+// LangAlternative maps RFC 3066 language tags to values, as used by XMP
+// properties such as dc:title
+type LangAlternative map[string]string
+
+// Default returns the x-default value or if that is not present, an arbitrary value
+func (l LangAlternative) Default() string {
+	if ans, found := l["x-default"]; found {
+		return ans
+	}
+	for _, v := range l {
+		return v
+	}
+	return ""
+}
+
+// XMP is a parsed view of some commonly used properties from an XMP packet
+type XMP struct {
+	// The raw XMP packet
+	Packet []byte
+	// The reassembled extended XMP packet, if any, from JPEG files
+	ExtendedPacket []byte
+
+	Title, Rights LangAlternative // dc:title and dc:rights
+	Rating        float64         // xmp:Rating -1 is rejected, 0 is unrated
+	Orientation   int             // tiff:Orientation zero if unspecified
+	// Camera Raw (crs) adjustments with simple values, keyed by property name
+	CameraRaw map[string]string
+}
+
+type xmp_property struct {
+	name    xml.Name
+	text    strings.Builder
+	items   []string
+	langs   []string
+	lang    string
+	in_item bool
+}
+
+func (x *XMP) set(p *xmp_property) {
+	value := strings.TrimSpace(p.text.String())
+	if len(p.items) > 0 {
+		value = strings.Join(p.items, ", ")
+	}
+	lang_alt := func(existing LangAlternative) LangAlternative {
+		if existing == nil {
+			existing = make(LangAlternative)
+		}
+		if len(p.items) == 0 {
+			if value != "" {
+				existing["x-default"] = value
+			}
+			return existing
+		}
+		for i, item := range p.items {
+			lang := p.langs[i]
+			if lang == "" {
+				lang = "x-default"
+			}
+			existing[lang] = item
+		}
+		return existing
+	}
+	switch p.name.Space {
+	case ns_dc:
+		switch p.name.Local {
+		case "title":
+			x.Title = lang_alt(x.Title)
+		case "rights":
+			x.Rights = lang_alt(x.Rights)
+		}
+	case ns_xmp:
+		if p.name.Local == "Rating" {
+			if r, err := strconv.ParseFloat(value, 64); err == nil {
+				x.Rating = r
+			}
+		}
+	case ns_tiff:
+		if p.name.Local == "Orientation" {
+			if o, err := strconv.Atoi(value); err == nil && o > 0 && o < 9 {
+				x.Orientation = o
+			}
+		}
+	case ns_crs:
+		if x.CameraRaw == nil {
+			x.CameraRaw = make(map[string]string)
+		}
+		x.CameraRaw[p.name.Local] = value
+	}
+}
+
+func (x *XMP) parse(packet []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(packet))
+	d.Strict = false
+	var stack []xml.Name
+	var prop *xmp_property
+	prop_depth := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			parent := xml.Name{}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			stack = append(stack, t.Name)
+			switch {
+			case prop == nil && t.Name.Space == ns_rdf && t.Name.Local == "Description":
+				// Simple properties can be specified as attributes
+				for _, a := range t.Attr {
+					if a.Name.Space != ns_rdf && a.Name.Space != "xmlns" && a.Name.Space != ns_xml && a.Name.Space != "" {
+						p := xmp_property{name: a.Name}
+						p.text.WriteString(a.Value)
+						x.set(&p)
+					}
+				}
+			case prop == nil && parent.Space == ns_rdf && parent.Local == "Description":
+				prop = &xmp_property{name: t.Name}
+				prop_depth = len(stack)
+			case prop != nil && t.Name.Space == ns_rdf && t.Name.Local == "li":
+				prop.in_item, prop.lang = true, ""
+				prop.text.Reset()
+				for _, a := range t.Attr {
+					if a.Name.Space == ns_xml && a.Name.Local == "lang" {
+						prop.lang = a.Value
+					}
+				}
+			}
+		case xml.CharData:
+			if prop != nil && (len(stack) == prop_depth || prop.in_item) {
+				prop.text.Write(t)
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			if prop == nil {
+				break
+			}
+			switch {
+			case prop.in_item && t.Name.Space == ns_rdf && t.Name.Local == "li":
+				prop.items = append(prop.items, strings.TrimSpace(prop.text.String()))
+				prop.langs = append(prop.langs, prop.lang)
+				prop.in_item = false
+				prop.text.Reset()
+			case len(stack) < prop_depth:
+				x.set(prop)
+				prop = nil
+			}
+		}
+	}
+}
+
+// ParseXMP parses the specified XMP packet and optional extended XMP packet.
+// Properties in the main packet take precedence.
+func ParseXMP(packet, extended_packet []byte) (*XMP, error) {
+	ans := &XMP{Packet: packet, ExtendedPacket: extended_packet}
+	if len(extended_packet) > 0 {
+		if err := ans.parse(extended_packet); err != nil {
+			return nil, err
+		}
+	}
+	if err := ans.parse(packet); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+// Returns a parsed XMP packet from this metadata.
+//
+// An error is returned if the XMP packet could not be correctly parsed.
+//
+// If no XMP packet was found, nil is returned without an error.
+func (md *Data) XMP() (*XMP, error) {
+	md.mutex.Lock()
+	defer md.mutex.Unlock()
+
+	if md.xmpErr != nil {
+		return nil, md.xmpErr
+	}
+	if md.xmp != nil {
+		return md.xmp, nil
+	}
+	if len(md.xmpData) == 0 {
+		return nil, nil
+	}
+	md.xmp, md.xmpErr = ParseXMP(md.xmpData, md.xmpExtendedData)
+	return md.xmp, md.xmpErr
+}
+
+// XMPData returns the raw XMP packet and the extended XMP packet, if any.
+func (md *Data) XMPData() (packet, extended_packet []byte) {
+	md.mutex.Lock()
+	defer md.mutex.Unlock()
+	return md.xmpData, md.xmpExtendedData
+}
+
+func (md *Data) SetXMPData(packet, extended_packet []byte) {
+	md.mutex.Lock()
+	defer md.mutex.Unlock()
+	md.xmpData, md.xmpExtendedData = packet, extended_packet
+	md.xmpErr = nil
+	md.xmp = nil
+}
+
+func (md *Data) SetXMPError(err error) {
+	md.mutex.Lock()
+	defer md.mutex.Unlock()
+	md.xmpData, md.xmpExtendedData = nil, nil
+	md.xmpErr = err
+	md.xmp = nil
+}
@@ -4,8 +4,10 @@ import (
 	"image"
 	"math"
 
+	"github.com/kovidgoyal/imaging/colorconv"
 	"github.com/kovidgoyal/imaging/nrgb"
 	"github.com/kovidgoyal/imaging/nrgba"
+	"github.com/kovidgoyal/imaging/rgbaf"
 )
 
 type indexWeight struct {
@@ -51,41 +53,32 @@ func precomputeWeights(dstSize, srcSize int, filter ResampleFilter) [][]indexWei
 // Resize resizes the image to the specified width and height using the specified resampling
 // filter and returns the transformed image. If one of width or height is 0, the image aspect
 // ratio is preserved. When is_opaque is true, returns a nrgb.Image otherwise
-// an image.NRGBA. When the image size is unchanged returns a clone with the
+// an image.NRGBA. Images with more than 8 bits per channel are resized
+// preserving 16 bits per channel, returning a nrgb.Image48 or image.NRGBA64
+// instead. RGBAF images are resized in floating point and an RGBAF
+// image is returned. When the image size is unchanged returns a clone with the
 // same image type.
 //
 // Example:
 //
 //	dstImage := imaging.Resize(srcImage, 800, 600, imaging.Lanczos)
 func ResizeWithOpacity(img image.Image, width, height int, filter ResampleFilter, is_opaque bool) image.Image {
-	dstW, dstH := width, height
-	if dstW < 0 || dstH < 0 || (dstW == 0 && dstH == 0) {
+	srcW, srcH, dstW, dstH := resize_dimensions(img, width, height)
+	if dstW == 0 {
 		if is_opaque {
 			return &NRGB{}
 		}
 		return &image.NRGBA{}
 	}
-	srcW := img.Bounds().Dx()
-	srcH := img.Bounds().Dy()
-	if srcW <= 0 || srcH <= 0 {
-		if is_opaque {
-			return &NRGB{}
-		}
-		return &image.NRGBA{}
+	if srcW == dstW && srcH == dstH {
+		return ClonePreservingType(img)
 	}
 
-	// If new width or height is 0 then preserve aspect ratio, minimum 1px.
-	if dstW == 0 {
-		tmpW := float64(dstH) * float64(srcW) / float64(srcH)
-		dstW = int(math.Max(1.0, math.Floor(tmpW+0.5)))
+	if f, ok := img.(*RGBAF); ok {
+		return resizeFloat(f, srcW, srcH, dstW, dstH, filter)
 	}
-	if dstH == 0 {
-		tmpH := float64(dstW) * float64(srcH) / float64(srcW)
-		dstH = int(math.Max(1.0, math.Floor(tmpH+0.5)))
-	}
-
-	if srcW == dstW && srcH == dstH {
-		return ClonePreservingType(img)
+	if has_16bit_channels(img) {
+		return resizeImage16(img, srcW, srcH, dstW, dstH, filter, is_opaque)
 	}
 
 	if filter.Support <= 0 {
@@ -122,6 +115,78 @@ func Resize(img image.Image, width, height int, filter ResampleFilter) image.Ima
 	return ResizeWithOpacity(img, width, height, filter, false)
 }
 
+// The size of the image and the size it should be resized to, preserving
+// its aspect ratio if one of width or height is 0. The returned dstW is 0 if
+// the image cannot be resized to the specified size.
+func resize_dimensions(img image.Image, width, height int) (srcW, srcH, dstW, dstH int) {
+	dstW, dstH = width, height
+	if dstW < 0 || dstH < 0 || (dstW == 0 && dstH == 0) {
+		return 0, 0, 0, 0
+	}
+	srcW = img.Bounds().Dx()
+	srcH = img.Bounds().Dy()
+	if srcW <= 0 || srcH <= 0 {
+		return 0, 0, 0, 0
+	}
+
+	// If new width or height is 0 then preserve aspect ratio, minimum 1px.
+	if dstW == 0 {
+		tmpW := float64(dstH) * float64(srcW) / float64(srcH)
+		dstW = int(math.Max(1.0, math.Floor(tmpW+0.5)))
+	}
+	if dstH == 0 {
+		tmpH := float64(dstW) * float64(srcH) / float64(srcW)
+		dstH = int(math.Max(1.0, math.Floor(tmpH+0.5)))
+	}
+	return
+}
+
+// ResizeLinearLight is like ResizeWithOpacity() except that the pixels are
+// averaged in linear light rather than in gamma-encoded sRGB, which avoids
+// darkening fine detail and dark fringes around high contrast edges. The
+// image is converted to a floating point intermediate for resampling, with
+// each pixel weighted by its alpha so that the colors of transparent pixels
+// do not bleed into their neighbors. The image must be in the sRGB color
+// space.
+func ResizeLinearLight(img image.Image, width, height int, filter ResampleFilter, is_opaque bool) image.Image {
+	srcW, srcH, dstW, dstH := resize_dimensions(img, width, height)
+	if dstW == 0 {
+		if is_opaque {
+			return &NRGB{}
+		}
+		return &image.NRGBA{}
+	}
+	if srcW == dstW && srcH == dstH {
+		return ClonePreservingType(img)
+	}
+	ans := from_linear_light(resizeFloat(to_linear_light(img), srcW, srcH, dstW, dstH, filter))
+	if _, ok := img.(*RGBAF); ok {
+		return ans
+	}
+	if has_16bit_channels(img) {
+		return as_16bit(ans, is_opaque)
+	}
+	if is_opaque {
+		return AsNRGB(ans)
+	}
+	return AsNRGBA(ans)
+}
+
+// Convert the sRGB image to linear light in a new RGBAF image
+func to_linear_light(img image.Image) *RGBAF {
+	w := img.Bounds().Dx()
+	src := rgbaf.NewRGBAFScanner(img)
+	dst := rgbaf.NewRGBAF(img.Bounds())
+	convert_rows(dst, colorconv.SrgbToLinearSrgb, func(y int, row []float32) { src.ScanFloat(0, y, w, y+1, row) })
+	return dst
+}
+
+// Convert the linear light image back to sRGB in place
+func from_linear_light(img *RGBAF) *RGBAF {
+	convert_rows(img, colorconv.LinearSrgbToSrgb, func(int, []float32) {})
+	return img
+}
+
 func resizeHorizontal(img image.Image, width int, filter ResampleFilter) *nrgb.Image {
 	w, h := img.Bounds().Dx(), img.Bounds().Dy()
 	src := nrgb.NewNRGBScanner(img, nrgb.Color{})
@@ -427,13 +492,13 @@ func cropAndResize(img image.Image, width, height int, anchor Anchor, filter Res
 	srcAspectRatio := float64(srcW) / float64(srcH)
 	dstAspectRatio := float64(dstW) / float64(dstH)
 
-	var tmp *image.NRGBA
+	var tmp image.Image
 	if srcAspectRatio < dstAspectRatio {
 		cropH := float64(srcW) * float64(dstH) / float64(dstW)
-		tmp = CropAnchor(img, srcW, int(math.Max(1, cropH)+0.5), anchor)
+		tmp = crop_preserving_depth(img, anchor_rect(img, srcW, int(math.Max(1, cropH)+0.5), anchor))
 	} else {
 		cropW := float64(srcH) * float64(dstW) / float64(dstH)
-		tmp = CropAnchor(img, int(math.Max(1, cropW)+0.5), srcH, anchor)
+		tmp = crop_preserving_depth(img, anchor_rect(img, int(math.Max(1, cropW)+0.5), srcH, anchor))
 	}
 
 	return Resize(tmp, dstW, dstH, filter)
@@ -442,7 +507,7 @@ func cropAndResize(img image.Image, width, height int, anchor Anchor, filter Res
 // resizeAndCrop resizes the image to the smallest possible size that will cover the specified dimensions,
 // crops the resized image to the specified dimensions using the given anchor point and returns
 // the transformed image.
-func resizeAndCrop(img image.Image, width, height int, anchor Anchor, filter ResampleFilter) *image.NRGBA {
+func resizeAndCrop(img image.Image, width, height int, anchor Anchor, filter ResampleFilter) image.Image {
 	dstW, dstH := width, height
 
 	srcBounds := img.Bounds()
@@ -458,7 +523,7 @@ func resizeAndCrop(img image.Image, width, height int, anchor Anchor, filter Res
 		tmp = Resize(img, 0, dstH, filter)
 	}
 
-	return CropAnchor(tmp, dstW, dstH, anchor)
+	return crop_preserving_depth(tmp, anchor_rect(tmp, dstW, dstH, anchor))
 }
 
 // Thumbnail scales the image up or down using the specified resample filter, crops it
@@ -720,3 +785,93 @@ func init() {
 		},
 	}
 }
+
+func resizeFloat(img *RGBAF, srcW, srcH, dstW, dstH int, filter ResampleFilter) *RGBAF {
+	if filter.Support <= 0 {
+		return resizeNearestFloat(img, dstW, dstH)
+	}
+	if srcW != dstW {
+		img = resizeHorizontalFloat(img, dstW, filter)
+	}
+	if srcH != dstH {
+		img = resizeVerticalFloat(img, dstH, filter)
+	}
+	return img
+}
+
+// resample_float computes the alpha weighted sum of the pixels in src, which
+// are spaced stride apart, into dst
+func resample_float(dst, src []float32, stride int, weights []indexWeight) {
+	var r, g, b, a float64
+	for _, w := range weights {
+		i := w.index * stride
+		s := src[i : i+4 : i+4]
+		aw := float64(s[3]) * w.weight
+		r += float64(s[0]) * aw
+		g += float64(s[1]) * aw
+		b += float64(s[2]) * aw
+		a += aw
+	}
+	if a != 0 {
+		aInv := 1 / a
+		dst[0], dst[1], dst[2], dst[3] = float32(r*aInv), float32(g*aInv), float32(b*aInv), float32(max(0, min(a, 1)))
+	}
+}
+
+func resizeHorizontalFloat(img *RGBAF, width int, filter ResampleFilter) *RGBAF {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dst := rgbaf.NewRGBAF(image.Rect(0, 0, width, h).Add(img.Bounds().Min))
+	weights := precomputeWeights(width, w, filter)
+	if err := run_in_parallel_over_range(0, func(start, limit int) {
+		for y := start; y < limit; y++ {
+			src := img.Pix[y*img.Stride:]
+			d := dst.Pix[y*dst.Stride:]
+			for x := range weights {
+				resample_float(d[x*4:x*4+4:x*4+4], src, 4, weights[x])
+			}
+		}
+	}, 0, h); err != nil {
+		panic(err)
+	}
+	return dst
+}
+
+func resizeVerticalFloat(img *RGBAF, height int, filter ResampleFilter) *RGBAF {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dst := rgbaf.NewRGBAF(image.Rect(0, 0, w, height).Add(img.Bounds().Min))
+	weights := precomputeWeights(height, h, filter)
+	if err := run_in_parallel_over_range(0, func(start, limit int) {
+		for x := start; x < limit; x++ {
+			src := img.Pix[x*4:]
+			for y := range weights {
+				j := y*dst.Stride + x*4
+				resample_float(dst.Pix[j:j+4:j+4], src, img.Stride, weights[y])
+			}
+		}
+	}, 0, w); err != nil {
+		panic(err)
+	}
+	return dst
+}
+
+func resizeNearestFloat(img *RGBAF, width, height int) *RGBAF {
+	dst := rgbaf.NewRGBAF(image.Rect(0, 0, width, height).Add(img.Bounds().Min))
+	dx := float64(img.Bounds().Dx()) / float64(width)
+	dy := float64(img.Bounds().Dy()) / float64(height)
+	if err := run_in_parallel_over_range(0, func(start, limit int) {
+		for y := start; y < limit; y++ {
+			srcY := int((float64(y) + 0.5) * dy)
+			srcOff0 := srcY * img.Stride
+			dstOff := y * dst.Stride
+			for x := range width {
+				srcX := int((float64(x) + 0.5) * dx)
+				srcOff := srcOff0 + srcX*4
+				copy(dst.Pix[dstOff:dstOff+4], img.Pix[srcOff:srcOff+4])
+				dstOff += 4
+			}
+		}
+	}, 0, height); err != nil {
+		panic(err)
+	}
+	return dst
+}
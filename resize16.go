@@ -0,0 +1,195 @@
+package imaging
+
+import (
+	"image"
+
+	"github.com/kovidgoyal/imaging/nrgb"
+	"github.com/kovidgoyal/imaging/nrgba"
+)
+
+// clamp16 rounds and clamps float64 value to fit into uint16.
+func clamp16(x float64) uint16 {
+	v := int64(x + 0.5)
+	if v > 0xffff {
+		return 0xffff
+	}
+	if v > 0 {
+		return uint16(v)
+	}
+	return 0
+}
+
+func get16(s []uint8) float64 { return float64(uint16(s[0])<<8 | uint16(s[1])) }
+
+func put16(d []uint8, v float64) {
+	q := clamp16(v)
+	d[0], d[1] = uint8(q>>8), uint8(q)
+}
+
+// A 16 bit per channel scanner and destination image, either opaque NRGB48
+// or NRGBA64
+func new_16bit_image(img image.Image, r image.Rectangle, is_opaque bool) (sc Scanner, dst image.Image, pix []uint8, stride int) {
+	if is_opaque {
+		sc = nrgb.NewNRGB48Scanner(img, NRGB48Color{})
+		d := nrgb.NewNRGB48(r)
+		return sc, d, d.Pix, d.Stride
+	}
+	sc = nrgba.NewNRGBA64Scanner(img)
+	d := image.NewNRGBA64(r)
+	return sc, d, d.Pix, d.Stride
+}
+
+// Convert the image to NRGB48 if is_opaque is true, otherwise to NRGBA64
+func as_16bit(img image.Image, is_opaque bool) image.Image {
+	src, dst, pix, stride := new_16bit_image(img, img.Bounds(), is_opaque)
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	rowSize := w * 2 * src.Num_of_channels()
+	if err := run_in_parallel_over_range(0, func(start, limit int) {
+		for y := start; y < limit; y++ {
+			i := y * stride
+			src.Scan(0, y, w, y+1, pix[i:i+rowSize])
+		}
+	}, 0, h); err != nil {
+		panic(err)
+	}
+	return dst
+}
+
+// resample16 computes the weighted sum of the contiguous big-endian 16 bit
+// pixels in src, which are bpp bytes wide, into dst. Pixels with alpha are
+// weighted by their alpha.
+func resample16(dst, src []uint8, bpp int, weights []indexWeight) {
+	if bpp == 6 {
+		var r, g, b float64
+		for _, w := range weights {
+			i := w.index * bpp
+			s := src[i : i+6 : i+6]
+			r += get16(s[0:]) * w.weight
+			g += get16(s[2:]) * w.weight
+			b += get16(s[4:]) * w.weight
+		}
+		put16(dst[0:], r)
+		put16(dst[2:], g)
+		put16(dst[4:], b)
+		return
+	}
+	var r, g, b, a float64
+	for _, w := range weights {
+		i := w.index * bpp
+		s := src[i : i+8 : i+8]
+		aw := get16(s[6:]) * w.weight
+		r += get16(s[0:]) * aw
+		g += get16(s[2:]) * aw
+		b += get16(s[4:]) * aw
+		a += aw
+	}
+	if a != 0 {
+		aInv := 1 / a
+		put16(dst[0:], r*aInv)
+		put16(dst[2:], g*aInv)
+		put16(dst[4:], b*aInv)
+		put16(dst[6:], a)
+	}
+}
+
+// resize16 resizes the width of the image to size pixels if horizontal is
+// true, otherwise its height, preserving 16 bits per channel.
+func resize16(img image.Image, size int, filter ResampleFilter, is_opaque, horizontal bool) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	r := image.Rect(0, 0, w, size)
+	if horizontal {
+		r = image.Rect(0, 0, size, h)
+	}
+	src, dst, pix, stride := new_16bit_image(img, r.Add(img.Bounds().Min), is_opaque)
+	bpp := 2 * src.Num_of_channels()
+	if horizontal {
+		weights := precomputeWeights(size, w, filter)
+		if err := run_in_parallel_over_range(0, func(start, limit int) {
+			scanLine := make([]uint8, w*bpp)
+			for y := start; y < limit; y++ {
+				src.Scan(0, y, w, y+1, scanLine)
+				j0 := y * stride
+				for x := range weights {
+					j := j0 + x*bpp
+					resample16(pix[j:j+bpp:j+bpp], scanLine, bpp, weights[x])
+				}
+			}
+		}, 0, h); err != nil {
+			panic(err)
+		}
+	} else {
+		weights := precomputeWeights(size, h, filter)
+		if err := run_in_parallel_over_range(0, func(start, limit int) {
+			scanLine := make([]uint8, h*bpp)
+			for x := start; x < limit; x++ {
+				src.Scan(x, 0, x+1, h, scanLine)
+				for y := range weights {
+					j := y*stride + x*bpp
+					resample16(pix[j:j+bpp:j+bpp], scanLine, bpp, weights[y])
+				}
+			}
+		}, 0, w); err != nil {
+			panic(err)
+		}
+	}
+	return dst
+}
+
+// resizeNearest16 is a fast nearest-neighbor resize, no filtering,
+// preserving 16 bits per channel.
+func resizeNearest16(img image.Image, width, height int, is_opaque bool) image.Image {
+	src, dst, pix, stride := new_16bit_image(img, image.Rect(0, 0, width, height).Add(img.Bounds().Min), is_opaque)
+	bpp := 2 * src.Num_of_channels()
+	dx := float64(img.Bounds().Dx()) / float64(width)
+	dy := float64(img.Bounds().Dy()) / float64(height)
+	if err := run_in_parallel_over_range(0, func(start, limit int) {
+		for y := start; y < limit; y++ {
+			srcY := int((float64(y) + 0.5) * dy)
+			dstOff := y * stride
+			for x := range width {
+				srcX := int((float64(x) + 0.5) * dx)
+				src.Scan(srcX, srcY, srcX+1, srcY+1, pix[dstOff:dstOff+bpp])
+				dstOff += bpp
+			}
+		}
+	}, 0, height); err != nil {
+		panic(err)
+	}
+	return dst
+}
+
+func resizeImage16(img image.Image, srcW, srcH, dstW, dstH int, filter ResampleFilter, is_opaque bool) image.Image {
+	if filter.Support <= 0 {
+		return resizeNearest16(img, dstW, dstH, is_opaque)
+	}
+	if srcW != dstW {
+		img = resize16(img, dstW, filter, is_opaque, true)
+	}
+	if srcH != dstH {
+		img = resize16(img, dstH, filter, is_opaque, false)
+	}
+	return img
+}
+
+// Crop preserving 16 bits per channel, if present
+func crop_preserving_depth(img image.Image, rect image.Rectangle) image.Image {
+	if !has_16bit_channels(img) {
+		return Crop(img, rect)
+	}
+	r := rect.Intersect(img.Bounds()).Sub(img.Bounds().Min)
+	if r.Empty() {
+		return &image.NRGBA64{}
+	}
+	src := nrgba.NewNRGBA64Scanner(img)
+	dst := image.NewNRGBA64(image.Rect(0, 0, r.Dx(), r.Dy()))
+	rowSize := r.Dx() * 8
+	if err := run_in_parallel_over_range(0, func(start, limit int) {
+		for y := start; y < limit; y++ {
+			i := (y - r.Min.Y) * dst.Stride
+			src.Scan(r.Min.X, y, r.Max.X, y+1, dst.Pix[i:i+rowSize])
+		}
+	}, r.Min.Y, r.Max.Y); err != nil {
+		panic(err)
+	}
+	return dst
+}
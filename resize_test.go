@@ -3,10 +3,12 @@ package imaging
 import (
 	"fmt"
 	"image"
+	"image/color"
 	"path/filepath"
 	"testing"
 
 	"github.com/kovidgoyal/imaging/nrgb"
+	"github.com/kovidgoyal/imaging/rgbaf"
 	"github.com/stretchr/testify/require"
 )
 
@@ -981,3 +983,77 @@ func BenchmarkFill(b *testing.B) {
 		}
 	}
 }
+
+func TestResizeFloat(t *testing.T) {
+	src := rgbaf.NewRGBAF(image.Rect(-1, -1, 1, 1))
+	copy(src.Pix, []float32{
+		0, 0, 0, 0, 1, 0, 0, 1,
+		0, 1, 0, 1, 0, 0, 4, 1,
+	})
+	for _, f := range []ResampleFilter{Box, NearestNeighbor} {
+		got, ok := Resize(src, 1, 1, f).(*RGBAF)
+		require.True(t, ok)
+		require.Equal(t, image.Rect(-1, -1, 0, 0), got.Rect)
+		c := got.RGBAFAt(-1, -1)
+		if f.Support > 0 {
+			require.InDeltaSlice(t, []float32{1. / 3, 1. / 3, 4. / 3, 0.75}, []float32{c.R, c.G, c.B, c.A}, 1e-6)
+		} else {
+			require.Equal(t, RGBAFColor{A: 1, B: 4}, c)
+		}
+	}
+	got := Resize(src, 4, 4, Lanczos).(*RGBAF)
+	require.Greater(t, got.RGBAFAt(2, 2).B, float32(1))
+}
+
+func TestResizeLinearLight(t *testing.T) {
+	checkerboard := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := range 8 {
+		for x := range 8 {
+			v := uint8(255 * ((x + y) % 2))
+			checkerboard.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	// The average of black and white in linear light is 0.5, which is 188 in sRGB
+	got := ResizeLinearLight(checkerboard, 2, 2, Box, true)
+	require.IsType(t, &NRGB{}, got)
+	require.Equal(t, nrgb.Color{R: 188, G: 188, B: 188}, got.(*NRGB).NRGBAt(1, 1))
+	require.Equal(t, color.NRGBA{128, 128, 128, 255}, Resize(checkerboard, 2, 2, Box).(*image.NRGBA).NRGBAAt(1, 1))
+	blurred := BlurLinearLight(checkerboard, 3)
+	require.InDelta(t, 188, int(blurred.NRGBAAt(4, 4).R), 1)
+
+	// The colors of transparent pixels do not bleed
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+	src.SetNRGBA(1, 0, color.NRGBA{0, 255, 0, 0})
+	got = ResizeLinearLight(src, 1, 1, Box, false)
+	require.Equal(t, color.NRGBA{255, 0, 0, 128}, got.(*image.NRGBA).NRGBAAt(0, 0))
+
+	f := AsRGBAF(src)
+	gotf, ok := ResizeLinearLight(f, 1, 1, Box, false).(*RGBAF)
+	require.True(t, ok)
+	require.InDeltaSlice(t, []float32{1, 0, 0, 0.5}, gotf.Pix[:4], 1e-5)
+	require.Equal(t, &image.NRGBA{}, ResizeLinearLight(src, 0, 0, Box, false))
+}
+
+func TestResize16(t *testing.T) {
+	src := image.NewNRGBA64(image.Rect(0, 0, 4, 2))
+	for y := range 2 {
+		for x := range 4 {
+			src.SetNRGBA64(x, y, color.NRGBA64{0x1234 + uint16(2*x), 0x8001, 0xfffe, 0xffff})
+		}
+	}
+	got := ResizeWithOpacity(src, 2, 1, Box, true)
+	require.IsType(t, &NRGB48{}, got)
+	require.Equal(t, NRGB48Color{R: 0x1235, G: 0x8001, B: 0xfffe}, got.(*NRGB48).NRGB48At(0, 0))
+	src.SetNRGBA64(1, 0, color.NRGBA64{0xffff, 0, 0, 0})
+	got = Resize(src, 2, 1, Box)
+	require.IsType(t, &image.NRGBA64{}, got)
+	// Transparent pixels do not contribute to the color
+	require.Equal(t, color.NRGBA64{0x1235, 0x8001, 0xfffe, 0xc000}, got.(*image.NRGBA64).NRGBA64At(0, 0))
+	require.IsType(t, &image.NRGBA64{}, Resize(src, 3, 3, NearestNeighbor))
+	require.IsType(t, &image.NRGBA64{}, Fit(src, 2, 2, Lanczos))
+	require.IsType(t, &image.NRGBA64{}, Fill(src, 3, 1, Center, Lanczos))
+	require.IsType(t, &image.NRGBA64{}, Thumbnail(src, 1, 2, Lanczos))
+	require.IsType(t, &NRGB48{}, ResizeLinearLight(image.NewGray16(image.Rect(0, 0, 4, 4)), 2, 2, Lanczos, true))
+	require.IsType(t, &image.NRGBA{}, Resize(image.NewNRGBA(image.Rect(0, 0, 4, 4)), 2, 2, Lanczos))
+}
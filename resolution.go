@@ -0,0 +1,175 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/kovidgoyal/imaging/apng"
+	"github.com/kovidgoyal/imaging/prism/meta"
+)
+
+var _ = fmt.Print
+
+func round_to_uint32(x float64) uint32 {
+	return uint32(max(0, min(math.Round(x), math.MaxUint32)))
+}
+
+func png_physical_dimensions(r meta.Resolution) *apng.PhysicalDimensions {
+	if !r.IsSet() {
+		return nil
+	}
+	if r.Unit == meta.NoResolutionUnit {
+		return &apng.PhysicalDimensions{PixelsPerUnitX: round_to_uint32(r.X), PixelsPerUnitY: round_to_uint32(r.Y)}
+	}
+	r = r.In(meta.PixelsPerCentimeter)
+	return &apng.PhysicalDimensions{PixelsPerUnitX: round_to_uint32(r.X * 100), PixelsPerUnitY: round_to_uint32(r.Y * 100), UnitIsMeter: true}
+}
+
+// Write the JPEG data with the specified segment inserted after the start of
+// image marker.
+func write_jpeg_with_segment(w io.Writer, data, segment []byte) error {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return fmt.Errorf("invalid JPEG data, does not start with SOI marker")
+	}
+	for _, chunk := range [][]byte{data[:2], segment, data[2:]} {
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the JPEG data with a JFIF APP0 segment specifying the resolution
+// inserted after the start of image marker.
+func write_jpeg_with_resolution(w io.Writer, data []byte, r meta.Resolution) error {
+	var unit byte
+	switch r.Unit {
+	case meta.PixelsPerInch:
+		unit = 1
+	case meta.PixelsPerCentimeter:
+		unit = 2
+	}
+	density := func(x float64) uint16 { return uint16(max(1, min(math.Round(x), math.MaxUint16))) }
+	app0 := []byte{0xff, 0xe0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 2, unit}
+	app0 = binary.BigEndian.AppendUint16(app0, density(r.X))
+	app0 = binary.BigEndian.AppendUint16(app0, density(r.Y))
+	app0 = append(app0, 0, 0) // no thumbnail
+	return write_jpeg_with_segment(w, data, app0)
+}
+
+// Write the JPEG data with an EXIF APP1 segment specifying the resolution
+// inserted after the start of image marker. CMYK JPEG files are identified by
+// their Adobe APP14 segment and must not have a JFIF APP0 segment, as JFIF
+// implies YCbCr or grayscale data.
+func write_jpeg_with_exif_resolution(w io.Writer, data []byte, r meta.Resolution) error {
+	const num_entries, denominator = 3, 1000
+	const values_offset = 8 + 2 + num_entries*12 + 4
+	t := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, num_entries}
+	entry := func(tag, typ uint16, value uint32) {
+		t = binary.BigEndian.AppendUint16(t, tag)
+		t = binary.BigEndian.AppendUint16(t, typ)
+		t = binary.BigEndian.AppendUint32(t, 1)
+		t = binary.BigEndian.AppendUint32(t, value)
+	}
+	entry(282, 5, values_offset)
+	entry(283, 5, values_offset+8)
+	entry(296, 3, uint32(tiff_resolution_unit(r))<<16)
+	t = binary.BigEndian.AppendUint32(t, 0) // no next IFD
+	for _, val := range []float64{r.X, r.Y} {
+		t = binary.BigEndian.AppendUint32(t, round_to_uint32(val*denominator))
+		t = binary.BigEndian.AppendUint32(t, denominator)
+	}
+	app1 := []byte{0xff, 0xe1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(2+6+len(t)))
+	app1 = append(app1, 'E', 'x', 'i', 'f', 0, 0)
+	app1 = append(app1, t...)
+	return write_jpeg_with_segment(w, data, app1)
+}
+
+// The value of the TIFF ResolutionUnit tag for the specified resolution
+func tiff_resolution_unit(r meta.Resolution) uint16 {
+	switch r.Unit {
+	case meta.PixelsPerInch:
+		return 2
+	case meta.PixelsPerCentimeter:
+		return 3
+	}
+	return 1
+}
+
+// Replace the resolution tags in the first IFD of the specified TIFF data
+func set_tiff_resolution(data []byte, r meta.Resolution) error {
+	if len(data) < 8 {
+		return fmt.Errorf("invalid TIFF data, too short")
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return fmt.Errorf("invalid TIFF data, unknown byte order")
+	}
+	unit := tiff_resolution_unit(r)
+	// Store the resolution as a rational with a fixed denominator
+	const denominator = 1000
+	offset := int(order.Uint32(data[4:]))
+	if offset+2 > len(data) {
+		return fmt.Errorf("invalid TIFF data, IFD offset out of bounds")
+	}
+	num_entries := int(order.Uint16(data[offset:]))
+	for i := range num_entries {
+		entry := data[offset+2+i*12:]
+		if len(entry) < 12 {
+			return fmt.Errorf("invalid TIFF data, truncated IFD")
+		}
+		switch tag := order.Uint16(entry); tag {
+		case 282, 283:
+			val := r.X
+			if tag == 283 {
+				val = r.Y
+			}
+			pos := int(order.Uint32(entry[8:]))
+			if pos+8 > len(data) {
+				return fmt.Errorf("invalid TIFF data, resolution value offset out of bounds")
+			}
+			order.PutUint32(data[pos:], round_to_uint32(val*denominator))
+			order.PutUint32(data[pos+4:], denominator)
+		case 296:
+			order.PutUint16(entry[8:], unit)
+		}
+	}
+	return nil
+}
+
+// Set the pixels per meter fields of the specified BMP data
+func set_bmp_resolution(data []byte, r meta.Resolution) error {
+	if len(data) < 46 || data[0] != 'B' || data[1] != 'M' || binary.LittleEndian.Uint32(data[14:]) < 40 {
+		return fmt.Errorf("invalid BMP data")
+	}
+	if !r.HasPhysicalUnit() {
+		return nil
+	}
+	r = r.In(meta.PixelsPerCentimeter)
+	binary.LittleEndian.PutUint32(data[38:], round_to_uint32(r.X*100))
+	binary.LittleEndian.PutUint32(data[42:], round_to_uint32(r.Y*100))
+	return nil
+}
+
+// Encode with the specified encoder into a buffer, so the encoded data can be
+// modified before being written to w.
+func encode_and_modify(w io.Writer, encode func(io.Writer) error, modify func([]byte) error) error {
+	buf := bytes.Buffer{}
+	if err := encode(&buf); err != nil {
+		return err
+	}
+	if err := modify(buf.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
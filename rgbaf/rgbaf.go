@@ -0,0 +1,199 @@
+package rgbaf
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/kovidgoyal/imaging/nrgb"
+)
+
+var _ = fmt.Print
+
+// Color is a non-alpha-premultiplied color with float32 components. Values
+// are nominally in [0, 1] but may lie outside that range, for example, for
+// HDR content.
+type Color struct {
+	R, G, B, A float32
+}
+
+func clamp16(x float32) uint32 {
+	return uint32(max(0, min(x, 1))*math.MaxUint16 + 0.5)
+}
+
+func (c Color) RGBA() (r, g, b, a uint32) {
+	a = clamp16(c.A)
+	r, g, b = clamp16(c.R), clamp16(c.G), clamp16(c.B)
+	if a != 0xffff {
+		r = r * a / 0xffff
+		g = g * a / 0xffff
+		b = b * a / 0xffff
+	}
+	return
+}
+
+func f16(x uint32) float32 { return float32(x) / math.MaxUint16 }
+
+// ColorFrom converts any color to Color at 16 bit precision
+func ColorFrom(c color.Color) Color {
+	switch q := c.(type) {
+	case Color:
+		return q
+	case color.NRGBA:
+		return Color{float32(q.R) / math.MaxUint8, float32(q.G) / math.MaxUint8, float32(q.B) / math.MaxUint8, float32(q.A) / math.MaxUint8}
+	case color.NRGBA64:
+		return Color{f16(uint32(q.R)), f16(uint32(q.G)), f16(uint32(q.B)), f16(uint32(q.A))}
+	case nrgb.Color:
+		return Color{float32(q.R) / math.MaxUint8, float32(q.G) / math.MaxUint8, float32(q.B) / math.MaxUint8, 1}
+	}
+	r, g, b, a := c.RGBA()
+	switch a {
+	case 0xffff:
+		return Color{f16(r), f16(g), f16(b), 1}
+	case 0:
+		return Color{}
+	default:
+		fa := float32(a)
+		return Color{float32(r) / fa, float32(g) / fa, float32(b) / fa, f16(a)}
+	}
+}
+
+var Model color.Model = color.ModelFunc(func(c color.Color) color.Color { return ColorFrom(c) })
+
+// Image is an in-memory image whose At method returns Color values.
+type Image struct {
+	// Pix holds the image's pixels, in R, G, B, A order. The pixel at
+	// (x, y) starts at Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*4].
+	Pix []float32
+	// Stride is the Pix stride (in float32 units) between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+}
+
+func (p *Image) ColorModel() color.Model { return Model }
+
+func (p *Image) Bounds() image.Rectangle { return p.Rect }
+
+func (p *Image) At(x, y int) color.Color {
+	return p.RGBAFAt(x, y)
+}
+
+func (p *Image) RGBAFAt(x, y int) Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return Color{}
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4] // Small cap improves performance, see https://golang.org/issue/27857
+	return Color{s[0], s[1], s[2], s[3]}
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *Image) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+func (p *Image) Set(x, y int, c color.Color) {
+	p.SetRGBAF(x, y, ColorFrom(c))
+}
+
+func (p *Image) SetRGBAF(x, y int, c Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4] // Small cap improves performance, see https://golang.org/issue/27857
+	s[0], s[1], s[2], s[3] = c.R, c.G, c.B, c.A
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *Image) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	// If r1 and r2 are Rectangles, r1.Intersect(r2) is not guaranteed to be inside
+	// either r1 or r2 if the intersection is empty. Without explicitly checking for
+	// this, the Pix[i:] expression below can panic.
+	if r.Empty() {
+		return &Image{}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &Image{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+// Opaque scans the entire image and reports whether it is fully opaque.
+func (p *Image) Opaque() bool {
+	if p.Rect.Empty() {
+		return true
+	}
+	i0, i1 := 3, p.Rect.Dx()*4
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		for i := i0; i < i1; i += 4 {
+			if p.Pix[i] < 1 {
+				return false
+			}
+		}
+		i0 += p.Stride
+		i1 += p.Stride
+	}
+	return true
+}
+
+// NewRGBAF returns a new Image with the given bounds.
+func NewRGBAF(r image.Rectangle) *Image {
+	return &Image{
+		Pix:    make([]float32, 4*r.Dx()*r.Dy()),
+		Stride: 4 * r.Dx(),
+		Rect:   r,
+	}
+}
+
+// FromImage converts any image to an Image preserving its bounds. The
+// conversion has the full precision of the source for the standard image
+// types and 16 bit precision otherwise.
+func FromImage(src image.Image) *Image {
+	b := src.Bounds()
+	dst := NewRGBAF(b)
+	s := newScanner(src)
+	w := b.Dx()
+	for y := range b.Dy() {
+		i := y * dst.Stride
+		s.ScanFloat(0, y, w, y+1, dst.Pix[i:i+4*w])
+	}
+	return dst
+}
+
+// ToNRGBA64 converts the image to an image.NRGBA64 clamping values to [0, 1]
+func (p *Image) ToNRGBA64() *image.NRGBA64 {
+	dst := image.NewNRGBA64(p.Rect)
+	w := p.Rect.Dx()
+	for y := range p.Rect.Dy() {
+		s, d := p.Pix[y*p.Stride:], dst.Pix[y*dst.Stride:]
+		for range w {
+			for c := range 4 {
+				v := clamp16(s[c])
+				d[2*c], d[2*c+1] = uint8(v>>8), uint8(v)
+			}
+			s, d = s[4:], d[8:]
+		}
+	}
+	return dst
+}
+
+// ToNRGBA converts the image to an image.NRGBA clamping values to [0, 1]
+func (p *Image) ToNRGBA() *image.NRGBA {
+	dst := image.NewNRGBA(p.Rect)
+	w := p.Rect.Dx()
+	for y := range p.Rect.Dy() {
+		s, d := p.Pix[y*p.Stride:], dst.Pix[y*dst.Stride:]
+		for i := range 4 * w {
+			d[i] = uint8(max(0, min(s[i], 1))*math.MaxUint8 + 0.5)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,56 @@
+package rgbaf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ = fmt.Print
+
+func TestRGBAF(t *testing.T) {
+	pix := []float32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	reverse4(pix)
+	require.Equal(t, []float32{9, 10, 11, 12, 5, 6, 7, 8, 1, 2, 3, 4}, pix)
+
+	src := image.NewNRGBA64(image.Rect(3, 4, 6, 6))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 37)
+	}
+	img := FromImage(src)
+	require.Equal(t, src.Rect, img.Rect)
+	require.Equal(t, src, img.ToNRGBA64())
+	for y := src.Rect.Min.Y; y < src.Rect.Max.Y; y++ {
+		for x := src.Rect.Min.X; x < src.Rect.Max.X; x++ {
+			require.Equal(t, color.RGBA64Model.Convert(src.At(x, y)), color.RGBA64Model.Convert(img.At(x, y)))
+		}
+	}
+
+	// Scanning into bytes gives float32 values in native byte order
+	s := NewRGBAFScanner(src)
+	b := make([]uint8, 4*4*2)
+	s.Scan(1, 0, 3, 1, b)
+	f := make([]float32, 4*2)
+	s.ScanFloat(1, 0, 3, 1, f)
+	for i, v := range f {
+		require.Equal(t, v, math.Float32frombits(binary.NativeEndian.Uint32(b[4*i:])))
+	}
+
+	// Out of range values are clamped when converting to other color types
+	c := Color{R: 2, G: -1, B: 1, A: 0.5}
+	require.Equal(t, color.NRGBA{R: 255, G: 0, B: 255, A: 128}, color.NRGBAModel.Convert(c))
+
+	o := NewRGBAF(image.Rect(0, 0, 2, 2))
+	for i := range o.Pix {
+		o.Pix[i] = 1
+	}
+	require.True(t, o.Opaque())
+	o.SetRGBAF(1, 1, c)
+	require.False(t, o.Opaque())
+	require.True(t, o.SubImage(image.Rect(0, 0, 1, 2)).(*Image).Opaque())
+}
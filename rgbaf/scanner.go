@@ -0,0 +1,141 @@
+package rgbaf
+
+import (
+	"encoding/binary"
+	"image"
+	"math"
+
+	"github.com/kovidgoyal/imaging/nrgb"
+	"github.com/kovidgoyal/imaging/types"
+)
+
+type scanner struct {
+	image image.Image
+}
+
+func (s scanner) Bytes_per_channel() int                 { return 4 }
+func (s scanner) Num_of_channels() int                   { return 4 }
+func (s scanner) Bounds() image.Rectangle                { return s.image.Bounds() }
+func (s scanner) NewImage(r image.Rectangle) image.Image { return NewRGBAF(r) }
+
+func newScanner(img image.Image) *scanner {
+	return &scanner{image: img}
+}
+
+func reverse4(pix []float32) {
+	if len(pix) <= 4 {
+		return
+	}
+	i := 0
+	j := len(pix) - 4
+	for i < j {
+		pi := pix[i : i+4 : i+4]
+		pj := pix[j : j+4 : j+4]
+		pi[0], pj[0] = pj[0], pi[0]
+		pi[1], pj[1] = pj[1], pi[1]
+		pi[2], pj[2] = pj[2], pi[2]
+		pi[3], pj[3] = pj[3], pi[3]
+		i += 4
+		j -= 4
+	}
+}
+
+func (s *scanner) ReverseRow(img image.Image, row int) {
+	d := img.(*Image)
+	pos := row * d.Stride
+	reverse4(d.Pix[pos : pos+4*d.Rect.Dx()])
+}
+
+func (s *scanner) ScanRow(x1, y1, x2, y2 int, img image.Image, row int) {
+	d := img.(*Image)
+	pos := row * d.Stride
+	s.ScanFloat(x1, y1, x2, y2, d.Pix[pos:pos+4*(x2-x1)*(y2-y1)])
+}
+
+// Scan scans the given rectangular region of the image into dst as float32
+// values in native byte order
+func (s *scanner) Scan(x1, y1, x2, y2 int, dst []uint8) {
+	f := make([]float32, 4*(x2-x1)*(y2-y1))
+	s.ScanFloat(x1, y1, x2, y2, f)
+	_ = dst[4*len(f)-1]
+	for i, v := range f {
+		binary.NativeEndian.PutUint32(dst[4*i:], math.Float32bits(v))
+	}
+}
+
+func u16(s []uint8) float32 { return float32(uint32(s[0])<<8|uint32(s[1])) / math.MaxUint16 }
+
+// ScanFloat scans the given rectangular region of the image into dst.
+func (s *scanner) ScanFloat(x1, y1, x2, y2 int, dst []float32) {
+	_ = dst[4*(x2-x1)*(y2-y1)-1]
+	d := dst
+	switch img := s.image.(type) {
+	case *Image:
+		for y := y1; y < y2; y++ {
+			i := y*img.Stride + x1*4
+			n := copy(d, img.Pix[i:i+4*(x2-x1)])
+			d = d[n:]
+		}
+	case *nrgb.Image:
+		for y := y1; y < y2; y++ {
+			src := img.Pix[y*img.Stride+x1*3:]
+			for range x2 - x1 {
+				d[0], d[1], d[2], d[3] = float32(src[0])/math.MaxUint8, float32(src[1])/math.MaxUint8, float32(src[2])/math.MaxUint8, 1
+				d, src = d[4:], src[3:]
+			}
+		}
+	case *image.NRGBA:
+		for y := y1; y < y2; y++ {
+			src := img.Pix[y*img.Stride+x1*4:]
+			for range x2 - x1 {
+				d[0], d[1], d[2], d[3] = float32(src[0])/math.MaxUint8, float32(src[1])/math.MaxUint8, float32(src[2])/math.MaxUint8, float32(src[3])/math.MaxUint8
+				d, src = d[4:], src[4:]
+			}
+		}
+	case *image.NRGBA64:
+		for y := y1; y < y2; y++ {
+			src := img.Pix[y*img.Stride+x1*8:]
+			for range x2 - x1 {
+				d[0], d[1], d[2], d[3] = u16(src[0:]), u16(src[2:]), u16(src[4:]), u16(src[6:])
+				d, src = d[4:], src[8:]
+			}
+		}
+	case *image.RGBA64:
+		for y := y1; y < y2; y++ {
+			src := img.Pix[y*img.Stride+x1*8:]
+			for range x2 - x1 {
+				if a := u16(src[6:]); a > 0 {
+					d[0], d[1], d[2], d[3] = u16(src[0:])/a, u16(src[2:])/a, u16(src[4:])/a, a
+				} else {
+					d[0], d[1], d[2], d[3] = 0, 0, 0, 0
+				}
+				d, src = d[4:], src[8:]
+			}
+		}
+	case *image.Gray16:
+		for y := y1; y < y2; y++ {
+			src := img.Pix[y*img.Stride+x1*2:]
+			for range x2 - x1 {
+				v := u16(src)
+				d[0], d[1], d[2], d[3] = v, v, v, 1
+				d, src = d[4:], src[2:]
+			}
+		}
+	default:
+		b := s.image.Bounds()
+		for y := y1 + b.Min.Y; y < y2+b.Min.Y; y++ {
+			for x := x1 + b.Min.X; x < x2+b.Min.X; x++ {
+				c := ColorFrom(s.image.At(x, y))
+				d[0], d[1], d[2], d[3] = c.R, c.G, c.B, c.A
+				d = d[4:]
+			}
+		}
+	}
+}
+
+// NewRGBAFScanner returns a scanner that converts pixels of any image to non
+// premultiplied RGBA float32 values. Scanning into bytes yields float32
+// values in native byte order.
+func NewRGBAFScanner(source_image image.Image) types.FloatScanner {
+	return newScanner(source_image)
+}
@@ -0,0 +1,185 @@
+package imaging
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"slices"
+
+	"github.com/kovidgoyal/imaging/prism/meta"
+)
+
+var _ = fmt.Print
+
+type tiff_ifd_entry struct {
+	tag, datatype uint16
+	count         uint32
+	data          []byte
+}
+
+// Encode a CMYK image as a deflate compressed, little endian TIFF with an
+// optional embedded ICC profile. The x/image/tiff encoder does not support
+// CMYK.
+func encode_cmyk_tiff(w io.Writer, img *image.CMYK, icc_profile []byte, r meta.Resolution) error {
+	const (
+		dt_short     = 3
+		dt_long      = 4
+		dt_rational  = 5
+		dt_undefined = 7
+	)
+	order := binary.LittleEndian
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	buf := bytes.Buffer{}
+	zw := zlib.NewWriter(&buf)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := img.PixOffset(b.Min.X, y)
+		if _, err := zw.Write(img.Pix[i : i+4*width]); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	pixels := buf.Bytes()
+
+	short := func(tag uint16, vals ...uint16) tiff_ifd_entry {
+		e := tiff_ifd_entry{tag: tag, datatype: dt_short, count: uint32(len(vals))}
+		for _, v := range vals {
+			e.data = order.AppendUint16(e.data, v)
+		}
+		return e
+	}
+	long := func(tag uint16, v uint32) tiff_ifd_entry {
+		return tiff_ifd_entry{tag: tag, datatype: dt_long, count: 1, data: order.AppendUint32(nil, v)}
+	}
+	rational := func(tag uint16, v float64) tiff_ifd_entry {
+		const denominator = 1000
+		data := order.AppendUint32(nil, round_to_uint32(v*denominator))
+		return tiff_ifd_entry{tag: tag, datatype: dt_rational, count: 1, data: order.AppendUint32(data, denominator)}
+	}
+	unit := uint16(2)
+	if !r.IsSet() {
+		r = meta.Resolution{X: 72, Y: 72, Unit: meta.PixelsPerInch}
+	}
+	switch r.Unit {
+	case meta.NoResolutionUnit:
+		unit = 1
+	case meta.PixelsPerCentimeter:
+		unit = 3
+	}
+	const header_size = 8
+	entries := []tiff_ifd_entry{
+		long(256, uint32(width)),
+		long(257, uint32(height)),
+		short(258, 8, 8, 8, 8),
+		short(259, 8),          // Adobe deflate compression
+		short(262, 5),          // Separated photometric interpretation
+		long(273, header_size), // strip offset
+		short(277, 4),
+		long(278, uint32(height)),
+		long(279, uint32(len(pixels))),
+		rational(282, r.X),
+		rational(283, r.Y),
+		short(284, 1), // chunky planar configuration
+		short(296, unit),
+		short(332, 1), // CMYK ink set
+	}
+	if len(icc_profile) > 0 {
+		entries = append(entries, tiff_ifd_entry{tag: 34675, datatype: dt_undefined, count: uint32(len(icc_profile)), data: icc_profile})
+	}
+	slices.SortFunc(entries, func(a, b tiff_ifd_entry) int { return int(a.tag) - int(b.tag) })
+
+	// Layout: header, pixel data, IFD, values that do not fit in the IFD entries
+	pad := func(x []byte) []byte {
+		if len(x)&1 != 0 {
+			x = append(x, 0)
+		}
+		return x
+	}
+	ifd_offset := header_size + len(pixels) + len(pixels)&1
+	ifd_size := 2 + 12*len(entries) + 4
+	out := append([]byte("II"), 0, 0)
+	order.PutUint16(out[2:], 42)
+	out = order.AppendUint32(out, uint32(ifd_offset))
+	out = pad(append(out, pixels...))
+	var extra []byte
+	out = order.AppendUint16(out, uint16(len(entries)))
+	for _, e := range entries {
+		out = order.AppendUint16(out, e.tag)
+		out = order.AppendUint16(out, e.datatype)
+		out = order.AppendUint32(out, e.count)
+		if len(e.data) <= 4 {
+			var val [4]byte
+			copy(val[:], e.data)
+			out = append(out, val[:]...)
+		} else {
+			out = order.AppendUint32(out, uint32(ifd_offset+ifd_size+len(extra)))
+			extra = pad(append(extra, e.data...))
+		}
+	}
+	out = order.AppendUint32(out, 0) // no more IFDs
+	out = append(out, extra...)
+	_, err := w.Write(out)
+	return err
+}
+
+// Add an ICC profile to the first IFD of the TIFF data. The IFD is rewritten
+// at the end of the data, with the profile after it, so that the offsets of
+// all existing values remain valid.
+func add_tiff_icc_profile(data, icc_profile []byte) ([]byte, error) {
+	const icc_tag, dt_undefined = 34675, 7
+	if len(data) < 8 {
+		return nil, fmt.Errorf("invalid TIFF data, too short")
+	}
+	var order interface {
+		binary.ByteOrder
+		binary.AppendByteOrder
+	}
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid TIFF data, unknown byte order")
+	}
+	offset := int(order.Uint32(data[4:]))
+	if offset+2 > len(data) {
+		return nil, fmt.Errorf("invalid TIFF data, IFD offset out of bounds")
+	}
+	num_entries := int(order.Uint16(data[offset:]))
+	if offset+2+num_entries*12+4 > len(data) {
+		return nil, fmt.Errorf("invalid TIFF data, truncated IFD")
+	}
+	entries := make([][]byte, 0, num_entries+1)
+	for i := range num_entries {
+		e := data[offset+2+i*12 : offset+2+(i+1)*12]
+		if order.Uint16(e) != icc_tag {
+			entries = append(entries, e)
+		}
+	}
+	next_ifd := data[offset+2+num_entries*12 : offset+2+num_entries*12+4]
+	ans := slices.Clone(data)
+	if len(ans)&1 != 0 {
+		ans = append(ans, 0)
+	}
+	ifd_offset := len(ans)
+	icc_entry := order.AppendUint16(nil, icc_tag)
+	icc_entry = order.AppendUint16(icc_entry, dt_undefined)
+	icc_entry = order.AppendUint32(icc_entry, uint32(len(icc_profile)))
+	icc_entry = order.AppendUint32(icc_entry, uint32(ifd_offset+2+12*(len(entries)+1)+4))
+	entries = append(entries, icc_entry)
+	slices.SortStableFunc(entries, func(a, b []byte) int { return int(order.Uint16(a)) - int(order.Uint16(b)) })
+	ans = order.AppendUint16(ans, uint16(len(entries)))
+	for _, e := range entries {
+		ans = append(ans, e...)
+	}
+	ans = append(ans, next_ifd...)
+	ans = append(ans, icc_profile...)
+	order.PutUint32(ans[4:], uint32(ifd_offset))
+	return ans, nil
+}
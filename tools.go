@@ -11,6 +11,7 @@ import (
 
 	"github.com/kovidgoyal/imaging/nrgb"
 	"github.com/kovidgoyal/imaging/nrgba"
+	"github.com/kovidgoyal/imaging/rgbaf"
 )
 
 var _ = fmt.Println
@@ -90,6 +91,25 @@ func AsNRGB(src image.Image) *NRGB {
 	return dst
 }
 
+// AsRGBAF returns the image as an RGBAF image, converting it without loss of
+// precision if needed
+func AsRGBAF(src image.Image) *RGBAF {
+	if img, ok := src.(*RGBAF); ok {
+		return img
+	}
+	sc := rgbaf.NewRGBAFScanner(src)
+	dst := sc.NewImage(src.Bounds()).(*RGBAF)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if err := run_in_parallel_over_range(0, func(start, limit int) {
+		for y := start; y < limit; y++ {
+			sc.ScanRow(0, y, w, y+1, dst, y)
+		}
+	}, 0, h); err != nil {
+		panic(err)
+	}
+	return dst
+}
+
 // Clone an image preserving it's type for all known image types or returning an NRGBA64 image otherwise
 func ClonePreservingType(src image.Image) image.Image {
 	switch src := src.(type) {
@@ -109,6 +129,14 @@ func ClonePreservingType(src image.Image) image.Image {
 		dst := *src
 		dst.Pix = slices.Clone(src.Pix)
 		return &dst
+	case *NRGB48:
+		dst := *src
+		dst.Pix = slices.Clone(src.Pix)
+		return &dst
+	case *RGBAF:
+		dst := *src
+		dst.Pix = slices.Clone(src.Pix)
+		return &dst
 	case *image.NRGBA64:
 		dst := *src
 		dst.Pix = slices.Clone(src.Pix)
@@ -191,6 +219,11 @@ func NormalizeOrigin(src image.Image) image.Image {
 		*src = NRGB{}
 		dst.Rect = r
 		return &dst
+	case *NRGB48:
+		dst := *src
+		*src = NRGB48{}
+		dst.Rect = r
+		return &dst
 	case *image.NRGBA64:
 		dst := *src
 		*src = image.NRGBA64{}
@@ -326,11 +359,15 @@ func Crop(img image.Image, rect image.Rectangle) *image.NRGBA {
 // CropAnchor cuts out a rectangular region with the specified size
 // from the image using the specified anchor point and returns the cropped image.
 func CropAnchor(img image.Image, width, height int, anchor Anchor) *image.NRGBA {
+	return Crop(img, anchor_rect(img, width, height, anchor))
+}
+
+// The region of the image with the specified size at the anchor point
+func anchor_rect(img image.Image, width, height int, anchor Anchor) image.Rectangle {
 	srcBounds := img.Bounds()
 	pt := anchorPt(srcBounds, width, height, anchor)
 	r := image.Rect(0, 0, width, height).Add(pt)
-	b := srcBounds.Intersect(r)
-	return Crop(img, b)
+	return srcBounds.Intersect(r)
 }
 
 // CropCenter cuts out a rectangular region with the specified size
@@ -8,6 +8,7 @@ import (
 
 	"github.com/kovidgoyal/imaging/nrgb"
 	"github.com/kovidgoyal/imaging/nrgba"
+	"github.com/kovidgoyal/imaging/rgbaf"
 	"github.com/kovidgoyal/imaging/types"
 )
 
@@ -16,11 +17,21 @@ var _ = fmt.Println
 type Scanner = types.Scanner
 type NRGB = nrgb.Image
 type NRGBColor = nrgb.Color
+type NRGB48 = nrgb.Image48
+type NRGB48Color = nrgb.Color48
+type RGBAF = rgbaf.Image
+type RGBAFColor = rgbaf.Color
 
 func ScannerForImage(img image.Image) Scanner {
 	switch img := img.(type) {
+	case *RGBAF:
+		return rgbaf.NewRGBAFScanner(img)
 	case *NRGB, *image.CMYK, *image.YCbCr, *image.Gray:
 		return nrgb.NewNRGBScanner(img, NRGBColor{})
+	case *NRGB48, *image.Gray16:
+		return nrgb.NewNRGB48Scanner(img, NRGB48Color{})
+	case *image.NRGBA64, *image.RGBA64:
+		return nrgba.NewNRGBA64Scanner(img)
 	case *image.Paletted:
 		for _, x := range img.Palette {
 			_, _, _, a := x.RGBA()
@@ -100,6 +100,13 @@ type Scanner interface {
 	NewImage(r image.Rectangle) image.Image
 }
 
+// A Scanner that can also scan into non-premultiplied RGBA float32 pixels
+// without loss of precision
+type FloatScanner interface {
+	Scanner
+	ScanFloat(x1, y1, x2, y2 int, dst []float32)
+}
+
 type Input struct {
 	Reader io.Reader
 	Path   string
@@ -62,10 +62,11 @@ func toNRGBA(img image.Image) *image.NRGBA {
 
 // rgbToHSL converts a color from RGB to HSL.
 func rgbToHSL(r, g, b uint8) (float64, float64, float64) {
-	rr := float64(r) / 255
-	gg := float64(g) / 255
-	bb := float64(b) / 255
+	return rgbToHSLf(float64(r)/255, float64(g)/255, float64(b)/255)
+}
 
+// rgbToHSLf converts a color from RGB with components in [0, 1] to HSL.
+func rgbToHSLf(rr, gg, bb float64) (float64, float64, float64) {
 	max := math.Max(rr, math.Max(gg, bb))
 	min := math.Min(rr, math.Min(gg, bb))
 
@@ -86,7 +87,7 @@ func rgbToHSL(r, g, b uint8) (float64, float64, float64) {
 	switch max {
 	case rr:
 		h = (gg - bb) / d
-		if g < b {
+		if gg < bb {
 			h += 6
 		}
 	case gg:
@@ -101,10 +102,14 @@ func rgbToHSL(r, g, b uint8) (float64, float64, float64) {
 
 // hslToRGB converts a color from HSL to RGB.
 func hslToRGB(h, s, l float64) (uint8, uint8, uint8) {
-	var r, g, b float64
+	r, g, b := hslToRGBf(h, s, l)
+	return clamp(r * 255), clamp(g * 255), clamp(b * 255)
+}
+
+// hslToRGBf converts a color from HSL to RGB with components in [0, 1].
+func hslToRGBf(h, s, l float64) (float64, float64, float64) {
 	if s == 0 {
-		v := clamp(l * 255)
-		return v, v, v
+		return l, l, l
 	}
 
 	var q float64
@@ -115,11 +120,7 @@ func hslToRGB(h, s, l float64) (uint8, uint8, uint8) {
 	}
 	p := 2*l - q
 
-	r = hueToRGB(p, q, h+1/3.0)
-	g = hueToRGB(p, q, h)
-	b = hueToRGB(p, q, h-1/3.0)
-
-	return clamp(r * 255), clamp(g * 255), clamp(b * 255)
+	return hueToRGB(p, q, h+1/3.0), hueToRGB(p, q, h), hueToRGB(p, q, h-1/3.0)
 }
 
 func hueToRGB(p, q, t float64) float64 {